@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 	"visor-datos-abiertos-go/internal/cache"
@@ -27,9 +29,45 @@ func main() {
 		Port:          getEnv("PORT", "8080"),
 		CKANBaseURL:   getEnv("CKAN_URL", "https://datos.gob.mx/api/3/action"),
 		RedisURL:      getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		AdminAPIKey:   os.Getenv("ADMIN_API_KEY"),
 		CacheDir:      getEnv("CACHE_DIR", "/tmp/datasets"),
 		MemoryCacheGB: 4,
 		DiskCacheGB:   50,
+
+		MemoryCacheDatasets: getEnvInt("MEMORY_CACHE_DATASETS", 10),
+		PinnedDatasets:      getEnvList("PINNED_DATASETS"),
+
+		MaxConcurrentDownloads: getEnvInt("MAX_CONCURRENT_DOWNLOADS", 3),
+		CKANMaxAttempts:        getEnvInt("CKAN_MAX_ATTEMPTS", 3),
+		CKANAPIKey:             os.Getenv("CKAN_API_KEY"),
+		HealthCheckUUID:        os.Getenv("HEALTH_CHECK_UUID"),
+		MaxFilterConditions:    getEnvInt("MAX_FILTER_CONDITIONS", 500),
+		MaxFilterDepth:         getEnvInt("MAX_FILTER_DEPTH", 2),
+		MaxResultLimit:         getEnvInt("MAX_RESULT_LIMIT", 10000),
+		MaxResultRows:          getEnvInt("MAX_RESULT_ROWS", 100000),
+		TruncateResults:        os.Getenv("TRUNCATE_RESULTS") != "false",
+		MaxDatasetVersions:     getEnvInt("MAX_DATASET_VERSIONS", 3),
+		AllowedOrigins:         getEnvList("ALLOWED_ORIGINS"),
+		FrontendDir:            os.Getenv("FRONTEND_DIR"),
+		RateLimitRPS:           getEnvFloat("RATE_LIMIT_RPS", 10),
+		RateLimitBurst:         getEnvInt("RATE_LIMIT_BURST", 20),
+		TrustProxy:             os.Getenv("TRUST_PROXY") == "true",
+		RequestTimeout:         getEnvDuration("REQUEST_TIMEOUT", 60*time.Second),
+		MaxDownloadBytes:       int64(getEnvInt("MAX_DOWNLOAD_MB", 10*1024)) * 1024 * 1024,
+		CaseInsensitiveFilters: os.Getenv("CASE_INSENSITIVE_FILTERS") == "true",
+
+		// DUCKDB_MEMORY_LIMIT es el nombre anterior, se sigue aceptando
+		DuckDBMemoryLimitPerDataset: getEnv("DUCKDB_MEMORY_LIMIT_PER_DATASET", os.Getenv("DUCKDB_MEMORY_LIMIT")),
+		DuckDBThreadsPerDataset:     getEnvInt("DUCKDB_THREADS_PER_DATASET", 0),
+
+		CacheTTLFilters:  getEnvTTL("CACHE_TTL_FILTERS", 0),
+		CacheTTLMetadata: getEnvTTL("CACHE_TTL_METADATA", 24*time.Hour),
+		CacheTTLData:     getEnvTTL("CACHE_TTL_DATA", 30*time.Minute),
+		CacheTTLAgg:      getEnvTTL("CACHE_TTL_AGG", time.Hour),
+		CacheTTLSearch:   getEnvTTL("CACHE_TTL_SEARCH", 15*time.Minute),
+		CacheTTLPreview:  getEnvTTL("CACHE_TTL_PREVIEW", 10*time.Minute),
+
+		PreloadUUIDs: getEnvList("PRELOAD_UUIDS"),
 	}
 
 	// Crear directorio de cache
@@ -37,11 +75,16 @@ func main() {
 		log.Fatalf("Error creando el directorio de cache: %v", err)
 	}
 
+	if config.AdminAPIKey == "" {
+		log.Println("Warning: ADMIN_API_KEY vacío, los endpoints de administración responden 403")
+	}
+
 	// Inicializar cache manager
 	log.Println("Inicializando cache manager...")
 	cacheManager, err := cache.NewManager(
 		config.RedisURL,
 		config.MemoryCacheGB*1024*1024*1024,
+		config.MemoryCacheDatasets,
 		config.DiskCacheGB*1024*1024*1024,
 		config.CacheDir,
 	)
@@ -49,24 +92,51 @@ func main() {
 		log.Fatalf("Error inicializando cache: %v", err)
 	}
 	defer cacheManager.Close()
+	for _, uuid := range config.PinnedDatasets {
+		cacheManager.PinDataset(uuid)
+	}
 
 	// Inicializando dataset managerl
 	log.Println("Inicializando dataset manager...")
-	datasetManager := dataset.NewManager(config.CKANBaseURL, cacheManager)
+	datasetManager := dataset.NewManager(config.CKANBaseURL, cacheManager, dataset.Options{
+		MaxConcurrentDownloads: config.MaxConcurrentDownloads,
+		CKANMaxAttempts:        config.CKANMaxAttempts,
+		CKANAPIKey:             config.CKANAPIKey,
+		MaxFilterConditions:    config.MaxFilterConditions,
+		MaxFilterDepth:         config.MaxFilterDepth,
+		MaxResultLimit:         config.MaxResultLimit,
+		MaxResultRows:          config.MaxResultRows,
+		TruncateResults:        config.TruncateResults,
+		MaxVersions:            config.MaxDatasetVersions,
+		MaxDownloadBytes:       config.MaxDownloadBytes,
+		CaseInsensitiveFilters: config.CaseInsensitiveFilters,
+
+		MemoryLimitPerDataset: config.DuckDBMemoryLimitPerDataset,
+		ThreadsPerDataset:     config.DuckDBThreadsPerDataset,
+	})
 	defer datasetManager.Close()
 
+	// Precalentar los datasets configurados; las descargas siguen en segundo plano
+	if len(config.PreloadUUIDs) > 0 {
+		log.Printf("🔥 Precargando %d datasets...", len(config.PreloadUUIDs))
+		datasetManager.GetDownloadManager().Preload(config.PreloadUUIDs)
+	}
+
 	// Crear servidor
 
 	srv := server.New(config, datasetManager, cacheManager)
 
-	// Montar frontend (SPA)
-	frontendDist, err := fs.Sub(frontendFS, "frontend/dist")
-	if err != nil {
-		log.Fatalf("Error montando frontend: %v", err)
+	// Montar frontend (SPA); en modo dev desde disco
+	if config.FrontendDir != "" {
+		srv.MountFrontendDir(config.FrontendDir)
+	} else {
+		frontendDist, err := fs.Sub(frontendFS, "frontend/dist")
+		if err != nil {
+			log.Fatalf("Error montando frontend: %v", err)
+		}
+		srv.MountFrontend(frontendDist)
 	}
 
-	srv.MountFrontend(frontendDist)
-
 	// Servidor HTTP
 	httpServer := &http.Server{
 		Addr:           ":" + config.Port,
@@ -99,6 +169,11 @@ func main() {
 		log.Fatalf("Error en shutdown: %v", err)
 	}
 
+	// Detener descargas en segundo plano antes de cerrar conexiones y cache
+	if err := datasetManager.GetDownloadManager().Shutdown(ctx); err != nil {
+		log.Printf("Warning: descargas detenidas sin terminar: %v", err)
+	}
+
 	log.Println("✓ Servidor apagado correctamente")
 }
 
@@ -108,3 +183,61 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Warning: valor inválido para %s: %q, usando %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		log.Printf("Warning: valor inválido para %s: %q, usando %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("Warning: valor inválido para %s: %q, usando %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvTTL lee un TTL de cache. A diferencia de getEnvDuration, un valor
+// inválido detiene el arranque: un TTL mal escrito no debe pasar desapercibido
+func getEnvTTL(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("❌ Valor inválido para %s: %q (usa p.ej. 30m o 24h)", key, value)
+	}
+	if d <= 0 {
+		log.Fatalf("❌ %s debe ser positivo: %q", key, value)
+	}
+	return d
+}
+
+// getEnvList lee una lista separada por comas, ignorando entradas vacías
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
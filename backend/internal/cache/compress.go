@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Las respuestas desde este tamaño se guardan en Redis comprimidas con gzip
+const compressMinSize = 1024
+
+// IsGzipped indica si un valor está comprimido con gzip. Las respuestas JSON
+// nunca empiezan con los bytes mágicos de gzip
+func IsGzipped(value []byte) bool {
+	return len(value) >= 2 && value[0] == 0x1f && value[1] == 0x8b
+}
+
+// compressValue comprime con gzip los valores grandes; los pequeños se
+// guardan tal cual porque no vale la pena el costo
+func compressValue(value []byte) []byte {
+	if len(value) < compressMinSize || IsGzipped(value) {
+		return value
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(value); err != nil {
+		return value
+	}
+	if err := gz.Close(); err != nil {
+		return value
+	}
+	return buf.Bytes()
+}
+
+// Decompress retorna el valor original de un valor comprimido con gzip
+func Decompress(value []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressValue(t *testing.T) {
+	small := []byte(`{"total": 1}`)
+	if got := compressValue(small); !bytes.Equal(got, small) || IsGzipped(got) {
+		t.Errorf("valor chico = %q, se esperaba sin comprimir", got)
+	}
+
+	large := []byte(strings.Repeat(`{"region": "Norte"},`, 200))
+	compressed := compressValue(large)
+	if !IsGzipped(compressed) || len(compressed) >= len(large) {
+		t.Fatalf("valor grande de %d bytes quedó en %d, se esperaba comprimido", len(large), len(compressed))
+	}
+	// Lo ya comprimido no se vuelve a comprimir
+	if again := compressValue(compressed); !bytes.Equal(again, compressed) {
+		t.Error("se recomprimió un valor ya comprimido")
+	}
+	data, err := Decompress(compressed)
+	if err != nil || !bytes.Equal(data, large) {
+		t.Errorf("Decompress = %d bytes, %v; se esperaba el valor original", len(data), err)
+	}
+}
+
+func TestRedisStoresLargeValuesCompressed(t *testing.T) {
+	m := newTestManager(t, 10, 1<<30)
+	large := []byte(strings.Repeat(`{"region": "Norte"},`, 200))
+	if err := m.SetToRedis("grande", large, time.Minute); err != nil {
+		t.Fatalf("SetToRedis: %v", err)
+	}
+
+	raw, gzipped, found := m.GetFromRedisEncoded("grande")
+	if !found || !gzipped || !IsGzipped(raw) {
+		t.Errorf("GetFromRedisEncoded: found %v, gzipped %v; se esperaba el valor comprimido", found, gzipped)
+	}
+	// GetFromRedis descomprime de forma transparente
+	if data, found := m.GetFromRedis("grande"); !found || !bytes.Equal(data, large) {
+		t.Errorf("GetFromRedis = %d bytes, se esperaba el valor original", len(data))
+	}
+
+	if err := m.SetToRedis("chico", map[string]int{"total": 1}, time.Minute); err != nil {
+		t.Fatalf("SetToRedis: %v", err)
+	}
+	if raw, gzipped, _ := m.GetFromRedisEncoded("chico"); gzipped || string(raw) != `{"total":1}` {
+		t.Errorf("valor chico = %q (gzipped %v), se esperaba sin comprimir", raw, gzipped)
+	}
+}
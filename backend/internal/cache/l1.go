@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Vida de una respuesta en L1; corta porque otras instancias pueden invalidar Redis
+	l1TTL = 10 * time.Second
+	// Solo se guardan en L1 respuestas pequeñas
+	l1MaxValueSize = 64 * 1024
+	// Máximo de respuestas en L1
+	l1MaxEntries = 1000
+)
+
+// l1Cache es un cache en memoria de proceso, con TTL corto, delante de Redis
+// para las respuestas JSON pequeñas más consultadas
+type l1Cache struct {
+	items map[string]l1Entry
+	mu    sync.RWMutex
+}
+
+type l1Entry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func newL1Cache() *l1Cache {
+	return &l1Cache{items: make(map[string]l1Entry)}
+}
+
+func (c *l1Cache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	item, ok := c.items[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(item.expiresAt) {
+		return nil, false
+	}
+	return item.value, true
+}
+
+// Set guarda la respuesta si es pequeña. ttl es el de Redis (0 = sin expiración);
+// la entrada nunca vive más que en Redis
+func (c *l1Cache) Set(key string, value []byte, ttl time.Duration) {
+	if len(value) > l1MaxValueSize {
+		return
+	}
+	if ttl <= 0 || ttl > l1TTL {
+		ttl = l1TTL
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.items[key]; !exists && len(c.items) >= l1MaxEntries {
+		c.purgeExpired(now)
+		if len(c.items) >= l1MaxEntries {
+			return
+		}
+	}
+	c.items[key] = l1Entry{value: value, expiresAt: now.Add(ttl)}
+}
+
+func (c *l1Cache) Delete(key string) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
+
+// DeleteDataset borra las respuestas de un dataset (keys <prefijo>:<uuid>[:<hash>])
+func (c *l1Cache) DeleteDataset(uuid string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key := range c.items {
+		if datasetKeyMatches(key, uuid) {
+			delete(c.items, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// purgeExpired elimina las entradas vencidas. Requiere el lock tomado.
+func (c *l1Cache) purgeExpired(now time.Time) {
+	for key, item := range c.items {
+		if now.After(item.expiresAt) {
+			delete(c.items, key)
+		}
+	}
+}
+
+// datasetKeyMatches replica los patrones "*:<uuid>" y "*:<uuid>:*" usados en Redis
+func datasetKeyMatches(key, uuid string) bool {
+	return strings.HasSuffix(key, ":"+uuid) || strings.Contains(key, ":"+uuid+":")
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestL1AvoidsRedisRoundTrip(t *testing.T) {
+	redis := testutil.NewRedis(t)
+	m, err := NewManager(redis.URL(), 1<<30, 10, 1<<30, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer m.Close()
+
+	// Escrito por otra instancia: la primera lectura va a Redis y las demás salen de L1
+	redis.Set("filters:ventas", `{"region":["Norte"]}`)
+	for i := 0; i < 3; i++ {
+		got, found := m.GetFromRedis("filters:ventas")
+		if !found || string(got) != `{"region":["Norte"]}` {
+			t.Fatalf("lectura %d = %q (%v), se esperaba el valor de Redis", i, got, found)
+		}
+	}
+	if n := redis.Calls("GET"); n != 1 {
+		t.Errorf("%d GET a Redis, se esperaba 1", n)
+	}
+
+	// Lo que escribe este proceso ya queda en L1
+	if err := m.SetToRedis("schema:ventas", []byte(`{"columns":[]}`), time.Hour); err != nil {
+		t.Fatalf("SetToRedis: %v", err)
+	}
+	if _, found := m.GetFromRedis("schema:ventas"); !found {
+		t.Fatal("schema:ventas no encontrado")
+	}
+	if n := redis.Calls("GET"); n != 1 {
+		t.Errorf("%d GET a Redis, la lectura de schema:ventas debió salir de L1", n)
+	}
+}
+
+func TestL1InvalidatedWithRedis(t *testing.T) {
+	redis := testutil.NewRedis(t)
+	m, err := NewManager(redis.URL(), 1<<30, 10, 1<<30, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer m.Close()
+
+	m.SetToRedis("filters:ventas", []byte(`{}`), time.Hour)
+	m.SetToRedis("filters:compras", []byte(`{}`), time.Hour)
+	if _, err := m.DeleteDatasetKeys("ventas"); err != nil {
+		t.Fatalf("DeleteDatasetKeys: %v", err)
+	}
+
+	if _, found := m.GetFromRedis("filters:ventas"); found {
+		t.Error("filters:ventas sigue en L1 después de invalidar el dataset")
+	}
+	if _, found := m.GetFromRedis("filters:compras"); !found {
+		t.Error("filters:compras no debería haberse invalidado")
+	}
+
+	m.SetToRedis("data:ventas", []byte(`{}`), time.Hour)
+	if _, err := m.PurgeByPrefix("data:"); err != nil {
+		t.Fatalf("PurgeByPrefix: %v", err)
+	}
+	if _, found := m.GetFromRedis("data:ventas"); found {
+		t.Error("data:ventas sigue en L1 después de purgar el prefijo")
+	}
+}
+
+func TestL1CacheLimits(t *testing.T) {
+	c := newL1Cache()
+
+	// Las respuestas grandes no se guardan en memoria de proceso
+	c.Set("grande", []byte(strings.Repeat("x", l1MaxValueSize+1)), time.Hour)
+	if _, ok := c.Get("grande"); ok {
+		t.Error("una respuesta de más de l1MaxValueSize no debería guardarse")
+	}
+
+	// La entrada no vive más que en Redis
+	c.Set("corta", []byte("{}"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("corta"); ok {
+		t.Error("la entrada debería haber expirado con el TTL de Redis")
+	}
+
+	// Con el cache lleno las entradas nuevas se descartan
+	for i := 0; i < l1MaxEntries; i++ {
+		c.Set(strings.Repeat("k", i+1), []byte("{}"), time.Hour)
+	}
+	c.Set("extra", []byte("{}"), time.Hour)
+	if _, ok := c.Get("extra"); ok {
+		t.Error("no debería guardarse una entrada con el cache lleno")
+	}
+}
+
+func TestL1DeleteDatasetExactUUID(t *testing.T) {
+	c := newL1Cache()
+	for _, key := range []string{"filters:ventas", "data:ventas:1", "filters:ventas2", "data:ventas2:1", "data:ventas-norte:1"} {
+		c.Set(key, []byte("{}"), time.Hour)
+	}
+
+	if deleted := c.DeleteDataset("ventas"); deleted != 2 {
+		t.Errorf("deleted = %d, se esperaban 2", deleted)
+	}
+	// Un uuid que empieza con "ventas" es otro dataset
+	for _, key := range []string{"filters:ventas2", "data:ventas2:1", "data:ventas-norte:1"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s se borró al invalidar ventas", key)
+		}
+	}
+}
@@ -11,7 +11,12 @@ type LRUCache struct {
 	maxSize   int64
 	items     map[string]*list.Element
 	evictList *list.List
-	mu        sync.RWMutex
+	// pinned son las keys que nunca se desalojan por capacidad o tamaño
+	pinned map[string]bool
+	mu     sync.RWMutex
+
+	// OnEvict se llama (fuera del lock) cuando una entrada es desalojada por capacidad
+	OnEvict func(key string)
 }
 
 type entry struct {
@@ -20,12 +25,19 @@ type entry struct {
 	size  int64
 }
 
-func NewLRUCache(maxSize int64) *LRUCache {
+// Datasets que se mantienen en memoria si no se configura otra capacidad
+const defaultLRUCapacity = 10
+
+func NewLRUCache(maxSize int64, capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = defaultLRUCapacity
+	}
 	return &LRUCache{
-		capacity:  10, // Top 10 datasets
+		capacity:  capacity,
 		maxSize:   maxSize,
 		items:     make(map[string]*list.Element),
 		evictList: list.New(),
+		pinned:    make(map[string]bool),
 	}
 }
 
@@ -42,7 +54,6 @@ func (c *LRUCache) Get(key string) (string, bool) {
 
 func (c *LRUCache) Set(key, value string, size int64) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	// Si existe, actualizar
 	if elem, ok := c.items[key]; ok {
@@ -51,6 +62,7 @@ func (c *LRUCache) Set(key, value string, size int64) {
 		c.size = c.size - oldEntry.size + size
 		oldEntry.value = value
 		oldEntry.size = size
+		c.mu.Unlock()
 		return
 	}
 
@@ -60,18 +72,85 @@ func (c *LRUCache) Set(key, value string, size int64) {
 	c.items[key] = elem
 	c.size += size
 
-	for c.evictList.Len() > c.capacity || c.size > c.maxSize {
-		c.evictOldest()
+	evicted := c.evictExcess()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
+// SetCapacity cambia en caliente el número máximo de entradas y desaloja
+// las menos usadas que excedan la nueva capacidad, salvo las fijadas con Pin.
+// Retorna las desalojadas.
+func (c *LRUCache) SetCapacity(capacity int) []string {
+	if capacity <= 0 {
+		capacity = defaultLRUCapacity
 	}
+
+	c.mu.Lock()
+	c.capacity = capacity
+	evicted := c.evictExcess()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return evicted
+}
+
+// Pin fija una key para que no se desaloje, aunque todavía no esté en el
+// cache. Si todas las entradas están fijadas el cache puede exceder la capacidad.
+func (c *LRUCache) Pin(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinned[key] = true
+}
+
+// Unpin libera una key fijada y desaloja el exceso que esta retenía
+func (c *LRUCache) Unpin(key string) []string {
+	c.mu.Lock()
+	delete(c.pinned, key)
+	evicted := c.evictExcess()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return evicted
+}
+
+// Pinned retorna cuántas keys están fijadas
+func (c *LRUCache) Pinned() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.pinned)
+}
+
+func (c *LRUCache) Capacity() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.capacity
 }
 
-func (c *LRUCache) evictOldest() {
+// evictExcess desaloja, de la menos a la más usada y saltando las fijadas,
+// hasta respetar capacidad y tamaño. Requiere el lock.
+func (c *LRUCache) evictExcess() []string {
+	var evicted []string
 	elem := c.evictList.Back()
-	if elem != nil {
-		c.evictList.Remove(elem)
-		entry := elem.Value.(*entry)
-		delete(c.items, entry.key)
-		c.size -= entry.size
+	for elem != nil && (c.evictList.Len() > c.capacity || c.size > c.maxSize) {
+		prev := elem.Prev()
+		if entry := elem.Value.(*entry); !c.pinned[entry.key] {
+			c.evictList.Remove(elem)
+			delete(c.items, entry.key)
+			c.size -= entry.size
+			evicted = append(evicted, entry.key)
+		}
+		elem = prev
+	}
+	return evicted
+}
+
+// notifyEvicted llama OnEvict fuera del lock para evitar deadlocks
+func (c *LRUCache) notifyEvicted(evicted []string) {
+	if c.OnEvict != nil {
+		for _, k := range evicted {
+			c.OnEvict(k)
+		}
 	}
 }
 
@@ -0,0 +1,123 @@
+package cache
+
+import "testing"
+
+func TestLRUCacheEvictsByCapacity(t *testing.T) {
+	c := NewLRUCache(1<<30, 2)
+	var evicted []string
+	// El callback usa el cache: si corriera con el lock tomado se bloquearía
+	c.OnEvict = func(key string) {
+		if _, ok := c.Get(key); ok {
+			t.Errorf("%s sigue en el cache durante OnEvict", key)
+		}
+		evicted = append(evicted, key)
+	}
+
+	c.Set("a", "a.duckdb", 1)
+	c.Set("b", "b.duckdb", 1)
+	c.Get("a")
+	c.Set("c", "c.duckdb", 1)
+
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("desalojados = %v, se esperaba b", evicted)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, se esperaba 2", c.Len())
+	}
+}
+
+func TestLRUCacheEvictsBySize(t *testing.T) {
+	c := NewLRUCache(100, 10)
+	var evicted []string
+	c.OnEvict = func(key string) { evicted = append(evicted, key) }
+
+	c.Set("a", "a.duckdb", 60)
+	c.Set("b", "b.duckdb", 60)
+
+	if len(evicted) != 1 || evicted[0] != "a" || c.Size() != 60 {
+		t.Errorf("desalojados = %v, tamaño %d; se esperaba desalojar a", evicted, c.Size())
+	}
+}
+
+func TestLRUCacheRemoveDoesNotNotify(t *testing.T) {
+	c := NewLRUCache(1<<30, 2)
+	c.OnEvict = func(key string) { t.Errorf("OnEvict(%s) en un Remove explícito", key) }
+
+	c.Set("a", "a.duckdb", 1)
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("a sigue en el cache")
+	}
+}
+
+func TestLRUCacheSetCapacity(t *testing.T) {
+	c := NewLRUCache(1<<30, 4)
+	var notified []string
+	c.OnEvict = func(key string) { notified = append(notified, key) }
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, key+".duckdb", 1)
+	}
+	c.Get("a")
+
+	// Al reducir se desalojan los menos usados: b y c
+	evicted := c.SetCapacity(2)
+	if len(evicted) != 2 || evicted[0] != "b" || evicted[1] != "c" {
+		t.Errorf("desalojados = %v, se esperaban b y c", evicted)
+	}
+	if len(notified) != 2 {
+		t.Errorf("OnEvict se llamó para %v, se esperaban b y c", notified)
+	}
+	if c.Len() != 2 || c.Capacity() != 2 {
+		t.Errorf("Len = %d, Capacity = %d; se esperaban 2 y 2", c.Len(), c.Capacity())
+	}
+	for _, key := range []string{"a", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s debería seguir en el cache", key)
+		}
+	}
+
+	// Ampliar no desaloja nada y la nueva capacidad se respeta en Set
+	if evicted := c.SetCapacity(3); len(evicted) != 0 {
+		t.Errorf("desalojados al ampliar = %v", evicted)
+	}
+	c.Set("e", "e.duckdb", 1)
+	if c.Len() != 3 {
+		t.Errorf("Len = %d, se esperaban 3", c.Len())
+	}
+
+	if c.SetCapacity(0); c.Capacity() != defaultLRUCapacity {
+		t.Errorf("Capacity = %d, se esperaba el default con 0", c.Capacity())
+	}
+}
+
+func TestLRUCacheSetCapacityRespectsPinned(t *testing.T) {
+	c := NewLRUCache(1<<30, 4)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, key+".duckdb", 1)
+	}
+	// a y b son los menos usados, pero a está fijado
+	c.Pin("a")
+
+	evicted := c.SetCapacity(2)
+	if len(evicted) != 2 || evicted[0] != "b" || evicted[1] != "c" {
+		t.Errorf("desalojados = %v, se esperaban b y c", evicted)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a está fijado y no debería desalojarse")
+	}
+
+	// Con todas las entradas fijadas el cache excede la capacidad
+	c.Pin("d")
+	if evicted := c.SetCapacity(1); len(evicted) != 0 {
+		t.Errorf("desalojados con todo fijado = %v", evicted)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, se esperaban 2", c.Len())
+	}
+
+	// Al liberar d se desaloja el exceso
+	if evicted := c.Unpin("d"); len(evicted) != 1 || evicted[0] != "d" {
+		t.Errorf("desalojados al liberar = %v, se esperaba d", evicted)
+	}
+}
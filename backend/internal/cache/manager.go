@@ -5,22 +5,30 @@ import (
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"visor-datos-abiertos-go/internal/metrics"
 )
 
 type Manager struct {
 	redis       *redis.Client
+	l1          *l1Cache
 	memoryCache *LRUCache
 	diskCache   *DiskCache
 	ctx         context.Context
+	onEvict     func(uuid string)
 }
 
-func NewManager(redisURL string, memorySize, diskSize int64, cacheDir string) (*Manager, error) {
+func NewManager(redisURL string, memorySize int64, memoryDatasets int, diskSize int64, cacheDir string) (*Manager, error) {
 	// Redis
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
@@ -35,39 +43,122 @@ func NewManager(redisURL string, memorySize, diskSize int64, cacheDir string) (*
 	}
 
 	// Memory cache
-	memCache := NewLRUCache(memorySize)
+	memCache := NewLRUCache(memorySize, memoryDatasets)
 
 	// Disk cache
 	diskCache := NewDiskCache(cacheDir, diskSize)
 
-	return &Manager{
+	m := &Manager{
 		redis:       redisClient,
+		l1:          newL1Cache(),
 		memoryCache: memCache,
 		diskCache:   diskCache,
 		ctx:         ctx,
-	}, nil
+	}
+
+	// Al desalojar de memoria, cerrar lo asociado al dataset
+	memCache.OnEvict = func(uuid string) {
+		if m.onEvict != nil {
+			m.onEvict(uuid)
+		}
+	}
+
+	// Al desalojar de disco, el dataset ya no debe quedar en memoria
+	diskCache.OnEvict = func(uuid string) {
+		m.memoryCache.Remove(uuid)
+		if m.onEvict != nil {
+			m.onEvict(uuid)
+		}
+	}
+
+	return m, nil
 }
 
-// Redis operaciones
+// SetEvictionCallback registra una función que se llama cuando un dataset
+// es desalojado del cache (p.ej. para cerrar su conexión)
+func (m *Manager) SetEvictionCallback(fn func(uuid string)) {
+	m.onEvict = fn
+}
+
+// Redis operaciones. Las respuestas pequeñas se consultan primero en L1 (memoria)
 func (m *Manager) GetFromRedis(key string) ([]byte, bool) {
-	val, err := m.redis.Get(m.ctx, key).Bytes()
+	val, gzipped, found := m.GetFromRedisEncoded(key)
+	if !found || !gzipped {
+		return val, found
+	}
+
+	data, err := Decompress(val)
 	if err != nil {
+		log.Printf("Warning: valor comprimido inválido en %s: %v", key, err)
 		return nil, false
 	}
-	return val, true
+	return data, true
+}
+
+// GetFromRedisEncoded retorna el valor tal como está guardado, sin
+// descomprimirlo, para poder enviarlo directo a clientes que aceptan gzip
+func (m *Manager) GetFromRedisEncoded(key string) (value []byte, gzipped bool, found bool) {
+	if val, ok := m.l1.Get(key); ok {
+		metrics.CacheResult("l1", true)
+		return val, IsGzipped(val), true
+	}
+	metrics.CacheResult("l1", false)
+
+	val, err := m.redis.Get(m.ctx, key).Bytes()
+	if err != nil {
+		metrics.CacheResult("redis", false)
+		return nil, false, false
+	}
+	metrics.CacheResult("redis", true)
+
+	// Sin consultar el TTL restante (otro round-trip): L1 vive a lo más l1TTL
+	m.l1.Set(key, val, 0)
+	return val, IsGzipped(val), true
 }
 
 func (m *Manager) SetToRedis(key string, value interface{}, ttl time.Duration) error {
-	data, err := json.Marshal(value)
+	// Si ya viene serializado, guardarlo tal cual
+	data, ok := value.([]byte)
+	if !ok {
+		var err error
+		data, err = json.Marshal(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Las respuestas grandes se guardan comprimidas (también en L1)
+	data = compressValue(data)
+
+	if err := m.redis.Set(m.ctx, key, data, ttl).Err(); err != nil {
+		m.l1.Delete(key)
+		return err
+	}
+	m.l1.Set(key, data, ttl)
+	return nil
+}
+
+// Ping verifica la conexión con Redis
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.redis.Ping(ctx).Err()
+}
+
+// CheckDisk verifica que el directorio de cache exista y se pueda escribir
+func (m *Manager) CheckDisk() error {
+	f, err := os.CreateTemp(m.diskCache.dir, ".healthcheck-*")
 	if err != nil {
 		return err
 	}
-	return m.redis.Set(m.ctx, key, data, ttl).Err()
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
 }
 
 // Memory operaciones
 func (m *Manager) GetFromMemory(uuid string) (string, bool) {
-	return m.memoryCache.Get(uuid)
+	dbPath, found := m.memoryCache.Get(uuid)
+	metrics.CacheResult("memory", found)
+	return dbPath, found
 }
 
 func (m *Manager) SetToMemory(uuid, dbPath string) {
@@ -79,19 +170,172 @@ func (m *Manager) SetToMemory(uuid, dbPath string) {
 	m.memoryCache.Set(uuid, dbPath, size)
 }
 
+// MemoryStats describe la ocupación del cache en memoria
+type MemoryStats struct {
+	Capacity  int   `json:"capacity"`
+	Datasets  int   `json:"datasets"`
+	Pinned    int   `json:"pinned"`
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+func (m *Manager) MemoryStats() MemoryStats {
+	return MemoryStats{
+		Capacity:  m.memoryCache.Capacity(),
+		Datasets:  m.memoryCache.Len(),
+		Pinned:    m.memoryCache.Pinned(),
+		SizeBytes: m.memoryCache.Size(),
+	}
+}
+
+// SetMemoryCapacity ajusta en caliente cuántos datasets se mantienen en memoria.
+// Los que excedan la nueva capacidad se desalojan (cerrando su conexión).
+func (m *Manager) SetMemoryCapacity(capacity int) []string {
+	evicted := m.memoryCache.SetCapacity(capacity)
+	if len(evicted) > 0 {
+		log.Printf("🧹 Capacidad de memoria ajustada a %d, %d datasets desalojados", m.memoryCache.Capacity(), len(evicted))
+	}
+	return evicted
+}
+
+// PinDataset mantiene un dataset en memoria aunque se reduzca la capacidad
+func (m *Manager) PinDataset(uuid string) {
+	m.memoryCache.Pin(uuid)
+}
+
+// UnpinDataset permite volver a desalojar un dataset fijado con PinDataset
+func (m *Manager) UnpinDataset(uuid string) {
+	m.memoryCache.Unpin(uuid)
+}
+
 // Disk operaciones
 func (m *Manager) GetFromDisk(uuid string) (string, bool) {
-	return m.diskCache.Get(uuid)
+	dbPath, found := m.diskCache.Get(uuid)
+	metrics.CacheResult("disk", found)
+	return dbPath, found
 }
 
 func (m *Manager) SetToDisk(uuid, dbPath string) error {
 	return m.diskCache.Set(uuid, dbPath)
 }
 
+// RemoveDataset borra un dataset de los caches en memoria y disco
+func (m *Manager) RemoveDataset(uuid string) error {
+	m.memoryCache.Remove(uuid)
+	return m.diskCache.Remove(uuid)
+}
+
+// GetDatasetSize retorna el tamaño en bytes del archivo DuckDB de un dataset
+func (m *Manager) GetDatasetSize(uuid string) (int64, bool) {
+	fi, err := os.Stat(m.diskCache.path(uuid))
+	if err != nil {
+		return 0, false
+	}
+	return fi.Size(), true
+}
+
+// InvalidateDataset borra un dataset de todos los niveles de cache: avisa para
+// cerrar su conexión, lo quita de memoria y disco y borra sus keys de Redis.
+// Retorna cuántas keys de Redis se borraron.
+func (m *Manager) InvalidateDataset(uuid string) (int, error) {
+	if uuid == "" {
+		return 0, fmt.Errorf("UUID requerido")
+	}
+
+	if m.onEvict != nil {
+		m.onEvict(uuid)
+	}
+	if err := m.RemoveDataset(uuid); err != nil {
+		return 0, err
+	}
+
+	return m.DeleteDatasetKeys(uuid)
+}
+
+// DeleteDatasetKeys borra de Redis los resultados cacheados de un dataset
+func (m *Manager) DeleteDatasetKeys(uuid string) (int, error) {
+	if uuid == "" {
+		return 0, fmt.Errorf("UUID requerido")
+	}
+	m.l1.DeleteDataset(uuid)
+
+	// Las keys de un dataset tienen la forma <prefijo>:<uuid>[:<hash>]. Se
+	// buscan por separado para no borrar las de otro uuid que empiece igual
+	deleted := 0
+	for _, pattern := range []string{"*:" + escapeGlob(uuid), "*:" + escapeGlob(uuid) + ":*"} {
+		n, err := m.deleteRedisKeys(pattern)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteRedisKeys borra las keys que coinciden con el patrón usando SCAN
+func (m *Manager) deleteRedisKeys(pattern string) (int, error) {
+	deleted := 0
+	iter := m.redis.Scan(m.ctx, 0, pattern, 500).Iterator()
+	for iter.Next(m.ctx) {
+		m.l1.Delete(iter.Val())
+		if err := m.redis.Del(m.ctx, iter.Val()).Err(); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, iter.Err()
+}
+
+// PurgeByPrefix borra de Redis (y de L1) las keys que empiezan con prefix,
+// p.ej. "data:" para todas las filas filtradas cacheadas. Usa SCAN para no
+// bloquear Redis. Retorna cuántas keys se borraron.
+func (m *Manager) PurgeByPrefix(prefix string) (int, error) {
+	if prefix == "" {
+		return 0, fmt.Errorf("prefijo requerido")
+	}
+	return m.deleteRedisKeys(escapeGlob(prefix) + "*")
+}
+
+// ListKeys retorna hasta limit keys de Redis que empiezan con prefix, en
+// orden alfabético, e indica si había más
+func (m *Manager) ListKeys(ctx context.Context, prefix string, limit int) ([]string, bool, error) {
+	keys := []string{}
+	truncated := false
+	iter := m.redis.Scan(ctx, 0, escapeGlob(prefix)+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		if len(keys) >= limit {
+			truncated = true
+			break
+		}
+		keys = append(keys, iter.Val())
+	}
+	sort.Strings(keys)
+	return keys, truncated, iter.Err()
+}
+
+// escapeGlob escapa los caracteres especiales de los patrones de Redis
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // Helpers
 func (m *Manager) GenerateKey(prefix string, data interface{}) string {
 	jsonData, _ := json.Marshal(data)
 	hash := md5.Sum(jsonData)
+
+	// Incluir el UUID del dataset en la key para poder invalidarla por dataset
+	if params, ok := data.(map[string]interface{}); ok {
+		if uuid, ok := params["uuid"].(string); ok && uuid != "" {
+			return fmt.Sprintf("%s:%s:%x", prefix, uuid, hash)
+		}
+	}
 	return fmt.Sprintf("%s:%x", prefix, hash)
 }
 
@@ -100,22 +344,40 @@ func (m *Manager) Close() error {
 }
 
 type DiskCache struct {
-	dir     string
-	maxSize int64
-	mu      sync.RWMutex
+	dir        string
+	maxSize    int64
+	lastAccess map[string]time.Time
+	evicted    int64
+	mu         sync.RWMutex
+
+	// OnEvict se llama (fuera del lock) por cada dataset desalojado
+	OnEvict func(uuid string)
 }
 
 func NewDiskCache(dir string, maxSize int64) *DiskCache {
 	os.MkdirAll(dir, 0755)
 	return &DiskCache{
-		dir:     dir,
-		maxSize: maxSize,
+		dir:        dir,
+		maxSize:    maxSize,
+		lastAccess: make(map[string]time.Time),
 	}
 }
 
+func (dc *DiskCache) path(uuid string) string {
+	return filepath.Join(dc.dir, uuid+".duckdb")
+}
+
+// metaPath es el sidecar con la metadata de vigencia del dataset
+func (dc *DiskCache) metaPath(uuid string) string {
+	return filepath.Join(dc.dir, uuid+".meta.json")
+}
+
 func (dc *DiskCache) Get(uuid string) (string, bool) {
-	path := filepath.Join(dc.dir, uuid+".duckdb")
+	path := dc.path(uuid)
 	if _, err := os.Stat(path); err == nil {
+		dc.mu.Lock()
+		dc.lastAccess[uuid] = time.Now()
+		dc.mu.Unlock()
 		return path, true
 	}
 	return "", false
@@ -123,16 +385,177 @@ func (dc *DiskCache) Get(uuid string) (string, bool) {
 
 func (dc *DiskCache) Set(uuid, srcPath string) error {
 	dc.mu.Lock()
+
+	dstPath := dc.path(uuid)
+
+	// Mover solo si no existe (el archivo puede haberse creado ya en el directorio de cache)
+	if _, err := os.Stat(dstPath); err != nil {
+		if err := os.Rename(srcPath, dstPath); err != nil {
+			dc.mu.Unlock()
+			return err
+		}
+	}
+	dc.lastAccess[uuid] = time.Now()
+
+	evicted := dc.enforceMaxSize(uuid)
+	dc.mu.Unlock()
+
+	// Callbacks fuera del lock
+	if dc.OnEvict != nil {
+		for _, id := range evicted {
+			dc.OnEvict(id)
+		}
+	}
+	return nil
+}
+
+// Remove borra el archivo de un dataset del cache en disco
+func (dc *DiskCache) Remove(uuid string) error {
+	dc.mu.Lock()
 	defer dc.mu.Unlock()
 
-	dstPath := filepath.Join(dc.dir, uuid+".duckdb")
+	path := dc.path(uuid)
+	delete(dc.lastAccess, uuid)
+	os.Remove(path + ".wal")
+	os.Remove(dc.metaPath(uuid))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// enforceMaxSize borra los datasets accedidos hace más tiempo hasta quedar
+// bajo maxSize. Nunca borra keep. Debe llamarse con el lock tomado.
+func (dc *DiskCache) enforceMaxSize(keep string) []string {
+	if dc.maxSize <= 0 {
+		return nil
+	}
 
-	// Si ya existe, no hacer nada
-	if _, err := os.Stat(dstPath); err == nil {
+	type cachedFile struct {
+		uuid       string
+		size       int64
+		lastAccess time.Time
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dc.dir, "*.duckdb"))
+	if err != nil {
 		return nil
 	}
-	//  Mover o copiar
-	return os.Rename(srcPath, dstPath)
+
+	var files []cachedFile
+	var total int64
+	for _, path := range matches {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		uuid := strings.TrimSuffix(filepath.Base(path), ".duckdb")
+		accessed, ok := dc.lastAccess[uuid]
+		if !ok {
+			accessed = fi.ModTime()
+		}
+		files = append(files, cachedFile{uuid: uuid, size: fi.Size(), lastAccess: accessed})
+		total += fi.Size()
+	}
+
+	if total <= dc.maxSize {
+		return nil
+	}
+
+	// Más antiguo primero
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].lastAccess.Before(files[j].lastAccess)
+	})
+
+	var evicted []string
+	for _, f := range files {
+		if total <= dc.maxSize {
+			break
+		}
+		if f.uuid == keep {
+			continue
+		}
+		path := dc.path(f.uuid)
+		if err := os.Remove(path); err != nil {
+			log.Printf("Warning: no se pudo desalojar %s: %v", path, err)
+			continue
+		}
+		os.Remove(path + ".wal")
+		os.Remove(dc.metaPath(f.uuid))
+		delete(dc.lastAccess, f.uuid)
+		total -= f.size
+		dc.evicted++
+		evicted = append(evicted, f.uuid)
+		log.Printf("🗑️  Dataset %s desalojado del cache en disco (%.2f MB)", f.uuid, float64(f.size)/(1024*1024))
+	}
+	return evicted
+}
+
+// Evicted retorna el número de datasets desalojados por tamaño
+func (dc *DiskCache) Evicted() int64 {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	return dc.evicted
+}
+
+// DiskStats describe la ocupación del cache en disco. Files y SizeBytes
+// incluyen todo el directorio (WAL, metadata y versiones archivadas)
+type DiskStats struct {
+	Datasets     int   `json:"datasets"`
+	Files        int   `json:"files"`
+	SizeBytes    int64 `json:"size_bytes"`
+	MaxSizeBytes int64 `json:"max_size_bytes"`
+	Evicted      int64 `json:"evicted"`
+}
+
+// Stats recorre el directorio del cache contando datasets, archivos y bytes
+func (dc *DiskCache) Stats() (DiskStats, error) {
+	stats := DiskStats{MaxSizeBytes: dc.maxSize, Evicted: dc.Evicted()}
+	err := filepath.WalkDir(dc.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Un archivo borrado durante el recorrido no es un error
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stats.Files++
+		stats.SizeBytes += info.Size()
+		if filepath.Dir(path) == filepath.Clean(dc.dir) && strings.HasSuffix(path, ".duckdb") {
+			stats.Datasets++
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// DiskStats retorna la ocupación del cache en disco
+func (m *Manager) DiskStats() (DiskStats, error) {
+	return m.diskCache.Stats()
+}
+
+// RedisKeyCounts cuenta las keys de Redis por prefijo (lo que va antes del
+// primer ":"; las keys sin prefijo cuentan con su nombre completo)
+func (m *Manager) RedisKeyCounts(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+	iter := m.redis.Scan(ctx, 0, "*", 1000).Iterator()
+	for iter.Next(ctx) {
+		prefix, _, _ := strings.Cut(iter.Val(), ":")
+		counts[prefix]++
+	}
+	return counts, iter.Err()
+}
+
+// DiskEvicted retorna el número de datasets desalojados del cache en disco
+func (m *Manager) DiskEvicted() int64 {
+	return m.diskCache.Evicted()
 }
 
 func (m *Manager) GetCacheDir() string {
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+// newTestManager crea un Manager con Redis en memoria y el cache en disco en
+// un directorio temporal
+func newTestManager(t *testing.T, memoryDatasets int, diskSize int64) *Manager {
+	t.Helper()
+	redis := testutil.NewRedis(t)
+	m, err := NewManager(redis.URL(), 1<<30, memoryDatasets, diskSize, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// writeFile crea un archivo de size bytes para mover al cache en disco
+func writeFile(t *testing.T, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dataset.duckdb")
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiskCacheEvictsLeastRecentlyAccessed(t *testing.T) {
+	dc := NewDiskCache(t.TempDir(), 250)
+	var evicted []string
+	dc.OnEvict = func(uuid string) { evicted = append(evicted, uuid) }
+
+	for _, uuid := range []string{"a", "b"} {
+		if err := dc.Set(uuid, writeFile(t, 100)); err != nil {
+			t.Fatalf("Set %s: %v", uuid, err)
+		}
+	}
+	// a se usó después de b, así que b es el más antiguo
+	if _, ok := dc.Get("a"); !ok {
+		t.Fatal("a no está en el cache")
+	}
+	if err := dc.Set("c", writeFile(t, 100)); err != nil {
+		t.Fatalf("Set c: %v", err)
+	}
+
+	if _, ok := dc.Get("b"); ok {
+		t.Error("b debería haberse desalojado")
+	}
+	for _, uuid := range []string{"a", "c"} {
+		if _, ok := dc.Get(uuid); !ok {
+			t.Errorf("%s no debería haberse desalojado", uuid)
+		}
+	}
+	if len(evicted) != 1 || evicted[0] != "b" || dc.Evicted() != 1 {
+		t.Errorf("desalojados = %v (Evicted %d), se esperaba solo b", evicted, dc.Evicted())
+	}
+}
+
+func TestDiskCacheKeepsNewDatasetOverLimit(t *testing.T) {
+	dc := NewDiskCache(t.TempDir(), 50)
+
+	// Un dataset más grande que el límite no se desaloja a sí mismo
+	if err := dc.Set("grande", writeFile(t, 100)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, ok := dc.Get("grande"); !ok || dc.Evicted() != 0 {
+		t.Errorf("el dataset recién guardado se desalojó")
+	}
+}
+
+func TestDiskEvictionRemovesFromMemory(t *testing.T) {
+	m := newTestManager(t, 10, 150)
+	var closed []string
+	m.SetEvictionCallback(func(uuid string) { closed = append(closed, uuid) })
+
+	for _, uuid := range []string{"a", "b"} {
+		if err := m.SetToDisk(uuid, writeFile(t, 100)); err != nil {
+			t.Fatalf("SetToDisk %s: %v", uuid, err)
+		}
+		path, _ := m.GetFromDisk(uuid)
+		m.SetToMemory(uuid, path)
+	}
+
+	if _, ok := m.GetFromMemory("a"); ok {
+		t.Error("a sigue en memoria tras desalojarse del disco")
+	}
+	if len(closed) != 1 || closed[0] != "a" {
+		t.Errorf("callbacks = %v, se esperaba cerrar a", closed)
+	}
+}
+
+func TestDiskCacheStats(t *testing.T) {
+	dir := t.TempDir()
+	dc := NewDiskCache(dir, 1000)
+	for _, uuid := range []string{"a", "b"} {
+		if err := dc.Set(uuid, writeFile(t, 100)); err != nil {
+			t.Fatalf("Set %s: %v", uuid, err)
+		}
+	}
+	// WAL y versiones archivadas cuentan como archivos pero no como datasets
+	if err := os.WriteFile(filepath.Join(dir, "a.duckdb.wal"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "versions"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "versions", "a-1.duckdb"), make([]byte, 5), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := dc.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	want := DiskStats{Datasets: 2, Files: 4, SizeBytes: 215, MaxSizeBytes: 1000}
+	if stats != want {
+		t.Errorf("stats = %+v, se esperaba %+v", stats, want)
+	}
+}
+
+func TestRedisKeyCounts(t *testing.T) {
+	m := newTestManager(t, 10, 1<<30)
+	for _, key := range []string{"agg:ventas:1", "agg:ventas:2", "filters:ventas", "csv-skip"} {
+		if err := m.SetToRedis(key, "x", time.Minute); err != nil {
+			t.Fatalf("SetToRedis %s: %v", key, err)
+		}
+	}
+
+	counts, err := m.RedisKeyCounts(context.Background())
+	if err != nil {
+		t.Fatalf("RedisKeyCounts: %v", err)
+	}
+	if counts["agg"] != 2 || counts["filters"] != 1 || counts["csv-skip"] != 1 || len(counts) != 3 {
+		t.Errorf("counts = %v, se esperaban agg 2, filters 1 y csv-skip 1", counts)
+	}
+}
+
+func TestPurgeByPrefix(t *testing.T) {
+	m := newTestManager(t, 10, 1<<30)
+	keys := []string{"data:ventas:1", "data:ventas:2", "data:*:3", "agg:ventas:1", "filters:ventas"}
+	for _, key := range keys {
+		if err := m.SetToRedis(key, "x", time.Minute); err != nil {
+			t.Fatalf("SetToRedis %s: %v", key, err)
+		}
+		// Dejar también la copia en L1
+		m.GetFromRedis(key)
+	}
+
+	deleted, err := m.PurgeByPrefix("data:ventas:")
+	if err != nil {
+		t.Fatalf("PurgeByPrefix: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted = %d, se esperaban 2", deleted)
+	}
+	for _, key := range []string{"data:ventas:1", "data:ventas:2"} {
+		if _, found := m.GetFromRedis(key); found {
+			t.Errorf("%s sigue en el cache", key)
+		}
+	}
+	// El * del prefijo se toma literal: no borra "data:*:3" ni las demás
+	for _, key := range []string{"data:*:3", "agg:ventas:1", "filters:ventas"} {
+		if _, found := m.GetFromRedis(key); !found {
+			t.Errorf("%s se borró", key)
+		}
+	}
+
+	deleted, err = m.PurgeByPrefix("data:*")
+	if err != nil || deleted != 1 {
+		t.Errorf("PurgeByPrefix(data:*) = %d, %v; se esperaba 1", deleted, err)
+	}
+
+	if _, err := m.PurgeByPrefix(""); err == nil {
+		t.Error("PurgeByPrefix sin prefijo no retornó error")
+	}
+}
+
+func TestDeleteDatasetKeys(t *testing.T) {
+	m := newTestManager(t, 10, 1<<30)
+	keys := []string{"filters:ventas", "data:ventas:1", "agg:ventas:2", "filters:ventas2", "data:ventas2:1", "data:ventas-norte:1"}
+	for _, key := range keys {
+		if err := m.SetToRedis(key, "x", time.Minute); err != nil {
+			t.Fatalf("SetToRedis %s: %v", key, err)
+		}
+	}
+
+	deleted, err := m.DeleteDatasetKeys("ventas")
+	if err != nil {
+		t.Fatalf("DeleteDatasetKeys: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("deleted = %d, se esperaban 3", deleted)
+	}
+	// Los datasets cuyo uuid empieza con "ventas" conservan sus keys
+	remaining, _, err := m.ListKeys(context.Background(), "", 100)
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if got := strings.Join(remaining, ","); got != "data:ventas-norte:1,data:ventas2:1,filters:ventas2" {
+		t.Errorf("keys restantes = %s", got)
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	m := newTestManager(t, 10, 1<<30)
+	for _, key := range []string{"data:c", "data:a", "data:b", "agg:a"} {
+		if err := m.SetToRedis(key, "x", time.Minute); err != nil {
+			t.Fatalf("SetToRedis %s: %v", key, err)
+		}
+	}
+	ctx := context.Background()
+
+	keys, truncated, err := m.ListKeys(ctx, "data:", 10)
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if strings.Join(keys, ",") != "data:a,data:b,data:c" || truncated {
+		t.Errorf("keys = %v, truncated = %v; se esperaban las 3 de data: en orden", keys, truncated)
+	}
+
+	keys, truncated, err = m.ListKeys(ctx, "data:", 2)
+	if err != nil {
+		t.Fatalf("ListKeys con límite: %v", err)
+	}
+	if len(keys) != 2 || !truncated {
+		t.Errorf("keys = %v, truncated = %v; se esperaban 2 y truncado", keys, truncated)
+	}
+
+	// Sin prefijo lista todas
+	if keys, _, _ := m.ListKeys(ctx, "", 10); len(keys) != 4 {
+		t.Errorf("keys = %v, se esperaban 4", keys)
+	}
+}
@@ -3,14 +3,33 @@ package ckan
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math/rand"
 	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	// Intentos por petición cuando no se configura otro valor
+	defaultMaxAttempts = 3
+	// Espera base del backoff exponencial entre reintentos
+	defaultBackoffBase = 500 * time.Millisecond
+)
+
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL     string
+	httpClient  *http.Client
+	maxAttempts int
+	backoffBase time.Duration
+
+	// APIKey se envía en el header Authorization (instancias con recursos privados).
+	// Nunca debe aparecer en logs.
+	APIKey string
 }
 
 func NewClient(baseURL string) *Client {
@@ -19,7 +38,17 @@ func NewClient(baseURL string) *Client {
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute,
 		},
+		maxAttempts: defaultMaxAttempts,
+		backoffBase: defaultBackoffBase,
+	}
+}
+
+// SetMaxAttempts configura cuántas veces se intenta cada petición (mínimo 1)
+func (c *Client) SetMaxAttempts(n int) {
+	if n < 1 {
+		n = 1
 	}
+	c.maxAttempts = n
 }
 
 type Resource struct {
@@ -34,73 +63,142 @@ type Resource struct {
 }
 
 type Package struct {
-	ID          string     `json:"id`
+	ID          string     `json:"id"`
 	Name        string     `json:"name"`
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
 	Resources   []Resource `json:"resources"`
 }
 
-func (c *Client) GetResource(ctx context.Context, resourceID string) (*Resource, error) {
-	url := fmt.Sprintf("%s/resource_show?id=%s", c.baseURL, resourceID)
+// SearchResult es una página de resultados de package_search
+type SearchResult struct {
+	Count   int       `json:"count"`
+	Results []Package `json:"results"`
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
+func (c *Client) GetResource(ctx context.Context, resourceID string) (*Resource, error) {
+	var resource Resource
+	if err := c.doRequest(ctx, "resource_show", neturl.Values{"id": {resourceID}}, &resource); err != nil {
 		return nil, err
 	}
+	return &resource, nil
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
+func (c *Client) GetPackage(ctx context.Context, packageID string) (*Package, error) {
+	var pkg Package
+	if err := c.doRequest(ctx, "package_show", neturl.Values{"id": {packageID}}, &pkg); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("CKAN API error: status &d", resp.StatusCode)
-	}
+	return &pkg, nil
+}
 
-	var result struct {
-		Success bool     `json:"success"`
-		Result  Resource `json:"result"`
-	}
+// SearchPackages busca paquetes en CKAN, paginando con start y rows
+func (c *Client) SearchPackages(ctx context.Context, query string, start, rows int) (*SearchResult, error) {
+	params := neturl.Values{}
+	params.Set("q", query)
+	params.Set("start", strconv.Itoa(start))
+	params.Set("rows", strconv.Itoa(rows))
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	var result SearchResult
+	if err := c.doRequest(ctx, "package_search", params, &result); err != nil {
 		return nil, err
 	}
+	return &result, nil
+}
 
-	if !result.Success {
-		return nil, fmt.Errorf("CKAN API returned success=false")
+// HTTPClient retorna el cliente HTTP configurado, para pedir archivos de
+// recursos con los mismos timeouts que la API
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// AuthorizeRequest agrega el API key a una petición dirigida al host de CKAN.
+// A otros hosts (p.ej. archivos alojados fuera de CKAN) no se envía.
+func (c *Client) AuthorizeRequest(req *http.Request) {
+	if c.APIKey == "" {
+		return
+	}
+	base, err := neturl.Parse(c.baseURL)
+	if err != nil || !strings.EqualFold(base.Host, req.URL.Host) {
+		return
 	}
+	req.Header.Set("Authorization", c.APIKey)
+}
 
-	return &result.Result, nil
+// retryableError marca los errores que justifican un nuevo intento
+type retryableError struct {
+	err error
 }
 
-func (c *Client) GetPackage(ctx context.Context, packageID string) (*Package, error) {
-	url := fmt.Sprintf("%spackage_show?id%s", c.baseURL, packageID)
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// doRequest llama a una acción de la API de CKAN y decodifica el campo result en out.
+// Reintenta con backoff exponencial y jitter ante errores de red y respuestas 5xx/429
+func (c *Client) doRequest(ctx context.Context, action string, params neturl.Values, out interface{}) error {
+	url := fmt.Sprintf("%s/%s?%s", c.baseURL, action, params.Encode())
+
+	var err error
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		err = c.doAttempt(ctx, url, out)
+
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt == c.maxAttempts {
+			break
+		}
 
+		// Backoff exponencial con jitter: base * 2^(intento-1) + [0, base)
+		wait := c.backoffBase<<(attempt-1) + time.Duration(rand.Int63n(int64(c.backoffBase)+1))
+		log.Printf("⚠️ CKAN %s falló (intento %d/%d): %v, reintentando en %v", action, attempt, c.maxAttempts, err, wait)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return err
+}
+
+// doAttempt realiza un único intento de la petición
+func (c *Client) doAttempt(ctx context.Context, url string, out interface{}) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	c.AuthorizeRequest(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		// La cancelación del contexto no se reintenta
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &retryableError{err}
 	}
 	defer resp.Body.Close()
 
-	var result struct {
-		Success bool    `json:"success"`
-		Result  Package `json:"result"`
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("CKAN API error: status %d", resp.StatusCode)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return &retryableError{err}
+		}
+		return err
 	}
 
+	result := struct {
+		Success bool        `json:"success"`
+		Result  interface{} `json:"result"`
+	}{Result: out}
+
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		return err
 	}
 
 	if !result.Success {
-		return nil, fmt.Errorf("CKAN API returned success=false")
+		return fmt.Errorf("CKAN API returned success=false")
 	}
 
-	return &result.Result, nil
+	return nil
 }
@@ -0,0 +1,146 @@
+package ckan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer responde status a las primeras fails peticiones y luego un
+// resource_show exitoso; cuenta las peticiones recibidas
+func flakyServer(t *testing.T, fails int, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= int32(fails) {
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "result": {"id": "ventas", "format": "CSV"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// newTestClient crea un cliente con backoff corto para no alargar las pruebas
+func newTestClient(baseURL string) *Client {
+	c := NewClient(baseURL)
+	c.backoffBase = time.Millisecond
+	return c
+}
+
+func TestDoRequestRetriesTransientErrors(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+	c := newTestClient(srv.URL)
+
+	resource, err := c.GetResource(context.Background(), "ventas")
+	if err != nil {
+		t.Fatalf("GetResource: %v", err)
+	}
+	if resource.ID != "ventas" || resource.Format != "CSV" {
+		t.Errorf("recurso = %+v, se esperaba ventas en CSV", resource)
+	}
+	if n := atomic.LoadInt32(calls); n != 3 {
+		t.Errorf("%d intentos, se esperaban 3", n)
+	}
+}
+
+func TestDoRequestGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, calls := flakyServer(t, 5, http.StatusTooManyRequests)
+	c := newTestClient(srv.URL)
+	c.SetMaxAttempts(2)
+
+	if _, err := c.GetResource(context.Background(), "ventas"); err == nil {
+		t.Fatal("se esperaba error tras agotar los intentos")
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("%d intentos, se esperaban 2", n)
+	}
+}
+
+func TestDoRequestDoesNotRetryClientErrors(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusNotFound)
+	c := newTestClient(srv.URL)
+
+	if _, err := c.GetResource(context.Background(), "ventas"); err == nil {
+		t.Fatal("se esperaba error con status 404")
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("%d intentos, se esperaba 1 (los 4xx no se reintentan)", n)
+	}
+}
+
+func TestDoRequestHonorsCancellationBetweenRetries(t *testing.T) {
+	srv, calls := flakyServer(t, 5, http.StatusBadGateway)
+	c := NewClient(srv.URL)
+	c.backoffBase = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetResource(ctx, "ventas"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, se esperaba context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("la cancelación tardó %v, no interrumpió el backoff", elapsed)
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("%d intentos, se esperaba 1", n)
+	}
+}
+
+// authServer responde resource_show y guarda el header Authorization recibido
+func authServer(t *testing.T) (*httptest.Server, *atomic.Value) {
+	t.Helper()
+	var auth atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"success": true, "result": {"id": "ventas"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &auth
+}
+
+func TestAPIKeyHeader(t *testing.T) {
+	srv, auth := authServer(t)
+
+	c := newTestClient(srv.URL)
+	c.APIKey = "secreto"
+	if _, err := c.GetResource(context.Background(), "ventas"); err != nil {
+		t.Fatalf("GetResource: %v", err)
+	}
+	if got := auth.Load(); got != "secreto" {
+		t.Errorf("Authorization = %q, se esperaba el API key", got)
+	}
+
+	c.APIKey = ""
+	if _, err := c.GetResource(context.Background(), "ventas"); err != nil {
+		t.Fatalf("GetResource: %v", err)
+	}
+	if got := auth.Load(); got != "" {
+		t.Errorf("Authorization = %q, no se esperaba header sin API key", got)
+	}
+}
+
+func TestAuthorizeRequestOnlyForCKANHost(t *testing.T) {
+	c := NewClient("https://datos.example.gob/api/3/action")
+	c.APIKey = "secreto"
+
+	own, _ := http.NewRequest("GET", "https://datos.example.gob/dataset/ventas.csv", nil)
+	c.AuthorizeRequest(own)
+	if got := own.Header.Get("Authorization"); got != "secreto" {
+		t.Errorf("mismo host: Authorization = %q, se esperaba el API key", got)
+	}
+
+	// El key no se filtra a archivos alojados en otro dominio
+	other, _ := http.NewRequest("GET", "https://almacenamiento.example.com/ventas.csv", nil)
+	c.AuthorizeRequest(other)
+	if got := other.Header.Get("Authorization"); got != "" {
+		t.Errorf("otro host: Authorization = %q, no se esperaba header", got)
+	}
+}
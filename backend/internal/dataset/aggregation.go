@@ -2,6 +2,7 @@ package dataset
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
 )
@@ -15,31 +16,186 @@ type AggregationParams struct {
 	OrderDir   string
 	Limit      int
 	DateFormat string
+	Having     *HavingCondition
+	// OrderNulls ubica los NULL al ordenar: "first", "last" o vacío (default de DuckDB)
+	OrderNulls string
+	// Measures permite varias agregaciones en el mismo query. Si está vacío
+	// se usa Agg/VarAgg como una sola medida con alias total
+	Measures []Measure
+	// ExcludeNulls descarta las filas con NULL en las columnas agrupadas o agregadas
+	ExcludeNulls bool
+	// NullCount agrega null_count: filas del grupo con NULL en alguna columna agregada
+	NullCount bool
 }
 
-func (m *Manager) GetAggregatedData(ctx context.Context, uuid string, params AggregationParams) ([]map[string]interface{}, error) {
+// Alias de la columna con el conteo de nulos por grupo
+const nullCountAlias = "null_count"
+
+// nullableColumns retorna las columnas agregadas por las medidas, sin repetir
+func (p AggregationParams) nullableColumns() []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, measure := range p.measures() {
+		if measure.VarAgg != "" && !seen[measure.VarAgg] {
+			seen[measure.VarAgg] = true
+			columns = append(columns, measure.VarAgg)
+		}
+	}
+	return columns
+}
+
+// Measure es una agregación con su alias en el resultado
+type Measure struct {
+	Agg    string
+	VarAgg string
+	Alias  string
+}
+
+// HavingCondition filtra los grupos según el valor de una medida,
+// p.ej. {"op": ">", "value": 100}. Measure es el alias de la medida (default total)
+type HavingCondition struct {
+	Op      string  `json:"op"`
+	Value   float64 `json:"value"`
+	Measure string  `json:"measure,omitempty"`
+}
+
+// measures retorna las medidas a calcular, incluyendo el caso de una sola agregación
+func (p AggregationParams) measures() []Measure {
+	if len(p.Measures) == 0 {
+		return []Measure{{Agg: p.Agg, VarAgg: p.VarAgg, Alias: "total"}}
+	}
+
+	measures := make([]Measure, len(p.Measures))
+	for i, measure := range p.Measures {
+		if measure.Alias == "" {
+			measure.Alias = strings.ToLower(measure.Agg)
+			if measure.VarAgg != "" {
+				measure.Alias += "_" + measure.VarAgg
+			}
+		}
+		measures[i] = measure
+	}
+	return measures
+}
+
+// havingMeasure retorna el alias sobre el que aplica el HAVING
+func (h *HavingCondition) havingMeasure() string {
+	if h.Measure == "" {
+		return "total"
+	}
+	return h.Measure
+}
+
+// Operadores permitidos en HAVING
+var havingOperators = map[string]string{
+	">":  ">",
+	">=": ">=",
+	"<":  "<",
+	"<=": "<=",
+	"=":  "=",
+	"!=": "<>",
+}
+
+// GetAggregatedData obtiene los datos agregados. truncated indica que el
+// resultado se cortó en el máximo de filas
+func (m *Manager) GetAggregatedData(ctx context.Context, uuid string, params AggregationParams) (data []map[string]interface{}, truncated bool, err error) {
+	rows, err := m.QueryAggregatedRows(ctx, uuid, params)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	// Convertir a slice de maps
+	return m.rowsToMaps(rows)
+}
+
+// QueryAggregatedRows ejecuta la agregación y retorna los rows sin
+// materializarlos, conservando el orden de las columnas.
+// El llamador es responsable de cerrar los rows.
+func (m *Manager) QueryAggregatedRows(ctx context.Context, uuid string, params AggregationParams) (*sql.Rows, error) {
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
 	// Obtener conexión db
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
 		return nil, err
 	}
 
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateAggregationParams(ctx, conn, params); err != nil {
+		return nil, err
+	}
+
+	m.recordFilterUsage(uuid, params.Filters, types)
+
 	// Construir query de agregación
-	query, args := m.buildAggregationQuery(params)
+	query, args := m.buildAggregationQuery(params, types)
 
 	// Ejecutar query
 	rows, err := conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error ejecutando agregación: %w", err)
 	}
-	defer rows.Close()
+	return rows, nil
+}
 
-	// Convertir a slice de maps
-	return m.rowsToMaps(rows)
+// validateAggregationParams valida columnas y operadores de la agregación
+func (m *Manager) validateAggregationParams(ctx context.Context, conn *sql.DB, params AggregationParams) error {
+	columns := append([]string{}, params.GroupBy...)
+	aliases := make(map[string]bool)
+	for _, measure := range params.measures() {
+		if measure.Alias == "" {
+			return fmt.Errorf("%w: medida sin agg ni alias", ErrInvalidParams)
+		}
+		if measure.VarAgg != "" {
+			columns = append(columns, measure.VarAgg)
+		}
+		if strings.Contains(measure.Alias, `"`) {
+			return fmt.Errorf("%w: alias inválido %q", ErrInvalidParams, measure.Alias)
+		}
+		if aliases[measure.Alias] || (params.NullCount && measure.Alias == nullCountAlias) {
+			return fmt.Errorf("%w: alias duplicado %q", ErrInvalidParams, measure.Alias)
+		}
+		aliases[measure.Alias] = true
+	}
+	if err := m.validateColumns(ctx, conn, columns); err != nil {
+		return err
+	}
+	if err := validateNullsOrder(params.OrderNulls); err != nil {
+		return err
+	}
+
+	// Solo se ordena por una columna agrupada o una medida del resultado
+	if params.OrderBy != "" {
+		orderable := aliases[params.OrderBy] || (params.NullCount && params.OrderBy == nullCountAlias)
+		for _, col := range params.GroupBy {
+			orderable = orderable || col == params.OrderBy
+		}
+		if !orderable {
+			return fmt.Errorf("%w: order_by %q debe ser una columna de group_by o una medida", ErrInvalidParams, params.OrderBy)
+		}
+	}
+
+	if params.Having != nil {
+		if _, ok := havingOperators[params.Having.Op]; !ok {
+			return fmt.Errorf("%w: operador having inválido %q", ErrInvalidParams, params.Having.Op)
+		}
+		if !aliases[params.Having.havingMeasure()] {
+			return fmt.Errorf("%w: medida having desconocida %q", ErrInvalidParams, params.Having.havingMeasure())
+		}
+	}
+	return nil
 }
 
-// buildAggregationQuery construye query SQL de agregación
-func (m *Manager) buildAggregationQuery(params AggregationParams) (string, []interface{}) {
+// buildAggregationQuery construye query SQL de agregación; types son los tipos
+// de las columnas filtradas, de filterTypes
+func (m *Manager) buildAggregationQuery(params AggregationParams, types columnTypes) (string, []interface{}) {
 	var query strings.Builder
 	args := []interface{}{}
 
@@ -58,39 +214,37 @@ func (m *Manager) buildAggregationQuery(params AggregationParams) (string, []int
 		query.WriteString(", ")
 	}
 
-	// Funciones de agregación
-	aggFunc := m.buildAggregationFunction(params.Agg, params.VarAgg)
-	query.WriteString(aggFunc)
-	query.WriteString(" as total")
+	// Funciones de agregación, una por medida
+	measures := params.measures()
+	measureCols := make([]string, len(measures))
+	for i, measure := range measures {
+		aggFunc := m.buildAggregationFunction(measure.Agg, measure.VarAgg)
+		measureCols[i] = fmt.Sprintf(`%s as "%s"`, aggFunc, measure.Alias)
+	}
+	query.WriteString(strings.Join(measureCols, ", "))
+
+	// Conteo de nulos en las columnas agregadas
+	if params.NullCount {
+		nullChecks := []string{"false"}
+		for _, col := range params.nullableColumns() {
+			nullChecks = append(nullChecks, fmt.Sprintf(`"%s" IS NULL`, col))
+		}
+		query.WriteString(fmt.Sprintf(`, COUNT(*) FILTER (WHERE %s) as "%s"`, strings.Join(nullChecks, " OR "), nullCountAlias))
+	}
 
 	// FROM clause (filtros)
 	query.WriteString(" FROM data")
 
 	// WHERE clause (filtros)
-	if len(params.Filters) > 0 {
+	if len(params.Filters) > 0 || params.ExcludeNulls {
 		query.WriteString(" WHERE ")
-		whereClauses := []string{}
-
-		for key, value := range params.Filters {
-			if value == nil || value == "" || value == "Todas" {
-				continue
-			}
+		whereClauses, filterArgs := m.buildFilterConditions(params.Filters, types)
+		args = append(args, filterArgs...)
 
-			safekey := fmt.Sprintf(`"%s"`, key)
-
-			//  Si es un array, usar IN
-			if arr, ok := value.([]interface{}); ok {
-				if len(arr) > 0 {
-					placeholders := make([]string, len(arr))
-					for i, v := range arr {
-						args = append(args, v)
-						placeholders[i] = "?"
-					}
-					whereClauses = append(whereClauses, fmt.Sprintf("%s IN (%s)", safekey, strings.Join(placeholders, ", ")))
-				}
-			} else {
-				whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", safekey))
-				args = append(args, value)
+		// Sin nulos en las columnas agrupadas ni agregadas
+		if params.ExcludeNulls {
+			for _, col := range append(append([]string{}, params.GroupBy...), params.nullableColumns()...) {
+				whereClauses = append(whereClauses, fmt.Sprintf(`"%s" IS NOT NULL`, col))
 			}
 		}
 
@@ -113,6 +267,14 @@ func (m *Manager) buildAggregationQuery(params AggregationParams) (string, []int
 		query.WriteString(strings.Join(groupCols, ", "))
 	}
 
+	// HAVING clause, se aplica sobre el alias de la medida (total por default)
+	if params.Having != nil {
+		if op, ok := havingOperators[params.Having.Op]; ok {
+			query.WriteString(fmt.Sprintf(` HAVING "%s" %s ?`, params.Having.havingMeasure(), op))
+			args = append(args, params.Having.Value)
+		}
+	}
+
 	// ORDER BY clause
 	if params.OrderBy != "" {
 		query.WriteString(fmt.Sprintf(" ORDER BY \"%s\"", params.OrderBy))
@@ -125,9 +287,10 @@ func (m *Manager) buildAggregationQuery(params AggregationParams) (string, []int
 		// Por defecto ordenar por la primera columna de agrupación
 		query.WriteString(" ORDER BY 1")
 	} else {
-		// Si no hay GROUP BY, ordenar por total descendente
-		query.WriteString(" ORDER BY total DESC")
+		// Si no hay GROUP BY, ordenar por la primera medida descendente
+		query.WriteString(fmt.Sprintf(` ORDER BY "%s" DESC`, measures[0].Alias))
 	}
+	query.WriteString(nullsOrder(params.OrderNulls))
 
 	// LIMIT clauses
 	if params.Limit > 0 {
@@ -144,6 +307,11 @@ func (m *Manager) buildAggregationFunction(agg, varAgg string) string {
 	switch agg {
 	case "count":
 		return "COUNT(*)"
+	case "count_distinct", "distinct":
+		if varAgg == "" {
+			return "COUNT(*)" // Fallback
+		}
+		return fmt.Sprintf(`COUNT(DISTINCT "%s")`, varAgg)
 	case "sum":
 		if varAgg == "" {
 			return "COUNT(*)" // Fallback
@@ -211,23 +379,39 @@ func (m *Manager) formatDateColumn(col, format string) string {
 	}
 }
 
-// GetStats obtiene estadísticas descriptivas de una columna
-func (m *Manager) GetStats(ctx context.Context, uuid, column string, filters map[string]interface{}) (map[string]interface{}, error) {
+// GetStats obtiene estadísticas descriptivas de una columna. Con approx la
+// mediana y los cuartiles se estiman con APPROX_QUANTILE, mucho más rápido en
+// datasets grandes a cambio de un error acotado
+func (m *Manager) GetStats(ctx context.Context, uuid, column string, filters map[string]interface{}, approx bool) (map[string]interface{}, error) {
+	if err := m.validateFilters(filters); err != nil {
+		return nil, err
+	}
+
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
 		return nil, err
 	}
 
+	types, err := m.filterTypes(ctx, conn, filters)
+	if err != nil {
+		return nil, err
+	}
+
 	// Construir WHERE clause
 	whereClause := "WHERE 1=1"
-	args := []interface{}{}
+	conditions, args := m.buildFilterConditions(filters, types)
+	for _, condition := range conditions {
+		whereClause += " AND " + condition
+	}
 
-	for key, value := range filters {
-		if value == nil || value == "" || value == "Todas" {
-			continue
-		}
-		whereClause += fmt.Sprintf(` AND "%s" = ? `, key)
-		args = append(args, value)
+	// Cuantiles exactos o aproximados
+	median := fmt.Sprintf(`MEDIAN("%s")`, column)
+	q25 := fmt.Sprintf(`PERCENTILE_CONT(0.25) WITHIN GROUP (ORDER BY "%s")`, column)
+	q75 := fmt.Sprintf(`PERCENTILE_CONT(0.75) WITHIN GROUP (ORDER BY "%s")`, column)
+	if approx {
+		median = fmt.Sprintf(`APPROX_QUANTILE("%s", 0.5)`, column)
+		q25 = fmt.Sprintf(`APPROX_QUANTILE("%s", 0.25)`, column)
+		q75 = fmt.Sprintf(`APPROX_QUANTILE("%s", 0.75)`, column)
 	}
 
 	// Query para estadísticas
@@ -238,13 +422,13 @@ func (m *Manager) GetStats(ctx context.Context, uuid, column string, filters map
 			MIN("%s") as min,
 			MAX("%s") as max,
 			AVG("%s") as mean,
-			MEDIAN("%s") as median,
+			%s as median,
 			STDDEV("%s") as stddev,
-			PERCENTILE_CONT(0.25) WITHIN GROUP (ORDER BY "%s") as q25,
-			PERCENTILE_CONT(0.75) WITHIN GROUP (ORDER BY "%s") as q75
+			%s as q25,
+			%s as q75
 		FROM  data
 		%s
-	`, column, column, column, column, column, column, column, column, whereClause)
+	`, column, column, column, column, median, column, q25, q75, whereClause)
 
 	row := conn.QueryRowContext(ctx, query, args...)
 
@@ -286,40 +470,61 @@ func (m *Manager) GetStats(ctx context.Context, uuid, column string, filters map
 		"q25":            stats.Q25,
 		"q75":            stats.Q75,
 		"iqr":            stats.Q75 - stats.Q25,
+		"approximate":    approx,
 	}, nil
 }
 
-// GetTopValues obtienen los N valores más  frecuentes de una columna
-func (m *Manager) GetTopValues(ctx context.Context, uuid, column string, limit int, filters map[string]interface{}) ([]map[string]interface{}, error) {
+// Etiqueta con la que se reportan los NULL en GetTopValues
+const nullLabel = "Sin dato"
+
+// GetTopValues obtienen los N valores más  frecuentes de una columna.
+// Con includeNulls los NULL se cuentan como una categoría más, etiquetada como "Sin dato"
+func (m *Manager) GetTopValues(ctx context.Context, uuid, column string, limit int, filters map[string]interface{}, includeNulls bool) ([]map[string]interface{}, error) {
+	if err := m.validateFilters(filters); err != nil {
+		return nil, err
+	}
+
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
 		return nil, err
 	}
 
+	types, err := m.filterTypes(ctx, conn, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{column}); err != nil {
+		return nil, err
+	}
+
 	// Construir WHERE clause
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
+	conditions, args := m.buildFilterConditions(filters, types)
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
 
-	for key, value := range filters {
-		if value == nil || value == "" || value == "Todas" {
-			continue
-		}
-		whereClause += fmt.Sprintf(` AND "%s" = ?`, key)
-		args = append(args, value)
+	// Con NULL incluidos el valor se reporta como texto para poder etiquetarlo
+	// y is_null distingue la categoría de un texto igual a la etiqueta
+	valueExpr := fmt.Sprintf(`"%s" as value`, column)
+	if includeNulls {
+		valueExpr = fmt.Sprintf(`COALESCE(CAST("%s" AS VARCHAR), '%s') as value, "%s" IS NULL as is_null`, column, nullLabel, column)
 	}
 
-	//  Query
+	//  Query; el porcentaje es sobre todas las filas filtradas
 	query := fmt.Sprintf(`
 		SELECT
-			%s as value,
+			%s,
 			COUNT(*) as count,
 			COUNT(*) * 100.0 / (SELECT COUNT(*) FROM data %s) as percentage
 		FROM data
 		%s
 		GROUP BY "%s"
 		ORDER BY count DESC
-		LIMIT %d 
-	`, column, whereClause, whereClause, column, limit)
+		LIMIT %d
+	`, valueExpr, whereClause, whereClause, column, limit)
+	args = append(args, args...)
 
 	rows, err := conn.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -327,94 +532,151 @@ func (m *Manager) GetTopValues(ctx context.Context, uuid, column string, limit i
 	}
 	defer rows.Close()
 
-	return m.rowsToMaps(rows)
+	// El LIMIT ya acota el top; cortado en el máximo de filas es un top más corto
+	data, _, err := m.rowsToMaps(rows)
+	return data, err
 }
 
-// GetTimeSeries obtiene serie temporal agregada
-func (m *Manager) GetTimeSeries(ctx context.Context, uuid, dateColumn, valueColumn, aggFunc string, filters map[string]interface{}) ([]map[string]interface{}, error) {
-	params := AggregationParams{
-		Filters:    filters,
-		Agg:        aggFunc,
-		VarAgg:     valueColumn,
-		GroupBy:    []string{dateColumn},
-		DateFormat: "day",
-		OrderBy:    dateColumn,
-		OrderDir:   "asc",
+// Máximo de puntos en la ventana del promedio móvil
+const maxMovingAverageWindow = 366
+
+// Granularidades de una serie temporal, con los nombres que acepta formatDateColumn
+var timeSeriesGranularities = map[string]bool{
+	"day": true, "dia": true,
+	"week": true, "semana": true,
+	"month": true, "mes": true,
+	"quarter": true, "trimestre": true,
+	"year": true, "año": true,
+	"yearmonth": true, "año-mes": true,
+}
+
+// TimeSeriesParams define una serie temporal agregada
+type TimeSeriesParams struct {
+	DateColumn  string                 `json:"date_column"`
+	ValueColumn string                 `json:"value_column"`
+	Agg         string                 `json:"agg"`
+	Granularity string                 `json:"granularity"`
+	Filters     map[string]interface{} `json:"filters"`
+	// MaxPoints > 0 reduce la serie a ese número de puntos preservando su forma (LTTB)
+	MaxPoints int `json:"max_points"`
+	// Window > 0 agrega a cada punto moving_avg, el promedio de los últimos
+	// Window puntos (incluido el actual)
+	Window int `json:"window"`
+}
+
+// GetTimeSeries obtiene serie temporal agregada por la granularidad indicada (default día).
+// La columna de fecha debe pasar la heurística de getDateColumns.
+func (m *Manager) GetTimeSeries(ctx context.Context, uuid string, ts TimeSeriesParams) ([]map[string]interface{}, error) {
+	params, err := m.timeSeriesAggregation(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	// La respuesta es la lista de puntos, sin lugar para truncated; una serie
+	// cortada conserva sus primeros periodos
+	var series []map[string]interface{}
+	if ts.Window > 0 {
+		series, _, err = m.getMovingAverage(ctx, uuid, params, ts.Window)
+	} else {
+		series, _, err = m.GetAggregatedData(ctx, uuid, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ts.MaxPoints > 0 {
+		series = downsampleLTTB(series, ts.DateColumn, params.measures()[0].Alias, ts.MaxPoints)
+	}
+	return series, nil
+}
+
+// timeSeriesAggregation valida la serie y arma la agregación por fecha, en orden ascendente
+func (m *Manager) timeSeriesAggregation(ts TimeSeriesParams) (AggregationParams, error) {
+	if ts.Granularity == "" {
+		ts.Granularity = "day"
+	}
+	if !timeSeriesGranularities[strings.ToLower(ts.Granularity)] {
+		return AggregationParams{}, fmt.Errorf("%w: granularidad inválida %q", ErrInvalidParams, ts.Granularity)
+	}
+	if len(m.getDateColumns([]ColumnInfo{{Name: ts.DateColumn}})) == 0 {
+		return AggregationParams{}, fmt.Errorf("%w: %q no es una columna de fecha", ErrInvalidParams, ts.DateColumn)
 	}
-	return m.GetAggregatedData(ctx, uuid, params)
+
+	return AggregationParams{
+		Filters:    ts.Filters,
+		Agg:        ts.Agg,
+		VarAgg:     ts.ValueColumn,
+		GroupBy:    []string{ts.DateColumn},
+		DateFormat: ts.Granularity,
+		OrderBy:    ts.DateColumn,
+		OrderDir:   "asc",
+	}, nil
 }
 
-// GetCrossTab obtiene tabla cruzada (pivot)
-func (m *Manager) GetCrossTab(ctx context.Context, uuid, rowVar, colVar, valueVar, aggFunc string, filters map[string]interface{}) ([]map[string]interface{}, error) {
+// getMovingAverage calcula la agregación de una serie y su promedio móvil
+// con una función de ventana sobre la serie ordenada
+func (m *Manager) getMovingAverage(ctx context.Context, uuid string, params AggregationParams, window int) (data []map[string]interface{}, truncated bool, err error) {
+	if window > maxMovingAverageWindow {
+		return nil, false, fmt.Errorf("%w: la ventana máxima es %d puntos", ErrInvalidParams, maxMovingAverageWindow)
+	}
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, false, err
+	}
+
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	// Construir WHERE clause
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, false, err
+	}
 
-	for key, value := range filters {
-		if value == nil || value == "" || value == "Todas" {
-			continue
-		}
-		whereClause += fmt.Sprintf(` AND "%s" = ?`, key)
-		args = append(args, value)
-	}
-
-	// Determinar función de agregación
-	aggFunction := "COUNT(*)"
-	if aggFunc != "" && aggFunc != "count" && valueVar != "" {
-		switch strings.ToLower(aggFunc) {
-		case "sum":
-			aggFunction = fmt.Sprintf(`SUM("%s")`, valueVar)
-		case "avg", "mean":
-			aggFunction = fmt.Sprintf(`AVG("%s")`, valueVar)
-		case "min":
-			aggFunction = fmt.Sprintf(`MIN("%s")`, valueVar)
-		case "max":
-			aggFunction = fmt.Sprintf(`MAX("%s")`, valueVar)
-		}
+	if err := m.validateAggregationParams(ctx, conn, params); err != nil {
+		return nil, false, err
 	}
 
-	// Query para crosstab usando PIVOT
+	m.recordFilterUsage(uuid, params.Filters, types)
+
+	aggQuery, args := m.buildAggregationQuery(params, types)
 	query := fmt.Sprintf(`
-		SELECT 
-			"%s" as row_value,
-			"%s" as col_value,
-			%s as value
-		FROM data
-		%s
-		GROUP BY "%s", "%s"
-		ORDER BY "%s", "%s"
-	`, rowVar, colVar, aggFunction, whereClause, rowVar, colVar, rowVar, colVar)
+		SELECT *,
+			AVG("%s") OVER (ORDER BY "%s" ROWS BETWEEN %d PRECEDING AND CURRENT ROW) as moving_avg
+		FROM (%s) series
+		ORDER BY "%s"
+	`, params.measures()[0].Alias, params.OrderBy, window-1, aggQuery, params.OrderBy)
 
 	rows, err := conn.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, false, fmt.Errorf("error calculando promedio móvil: %w", err)
 	}
 	defer rows.Close()
+
 	return m.rowsToMaps(rows)
 }
 
 // GetPercentiles obtiene percentiles de una distribución
 func (m *Manager) GetPercentiles(ctx context.Context, uuid, column string, percentiles []float64, filters map[string]interface{}) (map[string]float64, error) {
+	if err := m.validateFilters(filters); err != nil {
+		return nil, err
+	}
+
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
 		return nil, err
 	}
 
+	types, err := m.filterTypes(ctx, conn, filters)
+	if err != nil {
+		return nil, err
+	}
+
 	// Construir WHERE clause
 	whereClause := "WHERE 1=1"
-	args := []interface{}{}
-
-	for key, value := range filters {
-		if value == nil || value == "" || value == "Todas" {
-			continue
-		}
-		whereClause += fmt.Sprintf(` AND "%s" = ?`, key)
-		args = append(args, value)
+	conditions, args := m.buildFilterConditions(filters, types)
+	for _, condition := range conditions {
+		whereClause += " AND " + condition
 	}
 
 	results := make(map[string]float64)
@@ -441,21 +703,25 @@ func (m *Manager) GetPercentiles(ctx context.Context, uuid, column string, perce
 
 // GetCorrelation calcula correlación entre dos variables
 func (m *Manager) GetCorrelation(ctx context.Context, uuid, col1, col2 string, filters map[string]interface{}) (float64, error) {
+	if err := m.validateFilters(filters); err != nil {
+		return 0.0, err
+	}
+
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
 		return 0.0, err
 	}
 
+	types, err := m.filterTypes(ctx, conn, filters)
+	if err != nil {
+		return 0.0, err
+	}
+
 	// Construir WHERE clause
 	whereClause := "WHERE 1=1"
-	args := []interface{}{}
-
-	for key, value := range filters {
-		if value == nil || value == "" || value == "Todas" {
-			continue
-		}
-		whereClause += fmt.Sprintf(` AND "%s" = ?`, key)
-		args = append(args, value)
+	conditions, args := m.buildFilterConditions(filters, types)
+	for _, condition := range conditions {
+		whereClause += " AND " + condition
 	}
 
 	query := fmt.Sprintf(`
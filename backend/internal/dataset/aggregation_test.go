@@ -0,0 +1,474 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// rowsByKey indexa filas de una agregación por el valor de una columna
+func rowsByKey(rows []map[string]interface{}, column string) map[interface{}]map[string]interface{} {
+	indexed := make(map[interface{}]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		indexed[row[column]] = row
+	}
+	return indexed
+}
+
+// toFloat convierte un valor numérico de DuckDB a float64
+func toFloat(t *testing.T, value interface{}) float64 {
+	t.Helper()
+	switch v := value.(type) {
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	}
+	t.Fatalf("valor %v (%T) no es numérico", value, value)
+	return 0
+}
+
+func TestAggregationMultipleMeasures(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	rows, _, err := m.GetAggregatedData(context.Background(), "ventas", AggregationParams{
+		GroupBy: []string{"region"},
+		Measures: []Measure{
+			{Agg: "sum", VarAgg: "monto"},
+			{Agg: "count"},
+			{Agg: "avg", VarAgg: "monto", Alias: "promedio"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetAggregatedData: %v", err)
+	}
+
+	norte := rowsByKey(rows, "region")["Norte"]
+	if norte == nil {
+		t.Fatalf("falta el grupo Norte en %v", rows)
+	}
+	for alias, want := range map[string]float64{"sum_monto": 30, "count": 2, "promedio": 15} {
+		if got := toFloat(t, norte[alias]); got != want {
+			t.Errorf("%s = %v, se esperaba %v", alias, got, want)
+		}
+	}
+}
+
+func TestAggregationRejectsInvalidMeasures(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name     string
+		measures []Measure
+	}{
+		{"medida vacía", []Measure{{Agg: "count"}, {}}},
+		{"alias duplicado", []Measure{{Agg: "count"}, {Agg: "sum", VarAgg: "monto", Alias: "count"}}},
+		{"alias con comillas", []Measure{{Agg: "count", Alias: `x" FROM data --`}}},
+		{"columna inexistente", []Measure{{Agg: "sum", VarAgg: "no_existe"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.GetAggregatedData(context.Background(), "ventas", AggregationParams{
+				GroupBy:  []string{"region"},
+				Measures: tt.measures,
+			})
+			if !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("err = %v, se esperaba ErrInvalidParams", err)
+			}
+		})
+	}
+}
+
+func TestAggregationOrderNulls(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	for _, tt := range []struct {
+		nulls     string
+		nullFirst bool
+	}{{"first", true}, {"last", false}} {
+		t.Run(tt.nulls, func(t *testing.T) {
+			rows, _, err := m.GetAggregatedData(context.Background(), "ventas", AggregationParams{
+				Agg:        "count",
+				GroupBy:    []string{"region"},
+				OrderBy:    "region",
+				OrderDir:   "asc",
+				OrderNulls: tt.nulls,
+			})
+			if err != nil {
+				t.Fatalf("GetAggregatedData: %v", err)
+			}
+			if len(rows) != 4 {
+				t.Fatalf("grupos = %d, se esperaban 4", len(rows))
+			}
+			first, last := rows[0]["region"], rows[len(rows)-1]["region"]
+			if tt.nullFirst && first != nil {
+				t.Errorf("primer grupo = %v, se esperaba NULL", first)
+			}
+			if !tt.nullFirst && last != nil {
+				t.Errorf("último grupo = %v, se esperaba NULL", last)
+			}
+		})
+	}
+}
+
+func TestAggregationOrderByValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	valid := []AggregationParams{
+		{Agg: "count", GroupBy: []string{"region"}, OrderBy: "region"},
+		{Agg: "count", GroupBy: []string{"region"}, OrderBy: "total"},
+		{Agg: "sum", VarAgg: "monto", GroupBy: []string{"region"}, OrderBy: "null_count", NullCount: true},
+		{GroupBy: []string{"region"}, Measures: []Measure{{Agg: "max", VarAgg: "monto"}}, OrderBy: "max_monto"},
+	}
+	for _, params := range valid {
+		if _, _, err := m.GetAggregatedData(ctx, "ventas", params); err != nil {
+			t.Errorf("order_by %q: %v", params.OrderBy, err)
+		}
+	}
+
+	invalid := []AggregationParams{
+		{Agg: "count", GroupBy: []string{"region"}, OrderBy: "monto"},
+		{Agg: "count", GroupBy: []string{"region"}, OrderBy: "no_existe"},
+		{Agg: "count", GroupBy: []string{"region"}, OrderBy: `region" DESC, (SELECT 1) --`},
+		{Agg: "count", GroupBy: []string{"region"}, OrderBy: "null_count"},
+		{Agg: "count", GroupBy: []string{"region"}, OrderNulls: "middle"},
+	}
+	for _, params := range invalid {
+		if _, _, err := m.GetAggregatedData(ctx, "ventas", params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("order_by %q, nulls %q: err = %v, se esperaba ErrInvalidParams", params.OrderBy, params.OrderNulls, err)
+		}
+	}
+}
+
+// encuestaSQL tiene una columna mayormente nula
+var encuestaSQL = []string{
+	`CREATE TABLE data (zona VARCHAR, comentario VARCHAR)`,
+	`INSERT INTO data VALUES
+		('A', NULL), ('A', NULL), ('A', NULL), ('A', NULL), ('B', NULL),
+		('B', NULL), ('B', NULL), ('A', 'bien'), ('B', 'bien'), ('B', 'mal')`,
+}
+
+func TestTopValuesIncludeNulls(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "encuesta", encuestaSQL...)
+	ctx := context.Background()
+
+	rows, err := m.GetTopValues(ctx, "encuesta", "comentario", 10, nil, true)
+	if err != nil {
+		t.Fatalf("GetTopValues: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("valores = %d, se esperaban 3: %v", len(rows), rows)
+	}
+	top := rows[0]
+	if top["value"] != nullLabel || top["is_null"] != true || toFloat(t, top["count"]) != 7 || toFloat(t, top["percentage"]) != 70 {
+		t.Errorf("primer valor = %v, se esperaba %q con 7 filas (70%%)", top, nullLabel)
+	}
+	if rows[1]["is_null"] != false {
+		t.Errorf("is_null de %v debería ser false", rows[1])
+	}
+}
+
+func TestTopValuesWithoutIncludeNulls(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "encuesta", encuestaSQL...)
+	ctx := context.Background()
+
+	// Sin include_nulls se mantiene la respuesta de siempre: el grupo NULL
+	// sin etiquetar y el porcentaje sobre todas las filas filtradas
+	rows, err := m.GetTopValues(ctx, "encuesta", "comentario", 10, map[string]interface{}{"zona": "B"}, false)
+	if err != nil {
+		t.Fatalf("GetTopValues: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("valores = %d, se esperaban 3: %v", len(rows), rows)
+	}
+	total := 0.0
+	for _, row := range rows {
+		if _, ok := row["is_null"]; ok {
+			t.Errorf("sin include_nulls no debería haber is_null: %v", row)
+		}
+		total += toFloat(t, row["percentage"])
+	}
+	if rows[0]["value"] != nil || toFloat(t, rows[0]["count"]) != 3 {
+		t.Errorf("primer valor = %v, se esperaba NULL con 3 filas", rows[0])
+	}
+	if total < 99.99 || total > 100.01 {
+		t.Errorf("los porcentajes suman %v, se esperaba 100", total)
+	}
+}
+
+func TestAggregationHavingCountDistinct(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	// Norte y Sur venden dos productos distintos; Centro solo tiene NULL
+	rows, _, err := m.GetAggregatedData(context.Background(), "ventas", AggregationParams{
+		GroupBy: []string{"region"},
+		Measures: []Measure{
+			{Agg: "count_distinct", VarAgg: "producto", Alias: "productos"},
+			{Agg: "sum", VarAgg: "monto"},
+		},
+		Having:   &HavingCondition{Op: ">=", Value: 2, Measure: "productos"},
+		OrderBy:  "region",
+		OrderDir: "asc",
+	})
+	if err != nil {
+		t.Fatalf("GetAggregatedData: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["region"] != "Norte" || rows[1]["region"] != "Sur" {
+		t.Fatalf("grupos = %v, se esperaban Norte y Sur", rows)
+	}
+	if got := toFloat(t, rows[0]["productos"]); got != 2 {
+		t.Errorf("productos de Norte = %v, se esperaba 2", got)
+	}
+}
+
+func TestBuildAggregationQueryHavingCountDistinct(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	query, args := m.buildAggregationQuery(AggregationParams{
+		Agg:     "count_distinct",
+		VarAgg:  "municipio",
+		GroupBy: []string{"estado"},
+		Having:  &HavingCondition{Op: ">", Value: 10},
+	}, nil)
+
+	for _, want := range []string{`COUNT(DISTINCT "municipio") as "total"`, `GROUP BY 1`, `HAVING "total" > ?`} {
+		if !strings.Contains(query, want) {
+			t.Errorf("el query no contiene %q:\n%s", want, query)
+		}
+	}
+	if len(args) != 1 || args[0] != 10.0 {
+		t.Errorf("args = %v, se esperaba [10]", args)
+	}
+}
+
+func TestAggregationHavingOperators(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	// Totales por región: Norte 30, Sur 70, Centro 50 y NULL 60
+	tests := []struct {
+		op      string
+		value   float64
+		regions int
+	}{
+		{">", 50, 2},
+		{">=", 50, 3},
+		{"<", 50, 1},
+		{"<=", 50, 2},
+		{"=", 70, 1},
+		{"!=", 70, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			rows, _, err := m.GetAggregatedData(context.Background(), "ventas", AggregationParams{
+				Agg:     "sum",
+				VarAgg:  "monto",
+				GroupBy: []string{"region"},
+				Having:  &HavingCondition{Op: tt.op, Value: tt.value},
+			})
+			if err != nil {
+				t.Fatalf("GetAggregatedData: %v", err)
+			}
+			if len(rows) != tt.regions {
+				t.Errorf("total %s %v: %d grupos, se esperaban %d: %v", tt.op, tt.value, len(rows), tt.regions, rows)
+			}
+		})
+	}
+}
+
+func TestAggregationHavingRejectsInvalid(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	for _, having := range []*HavingCondition{
+		{Op: "; DROP TABLE data", Value: 1},
+		{Op: "LIKE", Value: 1},
+		{Op: ">", Value: 1, Measure: "no_existe"},
+	} {
+		_, _, err := m.GetAggregatedData(context.Background(), "ventas", AggregationParams{
+			Agg:     "count",
+			GroupBy: []string{"region"},
+			Having:  having,
+		})
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("having %+v: err = %v, se esperaba ErrInvalidParams", having, err)
+		}
+	}
+}
+
+// serieSQL tiene cinco días; el primero con dos filas
+var serieSQL = []string{
+	`CREATE TABLE data (fecha DATE, monto INTEGER)`,
+	`INSERT INTO data VALUES
+		('2024-01-01', 4), ('2024-01-01', 6),
+		('2024-01-02', 20),
+		('2024-01-03', 60),
+		('2024-01-04', 0),
+		('2024-01-05', 40)`,
+}
+
+func TestTimeSeriesMovingAverage(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "serie", serieSQL...)
+
+	ts := TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum", Window: 3}
+	series, err := m.GetTimeSeries(context.Background(), "serie", ts)
+	if err != nil {
+		t.Fatalf("GetTimeSeries: %v", err)
+	}
+
+	// Sumas diarias 10, 20, 60, 0, 40; los primeros puntos promedian lo disponible
+	params, _ := m.timeSeriesAggregation(ts)
+	alias := params.measures()[0].Alias
+	totals := []float64{10, 20, 60, 0, 40}
+	want := []float64{10, 15, 30, 80.0 / 3, 100.0 / 3}
+	if len(series) != len(want) {
+		t.Fatalf("%d puntos, se esperaban %d", len(series), len(want))
+	}
+	for i, row := range series {
+		total, _ := toFloat64(row[alias])
+		avg, _ := toFloat64(row["moving_avg"])
+		if total != totals[i] || math.Abs(avg-want[i]) > 1e-9 {
+			t.Errorf("punto %d: total %v, moving_avg %v; se esperaban %v y %v", i, total, avg, totals[i], want[i])
+		}
+	}
+}
+
+func TestTimeSeriesMovingAverageWindowLimit(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "serie", serieSQL...)
+
+	ts := TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum", Window: maxMovingAverageWindow + 1}
+	if _, err := m.GetTimeSeries(context.Background(), "serie", ts); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("err = %v, se esperaba ErrInvalidParams", err)
+	}
+
+	// Sin ventana no se agrega moving_avg
+	ts.Window = 0
+	series, err := m.GetTimeSeries(context.Background(), "serie", ts)
+	if err != nil {
+		t.Fatalf("GetTimeSeries: %v", err)
+	}
+	if _, ok := series[0]["moving_avg"]; ok {
+		t.Errorf("punto = %v, no se esperaba moving_avg sin ventana", series[0])
+	}
+}
+
+// nulosSQL tiene un NULL en monto en Norte y Sur, y una fila sin región
+var nulosSQL = []string{
+	`CREATE TABLE data (region VARCHAR, monto INTEGER)`,
+	`INSERT INTO data VALUES ('Norte', 10), ('Norte', NULL), ('Sur', 30), ('Sur', NULL), (NULL, 40)`,
+}
+
+func TestAggregationExcludeNulls(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "nulos", nulosSQL...)
+	ctx := context.Background()
+	measures := []Measure{{Agg: "count", Alias: "filas"}, {Agg: "sum", VarAgg: "monto", Alias: "suma"}}
+
+	rows, _, err := m.GetAggregatedData(ctx, "nulos", AggregationParams{GroupBy: []string{"region"}, Measures: measures})
+	if err != nil {
+		t.Fatalf("GetAggregatedData: %v", err)
+	}
+	groups := rowsByKey(rows, "region")
+	if len(groups) != 3 || toFloat(t, groups["Norte"]["filas"]) != 2 {
+		t.Errorf("grupos = %v, se esperaban 3 con 2 filas en Norte", rows)
+	}
+
+	rows, _, err = m.GetAggregatedData(ctx, "nulos", AggregationParams{GroupBy: []string{"region"}, Measures: measures, ExcludeNulls: true})
+	if err != nil {
+		t.Fatalf("GetAggregatedData con exclude_nulls: %v", err)
+	}
+	groups = rowsByKey(rows, "region")
+	if _, ok := groups[nil]; ok || len(groups) != 2 {
+		t.Errorf("grupos = %v, se esperaba descartar el grupo sin región", rows)
+	}
+	for _, region := range []string{"Norte", "Sur"} {
+		if got := toFloat(t, groups[region]["filas"]); got != 1 {
+			t.Errorf("%s: %v filas, se esperaba 1 sin el monto NULL", region, got)
+		}
+	}
+}
+
+func TestAggregationNullCount(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "nulos", nulosSQL...)
+
+	rows, _, err := m.GetAggregatedData(context.Background(), "nulos", AggregationParams{
+		GroupBy:   []string{"region"},
+		Agg:       "sum",
+		VarAgg:    "monto",
+		NullCount: true,
+	})
+	if err != nil {
+		t.Fatalf("GetAggregatedData: %v", err)
+	}
+	groups := rowsByKey(rows, "region")
+	for region, want := range map[interface{}]float64{"Norte": 1, "Sur": 1, nil: 0} {
+		if got := toFloat(t, groups[region][nullCountAlias]); got != want {
+			t.Errorf("%v: null_count = %v, se esperaba %v", region, got, want)
+		}
+	}
+
+	// null_count es un nombre reservado para las medidas
+	_, _, err = m.GetAggregatedData(context.Background(), "nulos", AggregationParams{
+		GroupBy:   []string{"region"},
+		Measures:  []Measure{{Agg: "count", Alias: nullCountAlias}},
+		NullCount: true,
+	})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("alias null_count: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestStatsApproxQuantiles(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "uniforme", `CREATE TABLE data AS SELECT (i * 7919) % 10000 as valor FROM range(10000) t(i)`)
+	ctx := context.Background()
+
+	exact, err := m.GetStats(ctx, "uniforme", "valor", nil, false)
+	if err != nil {
+		t.Fatalf("GetStats exacto: %v", err)
+	}
+	approx, err := m.GetStats(ctx, "uniforme", "valor", nil, true)
+	if err != nil {
+		t.Fatalf("GetStats aproximado: %v", err)
+	}
+
+	if exact["approximate"] != false || approx["approximate"] != true {
+		t.Errorf("approximate = %v/%v, se esperaba false/true", exact["approximate"], approx["approximate"])
+	}
+	// Los cuantiles aproximados quedan dentro del 1% del rango
+	for _, key := range []string{"median", "q25", "q75"} {
+		diff := math.Abs(toFloat(t, exact[key]) - toFloat(t, approx[key]))
+		if diff > 100 {
+			t.Errorf("%s: exacto %v, aproximado %v, diferencia mayor a la tolerancia", key, exact[key], approx[key])
+		}
+	}
+	// El resto de las estadísticas no cambia
+	for _, key := range []string{"count", "min", "max", "mean"} {
+		if fmt.Sprint(exact[key]) != fmt.Sprint(approx[key]) {
+			t.Errorf("%s: exacto %v, aproximado %v, se esperaban iguales", key, exact[key], approx[key])
+		}
+	}
+	if got := toFloat(t, exact["median"]); got != 4999.5 {
+		t.Errorf("mediana exacta = %v, se esperaba 4999.5", got)
+	}
+}
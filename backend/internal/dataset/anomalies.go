@@ -0,0 +1,99 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// Ventana por defecto para detectar anomalías (una semana de puntos diarios)
+	defaultAnomalyWindow = 7
+	// Desviaciones estándar por defecto a partir de las que un punto es anómalo
+	defaultAnomalyThreshold = 3.0
+)
+
+// AnomalyParams define la serie a analizar. Window es el número de puntos
+// previos contra los que se compara cada punto y Threshold cuántas
+// desviaciones estándar lo hacen anómalo
+type AnomalyParams struct {
+	TimeSeriesParams
+	Threshold float64 `json:"threshold"`
+}
+
+// GetAnomalies retorna la serie temporal con, para cada punto, el promedio
+// móvil y la desviación estándar de los Window puntos anteriores, la
+// desviación del punto respecto al promedio, su z-score y si es anómalo.
+// La ventana no incluye al punto, para que un pico no infle su propia
+// referencia. Con historia constante cualquier cambio cuenta como anomalía.
+// truncated indica que la serie se cortó en el máximo de filas.
+func (m *Manager) GetAnomalies(ctx context.Context, uuid string, p AnomalyParams) (data []map[string]interface{}, truncated bool, err error) {
+	if p.Window <= 0 {
+		p.Window = defaultAnomalyWindow
+	}
+	if p.Window < 2 {
+		return nil, false, fmt.Errorf("%w: la ventana mínima es 2 puntos", ErrInvalidParams)
+	}
+	if p.Window > maxMovingAverageWindow {
+		return nil, false, fmt.Errorf("%w: la ventana máxima es %d puntos", ErrInvalidParams, maxMovingAverageWindow)
+	}
+	if p.Threshold < 0 {
+		return nil, false, fmt.Errorf("%w: threshold debe ser positivo", ErrInvalidParams)
+	}
+	if p.Threshold == 0 {
+		p.Threshold = defaultAnomalyThreshold
+	}
+
+	params, err := m.timeSeriesAggregation(p.TimeSeriesParams)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, false, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := m.validateAggregationParams(ctx, conn, params); err != nil {
+		return nil, false, err
+	}
+
+	m.recordFilterUsage(uuid, params.Filters, types)
+
+	value := params.measures()[0].Alias
+	aggQuery, args := m.buildAggregationQuery(params, types)
+	query := fmt.Sprintf(`
+		SELECT * EXCLUDE (history),
+			"%[1]s" - moving_avg as deviation,
+			CASE WHEN moving_std > 0 THEN ("%[1]s" - moving_avg) / moving_std END as z_score,
+			COALESCE(history >= 2 AND (
+				ABS("%[1]s" - moving_avg) > %[2]s * moving_std
+				OR (moving_std = 0 AND "%[1]s" <> moving_avg)
+			), false) as anomaly
+		FROM (
+			SELECT *,
+				AVG("%[1]s") OVER w as moving_avg,
+				STDDEV_SAMP("%[1]s") OVER w as moving_std,
+				COUNT("%[1]s") OVER w as history
+			FROM (%[3]s) series
+			WINDOW w AS (ORDER BY "%[4]s" ROWS BETWEEN %[5]d PRECEDING AND 1 PRECEDING)
+		) windowed
+		ORDER BY "%[4]s"
+	`, value, strconv.FormatFloat(p.Threshold, 'f', -1, 64), aggQuery, params.OrderBy, p.Window)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error detectando anomalías: %w", err)
+	}
+	defer rows.Close()
+
+	return m.rowsToMaps(rows)
+}
@@ -0,0 +1,92 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+// anomaliaSQL alterna 10 y 12 por día, con un pico sembrado el día 15
+var anomaliaSQL = []string{
+	`CREATE TABLE data AS
+		SELECT DATE '2024-01-01' + i::INTEGER as fecha,
+			CASE WHEN i = 14 THEN 100 WHEN i % 2 = 0 THEN 10 ELSE 12 END as monto
+		FROM range(20) t(i)`,
+}
+
+func TestAnomaliesSeededSpike(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "anomalia", anomaliaSQL...)
+
+	series, _, err := m.GetAnomalies(context.Background(), "anomalia", AnomalyParams{
+		TimeSeriesParams: TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum"},
+	})
+	if err != nil {
+		t.Fatalf("GetAnomalies: %v", err)
+	}
+	if len(series) != 20 {
+		t.Fatalf("%d puntos, se esperaban 20", len(series))
+	}
+
+	for i, row := range series {
+		if anomaly := row["anomaly"] == true; anomaly != (i == 14) {
+			t.Errorf("punto %d: anomaly = %v, z_score = %v", i, row["anomaly"], row["z_score"])
+		}
+	}
+
+	// La referencia del pico son los 7 días previos, sin incluirlo: cuatro 12 y tres 10
+	spike := series[14]
+	avg, _ := toFloat64(spike["moving_avg"])
+	deviation, _ := toFloat64(spike["deviation"])
+	if math.Abs(avg-78.0/7) > 1e-9 || math.Abs(deviation-(100-78.0/7)) > 1e-9 {
+		t.Errorf("pico: moving_avg %v, deviation %v; se esperaban 78/7 y 100 - 78/7", avg, deviation)
+	}
+	if z, ok := toFloat64(spike["z_score"]); !ok || z < 3 {
+		t.Errorf("pico: z_score = %v, se esperaba mayor a 3", spike["z_score"])
+	}
+	// El primer punto no tiene historia
+	if series[0]["moving_avg"] != nil || series[0]["anomaly"] != false {
+		t.Errorf("primer punto = %v, se esperaba sin promedio ni anomalía", series[0])
+	}
+}
+
+func TestAnomaliesThreshold(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "anomalia", anomaliaSQL...)
+
+	// Con un umbral enorme el pico deja de ser anómalo
+	series, _, err := m.GetAnomalies(context.Background(), "anomalia", AnomalyParams{
+		TimeSeriesParams: TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum"},
+		Threshold:        1000,
+	})
+	if err != nil {
+		t.Fatalf("GetAnomalies: %v", err)
+	}
+	for i, row := range series {
+		if row["anomaly"] != false {
+			t.Errorf("punto %d marcado como anomalía con umbral 1000", i)
+		}
+	}
+}
+
+func TestAnomaliesValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "anomalia", anomaliaSQL...)
+	ctx := context.Background()
+
+	base := TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum"}
+	tests := []struct {
+		name   string
+		params AnomalyParams
+	}{
+		{"ventana de un punto", AnomalyParams{TimeSeriesParams: TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum", Window: 1}}},
+		{"ventana demasiado grande", AnomalyParams{TimeSeriesParams: TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum", Window: maxMovingAverageWindow + 1}}},
+		{"umbral negativo", AnomalyParams{TimeSeriesParams: base, Threshold: -1}},
+	}
+	for _, tt := range tests {
+		if _, _, err := m.GetAnomalies(ctx, "anomalia", tt.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
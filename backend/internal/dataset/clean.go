@@ -0,0 +1,208 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Reglas máximas por preview de limpieza
+	maxCleanRules = 50
+	// Filas de ejemplo del diff, por defecto y máximo
+	defaultCleanSample = 20
+	maxCleanSample     = 200
+)
+
+// CleanRule es una corrección sobre una columna de texto. Op puede ser trim,
+// upper, lower o replace (reemplaza From por To)
+type CleanRule struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// CleanPreviewParams son las reglas a previsualizar. Las reglas de una misma
+// columna se aplican en el orden en que vienen
+type CleanPreviewParams struct {
+	Rules      []CleanRule            `json:"rules"`
+	Filters    map[string]interface{} `json:"filters"`
+	SampleSize int                    `json:"sample_size"`
+}
+
+// CleanChange es el valor de una celda antes y después de las reglas
+type CleanChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// CleanPreview es el resultado del preview: cuántas filas cambiarían (en total
+// y por columna) y un diff de ejemplo con solo las columnas que cambian
+type CleanPreview struct {
+	AffectedRows int64                    `json:"affected_rows"`
+	Columns      map[string]int64         `json:"columns"`
+	Sample       []map[string]CleanChange `json:"sample"`
+	// Truncated indica que el diff de ejemplo se cortó en el máximo de filas
+	Truncated bool `json:"truncated"`
+}
+
+// cleanExpression aplica una regla sobre la expresión SQL de la columna
+func cleanExpression(expr string, rule CleanRule) (string, []interface{}, error) {
+	switch strings.ToLower(rule.Op) {
+	case "trim":
+		return fmt.Sprintf("TRIM(%s)", expr), nil, nil
+	case "upper":
+		return fmt.Sprintf("UPPER(%s)", expr), nil, nil
+	case "lower":
+		return fmt.Sprintf("LOWER(%s)", expr), nil, nil
+	case "replace":
+		if rule.From == "" {
+			return "", nil, fmt.Errorf("%w: replace en %q requiere from", ErrInvalidParams, rule.Column)
+		}
+		return fmt.Sprintf("REPLACE(%s, ?, ?)", expr), []interface{}{rule.From, rule.To}, nil
+	}
+	return "", nil, fmt.Errorf("%w: regla de limpieza inválida %q", ErrInvalidParams, rule.Op)
+}
+
+// PreviewClean aplica las reglas de limpieza en un SELECT, sin modificar el
+// dataset, y reporta las filas que cambiarían
+func (m *Manager) PreviewClean(ctx context.Context, uuid string, params CleanPreviewParams) (*CleanPreview, error) {
+	if len(params.Rules) == 0 {
+		return nil, fmt.Errorf("%w: se requiere al menos una regla", ErrInvalidParams)
+	}
+	if len(params.Rules) > maxCleanRules {
+		return nil, fmt.Errorf("%w: máximo %d reglas", ErrInvalidParams, maxCleanRules)
+	}
+	if params.SampleSize <= 0 {
+		params.SampleSize = defaultCleanSample
+	}
+	if params.SampleSize > maxCleanSample {
+		params.SampleSize = maxCleanSample
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	filterTypes, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col.Name] = col.Type
+	}
+
+	// Componer las reglas por columna, en orden de aparición
+	var order []string
+	expressions := map[string]string{}
+	exprArgs := map[string][]interface{}{}
+	for _, rule := range params.Rules {
+		colType, ok := types[rule.Column]
+		if !ok {
+			return nil, fmt.Errorf("%w: columna inexistente %q", ErrInvalidParams, rule.Column)
+		}
+		if !isTextType(colType) {
+			return nil, fmt.Errorf("%w: la columna %q no es de texto (%s)", ErrInvalidParams, rule.Column, colType)
+		}
+
+		expr, ok := expressions[rule.Column]
+		if !ok {
+			order = append(order, rule.Column)
+			expr = fmt.Sprintf(`"%s"`, rule.Column)
+		}
+		expr, ruleArgs, err := cleanExpression(expr, rule)
+		if err != nil {
+			return nil, err
+		}
+		expressions[rule.Column] = expr
+		exprArgs[rule.Column] = append(exprArgs[rule.Column], ruleArgs...)
+	}
+
+	// Los placeholders del SELECT van antes que los del WHERE
+	selectCols := make([]string, 0, len(order)*2)
+	changed := make([]string, len(order))
+	args := []interface{}{}
+	for i, col := range order {
+		selectCols = append(selectCols,
+			fmt.Sprintf(`"%s" as before_%d`, col, i),
+			fmt.Sprintf(`%s as after_%d`, expressions[col], i))
+		args = append(args, exprArgs[col]...)
+		changed[i] = fmt.Sprintf("before_%d IS DISTINCT FROM after_%d", i, i)
+	}
+
+	conditions, filterArgs := m.buildFilterConditions(params.Filters, filterTypes)
+	args = append(args, filterArgs...)
+	whereClause := "WHERE 1=1"
+	for _, condition := range conditions {
+		whereClause += " AND " + condition
+	}
+
+	inner := fmt.Sprintf("SELECT %s FROM data %s", strings.Join(selectCols, ", "), whereClause)
+	anyChanged := strings.Join(changed, " OR ")
+
+	// Conteo total y por columna en un solo recorrido
+	counts := make([]string, 0, len(order)+1)
+	counts = append(counts, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", anyChanged))
+	for _, cond := range changed {
+		counts = append(counts, fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", cond))
+	}
+	countQuery := fmt.Sprintf("SELECT %s FROM (%s) t", strings.Join(counts, ", "), inner)
+
+	values := make([]int64, len(counts))
+	dest := make([]interface{}, len(counts))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := conn.QueryRowContext(ctx, countQuery, args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("error contando filas afectadas: %w", err)
+	}
+
+	preview := &CleanPreview{
+		AffectedRows: values[0],
+		Columns:      make(map[string]int64, len(order)),
+		Sample:       []map[string]CleanChange{},
+	}
+	for i, col := range order {
+		preview.Columns[col] = values[i+1]
+	}
+	if preview.AffectedRows == 0 {
+		return preview, nil
+	}
+
+	sampleQuery := fmt.Sprintf("SELECT * FROM (%s) t WHERE %s LIMIT %d", inner, anyChanged, params.SampleSize)
+	rows, err := conn.QueryContext(ctx, sampleQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo diff de ejemplo: %w", err)
+	}
+	defer rows.Close()
+
+	sample, truncated, err := m.rowsToMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range sample {
+		diff := map[string]CleanChange{}
+		for i, col := range order {
+			before, after := row[fmt.Sprintf("before_%d", i)], row[fmt.Sprintf("after_%d", i)]
+			if before != after {
+				diff[col] = CleanChange{Before: before, After: after}
+			}
+		}
+		preview.Sample = append(preview.Sample, diff)
+	}
+	preview.Truncated = truncated
+
+	return preview, nil
+}
@@ -0,0 +1,123 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// sucioSQL tiene nombres con espacios y mayúsculas inconsistentes
+var sucioSQL = []string{
+	`CREATE TABLE data (nombre VARCHAR, ciudad VARCHAR, monto INTEGER)`,
+	`INSERT INTO data VALUES
+		('  ana ', 'CDMX', 1),
+		('LUIS', 'cdmx', 2),
+		('MARTA', 'CDMX', 3),
+		(' pedro', 'Puebla', 4),
+		(NULL, 'CDMX', 5)`,
+}
+
+func TestPreviewCleanTrimUpper(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "sucio", sucioSQL...)
+	ctx := context.Background()
+
+	preview, err := m.PreviewClean(ctx, "sucio", CleanPreviewParams{
+		Rules: []CleanRule{
+			{Column: "nombre", Op: "trim"},
+			{Column: "nombre", Op: "upper"},
+			{Column: "ciudad", Op: "upper"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PreviewClean: %v", err)
+	}
+
+	// Cambian ana (nombre), la fila de LUIS (ciudad) y la de pedro (ambas)
+	if preview.AffectedRows != 3 {
+		t.Errorf("affected_rows = %d, se esperaban 3", preview.AffectedRows)
+	}
+	if preview.Columns["nombre"] != 2 || preview.Columns["ciudad"] != 2 {
+		t.Errorf("columns = %v, se esperaban 2 cambios en nombre y 2 en ciudad", preview.Columns)
+	}
+	if len(preview.Sample) != 3 {
+		t.Fatalf("sample = %v, se esperaban 3 filas", preview.Sample)
+	}
+
+	// El diff solo trae las columnas que cambian, con las reglas compuestas en orden
+	var ana map[string]CleanChange
+	for _, diff := range preview.Sample {
+		if change, ok := diff["nombre"]; ok && change.Before == "  ana " {
+			ana = diff
+		}
+	}
+	if ana == nil || ana["nombre"].After != "ANA" {
+		t.Fatalf("sample = %v, se esperaba '  ana ' -> 'ANA'", preview.Sample)
+	}
+	if _, ok := ana["ciudad"]; ok {
+		t.Errorf("diff = %v, ciudad no cambia en esa fila", ana)
+	}
+
+	// El dataset no se modifica
+	rows, _, err := m.GetFilteredData(ctx, "sucio", FilterParams{Filters: map[string]interface{}{"nombre": "  ana "}})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("filas = %d, el valor original debe seguir en el dataset", len(rows))
+	}
+}
+
+func TestPreviewCleanWithFiltersAndSample(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "sucio", sucioSQL...)
+	ctx := context.Background()
+
+	preview, err := m.PreviewClean(ctx, "sucio", CleanPreviewParams{
+		Rules:      []CleanRule{{Column: "nombre", Op: "lower"}},
+		Filters:    map[string]interface{}{"monto": map[string]interface{}{"op": "<=", "value": 4}},
+		SampleSize: 1,
+	})
+	if err != nil {
+		t.Fatalf("PreviewClean: %v", err)
+	}
+	// Con monto <= 4 cambian LUIS y MARTA; el ejemplo se limita a una fila
+	if preview.AffectedRows != 2 || len(preview.Sample) != 1 {
+		t.Errorf("preview = %+v, se esperaban 2 filas afectadas y 1 de ejemplo", preview)
+	}
+
+	// Sin cambios no hay diff de ejemplo
+	preview, err = m.PreviewClean(ctx, "sucio", CleanPreviewParams{
+		Rules:   []CleanRule{{Column: "nombre", Op: "replace", From: "zzz", To: "y"}},
+		Filters: map[string]interface{}{"ciudad": "CDMX"},
+	})
+	if err != nil {
+		t.Fatalf("PreviewClean sin cambios: %v", err)
+	}
+	if preview.AffectedRows != 0 || len(preview.Sample) != 0 {
+		t.Errorf("preview = %+v, no se esperaban cambios", preview)
+	}
+}
+
+func TestPreviewCleanValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "sucio", sucioSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		rules []CleanRule
+	}{
+		{"sin reglas", nil},
+		{"demasiadas reglas", make([]CleanRule, maxCleanRules+1)},
+		{"columna inexistente", []CleanRule{{Column: "apellido", Op: "trim"}}},
+		{"columna numérica", []CleanRule{{Column: "monto", Op: "trim"}}},
+		{"regla desconocida", []CleanRule{{Column: "nombre", Op: "capitalize"}}},
+		{"replace sin from", []CleanRule{{Column: "nombre", Op: "replace", To: "x"}}},
+	}
+	for _, tt := range tests {
+		if _, err := m.PreviewClean(ctx, "sucio", CleanPreviewParams{Rules: tt.rules}); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
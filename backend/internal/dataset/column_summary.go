@@ -0,0 +1,63 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+)
+
+// ColumnSummary resume una columna según su rol en el esquema: las numéricas
+// traen Stats (GetStats) y las demás TopValues (GetTopValues)
+type ColumnSummary struct {
+	Column        string                   `json:"column"`
+	Type          string                   `json:"type"`
+	Role          string                   `json:"role"`
+	DistinctCount int64                    `json:"distinct_count"`
+	NullCount     int64                    `json:"null_count"`
+	Stats         map[string]interface{}   `json:"stats,omitempty"`
+	TopValues     []map[string]interface{} `json:"top_values,omitempty"`
+}
+
+// GetColumnSummary retorna el resumen de una columna, eligiendo estadísticas
+// o valores más frecuentes con el mismo rol inferido que GetSchema. limit
+// aplica a los valores más frecuentes.
+func (m *Manager) GetColumnSummary(ctx context.Context, uuid, column string, limit int) (*ColumnSummary, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *ColumnInfo
+	for i := range columns {
+		if columns[i].Name == column {
+			info = &columns[i]
+			break
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("%w: columna %s no existe", ErrInvalidParams, column)
+	}
+
+	summary := &ColumnSummary{Column: column, Type: info.Type}
+	query := fmt.Sprintf(`SELECT COUNT(DISTINCT "%s"), COUNT(*) - COUNT("%s") FROM data`, column, column)
+	if err := conn.QueryRowContext(ctx, query).Scan(&summary.DistinctCount, &summary.NullCount); err != nil {
+		return nil, fmt.Errorf("error contando valores: %w", err)
+	}
+
+	isDateName := len(m.getDateColumns([]ColumnInfo{*info})) > 0
+	summary.Role = inferRole(*info, summary.DistinctCount, isDateName)
+
+	if summary.Role == RoleNumeric {
+		summary.Stats, err = m.GetStats(ctx, uuid, column, nil, false)
+	} else {
+		summary.TopValues, err = m.GetTopValues(ctx, uuid, column, limit, nil, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,77 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestColumnSummaryNumeric(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	summary, err := m.GetColumnSummary(context.Background(), "ventas", "monto", 5)
+	if err != nil {
+		t.Fatalf("GetColumnSummary: %v", err)
+	}
+	if summary.Role != RoleNumeric || summary.Type != "INTEGER" {
+		t.Errorf("rol = %s, tipo = %s; se esperaba numérica INTEGER", summary.Role, summary.Type)
+	}
+	if summary.DistinctCount != 6 || summary.NullCount != 0 {
+		t.Errorf("distinct = %d, nulls = %d; se esperaban 6 y 0", summary.DistinctCount, summary.NullCount)
+	}
+	if summary.Stats == nil || summary.TopValues != nil {
+		t.Fatalf("resumen = %+v, se esperaban solo estadísticas", summary)
+	}
+	if toFloat(t, summary.Stats["min"]) != 10 || toFloat(t, summary.Stats["max"]) != 60 || toFloat(t, summary.Stats["mean"]) != 35 {
+		t.Errorf("stats = %v, se esperaba min 10, max 60 y media 35", summary.Stats)
+	}
+}
+
+func TestColumnSummaryCategorical(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	summary, err := m.GetColumnSummary(context.Background(), "ventas", "producto", 2)
+	if err != nil {
+		t.Fatalf("GetColumnSummary: %v", err)
+	}
+	if summary.Role != RoleCategorical {
+		t.Errorf("rol = %s, se esperaba categórica", summary.Role)
+	}
+	if summary.DistinctCount != 3 || summary.NullCount != 1 {
+		t.Errorf("distinct = %d, nulls = %d; se esperaban 3 y 1", summary.DistinctCount, summary.NullCount)
+	}
+	if summary.Stats != nil || len(summary.TopValues) != 2 {
+		t.Fatalf("resumen = %+v, se esperaban solo 2 valores frecuentes", summary)
+	}
+	if top := summary.TopValues[0]; top["value"] != "Pan" || toFloat(t, top["count"]) != 3 {
+		t.Errorf("primer valor = %v, se esperaba Pan con 3", top)
+	}
+}
+
+func TestColumnSummaryDate(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	// Las fechas no son numéricas: se resumen con valores frecuentes
+	summary, err := m.GetColumnSummary(context.Background(), "ventas", "fecha", 10)
+	if err != nil {
+		t.Fatalf("GetColumnSummary: %v", err)
+	}
+	if summary.Role != RoleDate || summary.Stats != nil || len(summary.TopValues) == 0 {
+		t.Errorf("resumen = %+v, se esperaba fecha con valores frecuentes", summary)
+	}
+	if summary.NullCount != 1 {
+		t.Errorf("nulls = %d, se esperaba 1", summary.NullCount)
+	}
+}
+
+func TestColumnSummaryUnknownColumn(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	if _, err := m.GetColumnSummary(context.Background(), "ventas", "precio", 5); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
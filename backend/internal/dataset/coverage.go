@@ -0,0 +1,179 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Límites de la matriz de cobertura
+	maxCoverageCategories = 500
+	maxCoveragePeriods    = 500
+)
+
+// CoverageParams define una matriz de cobertura: cuántas filas reporta cada
+// valor de Category en cada periodo de DateColumn truncada a Granularity
+// (default mes)
+type CoverageParams struct {
+	Category    string                 `json:"category"`
+	DateColumn  string                 `json:"date_column"`
+	Granularity string                 `json:"granularity"`
+	Filters     map[string]interface{} `json:"filters"`
+}
+
+// CoverageRow es la cobertura de una categoría. Counts va alineado con los
+// periodos de la matriz; Missing son los periodos sin filas a partir del
+// primero que reportó la categoría (huecos y periodos en que dejó de reportar)
+type CoverageRow struct {
+	Category interface{} `json:"category"`
+	Counts   []int64     `json:"counts"`
+	Present  int         `json:"present"`
+	Missing  []string    `json:"missing"`
+	Coverage float64     `json:"coverage"`
+}
+
+// GetCoverage calcula la matriz categoría × periodo con el conteo de filas.
+// Los periodos son los que tienen datos en cualquier categoría, así que un
+// periodo sin datos en ninguna no aparece.
+func (m *Manager) GetCoverage(ctx context.Context, uuid string, p CoverageParams) (map[string]interface{}, error) {
+	if p.Category == "" || p.DateColumn == "" {
+		return nil, fmt.Errorf("%w: category y date_column requeridas", ErrInvalidParams)
+	}
+	if p.Category == p.DateColumn {
+		return nil, fmt.Errorf("%w: category y date_column deben ser distintas", ErrInvalidParams)
+	}
+	if p.Category == "rows" {
+		return nil, fmt.Errorf("%w: la columna %q coincide con el conteo", ErrInvalidParams, p.Category)
+	}
+	if p.Granularity == "" {
+		p.Granularity = "month"
+	}
+
+	params, err := m.timeSeriesAggregation(TimeSeriesParams{
+		DateColumn:  p.DateColumn,
+		Granularity: p.Granularity,
+		Filters:     p.Filters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Las filas sin fecha o sin categoría no cuentan para ningún periodo
+	params.GroupBy = append(params.GroupBy, p.Category)
+	params.Measures = []Measure{{Agg: "count", Alias: "rows"}}
+	params.ExcludeNulls = true
+
+	if err := m.validateFilters(p.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, p.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{p.Category}); err != nil {
+		return nil, err
+	}
+
+	// Verificar la cardinalidad antes de agregar
+	conditions, args := m.buildFilterConditions(p.Filters, types)
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	var categoryCount int64
+	query := fmt.Sprintf(`SELECT COUNT(DISTINCT "%s") FROM data %s`, p.Category, where)
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&categoryCount); err != nil {
+		return nil, fmt.Errorf("error contando categorías: %w", err)
+	}
+	if categoryCount > maxCoverageCategories {
+		return nil, fmt.Errorf("%w: %s tiene %d valores, máximo %d categorías", ErrInvalidParams, p.Category, categoryCount, maxCoverageCategories)
+	}
+
+	data, truncated, err := m.GetAggregatedData(ctx, uuid, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Periodos con datos, en orden cronológico
+	periodSet := make(map[string]bool)
+	for _, record := range data {
+		periodSet[periodLabel(record[p.DateColumn])] = true
+	}
+	if len(periodSet) > maxCoveragePeriods {
+		return nil, fmt.Errorf("%w: %d periodos, máximo %d; usa una granularidad mayor", ErrInvalidParams, len(periodSet), maxCoveragePeriods)
+	}
+	periods := make([]string, 0, len(periodSet))
+	for period := range periodSet {
+		periods = append(periods, period)
+	}
+	sort.Strings(periods)
+	periodIndex := make(map[string]int, len(periods))
+	for i, period := range periods {
+		periodIndex[period] = i
+	}
+
+	// Una fila por categoría, en el orden de su etiqueta
+	rowIndex := make(map[string]*CoverageRow)
+	var keys []string
+	for _, record := range data {
+		key := crossTabLabel(record[p.Category])
+		row, ok := rowIndex[key]
+		if !ok {
+			row = &CoverageRow{Category: record[p.Category], Counts: make([]int64, len(periods))}
+			rowIndex[key] = row
+			keys = append(keys, key)
+		}
+		if count, ok := record["rows"].(int64); ok {
+			row.Counts[periodIndex[periodLabel(record[p.DateColumn])]] += count
+		}
+	}
+	sort.Strings(keys)
+
+	rows := make([]CoverageRow, 0, len(keys))
+	for _, key := range keys {
+		row := rowIndex[key]
+		row.Missing = []string{}
+		first := -1
+		for i, count := range row.Counts {
+			switch {
+			case count > 0:
+				row.Present++
+				if first < 0 {
+					first = i
+				}
+			case first >= 0:
+				row.Missing = append(row.Missing, periods[i])
+			}
+		}
+		if first >= 0 {
+			row.Coverage = float64(row.Present) / float64(len(periods)-first)
+		}
+		rows = append(rows, *row)
+	}
+
+	return map[string]interface{}{
+		"category":    p.Category,
+		"date_column": p.DateColumn,
+		"granularity": p.Granularity,
+		"periods":     periods,
+		"rows":        rows,
+		"truncated":   truncated,
+	}, nil
+}
+
+// periodLabel convierte el periodo truncado en una etiqueta ordenable
+func periodLabel(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("2006-01-02")
+	}
+	return crossTabLabel(value)
+}
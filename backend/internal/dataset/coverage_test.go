@@ -0,0 +1,102 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// coberturaSQL: Sonora no reporta en febrero y deja de reportar en abril;
+// Yucatán empieza en marzo
+var coberturaSQL = []string{
+	`CREATE TABLE data (estado VARCHAR, fecha DATE)`,
+	`INSERT INTO data VALUES
+		('Jalisco', '2024-01-03'), ('Jalisco', '2024-01-20'),
+		('Jalisco', '2024-02-10'), ('Jalisco', '2024-03-10'), ('Jalisco', '2024-04-10'),
+		('Sonora', '2024-01-15'), ('Sonora', '2024-03-15'),
+		('Yucatán', '2024-03-01'), ('Yucatán', '2024-04-30'),
+		(NULL, '2024-02-01'),
+		('Sonora', NULL)`,
+}
+
+func TestCoverageReportingGap(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "cobertura", coberturaSQL...)
+
+	result, err := m.GetCoverage(context.Background(), "cobertura", CoverageParams{Category: "estado", DateColumn: "fecha"})
+	if err != nil {
+		t.Fatalf("GetCoverage: %v", err)
+	}
+
+	periods := strings.Join(result["periods"].([]string), ",")
+	if periods != "2024-01-01,2024-02-01,2024-03-01,2024-04-01" {
+		t.Errorf("periods = %s, se esperaban los cuatro meses", periods)
+	}
+
+	want := []struct {
+		category string
+		counts   string
+		missing  string
+		coverage float64
+	}{
+		{"Jalisco", "[2 1 1 1]", "", 1},
+		{"Sonora", "[1 0 1 0]", "2024-02-01,2024-04-01", 0.5},
+		{"Yucatán", "[0 0 1 1]", "", 1},
+	}
+	rows := result["rows"].([]CoverageRow)
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %+v, se esperaban %d categorías sin la NULL", rows, len(want))
+	}
+	for i, row := range rows {
+		w := want[i]
+		if row.Category != w.category || fmt.Sprint(row.Counts) != w.counts ||
+			strings.Join(row.Missing, ",") != w.missing || row.Coverage != w.coverage {
+			t.Errorf("fila %d = %+v, se esperaba %+v", i, row, w)
+		}
+	}
+}
+
+func TestCoverageGranularityAndFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "cobertura", coberturaSQL...)
+
+	result, err := m.GetCoverage(context.Background(), "cobertura", CoverageParams{
+		Category:    "estado",
+		DateColumn:  "fecha",
+		Granularity: "quarter",
+		Filters:     map[string]interface{}{"estado": "Sonora"},
+	})
+	if err != nil {
+		t.Fatalf("GetCoverage: %v", err)
+	}
+	rows := result["rows"].([]CoverageRow)
+	if len(rows) != 1 || fmt.Sprint(rows[0].Counts) != "[2]" || len(rows[0].Missing) != 0 {
+		t.Errorf("rows = %+v, se esperaba Sonora con 2 filas en un trimestre", rows)
+	}
+}
+
+func TestCoverageValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "cobertura", coberturaSQL...)
+	writeDataset(t, m, "muchas", `CREATE TABLE data AS SELECT i as id, DATE '2024-01-01' as fecha FROM range(600) t(i)`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		uuid   string
+		params CoverageParams
+	}{
+		{"sin categoría", "cobertura", CoverageParams{DateColumn: "fecha"}},
+		{"misma columna", "cobertura", CoverageParams{Category: "fecha", DateColumn: "fecha"}},
+		{"categoría inexistente", "cobertura", CoverageParams{Category: "municipio", DateColumn: "fecha"}},
+		{"granularidad inválida", "cobertura", CoverageParams{Category: "estado", DateColumn: "fecha", Granularity: "siglo"}},
+		{"demasiadas categorías", "muchas", CoverageParams{Category: "id", DateColumn: "fecha"}},
+	}
+	for _, tt := range tests {
+		if _, err := m.GetCoverage(ctx, tt.uuid, tt.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Límites de cardinalidad de la tabla cruzada pivoteada
+	maxCrossTabRows    = 500
+	maxCrossTabColumns = 100
+	// Máximo de métricas por celda
+	maxCrossTabMetrics = 5
+)
+
+// Formas de salida de la tabla cruzada
+const (
+	// Una fila por combinación: row_value, col_value y las métricas (default)
+	CrossTabLong = "long"
+	// Matriz: una fila por valor de Row y una columna por valor de Column
+	CrossTabWide = "wide"
+	// Una fila por valor de Row con sus celdas anidadas por valor de Column
+	CrossTabNested = "nested"
+)
+
+// CrossTabParams define una tabla cruzada pivoteada con una o varias métricas por celda
+type CrossTabParams struct {
+	Row     string                 `json:"row"`
+	Column  string                 `json:"column"`
+	Metrics []Measure              `json:"metrics"`
+	Filters map[string]interface{} `json:"filters"`
+	Shape   string                 `json:"shape,omitempty"`
+}
+
+// GetCrossTab calcula la tabla cruzada de Row x Column en la forma pedida.
+// La forma larga (default) trae una fila por combinación con datos. En la forma
+// ancha cada valor de Column es una columna; con varias métricas las columnas se
+// llaman <valor>_<alias>. En la anidada cada fila trae sus celdas por valor de
+// Column, y cada celda anida sus métricas por alias.
+func (m *Manager) GetCrossTab(ctx context.Context, uuid string, params CrossTabParams) (map[string]interface{}, error) {
+	switch params.Shape {
+	case "":
+		params.Shape = CrossTabLong
+	case CrossTabLong, CrossTabWide, CrossTabNested:
+	default:
+		return nil, fmt.Errorf("%w: forma de tabla cruzada inválida %q", ErrInvalidParams, params.Shape)
+	}
+	if params.Row == "" || params.Column == "" {
+		return nil, fmt.Errorf("%w: columnas row y column requeridas", ErrInvalidParams)
+	}
+	if params.Row == params.Column {
+		return nil, fmt.Errorf("%w: row y column deben ser distintas", ErrInvalidParams)
+	}
+	if len(params.Metrics) == 0 {
+		params.Metrics = []Measure{{Agg: "count", Alias: "count"}}
+	}
+	if len(params.Metrics) > maxCrossTabMetrics {
+		return nil, fmt.Errorf("%w: máximo %d métricas por celda", ErrInvalidParams, maxCrossTabMetrics)
+	}
+
+	aggParams := AggregationParams{
+		Filters:  params.Filters,
+		GroupBy:  []string{params.Row, params.Column},
+		Measures: params.Metrics,
+	}
+	measures := aggParams.measures()
+	for _, measure := range measures {
+		if measure.Alias == params.Row || measure.Alias == params.Column {
+			return nil, fmt.Errorf("%w: el alias %q coincide con una columna de la tabla", ErrInvalidParams, measure.Alias)
+		}
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{params.Row, params.Column}); err != nil {
+		return nil, err
+	}
+
+	// Verificar la cardinalidad antes de agregar
+	conditions, args := m.buildFilterConditions(params.Filters, types)
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	var rowCount, colCount int64
+	query := fmt.Sprintf(`SELECT COUNT(DISTINCT "%s"), COUNT(DISTINCT "%s") FROM data %s`, params.Row, params.Column, where)
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&rowCount, &colCount); err != nil {
+		return nil, fmt.Errorf("error contando valores de la tabla cruzada: %w", err)
+	}
+	if rowCount > maxCrossTabRows {
+		return nil, fmt.Errorf("%w: %s tiene %d valores, máximo %d filas", ErrInvalidParams, params.Row, rowCount, maxCrossTabRows)
+	}
+	if colCount > maxCrossTabColumns {
+		return nil, fmt.Errorf("%w: %s tiene %d valores, máximo %d columnas", ErrInvalidParams, params.Column, colCount, maxCrossTabColumns)
+	}
+
+	data, truncated, err := m.GetAggregatedData(ctx, uuid, aggParams)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]string, len(measures))
+	for i, measure := range measures {
+		metrics[i] = measure.Alias
+	}
+	result := map[string]interface{}{
+		"row":       params.Row,
+		"column":    params.Column,
+		"metrics":   metrics,
+		"shape":     params.Shape,
+		"truncated": truncated,
+	}
+
+	if params.Shape == CrossTabLong {
+		long := make([]map[string]interface{}, len(data))
+		for i, record := range data {
+			entry := map[string]interface{}{
+				"row_value": record[params.Row],
+				"col_value": record[params.Column],
+			}
+			for _, alias := range metrics {
+				entry[alias] = record[alias]
+			}
+			long[i] = entry
+		}
+		result["rows"] = long
+		return result, nil
+	}
+
+	// Pivotear: una fila por valor de Row, conservando el orden del query
+	type pivotRow struct {
+		RowValue interface{}                       `json:"row_value"`
+		Cells    map[string]map[string]interface{} `json:"cells"`
+	}
+	var pivoted []*pivotRow
+	rowIndex := make(map[string]*pivotRow)
+	columnSet := make(map[string]bool)
+
+	for _, record := range data {
+		rowKey := crossTabLabel(record[params.Row])
+		row, ok := rowIndex[rowKey]
+		if !ok {
+			row = &pivotRow{RowValue: record[params.Row], Cells: make(map[string]map[string]interface{})}
+			rowIndex[rowKey] = row
+			pivoted = append(pivoted, row)
+		}
+
+		colKey := crossTabLabel(record[params.Column])
+		columnSet[colKey] = true
+
+		cell := make(map[string]interface{}, len(measures))
+		for _, measure := range measures {
+			cell[measure.Alias] = record[measure.Alias]
+		}
+		row.Cells[colKey] = cell
+	}
+
+	columns := make([]string, 0, len(columnSet))
+	for col := range columnSet {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	result["columns"] = columns
+
+	if params.Shape == CrossTabWide {
+		wide := make([]map[string]interface{}, len(pivoted))
+		for i, row := range pivoted {
+			entry := map[string]interface{}{"row_value": row.RowValue}
+			for _, col := range columns {
+				for _, alias := range metrics {
+					// Las combinaciones sin filas quedan en null
+					var value interface{}
+					if cell, ok := row.Cells[col]; ok {
+						value = cell[alias]
+					}
+					entry[wideColumnName(col, alias, len(metrics))] = value
+				}
+			}
+			wide[i] = entry
+		}
+		result["rows"] = wide
+		return result, nil
+	}
+
+	if pivoted == nil {
+		pivoted = []*pivotRow{}
+	}
+	result["rows"] = pivoted
+	return result, nil
+}
+
+// wideColumnName nombra la columna de la matriz para un valor de Column y una métrica
+func wideColumnName(colValue, alias string, metrics int) string {
+	if metrics == 1 {
+		return colValue
+	}
+	return colValue + "_" + alias
+}
+
+// crossTabLabel convierte el valor de una columna en la etiqueta de la celda
+func crossTabLabel(value interface{}) string {
+	if value == nil {
+		return nullLabel
+	}
+	return fmt.Sprint(value)
+}
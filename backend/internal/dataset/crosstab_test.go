@@ -0,0 +1,157 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// cruceSQL tiene dos filas en la celda Norte/Pan
+var cruceSQL = []string{
+	`CREATE TABLE data (region VARCHAR, producto VARCHAR, monto INTEGER)`,
+	`INSERT INTO data VALUES
+		('Norte', 'Pan', 10),
+		('Norte', 'Pan', 15),
+		('Norte', 'Leche', 20),
+		('Sur', 'Pan', 30)`,
+}
+
+// crossTabCells decodifica la forma anidada como la recibe el cliente:
+// celdas por fila y por columna, con sus métricas
+func crossTabCells(t *testing.T, result map[string]interface{}) map[string]map[string]map[string]interface{} {
+	t.Helper()
+	body, err := json.Marshal(result["rows"])
+	if err != nil {
+		t.Fatalf("error serializando filas: %v", err)
+	}
+	var rows []struct {
+		RowValue interface{}                       `json:"row_value"`
+		Cells    map[string]map[string]interface{} `json:"cells"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		t.Fatalf("error leyendo filas: %v", err)
+	}
+	cells := make(map[string]map[string]map[string]interface{})
+	for _, row := range rows {
+		cells[fmt.Sprint(row.RowValue)] = row.Cells
+	}
+	return cells
+}
+
+func TestCrossTabMultipleMetrics(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "cruce", cruceSQL...)
+
+	result, err := m.GetCrossTab(context.Background(), "cruce", CrossTabParams{
+		Row:    "region",
+		Column: "producto",
+		Shape:  CrossTabNested,
+		Metrics: []Measure{
+			{Agg: "count", Alias: "conteo"},
+			{Agg: "sum", VarAgg: "monto", Alias: "suma"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetCrossTab: %v", err)
+	}
+
+	cell := crossTabCells(t, result)["Norte"]["Pan"]
+	if fmt.Sprint(cell["conteo"]) != "2" || fmt.Sprint(cell["suma"]) != "25" {
+		t.Errorf("celda Norte/Pan = %v, se esperaba conteo 2 y suma 25", cell)
+	}
+	if cell := crossTabCells(t, result)["Sur"]["Leche"]; cell != nil {
+		t.Errorf("celda Sur/Leche = %v, no se esperaba celda sin filas", cell)
+	}
+	if got := fmt.Sprint(result["metrics"]); got != "[conteo suma]" {
+		t.Errorf("metrics = %s, se esperaba [conteo suma]", got)
+	}
+}
+
+func TestCrossTabLimits(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "cruce", cruceSQL...)
+	writeDataset(t, m, "ancho", `CREATE TABLE data AS SELECT i as id, i % 2 as par FROM range(600) t(i)`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		uuid   string
+		params CrossTabParams
+	}{
+		{"demasiadas filas", "ancho", CrossTabParams{Row: "id", Column: "par"}},
+		{"demasiadas columnas", "ancho", CrossTabParams{Row: "par", Column: "id"}},
+		{"demasiadas métricas", "cruce", CrossTabParams{Row: "region", Column: "producto", Metrics: make([]Measure, maxCrossTabMetrics+1)}},
+		{"alias repetido con columna", "cruce", CrossTabParams{Row: "region", Column: "producto", Metrics: []Measure{{Agg: "count", Alias: "region"}}}},
+	}
+	for _, tc := range tests {
+		if _, err := m.GetCrossTab(ctx, tc.uuid, tc.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tc.name, err)
+		}
+	}
+}
+
+func TestCrossTabShapes(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "cruce", cruceSQL...)
+	ctx := context.Background()
+	metrics := []Measure{{Agg: "sum", VarAgg: "monto", Alias: "suma"}}
+
+	// Formato largo (default): una fila por combinación con datos
+	long, err := m.GetCrossTab(ctx, "cruce", CrossTabParams{Row: "region", Column: "producto", Metrics: metrics})
+	if err != nil {
+		t.Fatalf("GetCrossTab largo: %v", err)
+	}
+	if long["shape"] != CrossTabLong {
+		t.Errorf("shape = %v, se esperaba la forma larga por default", long["shape"])
+	}
+	entries := long["rows"].([]map[string]interface{})
+	if len(entries) != 3 {
+		t.Fatalf("filas = %v, se esperaban 3 combinaciones", entries)
+	}
+	sums := make(map[string]string)
+	for _, entry := range entries {
+		sums[fmt.Sprint(entry["row_value"], "/", entry["col_value"])] = fmt.Sprint(entry["suma"])
+	}
+	if sums["Norte/Pan"] != "25" || sums["Norte/Leche"] != "20" || sums["Sur/Pan"] != "30" {
+		t.Errorf("sumas = %v, se esperaban Norte/Pan 25, Norte/Leche 20 y Sur/Pan 30", sums)
+	}
+
+	// Matriz: una columna por producto; Sur no tiene Leche
+	wide, err := m.GetCrossTab(ctx, "cruce", CrossTabParams{Row: "region", Column: "producto", Metrics: metrics, Shape: CrossTabWide})
+	if err != nil {
+		t.Fatalf("GetCrossTab ancho: %v", err)
+	}
+	if got := fmt.Sprint(wide["columns"]); got != "[Leche Pan]" {
+		t.Errorf("columns = %s, se esperaba [Leche Pan]", got)
+	}
+	matrix := make(map[string]map[string]interface{})
+	for _, row := range wide["rows"].([]map[string]interface{}) {
+		matrix[fmt.Sprint(row["row_value"])] = row
+	}
+	if fmt.Sprint(matrix["Norte"]["Pan"]) != "25" || fmt.Sprint(matrix["Norte"]["Leche"]) != "20" {
+		t.Errorf("fila Norte = %v, se esperaban Pan 25 y Leche 20", matrix["Norte"])
+	}
+	if value, ok := matrix["Sur"]["Leche"]; !ok || value != nil {
+		t.Errorf("fila Sur = %v, se esperaba Leche en null", matrix["Sur"])
+	}
+
+	// Con varias métricas las columnas se nombran <valor>_<alias>
+	wide, err = m.GetCrossTab(ctx, "cruce", CrossTabParams{
+		Row: "region", Column: "producto", Shape: CrossTabWide,
+		Metrics: []Measure{{Agg: "count", Alias: "conteo"}, {Agg: "sum", VarAgg: "monto", Alias: "suma"}},
+	})
+	if err != nil {
+		t.Fatalf("GetCrossTab ancho con dos métricas: %v", err)
+	}
+	for _, row := range wide["rows"].([]map[string]interface{}) {
+		if row["row_value"] == "Norte" && (fmt.Sprint(row["Pan_conteo"]) != "2" || fmt.Sprint(row["Pan_suma"]) != "25") {
+			t.Errorf("fila Norte = %v, se esperaban Pan_conteo 2 y Pan_suma 25", row)
+		}
+	}
+
+	if _, err := m.GetCrossTab(ctx, "cruce", CrossTabParams{Row: "region", Column: "producto", Shape: "diagonal"}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("forma inválida: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
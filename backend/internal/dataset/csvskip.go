@@ -0,0 +1,116 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+const (
+	// Key de Redis donde se persisten los preámbulos configurados por dataset
+	csvSkipRedisKey = "csv-skip"
+	// Líneas máximas de preámbulo configurables
+	maxCSVSkipRows = 100
+)
+
+// csvSkips guarda, por dataset, las líneas a saltar antes del encabezado del
+// CSV cuando la detección automática del preámbulo no acierta
+type csvSkips struct {
+	rows    map[string]int
+	mu      sync.Mutex
+	manager *Manager
+}
+
+func newCSVSkips(m *Manager) *csvSkips {
+	s := &csvSkips{
+		rows:    make(map[string]int),
+		manager: m,
+	}
+	s.load()
+	return s
+}
+
+// SetCSVSkip fija las líneas de preámbulo del CSV de un dataset y borra la
+// copia en cache para que se vuelva a cargar con el nuevo encabezado. Si hay
+// una descarga en curso el valor se aplica en la siguiente carga.
+func (m *Manager) SetCSVSkip(uuid string, skip int) error {
+	if skip < 0 || skip > maxCSVSkipRows {
+		return fmt.Errorf("%w: skip debe estar entre 0 y %d", ErrInvalidParams, maxCSVSkipRows)
+	}
+
+	m.csvSkips.mu.Lock()
+	m.csvSkips.rows[uuid] = skip
+	m.csvSkips.mu.Unlock()
+	m.csvSkips.save()
+
+	log.Printf("📄 Preámbulo de %s configurado en %d líneas", uuid, skip)
+	m.reloadWithNewSkip(uuid)
+	return nil
+}
+
+// RemoveCSVSkip vuelve a la detección automática del preámbulo. Retorna false
+// si el dataset no tenía un valor configurado.
+func (m *Manager) RemoveCSVSkip(uuid string) bool {
+	m.csvSkips.mu.Lock()
+	_, exists := m.csvSkips.rows[uuid]
+	delete(m.csvSkips.rows, uuid)
+	m.csvSkips.mu.Unlock()
+
+	if exists {
+		m.csvSkips.save()
+		m.reloadWithNewSkip(uuid)
+	}
+	return exists
+}
+
+// CSVSkip retorna las líneas de preámbulo configuradas para un dataset
+func (m *Manager) CSVSkip(uuid string) (int, bool) {
+	m.csvSkips.mu.Lock()
+	defer m.csvSkips.mu.Unlock()
+
+	skip, ok := m.csvSkips.rows[uuid]
+	return skip, ok
+}
+
+// reloadWithNewSkip invalida la copia en cache para que la siguiente consulta
+// cargue el CSV con el preámbulo nuevo
+func (m *Manager) reloadWithNewSkip(uuid string) {
+	if _, err := m.downloadManager.Invalidate(uuid); err != nil {
+		log.Printf("Warning: %s se recargará con el preámbulo nuevo en la siguiente descarga: %v", uuid, err)
+	}
+}
+
+// save persiste los preámbulos configurados en Redis
+func (s *csvSkips) save() {
+	s.mu.Lock()
+	rows := make(map[string]int, len(s.rows))
+	for uuid, skip := range s.rows {
+		rows[uuid] = skip
+	}
+	s.mu.Unlock()
+
+	if err := s.manager.cacheManager.SetToRedis(csvSkipRedisKey, rows, 0); err != nil {
+		log.Printf("Warning: error guardando preámbulos de CSV: %v", err)
+	}
+}
+
+// load recupera los preámbulos guardados en Redis
+func (s *csvSkips) load() {
+	data, found := s.manager.cacheManager.GetFromRedis(csvSkipRedisKey)
+	if !found {
+		return
+	}
+
+	var rows map[string]int
+	if err := json.Unmarshal(data, &rows); err != nil {
+		log.Printf("Warning: preámbulos de CSV inválidos en Redis: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uuid, skip := range rows {
+		s.rows[uuid] = skip
+	}
+}
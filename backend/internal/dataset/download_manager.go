@@ -3,9 +3,15 @@ package dataset
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"visor-datos-abiertos-go/internal/metrics"
 )
 
 type DownloadStatus string
@@ -29,28 +35,116 @@ type DownloadJob struct {
 	FileSize   int64          `json:"file_size"`
 	Downloaded int64          `json:"downloaded"`
 	Message    string         `json:"message"`
+	// Filas descartadas por formato inválido al cargar el CSV
+	RejectedRows int64 `json:"rejected_rows"`
+	// Filas cargadas contra registros del CSV, para detectar cargas parciales
+	LoadedRows       int64 `json:"loaded_rows"`
+	ExpectedRows     int64 `json:"expected_rows"`
+	RowCountMismatch bool  `json:"row_count_mismatch"`
+	// El CSV se cargó con todas las columnas como VARCHAR
+	AllVarchar bool `json:"all_varchar"`
+
+	// Opciones con las que se inició la descarga
+	opts DownloadOptions
+}
+
+// DownloadOptions ajusta cómo se carga un dataset descargado
+type DownloadOptions struct {
+	// Cargar todas las columnas como VARCHAR (modo seguro) sin intentar
+	// inferir tipos, para datasets que no se pueden tipar automáticamente
+	AllVarchar bool
 }
 
 type DownloadManager struct {
-	jobs    map[string]*DownloadJob
-	mu      sync.RWMutex
-	manager *Manager
+	jobs        map[string]*DownloadJob
+	cancels     map[string]context.CancelFunc
+	done        map[string]chan struct{}      // Se cierra cuando el job termina
+	subscribers map[string][]chan DownloadJob // Reciben cada cambio del job
+	slots       chan struct{}                 // Semáforo de descargas simultáneas
+	mu          sync.RWMutex
+	manager     *Manager
+	running     sync.WaitGroup // Goroutines de descarga activas
+	closed      bool           // Apagándose, no se aceptan descargas nuevas
 }
 
-func NewDownloadManager(m *Manager) *DownloadManager {
+// Buffer de actualizaciones por suscriptor; si se llena se descarta la más vieja
+const subscriberBuffer = 16
+
+// Mensaje del job cuando el usuario cancela la descarga
+const cancelledMessage = "cancelado por usuario"
+
+// Mensaje del job cuando la descarga se detiene porque el servidor se apaga
+const shutdownMessage = "servidor apagándose"
+
+// ErrShuttingDown indica que el servidor se está apagando y no acepta descargas
+var ErrShuttingDown = errors.New("servidor apagándose")
+
+func NewDownloadManager(m *Manager, maxConcurrent int) *DownloadManager {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
 	return &DownloadManager{
-		jobs:    make(map[string]*DownloadJob),
-		manager: m,
+		jobs:        make(map[string]*DownloadJob),
+		cancels:     make(map[string]context.CancelFunc),
+		done:        make(map[string]chan struct{}),
+		subscribers: make(map[string][]chan DownloadJob),
+		slots:       make(chan struct{}, maxConcurrent),
+		manager:     m,
 	}
 }
 
+// ErrDownloadOptionsConflict indica que ya hay un job del dataset iniciado con
+// otras opciones de carga
+var ErrDownloadOptionsConflict = errors.New("ya hay una descarga del dataset con otras opciones")
+
+// StartDownload inicia la descarga del dataset, o retorna el job que ya
+// exista para él sin importar con qué opciones se inició. Un job fallido (o
+// cancelado) se reemplaza por una descarga nueva. Retorna una copia del job,
+// que la goroutine de descarga sigue modificando.
 func (dm *DownloadManager) StartDownload(uuid string) *DownloadJob {
+	job, _ := dm.startDownload(uuid, DownloadOptions{}, false)
+	return job
+}
+
+// StartDownloadWithOptions es StartDownload con opciones de carga. Si ya hay
+// un job del dataset iniciado con otras opciones retorna
+// ErrDownloadOptionsConflict en vez de ignorarlas.
+func (dm *DownloadManager) StartDownloadWithOptions(uuid string, opts DownloadOptions) (*DownloadJob, error) {
+	return dm.startDownload(uuid, opts, true)
+}
+
+// startDownload inicia la descarga de uuid con opts; con strict un job
+// existente con otras opciones es un conflicto
+func (dm *DownloadManager) startDownload(uuid string, opts DownloadOptions, strict bool) (*DownloadJob, error) {
 	dm.mu.Lock()
 
-	// Si ya existe un job, retornarlo
+	// Si ya existe un job, retornarlo. El fallido se reintenta solo cuando su
+	// goroutine terminó, para no tener dos descargas del mismo archivo
 	if job, exists := dm.jobs[uuid]; exists {
+		_, running := dm.cancels[uuid]
+		if job.Status != StatusFailed || running || dm.closed {
+			defer dm.mu.Unlock()
+			if strict && job.opts != opts {
+				return nil, ErrDownloadOptionsConflict
+			}
+			return job.snapshot(), nil
+		}
+	}
+
+	// Durante el apagado no se inician descargas
+	if dm.closed {
 		dm.mu.Unlock()
-		return job
+		now := time.Now()
+		return &DownloadJob{
+			UUID:      uuid,
+			Status:    StatusFailed,
+			Error:     ErrShuttingDown,
+			ErrorMsg:  shutdownMessage,
+			Message:   shutdownMessage,
+			StartTime: now,
+			EndTime:   now,
+			opts:      opts,
+		}, nil
 	}
 
 	// Crear nuevo job
@@ -59,21 +153,300 @@ func (dm *DownloadManager) StartDownload(uuid string) *DownloadJob {
 		Status:    StatusPending,
 		StartTime: time.Now(),
 		Message:   "Iniciando descarga...",
+		opts:      opts,
 	}
 	dm.jobs[uuid] = job
+	dm.done[uuid] = make(chan struct{})
+	started := job.snapshot()
+
+	// Contexto independiente del request, cancelable solo con Cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	dm.cancels[uuid] = cancel
+	dm.running.Add(1)
 	dm.mu.Unlock()
 
 	log.Printf("🚀 Iniciando descarga asíncrona de dataset: %s", uuid)
 
-	// Iniciar descarga en goroutine con contexto background
-	go dm.downloadInBackground(uuid)
+	// Iniciar descarga en goroutine
+	go dm.downloadInBackground(ctx, uuid, opts)
 
-	return job
+	return started, nil
+}
+
+// Preload inicia la descarga de los datasets que aún no están en cache, para
+// que estén listos antes de que alguien los consulte. Las descargas respetan
+// el límite de concurrencia (las demás quedan en cola). Retorna el job de cada
+// UUID; los que ya están en cache se reportan listos sin descargarse.
+func (dm *DownloadManager) Preload(uuids []string) map[string]*DownloadJob {
+	jobs := make(map[string]*DownloadJob, len(uuids))
+	for _, uuid := range uuids {
+		if uuid == "" || jobs[uuid] != nil {
+			continue
+		}
+
+		_, inMemory := dm.manager.cacheManager.GetFromMemory(uuid)
+		_, onDisk := dm.manager.cacheManager.GetFromDisk(uuid)
+		if inMemory || onDisk {
+			now := time.Now()
+			jobs[uuid] = &DownloadJob{
+				UUID:      uuid,
+				Status:    StatusReady,
+				Progress:  100,
+				StartTime: now,
+				EndTime:   now,
+				Message:   "Ya está en cache",
+			}
+			continue
+		}
+
+		jobs[uuid] = dm.StartDownload(uuid)
+	}
+	return jobs
+}
+
+// ErrDownloadInProgress indica que el dataset se está descargando
+var ErrDownloadInProgress = errors.New("descarga en curso")
+
+// Invalidate borra el dataset de los caches y su job terminado, para que la
+// siguiente consulta lo descargue de nuevo. Falla si hay una descarga en curso.
+// Retorna cuántas keys de Redis se borraron.
+func (dm *DownloadManager) Invalidate(uuid string) (int, error) {
+	dm.mu.Lock()
+	if job, exists := dm.jobs[uuid]; exists && job.Status != StatusReady && job.Status != StatusFailed {
+		dm.mu.Unlock()
+		return 0, ErrDownloadInProgress
+	}
+	delete(dm.jobs, uuid)
+	dm.mu.Unlock()
+
+	// Redis y disco fuera del lock, para no bloquear el estado de las descargas
+	return dm.manager.InvalidateDataset(uuid)
+}
+
+// Redownload vuelve a descargar el dataset desde CKAN si hay una versión más
+// nueva; la copia en cache se sigue sirviendo hasta que la nueva esté lista.
+// Si ya hay una descarga en curso la retorna sin reiniciarla.
+func (dm *DownloadManager) Redownload(uuid string) (*DownloadJob, error) {
+	dm.mu.Lock()
+	if job, exists := dm.jobs[uuid]; exists {
+		_, running := dm.cancels[uuid]
+		if running || (job.Status != StatusReady && job.Status != StatusFailed) {
+			defer dm.mu.Unlock()
+			return job.snapshot(), nil
+		}
+		delete(dm.jobs, uuid)
+	}
+	dm.mu.Unlock()
+
+	log.Printf("🔄 Re-descargando dataset %s", uuid)
+	return dm.StartDownload(uuid), nil
+}
+
+// Cancel cancela una descarga en curso y marca el job como fallido.
+// Retorna false si no hay una descarga activa para el dataset.
+func (dm *DownloadManager) Cancel(uuid string) bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	// En processing la conversión ya terminó y el dataset se está registrando
+	job, exists := dm.jobs[uuid]
+	if !exists || job.Status == StatusReady || job.Status == StatusFailed || job.Status == StatusProcessing {
+		return false
+	}
+
+	// La goroutine borra su cancel al terminar
+	if cancel, ok := dm.cancels[uuid]; ok {
+		cancel()
+	}
+
+	job.Status = StatusFailed
+	job.Error = context.Canceled
+	job.ErrorMsg = cancelledMessage
+	job.Message = cancelledMessage
+	job.EndTime = time.Now()
+	dm.notifyDone(uuid, job)
+
+	log.Printf("🛑 Descarga de %s cancelada por usuario", uuid)
+	return true
+}
+
+// Shutdown cancela las descargas en curso y espera, hasta el deadline de ctx,
+// a que sus goroutines terminen y limpien sus archivos temporales. Si el
+// deadline se cumple antes, borra los archivos parciales que hayan quedado.
+// Después de Shutdown no se aceptan descargas nuevas.
+func (dm *DownloadManager) Shutdown(ctx context.Context) error {
+	dm.mu.Lock()
+	dm.closed = true
+	active := make([]string, 0, len(dm.cancels))
+	for uuid, cancel := range dm.cancels {
+		cancel()
+		active = append(active, uuid)
+
+		if job, exists := dm.jobs[uuid]; exists && job.Status != StatusReady && job.Status != StatusFailed {
+			job.Status = StatusFailed
+			job.Error = ErrShuttingDown
+			job.ErrorMsg = shutdownMessage
+			job.Message = shutdownMessage
+			job.EndTime = time.Now()
+			dm.notifyDone(uuid, job)
+		}
+	}
+	dm.mu.Unlock()
+
+	if len(active) > 0 {
+		log.Printf("🛑 Deteniendo %d descargas en curso...", len(active))
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		dm.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		log.Printf("Warning: las descargas no terminaron a tiempo, borrando archivos parciales")
+		for _, uuid := range active {
+			dm.manager.removePartialFiles(uuid)
+		}
+		return ctx.Err()
+	}
 }
 
-func (dm *DownloadManager) downloadInBackground(uuid string) {
-	// Usar contexto background para que no se cancele
-	ctx := context.Background()
+// Wait bloquea hasta que el job termine (listo o fallido), se cancele el
+// contexto o pase el timeout. Retorna una copia del job y si terminó.
+func (dm *DownloadManager) Wait(ctx context.Context, uuid string, timeout time.Duration) (*DownloadJob, bool) {
+	dm.mu.RLock()
+	done, waiting := dm.done[uuid]
+	dm.mu.RUnlock()
+
+	if waiting {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	job, exists := dm.GetJob(uuid)
+	if !exists {
+		return nil, false
+	}
+	return job, job.Status == StatusReady || job.Status == StatusFailed
+}
+
+// notifyDone envía el estado del job a los suscriptores y despierta a quienes
+// esperan el job si ya terminó. Debe llamarse con el lock tomado.
+func (dm *DownloadManager) notifyDone(uuid string, job *DownloadJob) {
+	dm.publish(uuid, job)
+
+	if job.Status != StatusReady && job.Status != StatusFailed {
+		return
+	}
+	if done, ok := dm.done[uuid]; ok {
+		close(done)
+		delete(dm.done, uuid)
+	}
+}
+
+// Subscribe retorna un canal que recibe una copia del job en cada cambio y se
+// cierra cuando el job termina. La función retornada cancela la suscripción.
+func (dm *DownloadManager) Subscribe(uuid string) (<-chan DownloadJob, func()) {
+	ch := make(chan DownloadJob, subscriberBuffer)
+
+	dm.mu.Lock()
+	dm.subscribers[uuid] = append(dm.subscribers[uuid], ch)
+	dm.mu.Unlock()
+
+	unsubscribe := func() {
+		dm.mu.Lock()
+		defer dm.mu.Unlock()
+
+		subs := dm.subscribers[uuid]
+		for i, sub := range subs {
+			if sub == ch {
+				dm.subscribers[uuid] = append(subs[:i], subs[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+		if len(dm.subscribers[uuid]) == 0 {
+			delete(dm.subscribers, uuid)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// publish envía una copia del job a los suscriptores sin bloquear; si el
+// suscriptor va atrasado se descarta su actualización más vieja. Al terminar
+// el job se cierran los canales. Debe llamarse con el lock tomado.
+func (dm *DownloadManager) publish(uuid string, job *DownloadJob) {
+	subs := dm.subscribers[uuid]
+	if len(subs) == 0 {
+		return
+	}
+
+	update := *job.snapshot()
+
+	for _, ch := range subs {
+		select {
+		case ch <- update:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- update:
+			default:
+			}
+		}
+	}
+
+	if job.Status == StatusReady || job.Status == StatusFailed {
+		for _, ch := range subs {
+			close(ch)
+		}
+		delete(dm.subscribers, uuid)
+	}
+}
+
+func (dm *DownloadManager) downloadInBackground(ctx context.Context, uuid string, opts DownloadOptions) {
+	defer dm.running.Done()
+	defer func() {
+		dm.mu.Lock()
+		if cancel, ok := dm.cancels[uuid]; ok {
+			cancel()
+			delete(dm.cancels, uuid)
+		}
+		dm.mu.Unlock()
+	}()
+
+	// Esperar turno, el job queda en pending mientras está en cola
+	select {
+	case dm.slots <- struct{}{}:
+	default:
+		dm.updateJob(uuid, func(job *DownloadJob) {
+			job.Message = "En cola, esperando turno de descarga..."
+		})
+		log.Printf("⏳ Descarga de %s en cola", uuid)
+
+		select {
+		case dm.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+	defer func() { <-dm.slots }()
+
+	metrics.ActiveDownloads.Inc()
+	defer metrics.ActiveDownloads.Dec()
+	start := time.Now()
 
 	dm.updateJob(uuid, func(job *DownloadJob) {
 		job.Status = StatusDownloading
@@ -92,49 +465,110 @@ func (dm *DownloadManager) downloadInBackground(uuid string) {
 		})
 	}
 
+	// Cancel pudo marcar el job como fallido justo cuando terminaba la
+	// conversión; se revisa bajo el lock antes de reemplazar la copia en
+	// cache, y desde processing Cancel ya no aplica
+	var startTime time.Time
+	beforeReplace := func() error {
+		dm.mu.Lock()
+		defer dm.mu.Unlock()
+
+		job, exists := dm.jobs[uuid]
+		if !exists || job.Status == StatusFailed {
+			return context.Canceled
+		}
+		job.Status = StatusProcessing
+		job.Progress = 95
+		job.Message = "Registrando en cache..."
+		startTime = job.StartTime
+		dm.notifyDone(uuid, job)
+		return nil
+	}
+
 	// Descargar y convertir (ya crea en la ubicación correcta del cache)
-	dbPath, err := dm.manager.downloadAndConvertWithProgress(ctx, uuid, progressCallback)
+	dbPath, stats, err := dm.manager.downloadAndConvertWithProgress(ctx, uuid, opts, progressCallback, beforeReplace)
+	metrics.DownloadDuration.WithLabelValues(downloadResult(ctx, err)).Observe(time.Since(start).Seconds())
+
+	if errors.Is(err, errNotModified) {
+		log.Printf("✓ Dataset %s sin cambios en CKAN, se conserva la copia en cache", uuid)
+		dm.updateJob(uuid, func(job *DownloadJob) {
+			job.Status = StatusReady
+			job.Progress = 100
+			job.EndTime = time.Now()
+			job.Message = "Sin cambios en CKAN, se conserva la copia en cache"
+		})
+		return
+	}
 
 	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			// Cancelada, Cancel o Shutdown ya actualizaron el job. La carga se
+			// descartó sin tocar la copia en cache
+			log.Printf("🛑 Descarga de %s detenida: %v", uuid, err)
+			return
+		}
 		log.Printf("❌ Error en descarga de %s: %v", uuid, err)
+		message := "Error en descarga"
+		if errors.Is(err, ErrDownloadTooLarge) {
+			message = "El archivo excede el tamaño máximo de descarga"
+		} else if errors.Is(err, ErrUnexpectedContent) {
+			message = "La URL del recurso no retornó un CSV; revisa el enlace en CKAN"
+		}
 		dm.updateJob(uuid, func(job *DownloadJob) {
 			job.Status = StatusFailed
 			job.Error = err
 			job.ErrorMsg = err.Error()
 			job.EndTime = time.Now()
-			job.Message = "Error en descarga"
+			job.Message = message
 		})
 		return
 	}
 
-	dm.updateJob(uuid, func(job *DownloadJob) {
-		job.Status = StatusProcessing
-		job.Progress = 95
-		job.Message = "Registrando en cache..."
-	})
-
 	// ✅ El archivo YA está en la ubicación correcta
-	// Solo registrarlo en memoria LRU
+	// Registrarlo en disco (aplica el límite de tamaño) y en memoria LRU
+	if err := dm.manager.cacheManager.SetToDisk(uuid, dbPath); err != nil {
+		log.Printf("Warning: error registrando en disco cache: %v", err)
+	}
 	dm.manager.cacheManager.SetToMemory(uuid, dbPath)
 
+	// Si reemplazó una copia anterior, reabrir la conexión y descartar resultados viejos
+	dm.manager.closeConnection(uuid)
+	if _, err := dm.manager.cacheManager.DeleteDatasetKeys(uuid); err != nil {
+		log.Printf("Warning: error borrando keys de Redis de %s: %v", uuid, err)
+	}
+
 	dm.updateJob(uuid, func(job *DownloadJob) {
 		job.Status = StatusReady
 		job.Progress = 100
 		job.EndTime = time.Now()
+		job.RejectedRows = stats.RejectedRows
+		job.LoadedRows = stats.LoadedRows
+		job.ExpectedRows = stats.ExpectedRows
+		job.RowCountMismatch = stats.RowCountMismatch()
+		job.AllVarchar = stats.AllVarchar
 		job.Message = "Dataset listo para consultar"
+		if stats.RejectedRows > 0 {
+			job.Message = fmt.Sprintf("Dataset listo para consultar (%d filas rechazadas)", stats.RejectedRows)
+		}
+		if stats.AllVarchar {
+			job.Message += "; columnas cargadas como texto"
+		}
 	})
 
-	duration := time.Since(dm.jobs[uuid].StartTime)
+	duration := time.Since(startTime)
 	log.Printf("✅ Dataset %s listo en %.2f segundos", uuid, duration.Seconds())
 	log.Printf("📁 Ubicación: %s", dbPath)
 }
 
+// updateJob aplica updateFn al job de uuid. Un job terminado no se modifica:
+// Cancel o Shutdown pudieron cerrarlo mientras la goroutine seguía corriendo.
 func (dm *DownloadManager) updateJob(uuid string, updateFn func(*DownloadJob)) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
-	if job, exists := dm.jobs[uuid]; exists {
+	if job, exists := dm.jobs[uuid]; exists && job.Status != StatusReady && job.Status != StatusFailed {
 		updateFn(job)
+		dm.notifyDone(uuid, job)
 	}
 }
 
@@ -143,16 +577,21 @@ func (dm *DownloadManager) GetJob(uuid string) (*DownloadJob, bool) {
 	defer dm.mu.RUnlock()
 
 	if job, exists := dm.jobs[uuid]; exists {
-		// Crear copia para evitar race conditions
-		jobCopy := *job
-		if job.Error != nil {
-			jobCopy.ErrorMsg = job.Error.Error()
-		}
-		return &jobCopy, true
+		return job.snapshot(), true
 	}
 	return nil, false
 }
 
+// snapshot retorna una copia del job para leerla sin el lock, con ErrorMsg
+// tomado de Error. Debe llamarse con el lock tomado.
+func (job *DownloadJob) snapshot() *DownloadJob {
+	jobCopy := *job
+	if job.Error != nil {
+		jobCopy.ErrorMsg = job.Error.Error()
+	}
+	return &jobCopy
+}
+
 func (dm *DownloadManager) CleanupOldJobs() {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
@@ -168,3 +607,36 @@ func (dm *DownloadManager) CleanupOldJobs() {
 		}
 	}
 }
+
+// downloadResult clasifica el resultado de una descarga para las métricas
+func downloadResult(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "ready"
+	case errors.Is(err, errNotModified):
+		return "not_modified"
+	case ctx.Err() != nil:
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+// removePartialFiles borra los archivos que una descarga interrumpida de uuid
+// pudo dejar: el CSV temporal (y su conversión a UTF-8) y la base DuckDB a medias
+func (m *Manager) removePartialFiles(uuid string) {
+	partial := []string{
+		filepath.Join(m.cacheManager.GetCacheDir(), uuid+".duckdb.tmp"),
+		filepath.Join(m.cacheManager.GetCacheDir(), uuid+".duckdb.tmp.wal"),
+	}
+	for _, pattern := range []string{uuid + "_*.csv", uuid + "_*.csv.utf8"} {
+		matches, _ := filepath.Glob(filepath.Join(os.TempDir(), pattern))
+		partial = append(partial, matches...)
+	}
+
+	for _, path := range partial {
+		if err := os.Remove(path); err == nil {
+			log.Printf("🗑️  Archivo parcial borrado: %s", path)
+		}
+	}
+}
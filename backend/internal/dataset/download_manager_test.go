@@ -0,0 +1,361 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+// waitFor reintenta cond hasta que se cumpla o pase el timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout esperando %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// holdResource registra un recurso cuya descarga queda abierta hasta el final de la prueba
+func holdResource(t *testing.T, ckan *testutil.CKAN, uuid string) {
+	t.Helper()
+	hold := make(chan struct{})
+	t.Cleanup(func() { close(hold) })
+	// Más de 512 bytes, lo que se lee para revisar el contenido antes de guardar
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 100)
+	ckan.SetResource(uuid, testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+}
+
+func TestCancelDownloadRemovesTempFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	ckan := testutil.NewCKAN(t)
+	holdResource(t, ckan, "ventas")
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("ventas")
+	waitFor(t, 10*time.Second, "el inicio de la descarga", func() bool {
+		job, _ := dm.GetJob("ventas")
+		return job.Downloaded > 0
+	})
+
+	if !dm.Cancel("ventas") {
+		t.Fatal("Cancel retornó false con una descarga en curso")
+	}
+	job, done := dm.Wait(context.Background(), "ventas", time.Second)
+	if !done || job.Status != StatusFailed || job.Message != cancelledMessage {
+		t.Errorf("job = %+v, se esperaba fallido por cancelación", job)
+	}
+
+	// Esperar a que la goroutine de descarga termine y limpie
+	if err := dm.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(tmp, "ventas_*")); len(leftovers) > 0 {
+		t.Errorf("quedaron archivos temporales: %v", leftovers)
+	}
+	if _, err := os.Stat(filepath.Join(m.cacheManager.GetCacheDir(), "ventas.duckdb")); err == nil {
+		t.Error("la descarga cancelada dejó el dataset en cache")
+	}
+	if dm.Cancel("ventas") {
+		t.Error("Cancel de un job terminado retornó true")
+	}
+}
+
+func TestStartDownloadRestartsFailedJob(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	holdResource(t, ckan, "ventas")
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("ventas")
+	waitFor(t, 10*time.Second, "el inicio de la descarga", func() bool {
+		job, _ := dm.GetJob("ventas")
+		return job.Downloaded > 0
+	})
+	if !dm.Cancel("ventas") {
+		t.Fatal("Cancel retornó false con una descarga en curso")
+	}
+
+	// Mientras la goroutine cancelada termina se sigue reportando el job fallido;
+	// después, la siguiente consulta inicia una descarga nueva
+	waitFor(t, 10*time.Second, "una descarga nueva", func() bool {
+		return dm.StartDownload("ventas").Status != StatusFailed
+	})
+	waitFor(t, 10*time.Second, "la segunda descarga en CKAN", func() bool {
+		return ckan.Downloads("ventas") == 2
+	})
+}
+
+func TestStartDownloadOptionsConflict(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	holdResource(t, ckan, "ventas")
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("ventas")
+
+	if _, err := dm.StartDownloadWithOptions("ventas", DownloadOptions{AllVarchar: true}); !errors.Is(err, ErrDownloadOptionsConflict) {
+		t.Errorf("all_varchar con una descarga normal en curso: err = %v, se esperaba ErrDownloadOptionsConflict", err)
+	}
+	if job, err := dm.StartDownloadWithOptions("ventas", DownloadOptions{}); err != nil || job.UUID != "ventas" {
+		t.Errorf("mismas opciones: job = %+v, err = %v; se esperaba el job en curso", job, err)
+	}
+}
+
+func TestCancelRacingCompletion(t *testing.T) {
+	m := newTestManager(t, Options{})
+	dm := m.GetDownloadManager()
+
+	// Con la conversión terminada el dataset ya se está registrando
+	dm.mu.Lock()
+	dm.jobs["ventas"] = &DownloadJob{UUID: "ventas", Status: StatusProcessing}
+	dm.mu.Unlock()
+	if dm.Cancel("ventas") {
+		t.Error("Cancel de un job en processing retornó true")
+	}
+
+	// Un job cancelado no se sobrescribe con las actualizaciones de la goroutine
+	dm.mu.Lock()
+	dm.jobs["ventas"].Status = StatusFailed
+	dm.jobs["ventas"].Message = cancelledMessage
+	dm.mu.Unlock()
+	dm.updateJob("ventas", func(j *DownloadJob) { j.Status, j.Progress = StatusReady, 100 })
+
+	job, _ := dm.GetJob("ventas")
+	if job.Status != StatusFailed || job.Message != cancelledMessage {
+		t.Errorf("job = %+v, se esperaba que siguiera cancelado", job)
+	}
+}
+
+func TestDownloadConcurrencyLimit(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	uuids := []string{"a", "b", "c", "d"}
+	for _, uuid := range uuids {
+		holdResource(t, ckan, uuid)
+	}
+	m := newCKANTestManager(t, ckan.URL(), Options{MaxConcurrentDownloads: 2})
+	dm := m.GetDownloadManager()
+
+	for _, uuid := range uuids {
+		dm.StartDownload(uuid)
+	}
+
+	countByStatus := func() map[DownloadStatus]int {
+		counts := make(map[DownloadStatus]int)
+		for _, uuid := range uuids {
+			job, _ := dm.GetJob(uuid)
+			counts[job.Status]++
+		}
+		return counts
+	}
+	waitFor(t, 10*time.Second, "dos descargas activas", func() bool {
+		return countByStatus()[StatusDownloading] == 2
+	})
+
+	// Las descargas retenidas no terminan: las otras dos siguen en cola
+	time.Sleep(50 * time.Millisecond)
+	counts := countByStatus()
+	if counts[StatusDownloading] != 2 || counts[StatusPending] != 2 {
+		t.Errorf("estados = %v, se esperaban 2 descargando y 2 en cola", counts)
+	}
+	if got := ckan.Downloads("a") + ckan.Downloads("b") + ckan.Downloads("c") + ckan.Downloads("d"); got != 2 {
+		t.Errorf("descargas iniciadas en CKAN = %d, se esperaban 2", got)
+	}
+
+	// Al cancelar una activa, entra una de la cola
+	for _, uuid := range uuids {
+		if job, _ := dm.GetJob(uuid); job.Status == StatusDownloading {
+			dm.Cancel(uuid)
+			break
+		}
+	}
+	waitFor(t, 10*time.Second, "que una descarga en cola empiece", func() bool {
+		counts := countByStatus()
+		return counts[StatusDownloading] == 2 && counts[StatusPending] == 1
+	})
+}
+
+func TestSubscribeReceivesOrderedUpdates(t *testing.T) {
+	m := newTestManager(t, Options{})
+	dm := m.GetDownloadManager()
+
+	dm.mu.Lock()
+	dm.jobs["ventas"] = &DownloadJob{UUID: "ventas", Status: StatusPending}
+	dm.mu.Unlock()
+
+	updates, unsubscribe := dm.Subscribe("ventas")
+	defer unsubscribe()
+
+	dm.updateJob("ventas", func(j *DownloadJob) { j.Status, j.Progress = StatusDownloading, 10 })
+	dm.updateJob("ventas", func(j *DownloadJob) { j.Progress = 60 })
+	dm.updateJob("ventas", func(j *DownloadJob) { j.Status, j.Progress = StatusReady, 100 })
+
+	var got []string
+	for update := range updates {
+		got = append(got, fmt.Sprintf("%s %.0f", update.Status, update.Progress))
+	}
+	want := []string{"downloading 10", "downloading 60", "ready 100"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("actualizaciones = %v, se esperaba %v", got, want)
+	}
+
+	// El canal se cerró al terminar el job y el suscriptor ya no está registrado
+	dm.mu.RLock()
+	_, registered := dm.subscribers["ventas"]
+	dm.mu.RUnlock()
+	if registered {
+		t.Error("el suscriptor sigue registrado después de que el job terminó")
+	}
+}
+
+func TestSubscribeDropsOldestWhenBehind(t *testing.T) {
+	m := newTestManager(t, Options{})
+	dm := m.GetDownloadManager()
+
+	dm.mu.Lock()
+	dm.jobs["ventas"] = &DownloadJob{UUID: "ventas", Status: StatusDownloading}
+	dm.mu.Unlock()
+
+	updates, unsubscribe := dm.Subscribe("ventas")
+	// Sin leer el canal, publicar más de lo que cabe no bloquea
+	for i := 1; i <= subscriberBuffer+5; i++ {
+		progress := float64(i)
+		dm.updateJob("ventas", func(j *DownloadJob) { j.Progress = progress })
+	}
+	unsubscribe()
+
+	var last DownloadJob
+	n := 0
+	for update := range updates {
+		last = update
+		n++
+	}
+	if n != subscriberBuffer || last.Progress != float64(subscriberBuffer+5) {
+		t.Errorf("%d actualizaciones, última %.0f; se esperaban %d y la más reciente", n, last.Progress, subscriberBuffer)
+	}
+}
+
+func TestShutdownStopsDownloads(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	ckan := testutil.NewCKAN(t)
+	holdResource(t, ckan, "ventas")
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("ventas")
+	waitFor(t, 10*time.Second, "el inicio de la descarga", func() bool {
+		job, _ := dm.GetJob("ventas")
+		return job.Downloaded > 0
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dm.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	job, _ := dm.GetJob("ventas")
+	if job.Status != StatusFailed || job.Message != shutdownMessage {
+		t.Errorf("job = %+v, se esperaba fallido por apagado", job)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(tmp, "ventas_*")); len(leftovers) > 0 {
+		t.Errorf("quedaron archivos temporales: %v", leftovers)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(m.cacheManager.GetCacheDir(), "ventas.duckdb*")); len(leftovers) > 0 {
+		t.Errorf("quedaron archivos en el cache: %v", leftovers)
+	}
+
+	// Después del apagado no se aceptan descargas nuevas
+	job = dm.StartDownload("otro")
+	if job.Status != StatusFailed || !errors.Is(job.Error, ErrShuttingDown) {
+		t.Errorf("job = %+v, se esperaba rechazado por apagado", job)
+	}
+	if ckan.Downloads("otro") != 0 {
+		t.Error("se inició una descarga después del apagado")
+	}
+}
+
+func TestRemovePartialFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	m := newTestManager(t, Options{})
+	cacheDir := m.cacheManager.GetCacheDir()
+
+	partial := []string{
+		filepath.Join(tmp, "ventas_123.csv"),
+		filepath.Join(tmp, "ventas_123.csv.utf8"),
+		filepath.Join(cacheDir, "ventas.duckdb.tmp"),
+		filepath.Join(cacheDir, "ventas.duckdb.tmp.wal"),
+	}
+	// Archivos de otro dataset y el dataset ya completo no se tocan
+	kept := []string{
+		filepath.Join(tmp, "otro_123.csv"),
+		filepath.Join(cacheDir, "ventas.duckdb"),
+	}
+	for _, path := range append(append([]string{}, partial...), kept...) {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("error creando %s: %v", path, err)
+		}
+	}
+
+	m.removePartialFiles("ventas")
+
+	for _, path := range partial {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s no se borró", path)
+		}
+	}
+	for _, path := range kept {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s se borró: %v", path, err)
+		}
+	}
+}
+
+func TestPreloadRespectsConcurrencyLimit(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	for _, uuid := range []string{"a", "b", "c"} {
+		holdResource(t, ckan, uuid)
+	}
+	m := newCKANTestManager(t, ckan.URL(), Options{MaxConcurrentDownloads: 1})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	dm := m.GetDownloadManager()
+
+	jobs := dm.Preload([]string{"a", "b", "c", "ventas", ""})
+	if len(jobs) != 4 || jobs["ventas"].Status != StatusReady {
+		t.Errorf("jobs = %v, se esperaban 4 con ventas ya lista", jobs)
+	}
+
+	countByStatus := func() map[DownloadStatus]int {
+		counts := make(map[DownloadStatus]int)
+		for _, uuid := range []string{"a", "b", "c"} {
+			job, _ := dm.GetJob(uuid)
+			counts[job.Status]++
+		}
+		return counts
+	}
+	waitFor(t, 10*time.Second, "una descarga activa", func() bool {
+		return countByStatus()[StatusDownloading] == 1
+	})
+	time.Sleep(50 * time.Millisecond)
+	if counts := countByStatus(); counts[StatusDownloading] != 1 || counts[StatusPending] != 2 {
+		t.Errorf("estados = %v, se esperaban 1 descargando y 2 en cola", counts)
+	}
+	if ckan.Downloads("ventas") != 0 {
+		t.Error("se descargó un dataset que ya estaba en cache")
+	}
+}
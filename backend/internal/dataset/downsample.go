@@ -0,0 +1,108 @@
+package dataset
+
+import (
+	"math"
+	"time"
+)
+
+// Mínimo de puntos al reducir una serie (primero, último y al menos uno intermedio)
+const minDownsamplePoints = 3
+
+// downsampleLTTB reduce una serie a maxPoints puntos con Largest-Triangle-Three-Buckets,
+// que conserva la forma visual. Siempre conserva el primer y último punto, y además
+// el máximo y mínimo globales de yKey reemplazando al elegido de su bucket.
+func downsampleLTTB(series []map[string]interface{}, xKey, yKey string, maxPoints int) []map[string]interface{} {
+	if maxPoints < minDownsamplePoints {
+		maxPoints = minDownsamplePoints
+	}
+	n := len(series)
+	if n <= maxPoints {
+		return series
+	}
+
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	maxIdx, minIdx := 0, 0
+	for i, row := range series {
+		xs[i] = seriesX(row[xKey], i)
+		ys[i], _ = toFloat64(row[yKey])
+		if ys[i] > ys[maxIdx] {
+			maxIdx = i
+		}
+		if ys[i] < ys[minIdx] {
+			minIdx = i
+		}
+	}
+
+	// Los puntos intermedios (sin primero y último) se reparten en maxPoints-2 buckets
+	every := float64(n-2) / float64(maxPoints-2)
+	bucketStart := func(b int) int { return int(math.Floor(float64(b)*every)) + 1 }
+
+	selected := make([]int, 0, maxPoints)
+	selected = append(selected, 0)
+	a := 0
+	for b := 0; b < maxPoints-2; b++ {
+		// Promedio del bucket siguiente (o el último punto)
+		nextStart, nextEnd := bucketStart(b+1), bucketStart(b+2)
+		if nextEnd > n {
+			nextEnd = n
+		}
+		if nextStart >= n-1 {
+			nextStart, nextEnd = n-1, n
+		}
+		var avgX, avgY float64
+		for i := nextStart; i < nextEnd; i++ {
+			avgX += xs[i]
+			avgY += ys[i]
+		}
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		// Punto del bucket actual que forma el triángulo de mayor área
+		best, bestArea := -1, -1.0
+		for i := bucketStart(b); i < bucketStart(b+1) && i < n-1; i++ {
+			area := math.Abs((xs[a]-avgX)*(ys[i]-ys[a]) - (xs[a]-xs[i])*(avgY-ys[a]))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		selected = append(selected, best)
+		a = best
+	}
+	selected = append(selected, n-1)
+
+	// Asegurar que los extremos globales sobrevivan
+	for _, extreme := range []int{minIdx, maxIdx} {
+		if extreme == 0 || extreme == n-1 {
+			continue
+		}
+		for s := 1; s < len(selected)-1; s++ {
+			b := s - 1
+			if extreme >= bucketStart(b) && extreme < bucketStart(b+1) {
+				selected[s] = extreme
+				break
+			}
+		}
+	}
+
+	result := make([]map[string]interface{}, len(selected))
+	for i, idx := range selected {
+		result[i] = series[idx]
+	}
+	return result
+}
+
+// seriesX convierte el valor del eje X a número; fechas como timestamp y,
+// si no es numérico, la posición en la serie
+func seriesX(val interface{}, index int) float64 {
+	if t, ok := val.(time.Time); ok {
+		return float64(t.Unix())
+	}
+	if f, ok := toFloat64(val); ok {
+		return f
+	}
+	return float64(index)
+}
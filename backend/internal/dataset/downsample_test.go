@@ -0,0 +1,88 @@
+package dataset
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// seasonalSeries crea n puntos diarios con una onda y dos picos aislados
+func seasonalSeries(n int) []map[string]interface{} {
+	series := make([]map[string]interface{}, n)
+	for i := range series {
+		y := 100 + 10*math.Sin(float64(i)/30)
+		switch i {
+		case 1234:
+			y = 500
+		case 2345:
+			y = -50
+		}
+		series[i] = map[string]interface{}{"x": i, "y": y}
+	}
+	return series
+}
+
+func TestDownsampleLTTB(t *testing.T) {
+	series := seasonalSeries(3650)
+	reduced := downsampleLTTB(series, "x", "y", 100)
+
+	if len(reduced) > 100 {
+		t.Fatalf("%d puntos, se esperaban a lo más 100", len(reduced))
+	}
+	if reduced[0]["x"] != 0 || reduced[len(reduced)-1]["x"] != 3649 {
+		t.Errorf("extremos = %v y %v, se esperaban el primer y último punto", reduced[0]["x"], reduced[len(reduced)-1]["x"])
+	}
+
+	// Los picos globales sobreviven y el orden se mantiene
+	var hasMax, hasMin bool
+	for i, row := range reduced {
+		hasMax = hasMax || row["y"] == 500.0
+		hasMin = hasMin || row["y"] == -50.0
+		if i > 0 && row["x"].(int) <= reduced[i-1]["x"].(int) {
+			t.Fatalf("punto %d fuera de orden: %v después de %v", i, row["x"], reduced[i-1]["x"])
+		}
+	}
+	if !hasMax || !hasMin {
+		t.Errorf("máximo conservado = %v, mínimo conservado = %v; se esperaban ambos", hasMax, hasMin)
+	}
+}
+
+func TestDownsampleLTTBShortSeries(t *testing.T) {
+	series := seasonalSeries(10)
+	if got := downsampleLTTB(series, "x", "y", 50); len(got) != 10 {
+		t.Errorf("%d puntos, una serie corta no se reduce", len(got))
+	}
+	// Menos del mínimo se sube a 3 puntos
+	if got := downsampleLTTB(series, "x", "y", 1); len(got) != minDownsamplePoints {
+		t.Errorf("%d puntos, se esperaban %d", len(got), minDownsamplePoints)
+	}
+}
+
+func TestTimeSeriesMaxPoints(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "diario",
+		`CREATE TABLE data AS
+			SELECT DATE '2015-01-01' + i::INTEGER as fecha, CASE WHEN i = 1000 THEN 9999 ELSE i % 7 END as monto
+			FROM range(3650) t(i)`)
+
+	ts := TimeSeriesParams{DateColumn: "fecha", ValueColumn: "monto", Agg: "sum", MaxPoints: 200}
+	series, err := m.GetTimeSeries(context.Background(), "diario", ts)
+	if err != nil {
+		t.Fatalf("GetTimeSeries: %v", err)
+	}
+	if len(series) > 200 {
+		t.Fatalf("%d puntos, se esperaban a lo más 200", len(series))
+	}
+
+	params, _ := m.timeSeriesAggregation(ts)
+	alias := params.measures()[0].Alias
+	var peak bool
+	for _, row := range series {
+		if v, _ := toFloat64(row[alias]); v == 9999 {
+			peak = true
+		}
+	}
+	if !peak {
+		t.Errorf("la serie reducida perdió el pico de 9999")
+	}
+}
@@ -0,0 +1,122 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errNotModified indica que la copia en cache sigue vigente respecto a CKAN
+var errNotModified = errors.New("recurso sin cambios")
+
+// Tiempo máximo de la verificación de vigencia contra CKAN al abrir un dataset
+const freshnessCheckTimeout = 30 * time.Second
+
+// datasetMeta se guarda junto al archivo DuckDB (<uuid>.meta.json) y permite
+// saber si la copia en cache sigue vigente
+type datasetMeta struct {
+	// last_modified del recurso en CKAN al momento de la descarga
+	LastModified string `json:"last_modified"`
+	// Validadores HTTP de la respuesta del CSV
+	ETag             string    `json:"etag,omitempty"`
+	HTTPLastModified string    `json:"http_last_modified,omitempty"`
+	DownloadedAt     time.Time `json:"downloaded_at"`
+	// Resultado de la carga del CSV, para verificar integridad después
+	LoadedRows   int64 `json:"loaded_rows"`
+	RejectedRows int64 `json:"rejected_rows"`
+	ExpectedRows int64 `json:"expected_rows"`
+	AllVarchar   bool  `json:"all_varchar,omitempty"`
+}
+
+// setLoadStats guarda en la metadata el resultado de la carga
+func (meta *datasetMeta) setLoadStats(stats *LoadStats) {
+	meta.LoadedRows = stats.LoadedRows
+	meta.RejectedRows = stats.RejectedRows
+	meta.ExpectedRows = stats.ExpectedRows
+	meta.AllVarchar = stats.AllVarchar
+}
+
+func (m *Manager) metaPath(uuid string) string {
+	return filepath.Join(m.cacheManager.GetCacheDir(), uuid+".meta.json")
+}
+
+// readMeta lee el sidecar de un dataset, si existe
+func (m *Manager) readMeta(uuid string) (*datasetMeta, bool) {
+	data, err := os.ReadFile(m.metaPath(uuid))
+	if err != nil {
+		return nil, false
+	}
+	var meta datasetMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		log.Printf("Warning: metadata inválida para %s: %v", uuid, err)
+		return nil, false
+	}
+	return &meta, true
+}
+
+// writeMeta guarda el sidecar de un dataset
+func (m *Manager) writeMeta(uuid string, meta *datasetMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.metaPath(uuid), data, 0644)
+}
+
+// resourceIsNewer indica si el last_modified remoto es posterior al guardado.
+// Si alguno no se conoce se asume que puede haber cambios.
+func resourceIsNewer(remote, local string) bool {
+	if remote == "" || local == "" {
+		return true
+	}
+	remoteTime, errRemote := parseCKANTime(remote)
+	localTime, errLocal := parseCKANTime(local)
+	if errRemote != nil || errLocal != nil {
+		// CKAN usa ISO 8601, que también ordena como texto
+		return remote > local
+	}
+	return remoteTime.After(localTime)
+}
+
+// parseCKANTime interpreta las fechas de CKAN (ISO 8601, con o sin zona)
+func parseCKANTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// checkFreshness compara la copia en cache con la metadata actual de CKAN y,
+// si el recurso es más nuevo, dispara una re-descarga en segundo plano.
+// Mientras tanto se sigue sirviendo la copia en cache.
+func (m *Manager) checkFreshness(uuid string) {
+	meta, found := m.readMeta(uuid)
+	if !found {
+		// Copias sin sidecar: no hay con qué comparar
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), freshnessCheckTimeout)
+	defer cancel()
+
+	resource, err := m.ckanClient.GetResource(ctx, uuid)
+	if err != nil {
+		log.Printf("Warning: no se pudo verificar vigencia de %s: %v", uuid, err)
+		return
+	}
+
+	if resource.LastModified == "" || !resourceIsNewer(resource.LastModified, meta.LastModified) {
+		return
+	}
+
+	log.Printf("🆕 Dataset %s actualizado en CKAN (%s > %s)", uuid, resource.LastModified, meta.LastModified)
+	if _, err := m.downloadManager.Redownload(uuid); err != nil {
+		log.Printf("Warning: error re-descargando %s: %v", uuid, err)
+	}
+}
@@ -0,0 +1,113 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestResourceIsNewer(t *testing.T) {
+	tests := []struct {
+		remote, local string
+		want          bool
+	}{
+		{"2024-03-01T10:00:00", "2024-02-01T10:00:00", true},
+		{"2024-02-01T10:00:00", "2024-02-01T10:00:00", false},
+		{"2024-02-01T10:00:00.123456", "2024-02-01T10:00:00", true},
+		{"2024-02-01T09:00:00Z", "2024-02-01T10:00:00+02:00", true},
+		{"", "2024-02-01T10:00:00", true},
+		{"2024-02-01T10:00:00", "", true},
+	}
+	for _, tt := range tests {
+		if got := resourceIsNewer(tt.remote, tt.local); got != tt.want {
+			t.Errorf("resourceIsNewer(%q, %q) = %v, se esperaba %v", tt.remote, tt.local, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSkipsUnchangedResource(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-01-01T00:00:00",
+		Body:         []byte("region,monto\nNorte,10\nSur,20\n"),
+	})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil); err != nil {
+		t.Fatalf("primera descarga: %v", err)
+	}
+	// Con el mismo last_modified no se vuelve a pedir el archivo
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil); !errors.Is(err, errNotModified) {
+		t.Errorf("err = %v, se esperaba errNotModified", err)
+	}
+	if n := ckan.Downloads("ventas"); n != 1 {
+		t.Errorf("%d descargas, se esperaba 1", n)
+	}
+}
+
+func TestDownloadNotModifiedByETag(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	res := testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-01-01T00:00:00",
+		Body:         []byte("region,monto\nNorte,10\nSur,20\n"),
+		Headers:      map[string]string{"ETag": `"v1"`},
+	}
+	ckan.SetResource("ventas", res)
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil); err != nil {
+		t.Fatalf("primera descarga: %v", err)
+	}
+
+	// CKAN reporta un last_modified nuevo pero el archivo no cambió: 304
+	res.LastModified = "2024-02-01T00:00:00"
+	ckan.SetResource("ventas", res)
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil); !errors.Is(err, errNotModified) {
+		t.Errorf("err = %v, se esperaba errNotModified por el 304", err)
+	}
+	if n := ckan.Downloads("ventas"); n != 2 {
+		t.Errorf("%d peticiones del archivo, se esperaban 2 (la segunda condicional)", n)
+	}
+}
+
+func TestDownloadChangedResource(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-01-01T00:00:00",
+		Body:         []byte("region,monto\nNorte,10\n"),
+		Headers:      map[string]string{"ETag": `"v1"`},
+	})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil); err != nil {
+		t.Fatalf("primera descarga: %v", err)
+	}
+
+	ckan.SetResource("ventas", testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-02-01T00:00:00",
+		Body:         []byte("region,monto\nNorte,10\nSur,20\nCentro,30\n"),
+		Headers:      map[string]string{"ETag": `"v2"`},
+	})
+	_, stats, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil)
+	if err != nil {
+		t.Fatalf("segunda descarga: %v", err)
+	}
+	if stats.LoadedRows != 3 {
+		t.Errorf("%d filas, se esperaban las 3 de la versión nueva", stats.LoadedRows)
+	}
+
+	// El sidecar guarda los validadores de la versión nueva
+	meta, found := m.readMeta("ventas")
+	if !found || meta.ETag != `"v2"` || meta.LastModified != "2024-02-01T00:00:00" {
+		t.Errorf("metadata = %+v, se esperaban ETag v2 y last_modified de febrero", meta)
+	}
+}
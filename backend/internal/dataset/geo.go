@@ -0,0 +1,98 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// Precisión máxima en decimales (~11 cm)
+	maxGeoPrecision = 6
+	// Máximo de celdas retornadas
+	maxGeoCells = 10000
+)
+
+// GeoAggregateParams define la agregación de puntos en celdas de una rejilla
+type GeoAggregateParams struct {
+	LatColumn string                 `json:"lat_column"`
+	LonColumn string                 `json:"lon_column"`
+	Precision int                    `json:"precision"` // Decimales a los que se redondean las coordenadas
+	Filters   map[string]interface{} `json:"filters"`
+}
+
+// GetGeoAggregate cuenta los puntos por celda, redondeando lat/lon a la precisión indicada.
+// Cada celda se identifica por su coordenada redondeada y mide 10^-precision grados.
+func (m *Manager) GetGeoAggregate(ctx context.Context, uuid string, params GeoAggregateParams) (map[string]interface{}, error) {
+	if params.LatColumn == "" || params.LonColumn == "" {
+		return nil, fmt.Errorf("%w: columnas lat y lon requeridas", ErrInvalidParams)
+	}
+	if params.Precision < 0 || params.Precision > maxGeoPrecision {
+		return nil, fmt.Errorf("%w: precisión debe estar entre 0 y %d", ErrInvalidParams, maxGeoPrecision)
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{params.LatColumn, params.LonColumn}); err != nil {
+		return nil, err
+	}
+
+	lat := fmt.Sprintf(`TRY_CAST("%s" AS DOUBLE)`, params.LatColumn)
+	lon := fmt.Sprintf(`TRY_CAST("%s" AS DOUBLE)`, params.LonColumn)
+
+	conditions, args := m.buildFilterConditions(params.Filters, types)
+	conditions = append(conditions,
+		fmt.Sprintf("%s BETWEEN -90 AND 90", lat),
+		fmt.Sprintf("%s BETWEEN -180 AND 180", lon),
+	)
+
+	query := fmt.Sprintf(`
+		SELECT
+			ROUND(%s, %d) as lat,
+			ROUND(%s, %d) as lon,
+			COUNT(*) as count
+		FROM data
+		WHERE %s
+		GROUP BY 1, 2
+		ORDER BY count DESC
+		LIMIT %d
+	`, lat, params.Precision, lon, params.Precision, strings.Join(conditions, " AND "), maxGeoCells+1)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error ejecutando agregación geográfica: %w", err)
+	}
+	defer rows.Close()
+
+	cells, truncated, err := m.rowsToMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Se pide una celda de más para saber si el resultado quedó cortado
+	if len(cells) > maxGeoCells {
+		cells = cells[:maxGeoCells]
+		truncated = true
+	}
+
+	return map[string]interface{}{
+		"precision":   params.Precision,
+		"cell_size":   math.Pow(10, -float64(params.Precision)),
+		"cells":       cells,
+		"total_cells": len(cells),
+		"truncated":   truncated,
+	}, nil
+}
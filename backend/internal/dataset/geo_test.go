@@ -0,0 +1,105 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// puntosSQL tiene puntos cerca de dos ciudades y filas con coordenadas inválidas
+var puntosSQL = []string{
+	`CREATE TABLE data (tipo VARCHAR, lat DOUBLE, lon VARCHAR)`,
+	`INSERT INTO data VALUES
+		('robo', 19.432, '-99.133'), ('robo', 19.438, '-99.131'), ('choque', 19.441, '-99.127'),
+		('robo', 20.671, '-103.362'), ('choque', 20.674, '-103.358'),
+		('robo', 95.0, '-99.1'), ('robo', 19.4, 'sin dato'), ('robo', NULL, '-99.1')`,
+}
+
+func TestGeoAggregateRoundedCells(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "puntos", puntosSQL...)
+	ctx := context.Background()
+
+	counts := func(params GeoAggregateParams) map[string]int64 {
+		t.Helper()
+		result, err := m.GetGeoAggregate(ctx, "puntos", params)
+		if err != nil {
+			t.Fatalf("GetGeoAggregate: %v", err)
+		}
+		cells := make(map[string]int64)
+		for _, cell := range result["cells"].([]map[string]interface{}) {
+			cells[fmt.Sprintf("%v,%v", cell["lat"], cell["lon"])] = cell["count"].(int64)
+		}
+		return cells
+	}
+
+	// Con un decimal los puntos de cada ciudad caen en una celda; las
+	// coordenadas fuera de rango o no numéricas se descartan
+	cells := counts(GeoAggregateParams{LatColumn: "lat", LonColumn: "lon", Precision: 1})
+	want := map[string]int64{"19.4,-99.1": 3, "20.7,-103.4": 2}
+	if len(cells) != len(want) {
+		t.Fatalf("celdas = %v, se esperaban %v", cells, want)
+	}
+	for cell, n := range want {
+		if cells[cell] != n {
+			t.Errorf("celda %s = %d, se esperaban %d", cell, cells[cell], n)
+		}
+	}
+
+	// Con dos decimales las celdas se separan, y los filtros se aplican
+	cells = counts(GeoAggregateParams{LatColumn: "lat", LonColumn: "lon", Precision: 2, Filters: map[string]interface{}{"tipo": "robo"}})
+	want = map[string]int64{"19.43,-99.13": 1, "19.44,-99.13": 1, "20.67,-103.36": 1}
+	if len(cells) != len(want) {
+		t.Fatalf("celdas = %v, se esperaban %v", cells, want)
+	}
+	for cell, n := range want {
+		if cells[cell] != n {
+			t.Errorf("celda %s = %d, se esperaban %d", cell, cells[cell], n)
+		}
+	}
+}
+
+func TestGeoAggregateValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "puntos", puntosSQL...)
+
+	for _, params := range []GeoAggregateParams{
+		{LatColumn: "lat"},
+		{LatColumn: "lat", LonColumn: "lon", Precision: maxGeoPrecision + 1},
+		{LatColumn: "lat", LonColumn: "lon", Precision: -1},
+		{LatColumn: "latitud", LonColumn: "lon"},
+	} {
+		if _, err := m.GetGeoAggregate(context.Background(), "puntos", params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%+v: err = %v, se esperaba ErrInvalidParams", params, err)
+		}
+	}
+}
+
+func TestGeoAggregateTruncated(t *testing.T) {
+	m := newTestManager(t, Options{})
+	// Exactamente maxGeoCells celdas distintas con precisión 0
+	writeDataset(t, m, "rejilla",
+		`CREATE TABLE data AS SELECT (i % 180) - 89 AS lat, (i // 180) - 179 AS lon FROM range(`+fmt.Sprint(maxGeoCells)+`) t(i)`)
+	ctx := context.Background()
+	params := GeoAggregateParams{LatColumn: "lat", LonColumn: "lon"}
+
+	result, err := m.GetGeoAggregate(ctx, "rejilla", params)
+	if err != nil {
+		t.Fatalf("GetGeoAggregate: %v", err)
+	}
+	if result["total_cells"] != maxGeoCells || result["truncated"] != false {
+		t.Errorf("total_cells = %v, truncated = %v; se esperaban %d sin corte", result["total_cells"], result["truncated"], maxGeoCells)
+	}
+
+	// Una celda más ya no cabe
+	writeDataset(t, m, "rejilla_mas",
+		`CREATE TABLE data AS SELECT (i % 180) - 89 AS lat, (i // 180) - 179 AS lon FROM range(`+fmt.Sprint(maxGeoCells+1)+`) t(i)`)
+	result, err = m.GetGeoAggregate(ctx, "rejilla_mas", params)
+	if err != nil {
+		t.Fatalf("GetGeoAggregate: %v", err)
+	}
+	if result["total_cells"] != maxGeoCells || result["truncated"] != true {
+		t.Errorf("total_cells = %v, truncated = %v; se esperaban %d con corte", result["total_cells"], result["truncated"], maxGeoCells)
+	}
+}
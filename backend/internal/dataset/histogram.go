@@ -0,0 +1,269 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Bins por defecto y máximo de un histograma
+	defaultHistogramBins = 20
+	maxHistogramBins     = 200
+	// Cortes máximos de los rangos personalizados
+	maxRangeBreaks = 100
+)
+
+// HistogramBin es un intervalo [BinStart, BinEnd) del histograma; el último incluye BinEnd
+type HistogramBin struct {
+	BinStart float64 `json:"bin_start"`
+	BinEnd   float64 `json:"bin_end"`
+	Count    int64   `json:"count"`
+}
+
+// requireNumericColumn valida que la columna exista y sea numérica
+func (m *Manager) requireNumericColumn(ctx context.Context, conn *sql.DB, column string) error {
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		if col.Name != column {
+			continue
+		}
+		if !isNumericType(col.Type) {
+			return fmt.Errorf("%w: la columna %q no es numérica (%s)", ErrInvalidParams, column, col.Type)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: columna inexistente %q", ErrInvalidParams, column)
+}
+
+// GetHistogram calcula un histograma de bins de igual ancho sobre una columna numérica.
+// Si todos los valores son iguales se retorna un único bin.
+func (m *Manager) GetHistogram(ctx context.Context, uuid, column string, bins int, filters map[string]interface{}) (map[string]interface{}, error) {
+	if bins <= 0 {
+		bins = defaultHistogramBins
+	}
+	if bins > maxHistogramBins {
+		bins = maxHistogramBins
+	}
+
+	if err := m.validateFilters(filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.requireNumericColumn(ctx, conn, column); err != nil {
+		return nil, err
+	}
+
+	value := fmt.Sprintf(`CAST("%s" AS DOUBLE)`, column)
+	conditions, args := m.buildFilterConditions(filters, types)
+	conditions = append(conditions, fmt.Sprintf(`"%s" IS NOT NULL`, column))
+	where := strings.Join(conditions, " AND ")
+
+	result := map[string]interface{}{
+		"column": column,
+		"bins":   []HistogramBin{},
+		"total":  int64(0),
+	}
+
+	var total int64
+	var minVal, maxVal *float64
+	rangeQuery := fmt.Sprintf("SELECT COUNT(*), MIN(%s), MAX(%s) FROM data WHERE %s", value, value, where)
+	if err := conn.QueryRowContext(ctx, rangeQuery, args...).Scan(&total, &minVal, &maxVal); err != nil {
+		return nil, fmt.Errorf("error obteniendo rango: %w", err)
+	}
+	if total == 0 || minVal == nil || maxVal == nil {
+		return result, nil
+	}
+	result["total"] = total
+	result["min"] = *minVal
+	result["max"] = *maxVal
+
+	if *minVal == *maxVal {
+		result["bins"] = []HistogramBin{{BinStart: *minVal, BinEnd: *maxVal, Count: total}}
+		return result, nil
+	}
+
+	// El máximo cae en el último bin en lugar de abrir uno nuevo
+	width := (*maxVal - *minVal) / float64(bins)
+	query := fmt.Sprintf(`
+		SELECT LEAST(CAST(FLOOR((%s - ?) / ?) AS BIGINT), ?) as bin, COUNT(*) as count
+		FROM data
+		WHERE %s
+		GROUP BY 1
+	`, value, where)
+	queryArgs := append([]interface{}{*minVal, width, bins - 1}, args...)
+
+	rows, err := conn.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando histograma: %w", err)
+	}
+	defer rows.Close()
+
+	histogram := make([]HistogramBin, bins)
+	for i := range histogram {
+		histogram[i].BinStart = *minVal + float64(i)*width
+		histogram[i].BinEnd = *minVal + float64(i+1)*width
+	}
+	histogram[bins-1].BinEnd = *maxVal
+
+	for rows.Next() {
+		var bin int
+		var count int64
+		if err := rows.Scan(&bin, &count); err != nil {
+			return nil, err
+		}
+		if bin >= 0 && bin < bins {
+			histogram[bin].Count += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result["bins"] = histogram
+	return result, nil
+}
+
+// RangeBucketParams define rangos con cortes arbitrarios (no equiespaciados).
+// Breaks [0, 1000, 5000] da los rangos [0, 1000) y [1000, 5000]; Labels, si
+// viene, nombra cada rango
+type RangeBucketParams struct {
+	Breaks  []float64              `json:"breaks"`
+	Labels  []string               `json:"labels"`
+	Filters map[string]interface{} `json:"filters"`
+}
+
+// RangeBucket es el conteo de un rango [From, To); el último incluye To
+type RangeBucket struct {
+	Label string  `json:"label"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int64   `json:"count"`
+}
+
+// GetRangeBuckets cuenta los valores de una columna numérica en los rangos
+// dados. Los valores fuera de los cortes se reportan en below y above.
+func (m *Manager) GetRangeBuckets(ctx context.Context, uuid, column string, params RangeBucketParams) (map[string]interface{}, error) {
+	breaks := params.Breaks
+	if len(breaks) < 2 {
+		return nil, fmt.Errorf("%w: se requieren al menos dos cortes", ErrInvalidParams)
+	}
+	if len(breaks) > maxRangeBreaks {
+		return nil, fmt.Errorf("%w: máximo %d cortes", ErrInvalidParams, maxRangeBreaks)
+	}
+	for i := 1; i < len(breaks); i++ {
+		if breaks[i] <= breaks[i-1] {
+			return nil, fmt.Errorf("%w: los cortes deben ser estrictamente crecientes", ErrInvalidParams)
+		}
+	}
+	if len(params.Labels) > 0 && len(params.Labels) != len(breaks)-1 {
+		return nil, fmt.Errorf("%w: se esperaban %d etiquetas", ErrInvalidParams, len(breaks)-1)
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.requireNumericColumn(ctx, conn, column); err != nil {
+		return nil, err
+	}
+
+	// -1 debajo del primer corte, i para [breaks[i], breaks[i+1]) y
+	// len(breaks)-1 arriba del último; el último rango incluye su límite
+	last := len(breaks) - 1
+	value := fmt.Sprintf(`CAST("%s" AS DOUBLE)`, column)
+	cases := []string{fmt.Sprintf("WHEN %s < ? THEN -1", value)}
+	args := []interface{}{breaks[0]}
+	for i := 1; i < last; i++ {
+		cases = append(cases, fmt.Sprintf("WHEN %s < ? THEN %d", value, i-1))
+		args = append(args, breaks[i])
+	}
+	cases = append(cases, fmt.Sprintf("WHEN %s <= ? THEN %d", value, last-1))
+	args = append(args, breaks[last])
+
+	conditions, filterArgs := m.buildFilterConditions(params.Filters, types)
+	conditions = append(conditions, fmt.Sprintf(`"%s" IS NOT NULL`, column))
+	args = append(args, filterArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT CASE %s ELSE %d END as bucket, COUNT(*) as count
+		FROM data
+		WHERE %s
+		GROUP BY 1
+	`, strings.Join(cases, " "), last, strings.Join(conditions, " AND "))
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando rangos: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make([]RangeBucket, last)
+	for i := range buckets {
+		buckets[i] = RangeBucket{From: breaks[i], To: breaks[i+1]}
+		if len(params.Labels) > 0 {
+			buckets[i].Label = params.Labels[i]
+		} else {
+			buckets[i].Label = formatBreak(breaks[i]) + " - " + formatBreak(breaks[i+1])
+		}
+	}
+
+	var below, above, total int64
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		total += count
+		switch {
+		case bucket < 0:
+			below += count
+		case bucket >= last:
+			above += count
+		default:
+			buckets[bucket].Count += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"column":  column,
+		"buckets": buckets,
+		"below":   below,
+		"above":   above,
+		"total":   total,
+	}, nil
+}
+
+// formatBreak formatea un corte sin decimales innecesarios (1000 y no 1000.000000)
+func formatBreak(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
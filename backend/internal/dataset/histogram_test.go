@@ -0,0 +1,166 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// valoresSQL crea los enteros 0..100 con su paridad
+var valoresSQL = []string{
+	`CREATE TABLE data AS SELECT i as valor, CASE WHEN i % 2 = 0 THEN 'par' ELSE 'impar' END as paridad FROM range(0, 101) t(i)`,
+}
+
+func TestHistogramBins(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "valores", valoresSQL...)
+
+	result, err := m.GetHistogram(context.Background(), "valores", "valor", 4, nil)
+	if err != nil {
+		t.Fatalf("GetHistogram: %v", err)
+	}
+
+	// El máximo (100) cae en el último bin
+	want := []HistogramBin{
+		{BinStart: 0, BinEnd: 25, Count: 25},
+		{BinStart: 25, BinEnd: 50, Count: 25},
+		{BinStart: 50, BinEnd: 75, Count: 25},
+		{BinStart: 75, BinEnd: 100, Count: 26},
+	}
+	bins := result["bins"].([]HistogramBin)
+	if len(bins) != len(want) {
+		t.Fatalf("bins = %+v, se esperaban %d", bins, len(want))
+	}
+	for i, bin := range bins {
+		if bin != want[i] {
+			t.Errorf("bin %d = %+v, se esperaba %+v", i, bin, want[i])
+		}
+	}
+	if result["total"] != int64(101) {
+		t.Errorf("total = %v, se esperaban 101", result["total"])
+	}
+}
+
+func TestHistogramWithFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "valores", valoresSQL...)
+
+	result, err := m.GetHistogram(context.Background(), "valores", "valor", 2, map[string]interface{}{"paridad": "impar"})
+	if err != nil {
+		t.Fatalf("GetHistogram: %v", err)
+	}
+	// Impares de 1 a 99: bins [1, 50) y [50, 99]
+	bins := result["bins"].([]HistogramBin)
+	if len(bins) != 2 || bins[0].BinStart != 1 || bins[1].BinEnd != 99 || bins[0].Count != 25 || bins[1].Count != 25 {
+		t.Errorf("bins = %+v, se esperaban dos bins de 25 entre 1 y 99", bins)
+	}
+}
+
+func TestHistogramSingleValue(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "constante", `CREATE TABLE data AS SELECT 7 as valor FROM range(5)`)
+
+	result, err := m.GetHistogram(context.Background(), "constante", "valor", 10, nil)
+	if err != nil {
+		t.Fatalf("GetHistogram: %v", err)
+	}
+	bins := result["bins"].([]HistogramBin)
+	if len(bins) != 1 || bins[0] != (HistogramBin{BinStart: 7, BinEnd: 7, Count: 5}) {
+		t.Errorf("bins = %+v, se esperaba un único bin con los 5 valores", bins)
+	}
+}
+
+func TestHistogramValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "valores", valoresSQL...)
+	ctx := context.Background()
+
+	for _, column := range []string{"paridad", "inexistente"} {
+		if _, err := m.GetHistogram(ctx, "valores", column, 10, nil); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", column, err)
+		}
+	}
+
+	// Sin filas que cumplan no hay bins
+	result, err := m.GetHistogram(ctx, "valores", "valor", 10, map[string]interface{}{"paridad": "ninguna"})
+	if err != nil {
+		t.Fatalf("GetHistogram sin filas: %v", err)
+	}
+	if bins := result["bins"].([]HistogramBin); len(bins) != 0 {
+		t.Errorf("bins = %+v, se esperaba vacío", bins)
+	}
+}
+
+func TestRangeBuckets(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "valores", valoresSQL...)
+
+	// Rangos no equiespaciados; 0..4 queda debajo y 91..100 arriba
+	result, err := m.GetRangeBuckets(context.Background(), "valores", "valor", RangeBucketParams{
+		Breaks: []float64{5, 10, 50, 90},
+	})
+	if err != nil {
+		t.Fatalf("GetRangeBuckets: %v", err)
+	}
+
+	want := []RangeBucket{
+		{Label: "5 - 10", From: 5, To: 10, Count: 5},
+		{Label: "10 - 50", From: 10, To: 50, Count: 40},
+		{Label: "50 - 90", From: 50, To: 90, Count: 41},
+	}
+	buckets := result["buckets"].([]RangeBucket)
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets = %+v, se esperaban %d", buckets, len(want))
+	}
+	for i, bucket := range buckets {
+		if bucket != want[i] {
+			t.Errorf("rango %d = %+v, se esperaba %+v", i, bucket, want[i])
+		}
+	}
+	if result["below"] != int64(5) || result["above"] != int64(10) || result["total"] != int64(101) {
+		t.Errorf("below/above/total = %v/%v/%v, se esperaban 5/10/101", result["below"], result["above"], result["total"])
+	}
+}
+
+func TestRangeBucketsLabelsAndFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "valores", valoresSQL...)
+
+	result, err := m.GetRangeBuckets(context.Background(), "valores", "valor", RangeBucketParams{
+		Breaks:  []float64{0, 1.5, 100},
+		Labels:  []string{"bajo", "alto"},
+		Filters: map[string]interface{}{"paridad": "par"},
+	})
+	if err != nil {
+		t.Fatalf("GetRangeBuckets: %v", err)
+	}
+	// Pares: 0 es bajo y 2..100 son altos
+	buckets := result["buckets"].([]RangeBucket)
+	if buckets[0].Label != "bajo" || buckets[0].Count != 1 || buckets[1].Label != "alto" || buckets[1].Count != 50 {
+		t.Errorf("buckets = %+v, se esperaban bajo 1 y alto 50", buckets)
+	}
+}
+
+func TestRangeBucketsValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "valores", valoresSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		column string
+		params RangeBucketParams
+	}{
+		{"un solo corte", "valor", RangeBucketParams{Breaks: []float64{10}}},
+		{"cortes no crecientes", "valor", RangeBucketParams{Breaks: []float64{10, 10, 20}}},
+		{"demasiados cortes", "valor", RangeBucketParams{Breaks: make([]float64, maxRangeBreaks+1)}},
+		{"etiquetas de más", "valor", RangeBucketParams{Breaks: []float64{0, 10}, Labels: []string{"a", "b"}}},
+		{"columna de texto", "paridad", RangeBucketParams{Breaks: []float64{0, 10}}},
+		{"columna inexistente", "monto", RangeBucketParams{Breaks: []float64{0, 10}}},
+	}
+	for _, tt := range tests {
+		if _, err := m.GetRangeBuckets(ctx, "valores", tt.column, tt.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// columnUsage cuenta cuántas veces se ha filtrado por cada columna
+type columnUsage struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// recordFilterUsage registra las columnas usadas en filtros para un dataset.
+// types es el esquema que ya cargó filterTypes. Solo cuenta columnas de la
+// tabla: keys arbitrarias de los clientes harían crecer el registro y fallar a
+// Reindex
+func (m *Manager) recordFilterUsage(uuid string, filters map[string]interface{}, types columnTypes) {
+	if len(filters) == 0 {
+		return
+	}
+
+	value, _ := m.filterUsage.LoadOrStore(uuid, &columnUsage{counts: make(map[string]int)})
+	usage := value.(*columnUsage)
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	for key, val := range filters {
+		if isSkippedFilterValue(val) {
+			continue
+		}
+		// Un rango de fechas cuenta como uso de su columna
+		column := filterColumn(key, val, types)
+		if _, ok := types[column]; !ok {
+			continue
+		}
+		usage.counts[column]++
+	}
+}
+
+// GetFilterUsage retorna las columnas filtradas de un dataset, de la más a la menos usada
+func (m *Manager) GetFilterUsage(uuid string) []string {
+	value, ok := m.filterUsage.Load(uuid)
+	if !ok {
+		return nil
+	}
+	usage := value.(*columnUsage)
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	columns := make([]string, 0, len(usage.counts))
+	for col := range usage.counts {
+		columns = append(columns, col)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if usage.counts[columns[i]] != usage.counts[columns[j]] {
+			return usage.counts[columns[i]] > usage.counts[columns[j]]
+		}
+		return columns[i] < columns[j]
+	})
+	return columns
+}
+
+// Reindex recrea los índices de un dataset solo sobre las columnas indicadas,
+// borrando los que ya no se usan. Si no se indican columnas se usan las
+// columnas registradas en el uso real de filtros; sin ninguna de las dos no
+// hay con qué reindexar y se rechaza, en vez de borrar todos los índices.
+func (m *Manager) Reindex(ctx context.Context, uuid string, columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		columns = m.GetFilterUsage(uuid)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: no se indicaron columnas ni hay uso de filtros registrado", ErrInvalidParams)
+	}
+
+	dbPath, found := m.cacheManager.GetFromMemory(uuid)
+	if !found {
+		dbPath, found = m.cacheManager.GetFromDisk(uuid)
+	}
+	if !found {
+		return nil, fmt.Errorf("dataset %s no está en cache", uuid)
+	}
+
+	// Validar columnas contra el esquema
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.validateColumns(ctx, conn, columns); err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]string, len(columns))
+	for _, col := range columns {
+		wanted[indexName(col)] = col
+	}
+
+	// La conexión del pool es read-only, hay que cerrarla para escribir. El
+	// lock evita que otra consulta la vuelva a abrir mientras tanto
+	lock := m.datasetLock(uuid)
+	lock.Lock()
+	defer lock.Unlock()
+	m.closeConnection(uuid)
+
+	rw, err := sql.Open("duckdb", m.connectionDSN(dbPath, false))
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DuckDB: %w", err)
+	}
+	defer rw.Close()
+
+	existing, err := m.listIndexes(ctx, rw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Borrar índices que no corresponden a las columnas pedidas
+	for _, name := range existing {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		if _, err := rw.ExecContext(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS "%s"`, name)); err != nil {
+			log.Printf("Warning: no se pudo borrar el índice %s: %v", name, err)
+		}
+	}
+
+	// Crear los índices faltantes
+	for _, col := range wanted {
+		if err := m.createIndex(ctx, rw, col); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := rw.ExecContext(ctx, "CHECKPOINT"); err != nil {
+		log.Printf("Warning: error en checkpoint: %v", err)
+	}
+
+	indexes, err := m.listIndexes(ctx, rw)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("📊 Reindexado %s: %d índices", uuid, len(indexes))
+	return indexes, nil
+}
+
+// listIndexes lista los índices de la tabla data
+func (m *Manager) listIndexes(ctx context.Context, conn *sql.DB) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT index_name FROM duckdb_indexes() WHERE table_name = 'data' ORDER BY index_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, name)
+	}
+	return indexes, rows.Err()
+}
@@ -0,0 +1,175 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// ventasIndexadasSQL es ventasSQL con un índice previo sobre monto
+var ventasIndexadasSQL = append(append([]string{}, ventasSQL...), `CREATE INDEX idx_monto ON data (monto)`)
+
+func TestReindexRequestedColumns(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasIndexadasSQL...)
+	ctx := context.Background()
+
+	indexes, err := m.Reindex(ctx, "ventas", []string{"region", "producto"})
+	if err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	if want := []string{"idx_producto", "idx_region"}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("índices = %v, se esperaban %v", indexes, want)
+	}
+
+	// La conexión read-only se vuelve a abrir y ve los índices nuevos
+	conn, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	listed, err := m.listIndexes(ctx, conn)
+	if err != nil {
+		t.Fatalf("listIndexes: %v", err)
+	}
+	if !reflect.DeepEqual(listed, indexes) {
+		t.Errorf("índices tras reabrir = %v, se esperaban %v", listed, indexes)
+	}
+}
+
+func TestReindexFromFilterUsage(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasIndexadasSQL...)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"producto": "Pan"}}); err != nil {
+			t.Fatalf("GetFilteredData: %v", err)
+		}
+	}
+	if _, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"region": "Sur"}}); err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+
+	if usage, want := m.GetFilterUsage("ventas"), []string{"producto", "region"}; !reflect.DeepEqual(usage, want) {
+		t.Errorf("uso de filtros = %v, se esperaba %v", usage, want)
+	}
+
+	indexes, err := m.Reindex(ctx, "ventas", nil)
+	if err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	if want := []string{"idx_producto", "idx_region"}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("índices = %v, se esperaban %v", indexes, want)
+	}
+}
+
+func TestFilterUsageCountsDateRangeColumn(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasIndexadasSQL...)
+	ctx := context.Background()
+
+	// Un rango de fechas cuenta para su columna
+	if _, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{
+		"fecha_range": map[string]interface{}{"from": "2024-01-01"},
+	}}); err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+
+	if usage, want := m.GetFilterUsage("ventas"), []string{"fecha"}; !reflect.DeepEqual(usage, want) {
+		t.Errorf("uso de filtros = %v, se esperaba %v", usage, want)
+	}
+
+	indexes, err := m.Reindex(ctx, "ventas", nil)
+	if err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	if want := []string{"idx_fecha"}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("índices = %v, se esperaban %v", indexes, want)
+	}
+}
+
+func TestReindexRejectsInvalidColumns(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasIndexadasSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		columns []string
+	}{
+		{"sin columnas ni uso registrado", nil},
+		{"columna inexistente", []string{"region", "no_existe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Reindex(ctx, "ventas", tt.columns); !errors.Is(err, ErrInvalidParams) {
+				t.Fatalf("Reindex: err = %v, se esperaba ErrInvalidParams", err)
+			}
+		})
+	}
+
+	// Los índices existentes no se tocan
+	conn, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	indexes, err := m.listIndexes(ctx, conn)
+	if err != nil {
+		t.Fatalf("listIndexes: %v", err)
+	}
+	if want := []string{"idx_monto"}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("índices = %v, se esperaban %v", indexes, want)
+	}
+}
+
+func TestFilterUsageIgnoresUnknownKeys(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	for _, key := range []string{"no_existe", "otra_key"} {
+		m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{key: "x"}})
+	}
+	if usage := m.GetFilterUsage("ventas"); len(usage) != 0 {
+		t.Errorf("uso de filtros = %v, no debería registrar columnas inexistentes", usage)
+	}
+
+	// Una key inexistente que no filtra se acepta, pero no hace fallar al
+	// reindexado por uso
+	if _, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"region": "Sur", "no_existe": "Todas"}}); err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if _, err := m.Reindex(ctx, "ventas", nil); err != nil {
+		t.Errorf("Reindex: %v", err)
+	}
+}
+
+func TestReindexWaitsForConnections(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasIndexadasSQL...)
+	ctx := context.Background()
+
+	// Abrir conexiones mientras se reindexa no debe chocar con el archivo
+	// abierto en modo escritura
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.GetConnection(ctx, "ventas"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	if _, err := m.Reindex(ctx, "ventas", []string{"region"}); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("GetConnection durante Reindex: %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package dataset
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,66 +17,85 @@ import (
 	"visor-datos-abiertos-go/internal/ckan"
 )
 
-func (m *Manager) downloadAndConvertWithProgress(ctx context.Context, uuid string, progressCallback func(downloaded, total int64)) (string, error) {
+// downloadAndConvertWithProgress descarga el CSV de uuid y lo carga en DuckDB.
+// beforeReplace, si no es nil, se llama con la carga terminada justo antes de
+// reemplazar la copia en cache; si retorna error se descarta la carga nueva
+// y la copia anterior queda intacta.
+func (m *Manager) downloadAndConvertWithProgress(ctx context.Context, uuid string, opts DownloadOptions, progressCallback func(downloaded, total int64), beforeReplace func() error) (string, *LoadStats, error) {
 	// 1. Obtener info del recurso
 	resource, err := m.ckanClient.GetResource(ctx, uuid)
 	if err != nil {
-		return "", fmt.Errorf("error obteniendo recurso de CKAN: %w", err)
+		return "", nil, fmt.Errorf("error obteniendo recurso de CKAN: %w", err)
 	}
 
 	log.Printf("📦 Recurso: %s (%s)", resource.Name, resource.Format)
 	log.Printf("📍 URL: %s", resource.URL)
 
+	cacheDir := m.cacheManager.GetCacheDir()
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("error creando directorio cache: %w", err)
+	}
+	dbPath := filepath.Join(cacheDir, fmt.Sprintf("%s.duckdb", uuid))
+
+	// Si ya hay una copia en cache, solo descargar si CKAN tiene una más nueva.
+	// El modo all_varchar recarga aunque no haya cambios, para reemplazar la
+	// copia tipada.
+	var prev, conditional *datasetMeta
+	if _, err := os.Stat(dbPath); err == nil {
+		prev, _ = m.readMeta(uuid)
+		if prev != nil && !opts.AllVarchar {
+			if !resourceIsNewer(resource.LastModified, prev.LastModified) {
+				return dbPath, nil, errNotModified
+			}
+			conditional = prev
+		}
+	}
+
 	// 2. Crear archivo temporal para CSV
 	tmpCSV := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%d.csv", uuid, time.Now().Unix()))
 	defer os.Remove(tmpCSV)
 
-	// 3. Descargar CSV con progreso
-	if err := m.downloadFileWithProgress(ctx, resource.URL, tmpCSV, progressCallback); err != nil {
-		return "", fmt.Errorf("error descargando CSV: %w", err)
+	// 3. Descargar CSV con progreso (condicional si hay copia previa)
+	meta, err := m.downloadFileWithProgress(ctx, resource.URL, tmpCSV, conditional, progressCallback)
+	if err != nil {
+		if errors.Is(err, errNotModified) {
+			return dbPath, nil, err
+		}
+		return "", nil, fmt.Errorf("error descargando CSV: %w", err)
 	}
 
 	log.Printf("✓ CSV descargado: %s", tmpCSV)
 
-	// 4. Crear DuckDB DIRECTAMENTE en el directorio de cache
-	cacheDir := m.cacheManager.GetCacheDir()
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return "", fmt.Errorf("error creando directorio cache: %w", err)
-	}
-
-	dbPath := filepath.Join(cacheDir, fmt.Sprintf("%s.duckdb", uuid))
+	// 4. Crear DuckDB en un archivo temporal del directorio de cache; se reemplaza
+	// la copia anterior solo cuando la carga termina bien
+	tmpDB := dbPath + ".tmp"
+	os.Remove(tmpDB)
+	os.Remove(tmpDB + ".wal")
 
 	log.Printf("📂 Creando DuckDB en cache: %s", dbPath)
 
-	conn, err := sql.Open("duckdb", dbPath)
+	conn, err := sql.Open("duckdb", tmpDB)
 	if err != nil {
-		return "", fmt.Errorf("error creando DuckDB: %w", err)
+		return "", nil, fmt.Errorf("error creando DuckDB: %w", err)
 	}
 	defer conn.Close()
 
+	// Si la carga falla o se cancela no dejar un archivo a medias en el cache
+	success := false
+	defer func() {
+		if !success {
+			conn.Close()
+			os.Remove(tmpDB)
+			os.Remove(tmpDB + ".wal")
+		}
+	}()
+
 	// 5. Cargar CSV en DuckDB
 	log.Printf("🔄 Convirtiendo CSV a DuckDB...")
 
-	query := fmt.Sprintf(`
-        CREATE TABLE data AS 
-        SELECT * FROM read_csv_auto('%s',
-            header = true,
-            ignore_errors = true,
-            sample_size = -1,
-            null_padding = true,
-            dateformat = '%%Y-%%m-%%d'
-        )
-    `, tmpCSV)
-
-	if _, err := conn.ExecContext(ctx, query); err != nil {
-		return "", fmt.Errorf("error cargando CSV en DuckDB: %w", err)
-	}
-
-	// 6. Obtener estadísticas
-	var rowCount int64
-	err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&rowCount)
-	if err == nil {
-		log.Printf("✓ Cargados %d registros", rowCount)
+	stats, err := m.loadCSV(ctx, conn, uuid, tmpCSV, opts.AllVarchar)
+	if err != nil {
+		return "", nil, err
 	}
 
 	// 7. Crear índices
@@ -87,14 +109,119 @@ func (m *Manager) downloadAndConvertWithProgress(ctx context.Context, uuid strin
 		log.Printf("Warning: error en checkpoint: %v", err)
 	}
 
+	// 9. Reemplazar la copia anterior, conservándola como versión histórica
+	if err := conn.Close(); err != nil {
+		return "", nil, fmt.Errorf("error cerrando DuckDB: %w", err)
+	}
+	if beforeReplace != nil {
+		if err := beforeReplace(); err != nil {
+			return "", nil, err
+		}
+	}
+	os.Remove(dbPath + ".wal")
+	m.archiveVersion(uuid, dbPath, prev)
+	if err := os.Rename(tmpDB, dbPath); err != nil {
+		return "", nil, fmt.Errorf("error moviendo DuckDB al cache: %w", err)
+	}
+	success = true
+
+	meta.LastModified = resource.LastModified
+	meta.DownloadedAt = time.Now()
+	meta.setLoadStats(stats)
+	if err := m.writeMeta(uuid, meta); err != nil {
+		log.Printf("Warning: error guardando metadata de %s: %v", uuid, err)
+	}
+
 	log.Printf("✓ DuckDB creado exitosamente: %s", dbPath)
-	return dbPath, nil // Retorna el path de la cache
+	return dbPath, stats, nil // Retorna el path de la cache
+}
+
+// ErrDownloadTooLarge indica que el archivo excede el tamaño máximo de descarga
+var ErrDownloadTooLarge = errors.New("archivo demasiado grande")
+
+// tooLarge retorna el error de un archivo que excede maxDownloadBytes
+func (m *Manager) tooLarge(size int64) error {
+	return fmt.Errorf("%w: %.2f MB excede el máximo de %.2f MB", ErrDownloadTooLarge,
+		float64(size)/(1024*1024), float64(m.maxDownloadBytes)/(1024*1024))
+}
+
+// exceedsDownloadLimit indica si size pasa del tamaño máximo de descarga
+func (m *Manager) exceedsDownloadLimit(size int64) bool {
+	return m.maxDownloadBytes > 0 && size > m.maxDownloadBytes
+}
+
+// ErrUnexpectedContent indica que la URL del recurso no retornó un CSV, p.ej.
+// la página de error HTML de un enlace roto
+var ErrUnexpectedContent = errors.New("el recurso no es un CSV")
+
+// checkCSVPayload revisa el Content-Type y los primeros bytes de la respuesta
+// y rechaza las páginas HTML y los errores JSON, que read_csv_auto cargaría
+// como una tabla de una sola columna. Retorna el body para seguir leyendo
+// sin perder los bytes ya inspeccionados.
+func checkCSVPayload(resp *http.Response, url string) (io.Reader, error) {
+	body := bufio.NewReaderSize(resp.Body, 32*1024)
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if kind := payloadKindFromContentType(contentType); kind != "" {
+		return nil, fmt.Errorf("%w: la URL retornó %s (Content-Type %s); revisa el enlace del recurso en CKAN: %s",
+			ErrUnexpectedContent, kind, contentType, url)
+	}
+
+	head, err := body.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if kind := payloadKindFromBytes(head); kind != "" {
+		return nil, fmt.Errorf("%w: la URL retornó %s; revisa el enlace del recurso en CKAN: %s",
+			ErrUnexpectedContent, kind, url)
+	}
+	return body, nil
+}
+
+// payloadKindFromContentType describe el tipo de contenido si no puede ser un CSV
+func payloadKindFromContentType(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "html"):
+		return "una página HTML"
+	case strings.Contains(contentType, "json"):
+		return "un documento JSON"
+	}
+	return ""
 }
 
-func (m *Manager) downloadFileWithProgress(ctx context.Context, url, filepath string, progressCallback func(downloaded, total int64)) error {
+// payloadKindFromBytes describe el contenido si los primeros bytes son de un
+// documento HTML, XML o JSON; ningún encabezado de CSV empieza así
+func payloadKindFromBytes(head []byte) string {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.ToLower(bytes.TrimSpace(head))
+	switch {
+	case bytes.HasPrefix(head, []byte("<!doctype html")), bytes.HasPrefix(head, []byte("<html")):
+		return "una página HTML"
+	case bytes.HasPrefix(head, []byte("<?xml")):
+		return "un documento XML"
+	case bytes.HasPrefix(head, []byte("{")):
+		return "un documento JSON"
+	}
+	return ""
+}
+
+// downloadFileWithProgress descarga el archivo reportando progreso. Si prev trae
+// validadores HTTP la petición es condicional y un 304 retorna errNotModified.
+// Retorna los validadores de la respuesta.
+func (m *Manager) downloadFileWithProgress(ctx context.Context, url, filepath string, prev *datasetMeta, progressCallback func(downloaded, total int64)) (*datasetMeta, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	m.ckanClient.AuthorizeRequest(req)
+
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.HTTPLastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.HTTPLastModified)
+		}
 	}
 
 	client := &http.Client{
@@ -105,22 +232,39 @@ func (m *Manager) downloadFileWithProgress(ctx context.Context, url, filepath st
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error en request: %w", err)
+		return nil, fmt.Errorf("error en request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		log.Printf("✓ El servidor reporta el archivo sin cambios (304)")
+		return nil, errNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error: status %d", resp.StatusCode)
+		return nil, fmt.Errorf("HTTP error: status %d", resp.StatusCode)
+	}
+
+	validators := &datasetMeta{
+		ETag:             resp.Header.Get("ETag"),
+		HTTPLastModified: resp.Header.Get("Last-Modified"),
 	}
 
 	totalSize := resp.ContentLength
 	if totalSize > 0 {
 		log.Printf("📦 Tamaño del archivo: %.2f MB", float64(totalSize)/(1024*1024))
 	}
+	if m.exceedsDownloadLimit(totalSize) {
+		return nil, m.tooLarge(totalSize)
+	}
+
+	body, err := checkCSVPayload(resp, url)
+	if err != nil {
+		return nil, err
+	}
 
 	out, err := os.Create(filepath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer out.Close()
 
@@ -129,17 +273,29 @@ func (m *Manager) downloadFileWithProgress(ctx context.Context, url, filepath st
 	lastLog := time.Now()
 
 	for {
-		nr, er := resp.Body.Read(buf)
+		// Respetar cancelación entre lecturas
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		nr, er := body.Read(buf)
 		if nr > 0 {
 			nw, ew := out.Write(buf[0:nr])
 			if nw > 0 {
 				written += int64(nw)
 			}
 			if ew != nil {
-				return ew
+				return nil, ew
 			}
 			if nr != nw {
-				return io.ErrShortWrite
+				return nil, io.ErrShortWrite
+			}
+
+			// Sin Content-Length (chunked) el límite se aplica sobre lo escrito
+			if m.exceedsDownloadLimit(written) {
+				out.Close()
+				os.Remove(filepath)
+				return nil, m.tooLarge(written)
 			}
 
 			// Callback de progreso
@@ -163,177 +319,190 @@ func (m *Manager) downloadFileWithProgress(ctx context.Context, url, filepath st
 		}
 		if er != nil {
 			if er != io.EOF {
-				return er
+				return nil, er
 			}
 			break
 		}
 	}
 
 	log.Printf("✓ Descarga completa: %.2f MB", float64(written)/(1024*1024))
-	return nil
+	return validators, nil
 }
 
-// downloadAndConvert descarga el CSV desde CKAN y lo convierte a DuckDB
-func (m *Manager) downloadAndConvert(ctx context.Context, uuid string) (string, error) {
-
-	// 1. Obtener info del recurso desde CKAN
-	resource, err := m.ckanClient.GetResource(ctx, uuid)
-	if err != nil {
-		return "", fmt.Errorf("error obteniendo recurso de CKAN: %w", err)
-	}
-	log.Printf("Recurso: %s (%s)", resource.Name, resource.Format)
-	log.Printf("URL: %s", resource.URL)
-
-	// 2. Crear archivo temporal para el CSV
-	tmpCSV := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%d.csv", uuid, time.Now().Unix()))
-	defer os.Remove(tmpCSV)
-
-	// 3. Descargar CSV
-	if err := m.downloadFile(ctx, resource.URL, tmpCSV); err != nil {
-		return "", fmt.Errorf("error descargando CSV: %w", err)
-	}
-
-	log.Printf("CSV descargado: %s", tmpCSV)
-
-	// 4. Crear base de datos DuckDB
-	dbPath := filepath.Join(os.TempDir(), fmt.Sprintf("%s.duckdb", uuid))
-
-	conn, err := sql.Open("duckdb", dbPath)
-	if err != nil {
-		return "", fmt.Errorf("error creando DuckDB: %w", err)
-	}
-	defer conn.Close()
-
-	// 5. Cargar CSV en DuckDB  usando función nativa
-	log.Printf("Convirtiendo CSV a DuckDB...")
+// LoadStats resume el resultado de cargar un CSV en DuckDB
+type LoadStats struct {
+	LoadedRows   int64 `json:"loaded_rows"`
+	RejectedRows int64 `json:"rejected_rows"`
+	// Registros del CSV sin el encabezado; -1 si no se pudo contar
+	ExpectedRows int64 `json:"expected_rows"`
+	// Todas las columnas se cargaron como VARCHAR (modo seguro)
+	AllVarchar bool `json:"all_varchar"`
+}
 
-	query := fmt.Sprintf(`
-		CREATE TABLE data AS 
-		SELECT * FROM read_csv_auto('%s', 
-			header = true,
-			ignore_errors = true,
-			sample_size = -1,
-			null_padding = true,
-			dateformat = '%%Y-%%m-%%d'
-		)
-	`, tmpCSV)
+// RowCountMismatch indica que se cargaron menos (o más) filas que las del CSV
+func (s *LoadStats) RowCountMismatch() bool {
+	return s.ExpectedRows >= 0 && s.LoadedRows != s.ExpectedRows
+}
 
-	if _, err := conn.ExecContext(ctx, query); err != nil {
-		return "", fmt.Errorf("error cargando CSV en DuckDB: %w", err)
-	}
+// csvLoadAttempt es una combinación de opciones para read_csv_auto
+type csvLoadAttempt struct {
+	name    string
+	options []string
+}
 
-	// 6. Obtener estadísticas
-	var rowCount int64
+// allVarcharAttempt es el modo seguro: sin inferir tipos ni exigir filas bien
+// formadas, así que carga aunque el tipado automático falle. Los valores
+// quedan como texto y se pueden castear después.
+var allVarcharAttempt = csvLoadAttempt{name: "all_varchar", options: []string{"all_varchar = true", "strict_mode = false"}}
+
+// csvLoadAttempts se prueban en orden hasta que uno cargue, de más estricto a más permisivo
+var csvLoadAttempts = []csvLoadAttempt{
+	{name: "default"},
+	// El lector paralelo no admite null_padding con saltos de línea entre comillas
+	{name: "sin lector paralelo", options: []string{"parallel = false"}},
+	{name: "delimitador ;", options: []string{"delim = ';'"}},
+	{name: "delimitador tab", options: []string{`delim = '\t'`}},
+	{name: "delimitador |", options: []string{"delim = '|'"}},
+	{name: "comillas simples", options: []string{"quote = ''''", "escape = ''''"}},
+	{name: "sin comillas", options: []string{"quote = ''", "escape = ''"}},
+	allVarcharAttempt,
+}
 
-	err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&rowCount)
+// loadCSV carga el CSV en la tabla data y cuenta las filas cargadas y rechazadas.
+// Si read_csv_auto falla reintenta con opciones más permisivas. Las líneas de
+// preámbulo antes del encabezado se saltan según lo configurado para el
+// dataset o, si no hay nada configurado, lo detectado en el archivo. Con
+// allVarchar se carga directo en modo seguro, todo como VARCHAR.
+func (m *Manager) loadCSV(ctx context.Context, conn *sql.DB, uuid, csvPath string, allVarchar bool) (*LoadStats, error) {
+	// store_rejects guarda las filas malformadas en la tabla temporal reject_errors
+	baseOptions := []string{
+		"header = true",
+		"ignore_errors = true",
+		"store_rejects = true",
+		"sample_size = -1",
+		"null_padding = true",
+		"dateformat = '%Y-%m-%d'",
+	}
+
+	// Detectar delimitador, encoding y preámbulo antes de importar
+	attempts := csvLoadAttempts
+	skip, configured := m.CSVSkip(uuid)
+	var preambleRecords int64
+	sniff, err := sniffCSV(csvPath)
 	if err != nil {
-		log.Printf("Warning: no se pudo obtener count: %v", err)
+		log.Printf("Warning: no se pudo analizar el formato del CSV: %v", err)
 	} else {
-		log.Printf("Cargados %d registros", rowCount)
-	}
+		if configured {
+			sniff.setSkipRows(skip)
+		}
+		skip, preambleRecords = sniff.SkipRows, sniff.PreambleRecords
+		log.Printf("🔍 CSV detectado: delimitador %q, encoding %s, %d líneas de preámbulo", sniff.Delimiter, sniff.Encoding, skip)
+
+		if sniff.Encoding == encodingLatin1 {
+			utf8Path := csvPath + ".utf8"
+			if err := transcodeLatin1(csvPath, utf8Path); err != nil {
+				os.Remove(utf8Path)
+				return nil, fmt.Errorf("error convirtiendo CSV a UTF-8: %w", err)
+			}
+			defer os.Remove(utf8Path)
+			csvPath = utf8Path
+		}
 
-	// 7. Crear indices para mejorar queries
-	if err := m.createIndexes(ctx, conn, resource); err != nil {
-		log.Printf("Warning: error creando índices: %v", err)
+		// La detección automática puede "cargar" todo en una sola columna sin fallar,
+		// así que el delimitador detectado se prueba primero
+		if sniff.Delimiter != ',' {
+			detected := csvLoadAttempt{name: "delimitador detectado", options: []string{sniff.delimOption()}}
+			attempts = append([]csvLoadAttempt{detected}, csvLoadAttempts...)
+		}
 	}
 
-	// 8. Optimizar base de datos
-	if _, err := conn.ExecContext(ctx, "CHECKPOINT"); err != nil {
-		log.Printf("Warning: error en checkpoint: %v", err)
+	if allVarchar {
+		safe := allVarcharAttempt
+		if sniff != nil && sniff.Delimiter != ',' {
+			safe.options = append([]string{sniff.delimOption()}, safe.options...)
+		}
+		attempts = []csvLoadAttempt{safe}
+		log.Printf("🛟 Cargando CSV en modo seguro (all_varchar)")
 	}
 
-	log.Printf("DuckDB creado exitosamente: %s", dbPath)
-	return dbPath, nil
-
-}
-
-// downloadFile descarga un archivo desde una URL
-func (m *Manager) downloadFile(ctx context.Context, url, filepath string) error {
-	// Crear request con contexto
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return err
+	if skip > 0 {
+		baseOptions = append(baseOptions, fmt.Sprintf("skip = %d", skip))
 	}
 
-	// Cliente con timeout largo
-	client := &http.Client{
-		Timeout: 10 * time.Minute, // Timeout generoso para archivos muy grandes
-	}
+	// reject_errors es temporal y existe solo en la conexión que cargó el CSV,
+	// así que la carga y las estadísticas usan la misma conexión del pool
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo conexión a DuckDB: %w", err)
+	}
+	defer c.Close()
+
+	var lastErr error
+	loaded := false
+	stats := &LoadStats{}
+	for i, attempt := range attempts {
+		// DuckDB agrega a reject_errors en cada lectura; se vacía para contar
+		// solo los rechazos del intento que carga
+		if _, err := c.ExecContext(ctx, "DROP TABLE IF EXISTS temp.reject_errors; DROP TABLE IF EXISTS temp.reject_scans"); err != nil {
+			return nil, fmt.Errorf("error limpiando filas rechazadas: %w", err)
+		}
 
-	log.Printf("⬇️  Descargando desde: %s", url)
+		options := append(append([]string{}, baseOptions...), attempt.options...)
+		query := fmt.Sprintf(`
+			CREATE OR REPLACE TABLE data AS 
+			SELECT * FROM read_csv_auto('%s',
+				%s
+			)
+		`, csvPath, strings.Join(options, ",\n\t\t\t\t"))
+
+		if _, err := c.ExecContext(ctx, query); err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("error cargando CSV en DuckDB: %w", err)
+			}
+			log.Printf("⚠️  Carga de CSV falló con opciones %q: %v", attempt.name, err)
+			lastErr = err
+			continue
+		}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error en request: %w", err)
+		if i > 0 {
+			log.Printf("✓ CSV cargado con opciones alternativas %q", attempt.name)
+		}
+		stats.AllVarchar = attempt.name == allVarcharAttempt.name
+		loaded = true
+		break
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error: status %d", resp.StatusCode)
+	if !loaded {
+		return nil, fmt.Errorf("error cargando CSV en DuckDB: %w", lastErr)
 	}
 
-	// Obtener tamaño del archivo si está disponible
-	totalSize := resp.ContentLength
-	if totalSize > 0 {
-		log.Printf("📦 Tamaño del archivo: %.2f MB", float64(totalSize)/(1024*1024))
+	// Obtener estadísticas
+	if err := c.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&stats.LoadedRows); err != nil {
+		log.Printf("Warning: no se pudo obtener count: %v", err)
+	} else {
+		log.Printf("✓ Cargados %d registros", stats.LoadedRows)
 	}
 
-	// Crear archivo
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
+	// Una fila puede tener varios errores, contar líneas distintas
+	if err := c.QueryRowContext(ctx, "SELECT COUNT(DISTINCT line) FROM reject_errors").Scan(&stats.RejectedRows); err != nil {
+		log.Printf("Warning: no se pudo obtener filas rechazadas: %v", err)
+	} else if stats.RejectedRows > 0 {
+		log.Printf("⚠️  %d filas rechazadas por formato inválido", stats.RejectedRows)
 	}
-	defer out.Close()
-
-	// Copiar con progreso
-	var written int64
-	buf := make([]byte, 32*1024) // Buffer de 32KB
-	lastLog := time.Now()
-
-	for {
-		nr, er := resp.Body.Read(buf)
-		if nr > 0 {
-			nw, ew := out.Write(buf[0:nr])
-			if nw > 0 {
-				written += int64(nw)
-			}
-			if ew != nil {
-				err = ew
-				break
-			}
-			if nr != nw {
-				err = io.ErrShortWrite
-				break
-			}
 
-			// Log progreso cada 2 segundos
-			if time.Since(lastLog) > 2*time.Second {
-				if totalSize > 0 {
-					percentage := float64(written) / float64(totalSize) * 100
-					log.Printf("📥 Descargando... %.2f MB / %.2f MB (%.1f%%)",
-						float64(written)/(1024*1024),
-						float64(totalSize)/(1024*1024),
-						percentage)
-				} else {
-					log.Printf("📥 Descargado: %.2f MB", float64(written)/(1024*1024))
-				}
-				lastLog = time.Now()
-			}
-		}
-		if er != nil {
-			if er != io.EOF {
-				err = er
-			}
-			break
-		}
+	// Verificar integridad contra los registros del CSV
+	stats.ExpectedRows = -1
+	if records, err := countCSVRecords(csvPath); err != nil {
+		log.Printf("Warning: no se pudieron contar los registros del CSV: %v", err)
+	} else if records-preambleRecords > 0 {
+		stats.ExpectedRows = records - preambleRecords - 1
+	} else {
+		stats.ExpectedRows = 0
 	}
-
-	if err != nil {
-		return err
+	if stats.RowCountMismatch() {
+		log.Printf("⚠️  Filas cargadas (%d) distintas de las esperadas (%d)", stats.LoadedRows, stats.ExpectedRows)
 	}
 
-	log.Printf("✓ Descarga completa: %.2f MB", float64(written)/(1024*1024))
-	return nil
+	return stats, nil
 }
 
 // createIndexes crea índices inteligentes basados en las columnas
@@ -349,9 +518,9 @@ func (m *Manager) createIndexes(ctx context.Context, conn *sql.DB, resource *cka
 		CID       int
 		Name      string
 		Type      string
-		NotNull   int
+		NotNull   bool
 		DfltValue interface{}
-		PK        int
+		PK        bool
 	}
 
 	var columns []Column
@@ -395,20 +564,23 @@ func (m *Manager) createIndexes(ctx context.Context, conn *sql.DB, resource *cka
 }
 
 func (m *Manager) createIndex(ctx context.Context, conn *sql.DB, columnName string) error {
-	// Limpiar nombre de la columna
+	query := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON data ("%s")`, indexName(columnName), columnName)
+	_, err := conn.ExecContext(ctx, query)
+	if err != nil {
+		log.Printf("Warning: no se pudo crear el índice para %s: %v", columnName, err)
+		return err
+	}
+	return nil
+}
 
+// indexName genera el nombre del índice para una columna
+func indexName(columnName string) string {
+	// Limpiar nombre de la columna
 	safeName := strings.Map(func(r rune) rune {
 		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
 			return r
 		}
 		return '_'
 	}, columnName)
-
-	query := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s ON data ("%s)`, safeName, columnName)
-	_, err := conn.ExecContext(ctx, query)
-	if err != nil {
-		log.Printf("Warning: no se pudo crear el índice para %s: %v", columnName, err)
-		return err
-	}
-	return nil
+	return "idx_" + safeName
 }
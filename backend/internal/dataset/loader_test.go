@@ -0,0 +1,504 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestDownloadCountsRejectedRows(t *testing.T) {
+	// La última fila tiene UTF-8 inválido y se rechaza. Va después de la
+	// muestra que analiza el encoding, para que el archivo se lea como UTF-8
+	var csv strings.Builder
+	csv.WriteString("region,monto\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&csv, "Norte,%d\n", i)
+	}
+	csv.WriteString("Cen\xfftro,1\n")
+
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte(csv.String())})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	_, stats, err := m.downloadAndConvertWithProgress(context.Background(), "ventas", DownloadOptions{}, nil, nil)
+	if err != nil {
+		t.Fatalf("downloadAndConvertWithProgress: %v", err)
+	}
+	if stats.LoadedRows != 10000 || stats.RejectedRows != 1 || stats.ExpectedRows != 10001 {
+		t.Errorf("stats = %+v, se esperaban 10000 cargadas, 1 rechazada y 10001 esperadas", stats)
+	}
+}
+
+// loadTestCSV escribe body en un archivo y lo carga con loadCSV en una DuckDB en memoria
+func loadTestCSV(t *testing.T, m *Manager, body string) (*sql.DB, *LoadStats, error) {
+	t.Helper()
+	path := writeCSV(t, body)
+	conn, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	stats, err := m.loadCSV(context.Background(), conn, "datos", path, false)
+	return conn, stats, err
+}
+
+func TestDownloadDiscardedBeforeReplaceKeepsCachedCopy(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	res := testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-01-01T00:00:00",
+		Body:         []byte("region,monto\nNorte,10\nSur,20\n"),
+	}
+	ckan.SetResource("ventas", res)
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+
+	dbPath, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil)
+	if err != nil {
+		t.Fatalf("primera descarga: %v", err)
+	}
+
+	// Una versión nueva cuya descarga se cancela al terminar la conversión
+	res.LastModified = "2024-02-01T00:00:00"
+	res.Body = []byte("region,monto\nNorte,10\nSur,20\nCentro,30\n")
+	ckan.SetResource("ventas", res)
+	cancelled := func() error { return context.Canceled }
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, se esperaba context.Canceled", err)
+	}
+
+	conn, err := sql.Open("duckdb", dbPath+"?access_mode=read_only")
+	if err != nil {
+		t.Fatalf("abriendo copia en cache: %v", err)
+	}
+	defer conn.Close()
+	var rows int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM data").Scan(&rows); err != nil || rows != 2 {
+		t.Errorf("filas en cache = %d, %v; se esperaba la copia anterior de 2 filas", rows, err)
+	}
+	if leftovers, _ := filepath.Glob(dbPath + ".tmp*"); len(leftovers) > 0 {
+		t.Errorf("quedaron archivos temporales: %v", leftovers)
+	}
+}
+
+func TestCSVLoadAttemptsAreValid(t *testing.T) {
+	m := newTestManager(t, Options{})
+	defer func(orig []csvLoadAttempt) { csvLoadAttempts = orig }(csvLoadAttempts)
+
+	// Cada combinación por sí sola debe ser SQL válido y cargar un CSV simple
+	for _, attempt := range csvLoadAttempts[1:] {
+		csvLoadAttempts = []csvLoadAttempt{attempt}
+		if _, stats, err := loadTestCSV(t, m, "region,monto\nNorte,1\nSur,2\n"); err != nil {
+			t.Errorf("opciones %q: %v", attempt.name, err)
+		} else if stats.LoadedRows != 2 {
+			t.Errorf("opciones %q: %d filas, se esperaban 2", attempt.name, stats.LoadedRows)
+		}
+	}
+}
+
+func TestLoadCSVFallsBackToPermissiveOptions(t *testing.T) {
+	m := newTestManager(t, Options{})
+	defer func(orig []csvLoadAttempt) { csvLoadAttempts = orig }(csvLoadAttempts)
+
+	// La detección automática ya reconoce comillas simples, así que el primer
+	// intento fija comillas dobles: la comilla sin cerrar de Centro lo hace
+	// fallar y el archivo solo carga con el fallback
+	var singleQuotes csvLoadAttempt
+	for _, attempt := range csvLoadAttempts {
+		if attempt.name == "comillas simples" {
+			singleQuotes = attempt
+		}
+	}
+	if singleQuotes.options == nil {
+		t.Fatal("no se encontró el intento de comillas simples")
+	}
+	csvLoadAttempts = []csvLoadAttempt{
+		{name: "comillas dobles", options: []string{`quote = '"'`}},
+		singleQuotes,
+	}
+	conn, stats, err := loadTestCSV(t, m, "region,monto\n'Norte, zona 1',10\n\"Centro,15\n'Sur',20\n")
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 3 || stats.AllVarchar {
+		t.Errorf("stats = %+v, se esperaban 3 filas sin modo seguro", stats)
+	}
+	var region string
+	if err := conn.QueryRow("SELECT region FROM data ORDER BY monto LIMIT 1").Scan(&region); err != nil {
+		t.Fatal(err)
+	}
+	if region != "Norte, zona 1" {
+		t.Errorf("region = %q, se esperaba el valor entre comillas simples", region)
+	}
+}
+
+func TestLoadCSVQuotedNewlines(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	conn, stats, err := loadTestCSV(t, m, "region,nota\nNorte,ok\nSur,\"linea 1\nlinea 2\"\nCentro,ok\n")
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 3 || stats.AllVarchar {
+		t.Errorf("stats = %+v, se esperaban 3 filas sin modo seguro", stats)
+	}
+	var nota string
+	if err := conn.QueryRow("SELECT nota FROM data WHERE region = 'Sur'").Scan(&nota); err != nil {
+		t.Fatal(err)
+	}
+	if nota != "linea 1\nlinea 2" {
+		t.Errorf("nota = %q, se esperaba el valor con el salto de línea", nota)
+	}
+}
+
+func TestLoadCSVCountsRejectsOfLoadingAttemptOnly(t *testing.T) {
+	m := newTestManager(t, Options{})
+	conn, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Una sola conexión: la tabla temporal reject_errors de una lectura
+	// anterior queda visible para loadCSV
+	conn.SetMaxOpenConns(1)
+	previous := writeCSV(t, "region,monto\nNorte,abc\nSur,1\n")
+	if _, err := conn.Exec(fmt.Sprintf(`SELECT * FROM read_csv('%s', store_rejects = true, types = {'monto': 'INTEGER'})`, previous)); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := m.loadCSV(context.Background(), conn, "datos", writeCSV(t, "region,monto\nNorte,1\nSur,2\n"), false)
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 2 || stats.RejectedRows != 0 {
+		t.Errorf("stats = %+v, se esperaban 2 filas sin rechazos", stats)
+	}
+}
+
+func TestLoadCSVAllAttemptsFail(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	// Una línea más larga que max_line_size no carga con ninguna combinación
+	_, _, err := loadTestCSV(t, m, "a,b\n1,"+strings.Repeat("x", 2100000)+"\n")
+	if err == nil || !strings.Contains(err.Error(), "error cargando CSV en DuckDB") {
+		t.Errorf("err = %v, se esperaba un error de carga", err)
+	}
+}
+
+func TestLoadCSVExpectedRows(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	// 4 registros; uno tiene un salto de línea dentro de comillas
+	_, stats, err := loadTestCSV(t, m, "region,nota\nNorte,ok\nSur,\"linea 1\nlinea 2\"\nCentro,ok\nEste,ok\n")
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 4 || stats.ExpectedRows != 4 || stats.RowCountMismatch() {
+		t.Errorf("stats = %+v, se esperaban 4 cargadas y 4 esperadas sin discrepancia", stats)
+	}
+}
+
+// preambuloCSV tiene un título y una nota antes del encabezado real
+const preambuloCSV = "Reporte de ventas 2023\nFuente: INEGI,,\nregion,monto,fecha\nNorte,10,2024-01-01\nSur,20,2024-01-02\n"
+
+func TestLoadCSVSkipsDetectedPreamble(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	conn, stats, err := loadTestCSV(t, m, preambuloCSV)
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 2 || stats.ExpectedRows != 2 {
+		t.Errorf("stats = %+v, se esperaban 2 filas cargadas y 2 esperadas", stats)
+	}
+	var total int
+	if err := conn.QueryRow("SELECT SUM(monto) FROM data WHERE region IN ('Norte', 'Sur')").Scan(&total); err != nil || total != 30 {
+		t.Errorf("SUM(monto) = %d, %v; se esperaban las columnas del encabezado real", total, err)
+	}
+}
+
+func TestLoadCSVConfiguredSkip(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	// Una línea de notas con todas las columnas llenas parece un encabezado
+	body := "nota,fuente,año\nregion,monto,fecha\nNorte,10,2024-01-01\n"
+	if err := m.SetCSVSkip("datos", 1); err != nil {
+		t.Fatalf("SetCSVSkip: %v", err)
+	}
+	conn, stats, err := loadTestCSV(t, m, body)
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	var monto int
+	if err := conn.QueryRow("SELECT monto FROM data WHERE region = 'Norte'").Scan(&monto); err != nil || monto != 10 {
+		t.Errorf("monto = %d, %v; se esperaba saltar la línea configurada", monto, err)
+	}
+	if stats.LoadedRows != 1 {
+		t.Errorf("stats = %+v, se esperaba 1 fila", stats)
+	}
+
+	// El valor se persiste en Redis y se recupera al reiniciar
+	if skip, ok := newCSVSkips(m).rows["datos"]; !ok || skip != 1 {
+		t.Errorf("preámbulo recuperado = %d, %v; se esperaba 1", skip, ok)
+	}
+
+	if !m.RemoveCSVSkip("datos") || m.RemoveCSVSkip("datos") {
+		t.Error("RemoveCSVSkip debe retornar true solo la primera vez")
+	}
+	if _, ok := m.CSVSkip("datos"); ok {
+		t.Error("el preámbulo sigue configurado después de quitarlo")
+	}
+	for _, skip := range []int{-1, maxCSVSkipRows + 1} {
+		if err := m.SetCSVSkip("datos", skip); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("skip %d: err = %v, se esperaba ErrInvalidParams", skip, err)
+		}
+	}
+}
+
+// assertNoDownloadLeftovers verifica que no quedó el CSV parcial ni el dataset en cache
+func assertNoDownloadLeftovers(t *testing.T, m *Manager, tmp, uuid string) {
+	t.Helper()
+	if leftovers, _ := filepath.Glob(filepath.Join(tmp, uuid+"_*")); len(leftovers) > 0 {
+		t.Errorf("quedaron archivos temporales: %v", leftovers)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(m.cacheManager.GetCacheDir(), uuid+".duckdb*")); len(leftovers) > 0 {
+		t.Errorf("quedaron archivos en el cache: %v", leftovers)
+	}
+}
+
+func TestDownloadRejectsDeclaredOversize(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 1000)
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("grande", testutil.CKANResource{
+		Format:  "CSV",
+		Body:    []byte(body),
+		Headers: map[string]string{"Content-Length": strconv.Itoa(len(body))},
+	})
+	m := newCKANTestManager(t, ckan.URL(), Options{MaxDownloadBytes: 1024})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("grande")
+	job, done := dm.Wait(context.Background(), "grande", 10*time.Second)
+	if !done || job.Status != StatusFailed || !errors.Is(job.Error, ErrDownloadTooLarge) {
+		t.Fatalf("job = %+v, se esperaba fallido por tamaño", job)
+	}
+	if job.Message != "El archivo excede el tamaño máximo de descarga" {
+		t.Errorf("message = %q, se esperaba el mensaje de tamaño máximo", job.Message)
+	}
+	assertNoDownloadLeftovers(t, m, tmp, "grande")
+}
+
+func TestDownloadAbortsChunkedOversize(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// Sin Content-Length y con la descarga abierta: solo termina si se corta
+	// al pasar el límite
+	ckan := testutil.NewCKAN(t)
+	hold := make(chan struct{})
+	t.Cleanup(func() { close(hold) })
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 10000)
+	ckan.SetResource("grande", testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+	m := newCKANTestManager(t, ckan.URL(), Options{MaxDownloadBytes: 16 * 1024})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("grande")
+	job, done := dm.Wait(context.Background(), "grande", 10*time.Second)
+	if !done || job.Status != StatusFailed || !errors.Is(job.Error, ErrDownloadTooLarge) {
+		t.Fatalf("job = %+v, se esperaba fallido por tamaño", job)
+	}
+
+	// La carga síncrona aplica el mismo límite
+	if _, err := m.GetConnection(context.Background(), "grande"); !errors.Is(err, ErrDownloadTooLarge) {
+		t.Errorf("GetConnection: err = %v, se esperaba ErrDownloadTooLarge", err)
+	}
+	if err := dm.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	assertNoDownloadLeftovers(t, m, tmp, "grande")
+}
+
+func TestDownloadUnderLimit(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+	m := newCKANTestManager(t, ckan.URL(), Options{MaxDownloadBytes: 1024})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownload("ventas")
+	if job, done := dm.Wait(context.Background(), "ventas", 10*time.Second); !done || job.Status != StatusReady {
+		t.Errorf("job = %+v, se esperaba listo", job)
+	}
+}
+
+func TestPayloadKindFromBytes(t *testing.T) {
+	tests := map[string]string{
+		"<!DOCTYPE html><html><body>404</body></html>": "una página HTML",
+		"\n  <HTML><head>":                         "una página HTML",
+		"\xef\xbb\xbf<html>":                       "una página HTML",
+		`<?xml version="1.0"?><Error/>`:            "un documento XML",
+		`{"success": false, "error": "Not found"}`: "un documento JSON",
+		"region,monto\nNorte,10\n":                 "",
+		"\xef\xbb\xbfregion;monto\n":               "",
+		"":                                         "",
+	}
+	for head, want := range tests {
+		if got := payloadKindFromBytes([]byte(head)); got != want {
+			t.Errorf("payloadKindFromBytes(%q) = %q, se esperaba %q", head, got, want)
+		}
+	}
+}
+
+func TestDownloadRejectsErrorPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource testutil.CKANResource
+	}{
+		{"HTML servido como CSV", testutil.CKANResource{Body: []byte("<!DOCTYPE html>\n<html><body><h1>Página no encontrada</h1></body></html>")}},
+		{"Content-Type HTML", testutil.CKANResource{ContentType: "text/html; charset=utf-8", Body: []byte("region,monto\nNorte,10\n")}},
+		{"error JSON", testutil.CKANResource{ContentType: "application/json", Body: []byte(`{"success": false}`)}},
+		{"error XML", testutil.CKANResource{Body: []byte(`<?xml version="1.0"?><Error><Code>NoSuchKey</Code></Error>`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+
+			ckan := testutil.NewCKAN(t)
+			tt.resource.Format = "CSV"
+			ckan.SetResource("roto", tt.resource)
+			m := newCKANTestManager(t, ckan.URL(), Options{})
+			dm := m.GetDownloadManager()
+
+			dm.StartDownload("roto")
+			job, done := dm.Wait(context.Background(), "roto", 10*time.Second)
+			if !done || job.Status != StatusFailed || !errors.Is(job.Error, ErrUnexpectedContent) {
+				t.Fatalf("job = %+v, se esperaba fallido por contenido inesperado", job)
+			}
+			if !strings.Contains(job.Message, "revisa el enlace") {
+				t.Errorf("message = %q, se esperaba un mensaje que indique revisar el enlace", job.Message)
+			}
+			assertNoDownloadLeftovers(t, m, tmp, "roto")
+
+			// La carga síncrona tampoco crea el dataset
+			if _, err := m.GetConnection(context.Background(), "roto"); !errors.Is(err, ErrUnexpectedContent) {
+				t.Errorf("GetConnection: err = %v, se esperaba ErrUnexpectedContent", err)
+			}
+			assertNoDownloadLeftovers(t, m, tmp, "roto")
+		})
+	}
+}
+
+func TestDownloadKeepsInspectedBytes(t *testing.T) {
+	// Los bytes revisados al inicio se escriben igual: el encabezado no se pierde
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("\xef\xbb\xbfregion,monto\nNorte,10\nSur,20\n")})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	rows, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{Filters: map[string]interface{}{"region": "Sur"}})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if len(rows) != 1 || toFloat(t, rows[0]["monto"]) != 20 {
+		t.Errorf("filas = %v, se esperaba Sur con monto 20", rows)
+	}
+}
+
+func TestLoadCSVAllVarchar(t *testing.T) {
+	m := newTestManager(t, Options{})
+	path := writeCSV(t, "region;monto;fecha\nNorte;10;2024-01-15\nSur;20;2024-02-01\n")
+	conn, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stats, err := m.loadCSV(context.Background(), conn, "datos", path, true)
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 2 || !stats.AllVarchar {
+		t.Errorf("stats = %+v, se esperaban 2 filas en modo seguro", stats)
+	}
+
+	// Todas las columnas quedan como texto, con el delimitador detectado
+	rows, err := conn.Query(`SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'data' ORDER BY ordinal_position`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			t.Fatal(err)
+		}
+		columns = append(columns, name+" "+dataType)
+	}
+	if got := strings.Join(columns, ", "); got != "region VARCHAR, monto VARCHAR, fecha VARCHAR" {
+		t.Errorf("columnas = %s, se esperaban 3 columnas VARCHAR", got)
+	}
+
+	// Los valores se pueden castear después
+	var total int
+	if err := conn.QueryRow(`SELECT SUM(CAST(monto AS INTEGER)) FROM data`).Scan(&total); err != nil || total != 30 {
+		t.Errorf("suma casteada = %d, %v; se esperaba 30", total, err)
+	}
+}
+
+func TestLoadCSVFallsBackToAllVarchar(t *testing.T) {
+	m := newTestManager(t, Options{})
+	defer func(orig []csvLoadAttempt) { csvLoadAttempts = orig }(csvLoadAttempts)
+
+	// Un intento que siempre falla deja solo el modo seguro como fallback
+	csvLoadAttempts = []csvLoadAttempt{
+		{name: "inválido", options: []string{"quote = 'ab'"}},
+		allVarcharAttempt,
+	}
+	_, stats, err := loadTestCSV(t, m, "region,monto\nNorte,10\n")
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 1 || !stats.AllVarchar {
+		t.Errorf("stats = %+v, se esperaba la carga en modo seguro", stats)
+	}
+}
+
+func TestDownloadAllVarchar(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	dm := m.GetDownloadManager()
+
+	dm.StartDownloadWithOptions("ventas", DownloadOptions{AllVarchar: true})
+	job, done := dm.Wait(context.Background(), "ventas", 10*time.Second)
+	if !done || job.Status != StatusReady || !job.AllVarchar {
+		t.Fatalf("job = %+v, se esperaba listo en modo seguro", job)
+	}
+	if !strings.HasSuffix(job.Message, "columnas cargadas como texto") {
+		t.Errorf("message = %q, se esperaba el aviso de modo seguro", job.Message)
+	}
+
+	schema, err := m.GetSchema(context.Background(), "ventas")
+	if err != nil {
+		t.Fatalf("GetSchema: %v", err)
+	}
+	for _, col := range schema {
+		if col.Type != "VARCHAR" {
+			t.Errorf("columna %s = %s, se esperaba VARCHAR", col.Name, col.Type)
+		}
+	}
+	if meta, _ := m.readMeta("ventas"); meta == nil || !meta.AllVarchar {
+		t.Errorf("meta = %+v, se esperaba all_varchar guardado", meta)
+	}
+}
@@ -3,33 +3,171 @@ package dataset
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/duckdb/duckdb-go/v2"
+	"github.com/duckdb/duckdb-go/v2"
 
 	"visor-datos-abiertos-go/internal/cache"
 	"visor-datos-abiertos-go/internal/ckan"
 )
 
+// ErrInvalidParams indica parámetros inválidos del cliente (columnas inexistentes, etc.)
+var ErrInvalidParams = errors.New("parámetros inválidos")
+
+// IsOutOfMemory indica si el error viene de una consulta que excedió el
+// memory_limit de DuckDB. Los errores que ya pasaron a texto se reconocen
+// por el mensaje.
+func IsOutOfMemory(err error) bool {
+	var duckErr *duckdb.Error
+	if errors.As(err, &duckErr) {
+		return duckErr.Type == duckdb.ErrorTypeOutOfMemory
+	}
+	return err != nil && strings.Contains(err.Error(), "Out of Memory Error")
+}
+
+// Tiempo máximo que una consulta espera una descarga asíncrona en curso
+const downloadWaitTimeout = 10 * time.Minute
+
+// Máximo por default del limit que puede pedir un cliente
+const defaultMaxResultLimit = 10000
+
+// Máximo por default de filas que una consulta carga en memoria
+const defaultMaxResultRows = 100000
+
+// Tiempo máximo del ping que valida una conexión del pool antes de usarla
+const connectionPingTimeout = 2 * time.Second
+
+// Options configura el Manager de datasets
+type Options struct {
+	// Número máximo de descargas simultáneas (default 3)
+	MaxConcurrentDownloads int
+	// Intentos por petición a CKAN (default 3)
+	CKANMaxAttempts int
+	// API key para instancias de CKAN con recursos privados
+	CKANAPIKey string
+	// Cada cuánto se revisan las re-descargas programadas (default 1 minuto)
+	SchedulerCheckInterval time.Duration
+	// Máximo de condiciones en los filtros de una consulta (default 500)
+	MaxFilterConditions int
+	// Profundidad máxima de un filtro (default 2: columna -> lista de valores).
+	// 1 solo acepta valores simples
+	MaxFilterDepth int
+	// Máximo de filas que un cliente puede pedir con limit (default 10000)
+	MaxResultLimit int
+	// Versiones anteriores que se conservan por dataset tras re-descargas (default 3).
+	// No cuentan para el tamaño máximo del cache en disco.
+	MaxVersions int
+	// memory_limit de DuckDB de cada dataset abierto (p.ej. "2GB"); vacío usa el
+	// default de DuckDB. No es un límite global: cada conexión abierta tiene el suyo
+	MemoryLimitPerDataset string
+	// threads de DuckDB de cada dataset abierto; 0 usa el default (núcleos del host)
+	ThreadsPerDataset int
+	// Tamaño máximo del CSV a descargar; 0 no limita
+	MaxDownloadBytes int64
+	// Máximo de filas que una consulta carga en memoria (default 100000).
+	// Debe ser mayor que MaxResultLimit para no cortar consultas con limit
+	MaxResultRows int
+	// Al pasar MaxResultRows, retornar las filas leídas marcadas como truncated
+	// en vez de fallar con ErrResultTooLarge
+	TruncateResults bool
+	// Compara los filtros de igualdad de texto sin distinguir mayúsculas; cada
+	// filtro estructurado puede cambiarlo con case_insensitive
+	CaseInsensitiveFilters bool
+}
+
 type Manager struct {
 	ckanClient      *ckan.Client
 	cacheManager    *cache.Manager
 	connections     sync.Map // Pool de conexiones DuckDB
+	connPaths       sync.Map // uuid -> archivo .duckdb abierto por la conexión
+	filterUsage     sync.Map // uuid -> *columnUsage
+	datasetLocks    sync.Map // uuid -> *sync.RWMutex, ver datasetLock
 	downloadManager *DownloadManager
+	scheduler       *Scheduler
+	csvSkips        *csvSkips
+
+	maxFilterConditions int
+	maxFilterDepth      int
+	maxResultLimit      int
+	maxVersions         int
+	maxDownloadBytes    int64
+	maxResultRows       int
+	truncateResults     bool
+	// Límites de DuckDB que recibe cada conexión (ver Options)
+	memoryLimitPerDataset string
+	threadsPerDataset     int
+	// Igualdad de texto en filtros sin distinguir mayúsculas
+	caseInsensitiveFilters bool
 	// mu           sync.RWMutex
 }
 
-func NewManager(ckanURL string, cacheManager *cache.Manager) *Manager {
+func NewManager(ckanURL string, cacheManager *cache.Manager, opts Options) *Manager {
+	if opts.MaxConcurrentDownloads <= 0 {
+		opts.MaxConcurrentDownloads = 3
+	}
+	if opts.MaxFilterConditions <= 0 {
+		opts.MaxFilterConditions = 500
+	}
+	if opts.MaxFilterDepth <= 0 {
+		opts.MaxFilterDepth = defaultMaxFilterDepth
+	}
+	if opts.MaxResultLimit <= 0 {
+		opts.MaxResultLimit = defaultMaxResultLimit
+	}
+	if opts.MaxVersions <= 0 {
+		opts.MaxVersions = defaultMaxVersions
+	}
+	if opts.MaxResultRows <= 0 {
+		opts.MaxResultRows = defaultMaxResultRows
+	}
+
+	ckanClient := ckan.NewClient(ckanURL)
+	if opts.CKANMaxAttempts > 0 {
+		ckanClient.SetMaxAttempts(opts.CKANMaxAttempts)
+	}
+	ckanClient.APIKey = opts.CKANAPIKey
+
 	m := &Manager{
-		ckanClient:   ckan.NewClient(ckanURL),
+		ckanClient:   ckanClient,
 		cacheManager: cacheManager,
+
+		maxFilterConditions: opts.MaxFilterConditions,
+		maxFilterDepth:      opts.MaxFilterDepth,
+		maxResultLimit:      opts.MaxResultLimit,
+		maxVersions:         opts.MaxVersions,
+		maxResultRows:       opts.MaxResultRows,
+		truncateResults:     opts.TruncateResults,
+		maxDownloadBytes:    opts.MaxDownloadBytes,
+
+		caseInsensitiveFilters: opts.CaseInsensitiveFilters,
+		memoryLimitPerDataset:  opts.MemoryLimitPerDataset,
+		threadsPerDataset:      opts.ThreadsPerDataset,
 	}
 
+	// Cerrar la conexión de los datasets desalojados del cache
+	cacheManager.SetEvictionCallback(m.closeConnection)
+
+	// Conversiones que quedaron a medias si el proceso murió durante una descarga
+	m.removeStaleConversions()
+
 	// Inicializar download manager
-	m.downloadManager = NewDownloadManager(m)
+	m.downloadManager = NewDownloadManager(m, opts.MaxConcurrentDownloads)
+
+	// Preámbulos de CSV configurados por dataset
+	m.csvSkips = newCSVSkips(m)
+
+	// Re-descargas programadas
+	m.scheduler = NewScheduler(m, opts.SchedulerCheckInterval)
+	m.scheduler.Start()
 
 	// Limpiar jobs antiguos cada hora
 	go func() {
@@ -43,42 +181,123 @@ func NewManager(ckanURL string, cacheManager *cache.Manager) *Manager {
 	return m
 }
 
+// ClampLimit normaliza el limit pedido por un cliente: no positivo usa
+// defaultLimit y nunca excede el máximo configurado
+func (m *Manager) ClampLimit(limit, defaultLimit int) int {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > m.maxResultLimit {
+		limit = m.maxResultLimit
+	}
+	return limit
+}
+
 func (m *Manager) GetDownloadManager() *DownloadManager {
 	return m.downloadManager
 }
 
-// GetConnection obtiene o crea una conexión DuckDB para un dataset
+func (m *Manager) GetScheduler() *Scheduler {
+	return m.scheduler
+}
+
+// GetConnection obtiene o crea una conexión DuckDB para un dataset. Mientras
+// Reindex tiene el archivo abierto para escritura espera a que termine
 func (m *Manager) GetConnection(ctx context.Context, uuid string) (*sql.DB, error) {
-	// 1. Verificar si ya tenemos la conexión en el pool
-	if conn, ok := m.connections.Load(uuid); ok {
-		return conn.(*sql.DB), nil
+	lock := m.datasetLock(uuid)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return m.getConnection(ctx, uuid)
+}
+
+// datasetLock retorna el lock del archivo de un dataset: abrir la conexión
+// read-only toma el de lectura y Reindex el de escritura, porque DuckDB no
+// permite abrir el mismo archivo en ambos modos a la vez
+func (m *Manager) datasetLock(uuid string) *sync.RWMutex {
+	lock, _ := m.datasetLocks.LoadOrStore(uuid, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+func (m *Manager) getConnection(ctx context.Context, uuid string) (*sql.DB, error) {
+	// 1. Verificar si ya tenemos la conexión en el pool y sigue viva
+	if pooled, ok := m.connections.Load(uuid); ok {
+		conn := pooled.(*sql.DB)
+		err := m.checkConnection(ctx, uuid, conn)
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("⚠️ Conexión de %s descartada: %v", uuid, err)
+		if m.connections.CompareAndDelete(uuid, conn) {
+			m.connPaths.Delete(uuid)
+			conn.Close()
+		}
+		// Sin archivo no sirve la entrada del cache: se vuelve a descargar
+		if errors.Is(err, os.ErrNotExist) {
+			if err := m.cacheManager.RemoveDataset(uuid); err != nil {
+				log.Printf("Warning: error limpiando cache de %s: %v", uuid, err)
+			}
+		}
 	}
 
 	// 2. Verificar cache en memoria (LRU)
+	// Al abrir una copia en cache se verifica en segundo plano si CKAN tiene una más nueva
 	dbPath, found := m.cacheManager.GetFromMemory(uuid)
 	if found {
 		log.Printf(" Dataset %s encontrado en memoria", uuid)
-		return m.openConnection(uuid, dbPath)
+		conn, err := m.openCachedConnection(ctx, uuid, dbPath)
+		if err == nil {
+			go m.checkFreshness(uuid)
+			return conn, nil
+		}
+		if !errors.Is(err, errInvalidCachedCopy) {
+			return nil, err
+		}
 	}
 
 	// 3. Verificar cache en disco
 	dbPath, found = m.cacheManager.GetFromDisk(uuid)
 	if found {
 		log.Printf("Dataset %s  encontrado en disco, promoviendo a memoria", uuid)
-		m.cacheManager.SetToMemory(uuid, dbPath)
-		return m.openConnection(uuid, dbPath)
+		conn, err := m.openCachedConnection(ctx, uuid, dbPath)
+		if err == nil {
+			m.cacheManager.SetToMemory(uuid, dbPath)
+			go m.checkFreshness(uuid)
+			return conn, nil
+		}
+		if !errors.Is(err, errInvalidCachedCopy) {
+			return nil, err
+		}
 	}
 
-	// 4. Descargar desde CKAN y convertir a DuckDB
-	log.Printf("Descargando dataset %s desde CKAN...", uuid)
-	dbPath, err := m.downloadAndConvert(ctx, uuid)
-	if err != nil {
-		return nil, fmt.Errorf("error descargando dataset: %w", err)
+	// 4. Descargar desde CKAN con el DownloadManager, que aplica el límite de
+	// descargas simultáneas y la detiene en Shutdown. Si ya hay una descarga en
+	// curso (p.ej. una re-descarga) se espera esa; un job terminado sin copia
+	// en cache quedó viejo y se reemplaza. Si el request vence o se cancela la
+	// descarga sigue: el dataset queda en cache para la siguiente consulta
+	job, _ := m.downloadManager.Redownload(uuid)
+	if job.Status != StatusReady && job.Status != StatusFailed {
+		log.Printf("⏳ Esperando descarga de %s", uuid)
+		job, _ = m.downloadManager.Wait(ctx, uuid, downloadWaitTimeout)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 	}
-
-	// Guardar en cache
-	if err := m.cacheManager.SetToDisk(uuid, dbPath); err != nil {
-		log.Printf("Warning: error guardando en disco cache: %v", err)
+	if job == nil {
+		return nil, fmt.Errorf("dataset %s no disponible: descarga cancelada", uuid)
+	}
+	if job.Status == StatusFailed {
+		return nil, fmt.Errorf("error descargando dataset: %w", job.Error)
+	}
+	if job.Status != StatusReady {
+		return nil, fmt.Errorf("dataset %s no disponible: descarga en curso", uuid)
+	}
+	dbPath, found = m.cacheManager.GetFromDisk(uuid)
+	if !found {
+		return nil, fmt.Errorf("dataset %s no disponible: no quedó en cache", uuid)
 	}
 	m.cacheManager.SetToMemory(uuid, dbPath)
 
@@ -86,9 +305,28 @@ func (m *Manager) GetConnection(ctx context.Context, uuid string) (*sql.DB, erro
 
 }
 
+// connectionDSN arma el DSN de DuckDB de un archivo con los límites de
+// memoria y threads por dataset configurados
+func (m *Manager) connectionDSN(dbPath string, readOnly bool) string {
+	params := url.Values{}
+	if readOnly {
+		params.Set("access_mode", "read_only")
+	}
+	if m.memoryLimitPerDataset != "" {
+		params.Set("memory_limit", m.memoryLimitPerDataset)
+	}
+	if m.threadsPerDataset > 0 {
+		params.Set("threads", strconv.Itoa(m.threadsPerDataset))
+	}
+	if len(params) == 0 {
+		return dbPath
+	}
+	return dbPath + "?" + params.Encode()
+}
+
 func (m *Manager) openConnection(uuid, dbPath string) (*sql.DB, error) {
 	// Abrir conexión read-only
-	conn, err := sql.Open("duckdb", dbPath+"?access_mode=read_only")
+	conn, err := sql.Open("duckdb", m.connectionDSN(dbPath, true))
 	if err != nil {
 		return nil, fmt.Errorf("error abriendo DuckDB: %w", err)
 	}
@@ -103,15 +341,162 @@ func (m *Manager) openConnection(uuid, dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("error ping DuckDB: %w", err)
 	}
 
-	// Guardar en pool
-	m.connections.Store(uuid, conn)
+	// Guardar en pool. Si otra consulta abrió el dataset al mismo tiempo se usa
+	// la suya: una conexión fuera del pool dejaría el archivo abierto
+	if pooled, loaded := m.connections.LoadOrStore(uuid, conn); loaded {
+		conn.Close()
+		return pooled.(*sql.DB), nil
+	}
+	m.connPaths.Store(uuid, dbPath)
 
 	log.Printf("Conexión DuckDB establecida para dataset %s", uuid)
 	return conn, nil
 }
 
-// Close cierra todas las conexiones
+// errInvalidCachedCopy indica que la copia en cache de un dataset estaba
+// corrupta y se descartó, así que hay que volver a descargarlo
+var errInvalidCachedCopy = errors.New("copia en cache inválida")
+
+// openCachedConnection abre la copia en cache de un dataset y verifica que
+// tenga la tabla data. Si el archivo está truncado o corrupto (p.ej. el proceso
+// murió a media conversión) se borra del cache para que se vuelva a descargar
+// y se retorna errInvalidCachedCopy. Otras fallas (locks, memoria, contexto
+// cancelado) se retornan sin tocar la copia.
+func (m *Manager) openCachedConnection(ctx context.Context, uuid, dbPath string) (*sql.DB, error) {
+	conn, err := m.openConnection(uuid, dbPath)
+	if err == nil {
+		var tables int
+		err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = 'data'").Scan(&tables)
+		if err == nil && tables > 0 {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			err = errors.New("no contiene la tabla data")
+		} else if !isCorruptDatabase(err) {
+			return nil, err
+		}
+		m.closeConnection(uuid)
+	} else if !isCorruptDatabase(err) {
+		return nil, err
+	}
+
+	log.Printf("⚠️ Copia en cache de %s inválida, se descarta: %v", uuid, err)
+	if err := m.cacheManager.RemoveDataset(uuid); err != nil {
+		log.Printf("Warning: error borrando copia inválida de %s: %v", uuid, err)
+	}
+	return nil, fmt.Errorf("%w: %v", errInvalidCachedCopy, err)
+}
+
+// isCorruptDatabase indica si un error de DuckDB se debe al archivo (truncado,
+// corrupto o que no es una base DuckDB) y no a una falla pasajera. Al abrir
+// la base el driver solo reporta el mensaje, con el tipo de error como prefijo.
+func isCorruptDatabase(err error) bool {
+	msg := err.Error()
+	// Errores de IO que no dependen del contenido del archivo
+	for _, transient := range []string{"Could not set lock", "Too many open files"} {
+		if strings.Contains(msg, transient) {
+			return false
+		}
+	}
+	return strings.Contains(msg, "IO Error") ||
+		strings.Contains(msg, "Serialization Error") ||
+		strings.Contains(strings.ToLower(msg), "corrupt")
+}
+
+// removeStaleConversions borra las bases temporales (.duckdb.tmp) del
+// directorio de cache. Al arrancar ninguna descarga está en curso, así que
+// son restos de conversiones interrumpidas.
+func (m *Manager) removeStaleConversions() {
+	for _, pattern := range []string{"*.duckdb.tmp", "*.duckdb.tmp.wal"} {
+		matches, _ := filepath.Glob(filepath.Join(m.cacheManager.GetCacheDir(), pattern))
+		for _, path := range matches {
+			if err := os.Remove(path); err == nil {
+				log.Printf("🗑️  Conversión incompleta borrada: %s", path)
+			}
+		}
+	}
+}
+
+// checkConnection valida una conexión del pool: su archivo debe seguir existiendo
+// (una invalidación puede haberlo borrado) y DuckDB debe responder al ping
+func (m *Manager) checkConnection(ctx context.Context, uuid string, conn *sql.DB) error {
+	if dbPath, ok := m.connPaths.Load(uuid); ok {
+		if _, err := os.Stat(dbPath.(string)); err != nil {
+			return err
+		}
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, connectionPingTimeout)
+	defer cancel()
+	err := conn.PingContext(pingCtx)
+	// Si el pool está ocupado el ping espera una conexión libre: eso no la hace inválida
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+// OpenConnections retorna el número de conexiones DuckDB abiertas en el pool
+func (m *Manager) OpenConnections() int {
+	count := 0
+	m.connections.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// PingDataset ejecuta una query trivial contra un dataset ya cacheado para
+// confirmar que DuckDB responde. Nunca dispara una descarga.
+func (m *Manager) PingDataset(ctx context.Context, uuid string) error {
+	if _, pooled := m.connections.Load(uuid); !pooled {
+		if _, found := m.cacheManager.GetFromDisk(uuid); !found {
+			return fmt.Errorf("dataset %s no está en cache", uuid)
+		}
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	var one int
+	err = conn.QueryRowContext(ctx, "SELECT 1 FROM data LIMIT 1").Scan(&one)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// InvalidateDataset cierra la conexión del dataset y lo borra de todos los
+// niveles de cache, para que la siguiente consulta lo descargue de nuevo.
+// Retorna cuántas keys de Redis se borraron.
+func (m *Manager) InvalidateDataset(uuid string) (int, error) {
+	deleted, err := m.cacheManager.InvalidateDataset(uuid)
+	if err != nil {
+		return deleted, fmt.Errorf("error borrando dataset del cache: %w", err)
+	}
+	log.Printf("♻️  Dataset %s invalidado (%d keys de Redis)", uuid, deleted)
+	return deleted, nil
+}
+
+// closeConnection cierra y remueve del pool la conexión de un dataset
+func (m *Manager) closeConnection(uuid string) {
+	m.connPaths.Delete(uuid)
+	if conn, ok := m.connections.LoadAndDelete(uuid); ok {
+		if err := conn.(*sql.DB).Close(); err != nil {
+			log.Printf("Error cerrando conexión %s: %v", uuid, err)
+		}
+	}
+}
+
+// Close detiene el scheduler y cierra todas las conexiones
 func (m *Manager) Close() error {
+	m.scheduler.Stop()
+
 	var lastErr error
 	m.connections.Range(func(key, value interface{}) bool {
 		if conn, ok := value.(*sql.DB); ok {
@@ -0,0 +1,364 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+// newTestManager crea un Manager con Redis en memoria y el cache en un
+// directorio temporal. CKAN apunta a un puerto cerrado: los datasets de las
+// pruebas se escriben directo en el cache con writeDataset
+func newTestManager(t *testing.T, opts Options) *Manager {
+	t.Helper()
+	return newCKANTestManager(t, "http://127.0.0.1:1", opts)
+}
+
+// newCKANTestManager es newTestManager contra el CKAN indicado, para probar descargas
+func newCKANTestManager(t *testing.T, ckanURL string, opts Options) *Manager {
+	t.Helper()
+	redis := testutil.NewRedis(t)
+	cacheManager, err := cache.NewManager(redis.URL(), 1<<30, 10, 1<<30, t.TempDir())
+	if err != nil {
+		t.Fatalf("error creando cache: %v", err)
+	}
+
+	if opts.CKANMaxAttempts == 0 {
+		opts.CKANMaxAttempts = testutil.NoRetryAttempts
+	}
+	m := NewManager(ckanURL, cacheManager, opts)
+	t.Cleanup(func() {
+		// Detener las descargas en segundo plano antes de borrar el cache
+		m.GetDownloadManager().Shutdown(context.Background())
+		m.Close()
+		cacheManager.Close()
+	})
+	return m
+}
+
+// writeDataset crea el dataset uuid en el cache en disco del Manager
+func writeDataset(t *testing.T, m *Manager, uuid string, statements ...string) {
+	t.Helper()
+	testutil.WriteDataset(t, m.cacheManager.GetCacheDir(), uuid, statements...)
+}
+
+// ventasSQL crea un dataset chico con texto, números y fechas
+var ventasSQL = []string{
+	`CREATE TABLE data (region VARCHAR, producto VARCHAR, monto INTEGER, fecha DATE)`,
+	`INSERT INTO data VALUES
+		('Norte', 'Pan', 10, '2024-01-05'),
+		('Norte', 'Leche', 20, '2024-02-10'),
+		('Sur', 'Pan', 30, '2024-03-15'),
+		('Sur', 'Queso', 40, '2024-04-20'),
+		('Centro', NULL, 50, '2024-05-25'),
+		(NULL, 'Pan', 60, NULL)`,
+}
+
+func TestConnectionAppliesPerDatasetSettings(t *testing.T) {
+	m := newTestManager(t, Options{MemoryLimitPerDataset: "512MB", ThreadsPerDataset: 2})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	conn, err := m.GetConnection(context.Background(), "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+
+	// DuckDB muestra memory_limit en MiB: 512MB son 488.2 MiB
+	for name, want := range map[string]string{"memory_limit": "488.2 MiB", "threads": "2"} {
+		var got string
+		if err := conn.QueryRow("SELECT value FROM duckdb_settings() WHERE name = ?", name).Scan(&got); err != nil {
+			t.Fatalf("leyendo %s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, se esperaba %q", name, got, want)
+		}
+	}
+}
+
+func TestMemoryEvictionClosesConnection(t *testing.T) {
+	m := newTestManager(t, Options{})
+	m.cacheManager.SetMemoryCapacity(1)
+	writeDataset(t, m, "ventas", ventasSQL...)
+	writeDataset(t, m, "otras", ventasSQL...)
+	ctx := context.Background()
+
+	first, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection ventas: %v", err)
+	}
+	// Abrir un segundo dataset desaloja el primero de la memoria
+	if _, err := m.GetConnection(ctx, "otras"); err != nil {
+		t.Fatalf("GetConnection otras: %v", err)
+	}
+
+	if _, ok := m.connections.Load("ventas"); ok {
+		t.Error("la conexión desalojada sigue en el pool")
+	}
+	if err := first.PingContext(ctx); err == nil {
+		t.Error("la conexión desalojada sigue abierta")
+	}
+	if _, ok := m.connections.Load("otras"); !ok {
+		t.Error("falta la conexión del dataset en memoria")
+	}
+}
+
+func TestConnectionWithDeletedFileRedownloads(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+
+	first, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	dbPath, ok := m.connPaths.Load("ventas")
+	if !ok {
+		t.Fatal("no se registró el archivo de la conexión")
+	}
+
+	// El archivo desaparece con la conexión todavía en el pool
+	if err := os.Remove(dbPath.(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection tras borrar el archivo: %v", err)
+	}
+	if conn == first {
+		t.Error("se reutilizó la conexión sin archivo")
+	}
+	if ckan.Downloads("ventas") != 2 {
+		t.Errorf("%d descargas, se esperaba volver a descargar", ckan.Downloads("ventas"))
+	}
+	var count int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&count); err != nil || count != 2 {
+		t.Errorf("COUNT(*) = %d, %v; se esperaban 2 filas", count, err)
+	}
+}
+
+func TestCancelledRequestKeepsDownloading(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	hold := make(chan struct{})
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 100)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.GetConnection(ctx, "ventas")
+		done <- err
+	}()
+	waitFor(t, 10*time.Second, "el inicio de la descarga", func() bool { return ckan.Downloads("ventas") == 1 })
+
+	// El request se cancela a mitad de la descarga, que sigue en el
+	// DownloadManager hasta terminar
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetConnection = %v, se esperaba context.Canceled", err)
+	}
+	if _, exists := m.downloadManager.GetJob("ventas"); !exists {
+		t.Fatal("la descarga no quedó registrada en el DownloadManager")
+	}
+	close(hold)
+	if job, _ := m.downloadManager.Wait(context.Background(), "ventas", 10*time.Second); job == nil || job.Status != StatusReady {
+		t.Fatalf("job = %+v, se esperaba ready", job)
+	}
+	if _, err := m.GetConnection(context.Background(), "ventas"); err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	if got := ckan.Downloads("ventas"); got != 1 {
+		t.Errorf("%d descargas, se esperaba reutilizar la del request cancelado", got)
+	}
+}
+
+func TestShutdownStopsRequestDownload(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	hold := make(chan struct{})
+	defer close(hold)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n"), Hold: hold})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.GetConnection(context.Background(), "ventas")
+		done <- err
+	}()
+	waitFor(t, 10*time.Second, "el inicio de la descarga", func() bool { return ckan.Downloads("ventas") == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.downloadManager.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("GetConnection no falló tras el apagado")
+	}
+}
+
+func TestClosedConnectionIsReopened(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	first, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	first.Close()
+
+	// El archivo sigue ahí: se reabre sin descargar
+	conn, err := m.GetConnection(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection tras cerrar: %v", err)
+	}
+	if conn == first {
+		t.Fatal("se reutilizó la conexión cerrada")
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		t.Errorf("la conexión reabierta no responde: %v", err)
+	}
+}
+
+func TestClampLimit(t *testing.T) {
+	m := newTestManager(t, Options{MaxResultLimit: 100})
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"debajo del máximo", 50, 50},
+		{"en el máximo", 100, 100},
+		{"arriba del máximo", 100000000, 100},
+		{"cero usa el default", 0, 10},
+		{"negativo usa el default", -5, 10},
+	}
+	for _, tc := range tests {
+		if got := m.ClampLimit(tc.limit, 10); got != tc.want {
+			t.Errorf("%s: ClampLimit(%d) = %d, se esperaba %d", tc.name, tc.limit, got, tc.want)
+		}
+	}
+
+	// Sin máximo configurado se usa el default
+	m = newTestManager(t, Options{})
+	if got := m.ClampLimit(1<<30, 10); got != defaultMaxResultLimit {
+		t.Errorf("ClampLimit sin máximo = %d, se esperaba %d", got, defaultMaxResultLimit)
+	}
+}
+
+func TestCorruptCachedDatasetIsRedownloaded(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, m *Manager)
+	}{
+		{"archivo truncado", func(t *testing.T, m *Manager) {
+			path := filepath.Join(m.cacheManager.GetCacheDir(), "ventas.duckdb")
+			if err := os.WriteFile(path, []byte("no es una base DuckDB"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"sin tabla data", func(t *testing.T, m *Manager) {
+			writeDataset(t, m, "ventas", `CREATE TABLE otra (x INTEGER)`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ckan := testutil.NewCKAN(t)
+			ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+			m := newCKANTestManager(t, ckan.URL(), Options{})
+			tt.write(t, m)
+			ctx := context.Background()
+
+			conn, err := m.GetConnection(ctx, "ventas")
+			if err != nil {
+				t.Fatalf("GetConnection: %v", err)
+			}
+			if ckan.Downloads("ventas") != 1 {
+				t.Errorf("%d descargas, se esperaba descargar de nuevo la copia inválida", ckan.Downloads("ventas"))
+			}
+			var count int
+			if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&count); err != nil || count != 2 {
+				t.Errorf("COUNT(*) = %d, %v; se esperaban 2 filas", count, err)
+			}
+		})
+	}
+}
+
+func TestCachedDatasetKeptOnTransientError(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n")})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	path := filepath.Join(m.cacheManager.GetCacheDir(), "ventas.duckdb")
+
+	// Una conexión de escritura abierta impide abrir la copia en solo lectura;
+	// el archivo está sano y no debe borrarse ni descargarse de nuevo
+	writer, err := sql.Open("duckdb", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetConnection(context.Background(), "ventas"); err == nil {
+		t.Fatal("GetConnection no retornó error con la copia bloqueada")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("la copia en cache se borró: %v", err)
+	}
+	if got := ckan.Downloads("ventas"); got != 0 {
+		t.Errorf("%d descargas, no se esperaba descargar de nuevo", got)
+	}
+
+	writer.Close()
+	conn, err := m.GetConnection(context.Background(), "ventas")
+	if err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+	var count int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM data").Scan(&count); err != nil || count != 6 {
+		t.Errorf("COUNT(*) = %d, %v; se esperaban las 6 filas de la copia en cache", count, err)
+	}
+}
+
+func TestStartupRemovesStaleConversions(t *testing.T) {
+	redis := testutil.NewRedis(t)
+	dir := t.TempDir()
+	stale := []string{filepath.Join(dir, "ventas.duckdb.tmp"), filepath.Join(dir, "ventas.duckdb.tmp.wal")}
+	for _, path := range stale {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testutil.WriteDataset(t, dir, "otro", ventasSQL...)
+
+	cacheManager, err := cache.NewManager(redis.URL(), 1<<30, 10, 1<<30, dir)
+	if err != nil {
+		t.Fatalf("error creando cache: %v", err)
+	}
+	m := NewManager("http://127.0.0.1:1", cacheManager, Options{CKANMaxAttempts: testutil.NoRetryAttempts})
+	t.Cleanup(func() {
+		m.Close()
+		cacheManager.Close()
+	})
+
+	for _, path := range stale {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s no se borró al arrancar", path)
+		}
+	}
+	// Los datasets completos se conservan
+	if _, err := os.Stat(filepath.Join(dir, "otro.duckdb")); err != nil {
+		t.Errorf("se borró un dataset completo: %v", err)
+	}
+}
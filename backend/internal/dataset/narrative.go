@@ -0,0 +1,211 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Narrative es un resumen en texto de los hallazgos principales de un dataset
+type Narrative struct {
+	Text       string                 `json:"text"`
+	Highlights map[string]interface{} `json:"highlights"`
+}
+
+// GetNarrative genera un resumen ejecutivo en español a partir de las agregaciones existentes.
+// metric es la columna a agregar (vacía para contar registros) y group la columna de agrupación.
+func (m *Manager) GetNarrative(ctx context.Context, uuid, metric, agg, group string, filters map[string]interface{}) (*Narrative, error) {
+	if group == "" {
+		return nil, fmt.Errorf("%w: columna de agrupación requerida", ErrInvalidParams)
+	}
+	if metric == "" {
+		agg = "count"
+	} else if agg == "" {
+		agg = "sum"
+	}
+
+	data, truncated, err := m.GetAggregatedData(ctx, uuid, AggregationParams{
+		Filters: filters,
+		Agg:     agg,
+		VarAgg:  metric,
+		GroupBy: []string{group},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return &Narrative{
+			Text:       "No hay datos para los filtros seleccionados.",
+			Highlights: map[string]interface{}{},
+		}, nil
+	}
+
+	var sum float64
+	var maxGroup, minGroup interface{}
+	var maxValue, minValue float64
+	groups := 0
+	for _, row := range data {
+		value, ok := toFloat64(row["total"])
+		if !ok {
+			continue
+		}
+		if groups == 0 || value > maxValue {
+			maxValue, maxGroup = value, row[group]
+		}
+		if groups == 0 || value < minValue {
+			minValue, minGroup = value, row[group]
+		}
+		sum += value
+		groups++
+	}
+	if groups == 0 {
+		return nil, fmt.Errorf("la métrica %s no es numérica", metric)
+	}
+	average := sum / float64(groups)
+
+	// El valor global se calcula sin agrupar con la misma agregación: sumar los
+	// grupos solo sirve para sum y count, no para avg, min, max ni mediana
+	overall, _, err := m.GetAggregatedData(ctx, uuid, AggregationParams{
+		Filters: filters,
+		Agg:     agg,
+		VarAgg:  metric,
+	})
+	if err != nil {
+		return nil, err
+	}
+	total, ok := 0.0, false
+	if len(overall) > 0 {
+		total, ok = toFloat64(overall[0]["total"])
+	}
+	if !ok {
+		return nil, fmt.Errorf("la métrica %s no es numérica", metric)
+	}
+
+	metricLabel := "registros"
+	if metric != "" {
+		metricLabel = fmt.Sprintf("%s de %s", aggLabel(agg), metric)
+	}
+
+	var text strings.Builder
+	switch strings.ToLower(agg) {
+	case "count", "sum":
+		fmt.Fprintf(&text, "En total se registran %s %s distribuidos en %d grupos de %s. ",
+			formatNumber(total), metricLabel, groups, group)
+	default:
+		fmt.Fprintf(&text, "Considerando todos los registros, %s: %s, en %d grupos de %s. ",
+			metricLabel, formatNumber(total), groups, group)
+	}
+	fmt.Fprintf(&text, "El valor más alto corresponde a %v con %s y el más bajo a %v con %s. ",
+		maxGroup, formatNumber(maxValue), minGroup, formatNumber(minValue))
+	fmt.Fprintf(&text, "El promedio por grupo es de %s.", formatNumber(average))
+
+	highlights := map[string]interface{}{
+		"total":     total,
+		"groups":    groups,
+		"max_group": maxGroup,
+		"max_value": maxValue,
+		"min_group": minGroup,
+		"min_value": minValue,
+		"average":   average,
+		"truncated": truncated,
+	}
+
+	// Tendencia si el dataset tiene columna de fecha
+	if trend, ok := m.narrativeTrend(ctx, uuid, metric, agg, filters); ok {
+		highlights["trend"] = trend
+		text.WriteString(" ")
+		text.WriteString(trend["text"].(string))
+	}
+
+	return &Narrative{Text: text.String(), Highlights: highlights}, nil
+}
+
+// narrativeTrend compara el primer y último año de la primera columna de fecha
+func (m *Manager) narrativeTrend(ctx context.Context, uuid, metric, agg string, filters map[string]interface{}) (map[string]interface{}, bool) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, false
+	}
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, false
+	}
+	dateColumns := m.getDateColumns(columns)
+	if len(dateColumns) == 0 {
+		return nil, false
+	}
+	dateCol := dateColumns[0]
+
+	// Sin fechas nulas: el grupo NULL quedaría al final de la serie y la
+	// tendencia terminaría en un año vacío
+	series, _, err := m.GetAggregatedData(ctx, uuid, AggregationParams{
+		Filters:      filters,
+		Agg:          agg,
+		VarAgg:       metric,
+		GroupBy:      []string{dateCol},
+		DateFormat:   "year",
+		ExcludeNulls: true,
+	})
+	if err != nil || len(series) < 2 {
+		return nil, false
+	}
+
+	first, last := series[0], series[len(series)-1]
+	firstValue, ok1 := toFloat64(first["total"])
+	lastValue, ok2 := toFloat64(last["total"])
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+
+	var text string
+	change := 0.0
+	if firstValue != 0 {
+		change = (lastValue - firstValue) / firstValue * 100
+	}
+	switch {
+	case lastValue > firstValue:
+		text = fmt.Sprintf("Entre %v y %v se observa un aumento de %.1f%%.", first[dateCol], last[dateCol], change)
+	case lastValue < firstValue:
+		text = fmt.Sprintf("Entre %v y %v se observa una disminución de %.1f%%.", first[dateCol], last[dateCol], -change)
+	default:
+		text = fmt.Sprintf("Entre %v y %v el valor se mantiene estable.", first[dateCol], last[dateCol])
+	}
+
+	return map[string]interface{}{
+		"column":     dateCol,
+		"from":       first[dateCol],
+		"to":         last[dateCol],
+		"from_value": firstValue,
+		"to_value":   lastValue,
+		"change_pct": change,
+		"text":       text,
+	}, true
+}
+
+// aggLabel retorna el nombre en español de una función de agregación
+func aggLabel(agg string) string {
+	switch strings.ToLower(agg) {
+	case "sum":
+		return "suma"
+	case "avg", "mean":
+		return "promedio"
+	case "min":
+		return "mínimo"
+	case "max":
+		return "máximo"
+	case "median":
+		return "mediana"
+	case "count_distinct", "distinct":
+		return "valores distintos"
+	default:
+		return agg
+	}
+}
+
+// formatNumber formatea un número sin decimales si es entero
+func formatNumber(value float64) string {
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d", int64(value))
+	}
+	return fmt.Sprintf("%.2f", value)
+}
@@ -0,0 +1,59 @@
+package dataset
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNarrativeOverallValue(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		agg   string
+		total float64
+	}{
+		// Norte 30, Sur 70, Centro 50 y NULL 60
+		{"sum", 210},
+		// El promedio global es de las 6 filas, no la suma de los promedios por región
+		{"avg", 35},
+		{"max", 60},
+		{"min", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			narrative, err := m.GetNarrative(context.Background(), "ventas", "monto", tt.agg, "region", nil)
+			if err != nil {
+				t.Fatalf("GetNarrative: %v", err)
+			}
+			if got := narrative.Highlights["total"]; got != tt.total {
+				t.Errorf("total = %v, se esperaba %v", got, tt.total)
+			}
+			if !strings.Contains(narrative.Text, formatNumber(tt.total)) {
+				t.Errorf("el texto no menciona el valor global %v: %q", tt.total, narrative.Text)
+			}
+		})
+	}
+}
+
+func TestNarrativeTrendIgnoresNullDates(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "anual",
+		`CREATE TABLE data (region VARCHAR, monto INTEGER, fecha DATE)`,
+		`INSERT INTO data VALUES
+			('Norte', 10, '2022-03-01'),
+			('Sur', 20, '2023-06-01'),
+			('Norte', 15, '2024-09-01'),
+			('Sur', 99, NULL)`)
+
+	narrative, err := m.GetNarrative(context.Background(), "anual", "monto", "sum", "region", nil)
+	if err != nil {
+		t.Fatalf("GetNarrative: %v", err)
+	}
+	// La fila sin fecha no cuenta como último año de la serie
+	want := "Entre 2022 y 2024 se observa un aumento de 50.0%."
+	if !strings.HasSuffix(narrative.Text, want) {
+		t.Errorf("texto = %q, se esperaba que terminara en %q", narrative.Text, want)
+	}
+}
@@ -0,0 +1,108 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Re-agregaciones del nivel hijo al padre. weighted_avg pondera cada valor
+// hijo por el número de filas de su grupo
+var reaggregations = map[string]string{
+	"avg":          `AVG("total")`,
+	"sum":          `SUM("total")`,
+	"min":          `MIN("total")`,
+	"max":          `MAX("total")`,
+	"median":       `MEDIAN("total")`,
+	"weighted_avg": `SUM("total" * "child_rows") / NULLIF(SUM("child_rows"), 0)`,
+}
+
+// NestedAggregationParams define una agregación en dos niveles: primero se
+// agrega por ParentGroupBy + ChildGroupBy y luego esos valores se re-agregan
+// por ParentGroupBy con Reagg (p.ej. promedio por municipio y luego promedio
+// de esos promedios por estado)
+type NestedAggregationParams struct {
+	Filters       map[string]interface{} `json:"filters"`
+	ParentGroupBy []string               `json:"parent_group_by"`
+	ChildGroupBy  []string               `json:"child_group_by"`
+	Agg           string                 `json:"agg"`
+	VarAgg        string                 `json:"var_agg"`
+	Reagg         string                 `json:"reagg"`
+}
+
+// GetNestedAggregation calcula la agregación de dos niveles en un solo query.
+// Cada fila trae las columnas padre, total (la re-agregación) y children (grupos hijo).
+// truncated indica que se cortó en el máximo de filas
+func (m *Manager) GetNestedAggregation(ctx context.Context, uuid string, params NestedAggregationParams) (data []map[string]interface{}, truncated bool, err error) {
+	if len(params.ParentGroupBy) == 0 || len(params.ChildGroupBy) == 0 {
+		return nil, false, fmt.Errorf("%w: parent_group_by y child_group_by requeridos", ErrInvalidParams)
+	}
+	parents := make(map[string]bool, len(params.ParentGroupBy))
+	for _, col := range params.ParentGroupBy {
+		parents[col] = true
+	}
+	for _, col := range params.ChildGroupBy {
+		if parents[col] {
+			return nil, false, fmt.Errorf("%w: la columna %s no puede estar en ambos niveles", ErrInvalidParams, col)
+		}
+	}
+	if params.Reagg == "" {
+		params.Reagg = "avg"
+	}
+	reagg, ok := reaggregations[strings.ToLower(params.Reagg)]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: re-agregación inválida %q", ErrInvalidParams, params.Reagg)
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, false, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Nivel hijo: el valor por grupo y sus filas, para poder ponderar
+	inner := AggregationParams{
+		Filters: params.Filters,
+		GroupBy: append(append([]string{}, params.ParentGroupBy...), params.ChildGroupBy...),
+		Measures: []Measure{
+			{Agg: params.Agg, VarAgg: params.VarAgg, Alias: "total"},
+			{Agg: "count", Alias: "child_rows"},
+		},
+	}
+	if err := m.validateAggregationParams(ctx, conn, inner); err != nil {
+		return nil, false, err
+	}
+
+	m.recordFilterUsage(uuid, params.Filters, types)
+
+	innerQuery, args := m.buildAggregationQuery(inner, types)
+
+	quoted := make([]string, len(params.ParentGroupBy))
+	for i, col := range params.ParentGroupBy {
+		quoted[i] = fmt.Sprintf(`"%s"`, col)
+	}
+	parentCols := strings.Join(quoted, ", ")
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s as total, COUNT(*) as children
+		FROM (%s) child
+		GROUP BY %s
+		ORDER BY %s
+	`, parentCols, reagg, innerQuery, parentCols, parentCols)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error ejecutando agregación anidada: %w", err)
+	}
+	defer rows.Close()
+
+	return m.rowsToMaps(rows)
+}
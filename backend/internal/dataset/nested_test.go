@@ -0,0 +1,103 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// municipiosSQL tiene municipios con distinto número de filas para que el
+// promedio de promedios difiera del ponderado
+var municipiosSQL = []string{
+	`CREATE TABLE data (estado VARCHAR, municipio VARCHAR, monto DOUBLE)`,
+	`INSERT INTO data VALUES
+		('Jalisco', 'Guadalajara', 10),
+		('Jalisco', 'Guadalajara', 20),
+		('Jalisco', 'Guadalajara', 30),
+		('Jalisco', 'Zapopan', 100),
+		('Sonora', 'Hermosillo', 5)`,
+}
+
+func TestNestedAggregation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "municipios", municipiosSQL...)
+	ctx := context.Background()
+
+	// Promedio por municipio: Guadalajara 20, Zapopan 100, Hermosillo 5
+	tests := []struct {
+		reagg   string
+		jalisco float64
+	}{
+		{"avg", 60},
+		{"sum", 120},
+		{"min", 20},
+		{"max", 100},
+		{"weighted_avg", 40},
+	}
+	for _, tc := range tests {
+		rows, _, err := m.GetNestedAggregation(ctx, "municipios", NestedAggregationParams{
+			ParentGroupBy: []string{"estado"},
+			ChildGroupBy:  []string{"municipio"},
+			Agg:           "avg",
+			VarAgg:        "monto",
+			Reagg:         tc.reagg,
+		})
+		if err != nil {
+			t.Fatalf("%s: GetNestedAggregation: %v", tc.reagg, err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("%s: filas = %v, se esperaban 2 estados", tc.reagg, rows)
+		}
+		if rows[0]["estado"] != "Jalisco" || toFloat(t, rows[0]["total"]) != tc.jalisco {
+			t.Errorf("%s: fila = %v, se esperaba Jalisco con total %v", tc.reagg, rows[0], tc.jalisco)
+		}
+		if fmt.Sprint(rows[0]["children"]) != "2" {
+			t.Errorf("%s: children = %v, se esperaban 2 municipios", tc.reagg, rows[0]["children"])
+		}
+		if toFloat(t, rows[1]["total"]) != 5 {
+			t.Errorf("%s: fila Sonora = %v, se esperaba total 5", tc.reagg, rows[1])
+		}
+	}
+}
+
+func TestNestedAggregationWithFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "municipios", municipiosSQL...)
+
+	rows, _, err := m.GetNestedAggregation(context.Background(), "municipios", NestedAggregationParams{
+		Filters:       map[string]interface{}{"estado": "Jalisco"},
+		ParentGroupBy: []string{"estado"},
+		ChildGroupBy:  []string{"municipio"},
+		Agg:           "count",
+	})
+	if err != nil {
+		t.Fatalf("GetNestedAggregation: %v", err)
+	}
+	// Conteos por municipio 3 y 1; el promedio por defecto da 2
+	if len(rows) != 1 || toFloat(t, rows[0]["total"]) != 2 {
+		t.Errorf("filas = %v, se esperaba solo Jalisco con total 2", rows)
+	}
+}
+
+func TestNestedAggregationValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "municipios", municipiosSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params NestedAggregationParams
+	}{
+		{"sin nivel hijo", NestedAggregationParams{ParentGroupBy: []string{"estado"}, Agg: "count"}},
+		{"sin nivel padre", NestedAggregationParams{ChildGroupBy: []string{"municipio"}, Agg: "count"}},
+		{"columna en ambos niveles", NestedAggregationParams{ParentGroupBy: []string{"estado"}, ChildGroupBy: []string{"estado"}, Agg: "count"}},
+		{"re-agregación inválida", NestedAggregationParams{ParentGroupBy: []string{"estado"}, ChildGroupBy: []string{"municipio"}, Agg: "count", Reagg: "moda"}},
+		{"columna inexistente", NestedAggregationParams{ParentGroupBy: []string{"estado"}, ChildGroupBy: []string{"colonia"}, Agg: "count"}},
+	}
+	for _, tc := range tests {
+		if _, _, err := m.GetNestedAggregation(ctx, "municipios", tc.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tc.name, err)
+		}
+	}
+}
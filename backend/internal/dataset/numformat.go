@@ -0,0 +1,197 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Valores de la muestra analizada para detectar el formato numérico
+	numberFormatSampleSize = 1000
+	// Ejemplos que se retornan por tipo de formato
+	numberFormatExamples = 5
+)
+
+// Formatos reconocidos en un valor numérico escrito como texto
+const (
+	formatInteger        = "integer"         // 1234
+	formatDecimalPoint   = "decimal_point"   // 1234.5
+	formatDecimalComma   = "decimal_comma"   // 1234,5
+	formatThousandsComma = "thousands_comma" // 1,234.5
+	formatThousandsDot   = "thousands_dot"   // 1.234,5
+	formatThousandsSpace = "thousands_space" // 1 234,5
+	formatAmbiguousComma = "ambiguous_comma" // 1,234 (miles o decimal)
+	formatAmbiguousDot   = "ambiguous_dot"   // 1.234 (miles o decimal)
+	formatNonNumeric     = "non_numeric"
+)
+
+var (
+	reInteger        = regexp.MustCompile(`^\d+$`)
+	reDecimalPoint   = regexp.MustCompile(`^\d+\.\d+$`)
+	reDecimalComma   = regexp.MustCompile(`^\d+,\d+$`)
+	reThousandsComma = regexp.MustCompile(`^\d{1,3}(,\d{3})+\.\d+$`)
+	reThousandsDot   = regexp.MustCompile(`^\d{1,3}(\.\d{3})+,\d+$`)
+	reThousandsSpace = regexp.MustCompile(`^\d{1,3}( \d{3})+([.,]\d+)?$`)
+	reAmbiguousComma = regexp.MustCompile(`^\d{1,3}(,\d{3})+$`)
+	reAmbiguousDot   = regexp.MustCompile(`^\d{1,3}(\.\d{3})+$`)
+)
+
+// NumberFormat describe los separadores que parece usar una columna numérica escrita como texto
+type NumberFormat struct {
+	Column             string              `json:"column"`
+	Type               string              `json:"type"`
+	AlreadyNumeric     bool                `json:"already_numeric"`
+	SampleSize         int                 `json:"sample_size"`
+	NumericRatio       float64             `json:"numeric_ratio"`
+	DecimalSeparator   string              `json:"decimal_separator,omitempty"`
+	ThousandsSeparator string              `json:"thousands_separator,omitempty"`
+	Confidence         float64             `json:"confidence"`
+	Counts             map[string]int      `json:"counts"`
+	Examples           map[string][]string `json:"examples"`
+}
+
+// GetNumberFormat analiza una muestra de la columna y detecta separador decimal y de miles,
+// para que el usuario confirme antes de convertirla a número
+func (m *Manager) GetNumberFormat(ctx context.Context, uuid, column string) (*NumberFormat, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &NumberFormat{
+		Column:   column,
+		Counts:   map[string]int{},
+		Examples: map[string][]string{},
+	}
+	for _, col := range columns {
+		if col.Name == column {
+			result.Type = col.Type
+		}
+	}
+	if result.Type == "" {
+		return nil, fmt.Errorf("%w: columna inexistente %q", ErrInvalidParams, column)
+	}
+
+	// Si DuckDB ya la cargó como número no hay nada que convertir
+	if isNumericType(result.Type) {
+		result.AlreadyNumeric = true
+		result.NumericRatio = 1
+		result.Confidence = 1
+		result.DecimalSeparator = "."
+		return result, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT v FROM (
+			SELECT TRIM(CAST("%s" AS VARCHAR)) AS v
+			FROM data
+			WHERE "%s" IS NOT NULL AND TRIM(CAST("%s" AS VARCHAR)) <> ''
+		) USING SAMPLE reservoir(%d ROWS) REPEATABLE (42)
+	`, column, column, column, numberFormatSampleSize)
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo muestra: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		format := classifyNumber(value)
+		result.Counts[format]++
+		if len(result.Examples[format]) < numberFormatExamples {
+			result.Examples[format] = append(result.Examples[format], value)
+		}
+		result.SampleSize++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolveNumberFormat(result)
+	return result, nil
+}
+
+// classifyNumber identifica el formato de un valor, ignorando signo, moneda y porcentaje
+func classifyNumber(value string) string {
+	v := strings.TrimSpace(value)
+	v = strings.TrimLeft(v, "+-$ ")
+	v = strings.TrimRight(v, "% ")
+
+	switch {
+	case v == "":
+		return formatNonNumeric
+	case reInteger.MatchString(v):
+		return formatInteger
+	case reThousandsComma.MatchString(v):
+		return formatThousandsComma
+	case reThousandsDot.MatchString(v):
+		return formatThousandsDot
+	case reThousandsSpace.MatchString(v):
+		return formatThousandsSpace
+	case reAmbiguousComma.MatchString(v):
+		return formatAmbiguousComma
+	case reAmbiguousDot.MatchString(v):
+		return formatAmbiguousDot
+	case reDecimalPoint.MatchString(v):
+		return formatDecimalPoint
+	case reDecimalComma.MatchString(v):
+		return formatDecimalComma
+	default:
+		return formatNonNumeric
+	}
+}
+
+// resolveNumberFormat decide los separadores a partir de los conteos. Los valores
+// ambiguos (1,234 o 1.234) encajan con ambas convenciones, así que solo cuenta la
+// evidencia no ambigua; sin ella se asume coma de miles y punto decimal, lo común
+// en México, con confianza 0.5.
+func resolveNumberFormat(f *NumberFormat) {
+	c := f.Counts
+	numeric := f.SampleSize - c[formatNonNumeric]
+	if numeric == 0 {
+		return
+	}
+	f.NumericRatio = float64(numeric) / float64(f.SampleSize)
+
+	pointEvidence := c[formatDecimalPoint] + c[formatThousandsComma]
+	commaEvidence := c[formatDecimalComma] + c[formatThousandsDot]
+	ambiguous := c[formatAmbiguousComma] + c[formatAmbiguousDot]
+	grouped := c[formatThousandsComma] + c[formatThousandsDot] + c[formatThousandsSpace] + ambiguous
+
+	switch {
+	case pointEvidence+commaEvidence > 0:
+		if commaEvidence > pointEvidence {
+			f.DecimalSeparator, f.ThousandsSeparator = ",", "."
+			f.Confidence = float64(commaEvidence) / float64(pointEvidence+commaEvidence)
+		} else {
+			f.DecimalSeparator, f.ThousandsSeparator = ".", ","
+			f.Confidence = float64(pointEvidence) / float64(pointEvidence+commaEvidence)
+		}
+	case ambiguous > 0:
+		f.DecimalSeparator, f.ThousandsSeparator = ".", ","
+		f.Confidence = 0.5
+	default:
+		// Solo enteros (o miles con espacio): no hay nada que decidir
+		f.Confidence = 1
+	}
+
+	if c[formatThousandsSpace] > 0 {
+		f.ThousandsSeparator = " "
+	}
+
+	// Sin agrupación de miles en la muestra no se reporta separador
+	if grouped == 0 {
+		f.ThousandsSeparator = ""
+	}
+}
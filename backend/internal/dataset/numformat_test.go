@@ -0,0 +1,73 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClassifyNumber(t *testing.T) {
+	tests := map[string]string{
+		"1234":      formatInteger,
+		"-1234":     formatInteger,
+		"1234.5":    formatDecimalPoint,
+		"1234,5":    formatDecimalComma,
+		"$1,234.50": formatThousandsComma,
+		"1.234,5":   formatThousandsDot,
+		"1 234,5":   formatThousandsSpace,
+		"1,234":     formatAmbiguousComma,
+		"1.234.567": formatAmbiguousDot,
+		"12.5%":     formatDecimalPoint,
+		"N/D":       formatNonNumeric,
+		"1,2,3":     formatNonNumeric,
+	}
+	for value, want := range tests {
+		if got := classifyNumber(value); got != want {
+			t.Errorf("classifyNumber(%q) = %s, se esperaba %s", value, got, want)
+		}
+	}
+}
+
+func TestGetNumberFormat(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "montos",
+		`CREATE TABLE data (coma VARCHAR, punto VARCHAR, ambiguo VARCHAR, enteros VARCHAR, numerico DOUBLE)`,
+		`INSERT INTO data VALUES
+			('1.234,56', '1,234.56', '1,234', '10', 1.5),
+			('12,5', '12.5', '5,000', '20', 2.5),
+			('3,75', '3.75', '12,000', '30', 3.5),
+			('N/D', NULL, '', '40', NULL)`)
+
+	tests := []struct {
+		column              string
+		decimal, thousands  string
+		confidence, numeric float64
+	}{
+		{"coma", ",", ".", 1, 0.75},
+		{"punto", ".", ",", 1, 1},
+		// Sin evidencia no ambigua se asume el formato mexicano con confianza media
+		{"ambiguo", ".", ",", 0.5, 1},
+		{"enteros", "", "", 1, 1},
+		{"numerico", ".", "", 1, 1},
+	}
+	for _, tt := range tests {
+		f, err := m.GetNumberFormat(context.Background(), "montos", tt.column)
+		if err != nil {
+			t.Fatalf("%s: GetNumberFormat: %v", tt.column, err)
+		}
+		if f.DecimalSeparator != tt.decimal || f.ThousandsSeparator != tt.thousands ||
+			f.Confidence != tt.confidence || f.NumericRatio != tt.numeric {
+			t.Errorf("%s: decimal %q, miles %q, confianza %v, proporción %v; se esperaba %q, %q, %v, %v",
+				tt.column, f.DecimalSeparator, f.ThousandsSeparator, f.Confidence, f.NumericRatio,
+				tt.decimal, tt.thousands, tt.confidence, tt.numeric)
+		}
+	}
+
+	f, _ := m.GetNumberFormat(context.Background(), "montos", "numerico")
+	if !f.AlreadyNumeric {
+		t.Errorf("numerico: already_numeric = false, la columna ya es DOUBLE")
+	}
+	if _, err := m.GetNumberFormat(context.Background(), "montos", "otra"); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("columna inexistente: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
@@ -0,0 +1,133 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Debajo de este número de filas no vale la pena particionar
+	partitionMinRows = 1_000_000
+	// Si un año tiene más filas que esto, conviene particionar por mes
+	partitionMaxRowsPerYear = 50_000_000
+)
+
+// PartitionPeriod es el número de filas en un periodo (año o mes)
+type PartitionPeriod struct {
+	Period string `json:"period"`
+	Rows   int64  `json:"rows"`
+}
+
+// PartitionSuggestion es el esquema de partición temporal sugerido para un dataset
+type PartitionSuggestion struct {
+	Column     string            `json:"column"`
+	Scheme     string            `json:"scheme"` // none, year, month
+	Reason     string            `json:"reason"`
+	TotalRows  int64             `json:"total_rows"`
+	Partitions int               `json:"partitions"`
+	Periods    []PartitionPeriod `json:"periods"`
+	// Porcentaje de filas que se dejaría de leer en una consulta sobre un solo periodo
+	EstimatedScanReductionPct float64 `json:"estimated_scan_reduction_pct"`
+	// Relación entre el periodo más grande y el promedio (1 = distribución uniforme)
+	Skew float64 `json:"skew"`
+}
+
+// GetPartitionSuggestion analiza la distribución de una columna de fecha y sugiere
+// particionar por año o mes. Si column está vacía se usa la primera columna de fecha.
+func (m *Manager) GetPartitionSuggestion(ctx context.Context, uuid, column string) (*PartitionSuggestion, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if column == "" {
+		columns, err := m.getColumns(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		dateColumns := m.getDateColumns(columns)
+		if len(dateColumns) == 0 {
+			return nil, fmt.Errorf("%w: el dataset no tiene columnas de fecha", ErrInvalidParams)
+		}
+		column = dateColumns[0]
+	} else if err := m.validateColumns(ctx, conn, []string{column}); err != nil {
+		return nil, err
+	}
+
+	// Distribución mensual, la anual se deriva de ella
+	query := fmt.Sprintf(`
+		SELECT STRFTIME(TRY_CAST("%s" AS DATE), '%%Y-%%m') as period, COUNT(*) as rows
+		FROM data
+		WHERE TRY_CAST("%s" AS DATE) IS NOT NULL
+		GROUP BY 1
+		ORDER BY 1
+	`, column, column)
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error analizando distribución: %w", err)
+	}
+	defer rows.Close()
+
+	var months []PartitionPeriod
+	var years []PartitionPeriod
+	var total int64
+	for rows.Next() {
+		var p PartitionPeriod
+		if err := rows.Scan(&p.Period, &p.Rows); err != nil {
+			return nil, err
+		}
+		months = append(months, p)
+		total += p.Rows
+
+		year := strings.SplitN(p.Period, "-", 2)[0]
+		if len(years) > 0 && years[len(years)-1].Period == year {
+			years[len(years)-1].Rows += p.Rows
+		} else {
+			years = append(years, PartitionPeriod{Period: year, Rows: p.Rows})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	suggestion := &PartitionSuggestion{
+		Column:    column,
+		TotalRows: total,
+		Scheme:    "none",
+	}
+
+	switch {
+	case total < partitionMinRows:
+		suggestion.Reason = fmt.Sprintf("El dataset tiene menos de %d filas con fecha, particionar no aporta beneficio", partitionMinRows)
+		suggestion.Periods = years
+	case len(years) >= 2 && total/int64(len(years)) <= partitionMaxRowsPerYear:
+		suggestion.Scheme = "year"
+		suggestion.Reason = fmt.Sprintf("Los datos abarcan %d años con un volumen manejable por año", len(years))
+		suggestion.Periods = years
+	case len(months) >= 2:
+		suggestion.Scheme = "month"
+		suggestion.Reason = "El volumen por año es muy alto o hay un solo año, conviene particionar por mes"
+		suggestion.Periods = months
+	default:
+		suggestion.Reason = "Todos los datos caen en un solo periodo"
+		suggestion.Periods = years
+	}
+
+	if suggestion.Scheme != "none" {
+		suggestion.Partitions = len(suggestion.Periods)
+		suggestion.EstimatedScanReductionPct = (1 - 1/float64(suggestion.Partitions)) * 100
+
+		var largest int64
+		for _, p := range suggestion.Periods {
+			if p.Rows > largest {
+				largest = p.Rows
+			}
+		}
+		average := float64(total) / float64(suggestion.Partitions)
+		suggestion.Skew = float64(largest) / average
+	}
+
+	return suggestion, nil
+}
@@ -0,0 +1,56 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPartitionSuggestion(t *testing.T) {
+	m := newTestManager(t, Options{})
+	// 1.2 millones de filas repartidas entre 2020 y 2023
+	writeDataset(t, m, "multianual", `CREATE TABLE data AS
+		SELECT i as id, DATE '2020-01-01' + CAST(i % 1461 AS INTEGER) as fecha
+		FROM range(1200000) t(i)`)
+	// Las mismas filas en un solo año
+	writeDataset(t, m, "anual", `CREATE TABLE data AS
+		SELECT i as id, DATE '2022-01-01' + CAST(i % 365 AS INTEGER) as fecha
+		FROM range(1200000) t(i)`)
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		uuid       string
+		scheme     string
+		partitions int
+	}{
+		{"multianual", "year", 4},
+		{"anual", "month", 12},
+		{"ventas", "none", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uuid, func(t *testing.T) {
+			suggestion, err := m.GetPartitionSuggestion(context.Background(), tt.uuid, "")
+			if err != nil {
+				t.Fatalf("GetPartitionSuggestion: %v", err)
+			}
+			if suggestion.Column != "fecha" || suggestion.Scheme != tt.scheme || suggestion.Partitions != tt.partitions {
+				t.Errorf("sugerencia = %s por %s en %d particiones, se esperaba %s en %d",
+					suggestion.Column, suggestion.Scheme, suggestion.Partitions, tt.scheme, tt.partitions)
+			}
+		})
+	}
+
+	suggestion, _ := m.GetPartitionSuggestion(context.Background(), "multianual", "fecha")
+	if suggestion.TotalRows != 1200000 || suggestion.EstimatedScanReductionPct != 75 {
+		t.Errorf("filas = %d, reducción = %v%%; se esperaban 1200000 y 75%%", suggestion.TotalRows, suggestion.EstimatedScanReductionPct)
+	}
+}
+
+func TestPartitionSuggestionWithoutDates(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "sin_fechas", `CREATE TABLE data AS SELECT 1 as id`)
+
+	if _, err := m.GetPartitionSuggestion(context.Background(), "sin_fechas", ""); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("err = %v, se esperaba ErrInvalidParams sin columnas de fecha", err)
+	}
+}
@@ -0,0 +1,157 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Bytes del CSV remoto que se leen para el preview
+	previewBytes = 64 * 1024
+	// Filas de ejemplo del preview
+	previewRows = 5
+	// Tiempo máximo para obtener el preview, que no debe retrasar la respuesta
+	previewTimeout = 10 * time.Second
+)
+
+// PreviewColumn es una columna detectada en el preview con su tipo inferido
+type PreviewColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SchemaPreview es el esquema de un CSV remoto inferido de sus primeros KB
+type SchemaPreview struct {
+	Columns []PreviewColumn          `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+	// Partial indica que solo se leyó el inicio del archivo; los tipos pueden
+	// cambiar al cargarlo completo
+	Partial bool `json:"partial"`
+	// Truncated indica que las filas de ejemplo se cortaron en el máximo de filas
+	Truncated bool `json:"truncated"`
+}
+
+// GetRemotePreview lee solo el inicio del CSV de un recurso (HTTP Range) y
+// retorna sus columnas con tipos inferidos y unas filas de ejemplo, sin
+// descargar el archivo completo
+func (m *Manager) GetRemotePreview(ctx context.Context, uuid string) (*SchemaPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	resource, err := m.ckanClient.GetResource(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo recurso de CKAN: %w", err)
+	}
+
+	head, partial, err := m.fetchCSVHead(ctx, resource.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "preview-"+uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	csvPath := filepath.Join(tmpDir, "head.csv")
+	if err := os.WriteFile(csvPath, head, 0644); err != nil {
+		return nil, err
+	}
+
+	options := "header = true, ignore_errors = true, null_padding = true"
+	sniff, err := sniffCSV(csvPath)
+	if err == nil {
+		if sniff.Encoding == encodingLatin1 {
+			utf8Path := csvPath + ".utf8"
+			if err := transcodeLatin1(csvPath, utf8Path); err != nil {
+				return nil, fmt.Errorf("error convirtiendo CSV a UTF-8: %w", err)
+			}
+			csvPath = utf8Path
+		}
+		options += ", " + sniff.delimOption()
+		if skip, ok := m.CSVSkip(uuid); ok {
+			sniff.setSkipRows(skip)
+		}
+		if skip := sniff.skipOption(); skip != "" {
+			options += ", " + skip
+		}
+	}
+
+	conn, err := sql.Open("duckdb", "")
+	if err != nil {
+		return nil, fmt.Errorf("error creando DuckDB: %w", err)
+	}
+	defer conn.Close()
+
+	query := fmt.Sprintf(`SELECT * FROM read_csv_auto('%s', %s) LIMIT %d`, csvPath, options, previewRows)
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo encabezado del CSV: %w", err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	preview := &SchemaPreview{
+		Columns: make([]PreviewColumn, len(types)),
+		Partial: partial,
+	}
+	for i, colType := range types {
+		preview.Columns[i] = PreviewColumn{Name: colType.Name(), Type: colType.DatabaseTypeName()}
+	}
+
+	preview.Rows, preview.Truncated, err = m.rowsToMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// fetchCSVHead descarga a lo más previewBytes del inicio del archivo. Si el
+// servidor ignora el Range se deja de leer igual. Cuando el archivo se cortó,
+// se descarta la última línea incompleta y partial es true.
+func (m *Manager) fetchCSVHead(ctx context.Context, url string) (head []byte, partial bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	m.ckanClient.AuthorizeRequest(req)
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", previewBytes-1))
+
+	resp, err := m.ckanClient.HTTPClient().Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("error en request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, false, fmt.Errorf("HTTP error: status %d", resp.StatusCode)
+	}
+
+	// Un byte extra permite saber si el archivo sigue cuando no se respetó el Range
+	head, err = io.ReadAll(io.LimitReader(resp.Body, previewBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	partial = len(head) > previewBytes || (resp.StatusCode == http.StatusPartialContent && len(head) == previewBytes)
+	if len(head) > previewBytes {
+		head = head[:previewBytes]
+	}
+	if partial {
+		if i := bytes.LastIndexByte(head, '\n'); i > 0 {
+			head = head[:i+1]
+		}
+	}
+	return head, partial, nil
+}
@@ -0,0 +1,85 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestRemotePreview(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{
+		Format: "CSV",
+		Body:   []byte("region,monto,fecha\nNorte,10,2024-01-05\nSur,20.5,2024-02-10\n"),
+	})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	preview, err := m.GetRemotePreview(context.Background(), "ventas")
+	if err != nil {
+		t.Fatalf("GetRemotePreview: %v", err)
+	}
+	want := []PreviewColumn{{"region", "VARCHAR"}, {"monto", "DOUBLE"}, {"fecha", "DATE"}}
+	if fmt.Sprint(preview.Columns) != fmt.Sprint(want) {
+		t.Errorf("columnas = %v, se esperaban %v", preview.Columns, want)
+	}
+	if len(preview.Rows) != 2 || preview.Partial {
+		t.Errorf("%d filas (parcial %v), se esperaban las 2 del archivo completo", len(preview.Rows), preview.Partial)
+	}
+}
+
+func TestRemotePreviewReadsOnlyHead(t *testing.T) {
+	// Un archivo mayor que previewBytes: solo se pide el inicio
+	var csv strings.Builder
+	csv.WriteString("id;nombre\n")
+	for i := 0; csv.Len() < 3*previewBytes; i++ {
+		fmt.Fprintf(&csv, "%d;registro número %d\n", i, i)
+	}
+
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("grande", testutil.CKANResource{Format: "CSV", Body: []byte(csv.String())})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	preview, err := m.GetRemotePreview(context.Background(), "grande")
+	if err != nil {
+		t.Fatalf("GetRemotePreview: %v", err)
+	}
+	if !preview.Partial {
+		t.Error("se esperaba un preview parcial")
+	}
+	if len(preview.Columns) != 2 || preview.Columns[0].Name != "id" || preview.Columns[0].Type != "BIGINT" {
+		t.Errorf("columnas = %v, se esperaban id BIGINT y nombre con el delimitador detectado", preview.Columns)
+	}
+	if len(preview.Rows) != previewRows {
+		t.Errorf("%d filas, se esperaban %d", len(preview.Rows), previewRows)
+	}
+
+	// El dataset no queda descargado
+	if _, found := m.cacheManager.GetFromDisk("grande"); found {
+		t.Error("el preview no debería dejar el dataset en cache")
+	}
+}
+
+func TestFetchCSVHeadWithoutRangeSupport(t *testing.T) {
+	// Un recurso con Hold se sirve completo aunque se pida un Range
+	body := strings.Repeat("a,b\n", previewBytes)
+	hold := make(chan struct{})
+	defer close(hold)
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("lento", testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	resource, err := m.ckanClient.GetResource(context.Background(), "lento")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, partial, err := m.fetchCSVHead(context.Background(), resource.URL)
+	if err != nil {
+		t.Fatalf("fetchCSVHead: %v", err)
+	}
+	if !partial || len(head) > previewBytes || !strings.HasSuffix(string(head), "\n") {
+		t.Errorf("%d bytes (parcial %v), se esperaba cortar en la última línea completa", len(head), partial)
+	}
+}
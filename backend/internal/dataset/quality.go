@@ -0,0 +1,358 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GetTextLengthDistribution cuenta los valores de una columna por longitud de texto,
+// útil para detectar truncamientos y campos vacíos
+func (m *Manager) GetTextLengthDistribution(ctx context.Context, uuid, column string) (map[string]interface{}, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{column}); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			LENGTH(CAST("%s" AS VARCHAR)) as length,
+			COUNT(*) as count
+		FROM data
+		WHERE "%s" IS NOT NULL
+		GROUP BY 1
+		ORDER BY 1
+	`, column, column)
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo longitudes: %w", err)
+	}
+	defer rows.Close()
+
+	distribution, truncated, err := m.rowsToMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var nulls, empty int64
+	query = fmt.Sprintf(`
+		SELECT
+			COUNT(*) FILTER (WHERE "%s" IS NULL),
+			COUNT(*) FILTER (WHERE TRIM(CAST("%s" AS VARCHAR)) = '')
+		FROM data
+	`, column, column)
+	if err := conn.QueryRowContext(ctx, query).Scan(&nulls, &empty); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"column":       column,
+		"distribution": distribution,
+		"nulls":        nulls,
+		"empty":        empty,
+		"truncated":    truncated,
+	}, nil
+}
+
+const (
+	// Máximo de valores válidos aceptados en una verificación de dominio
+	maxDomainValues = 10000
+	// Número de valores inesperados que se retornan como muestra
+	domainSampleSize = 20
+)
+
+// CheckDomain cuenta las filas cuyo valor en column no pertenece al conjunto válido
+// y retorna una muestra de los valores inesperados más frecuentes.
+// La comparación se hace como texto para no depender del tipo de la columna.
+func (m *Manager) CheckDomain(ctx context.Context, uuid, column string, validValues []interface{}) (map[string]interface{}, error) {
+	if len(validValues) == 0 {
+		return nil, fmt.Errorf("%w: se requiere al menos un valor válido", ErrInvalidParams)
+	}
+	if len(validValues) > maxDomainValues {
+		return nil, fmt.Errorf("%w: máximo %d valores válidos", ErrInvalidParams, maxDomainValues)
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{column}); err != nil {
+		return nil, err
+	}
+
+	placeholders := make([]string, len(validValues))
+	args := make([]interface{}, len(validValues))
+	for i, v := range validValues {
+		placeholders[i] = "?"
+		args[i] = fmt.Sprint(v)
+	}
+	outOfDomain := fmt.Sprintf(`CAST("%s" AS VARCHAR) NOT IN (%s)`, column, strings.Join(placeholders, ", "))
+
+	var total, invalid, nulls int64
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE %s),
+			COUNT(*) FILTER (WHERE "%s" IS NULL)
+		FROM data
+	`, outOfDomain, column)
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&total, &invalid, &nulls); err != nil {
+		return nil, fmt.Errorf("error verificando dominio: %w", err)
+	}
+
+	query = fmt.Sprintf(`
+		SELECT CAST("%s" AS VARCHAR) as value, COUNT(*) as count
+		FROM data
+		WHERE %s
+		GROUP BY 1
+		ORDER BY count DESC
+		LIMIT %d
+	`, column, outOfDomain, domainSampleSize)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo muestra: %w", err)
+	}
+	defer rows.Close()
+
+	sample, truncated, err := m.rowsToMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var pct float64
+	if total > 0 {
+		pct = float64(invalid) / float64(total) * 100
+	}
+
+	return map[string]interface{}{
+		"column":            column,
+		"total_rows":        total,
+		"out_of_domain":     invalid,
+		"out_of_domain_pct": pct,
+		"nulls":             nulls,
+		"unexpected_values": sample,
+		"truncated":         truncated,
+	}, nil
+}
+
+// ColumnCompleteness describe la completitud de una columna
+type ColumnCompleteness struct {
+	Column   string  `json:"column"`
+	Nulls    int64   `json:"nulls"`
+	NonNull  int64   `json:"non_null"`
+	FillRate float64 `json:"fill_rate"`
+}
+
+// GetNullCounts cuenta nulos y no nulos de todas las columnas en una sola pasada.
+// fill_rate es no_nulos/total (0 si el dataset está vacío).
+func (m *Manager) GetNullCounts(ctx context.Context, uuid string) (map[string]interface{}, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// COUNT(*) seguido de COUNT(col) por columna; COUNT(col) ignora nulos
+	exprs := make([]string, 0, len(columns)+1)
+	exprs = append(exprs, "COUNT(*)")
+	for _, col := range columns {
+		exprs = append(exprs, fmt.Sprintf(`COUNT("%s")`, col.Name))
+	}
+	query := fmt.Sprintf("SELECT %s FROM data", strings.Join(exprs, ", "))
+
+	counts := make([]int64, len(exprs))
+	pointers := make([]interface{}, len(exprs))
+	for i := range counts {
+		pointers[i] = &counts[i]
+	}
+	if err := conn.QueryRowContext(ctx, query).Scan(pointers...); err != nil {
+		return nil, fmt.Errorf("error contando nulos: %w", err)
+	}
+
+	total := counts[0]
+	result := make([]ColumnCompleteness, len(columns))
+	for i, col := range columns {
+		nonNull := counts[i+1]
+		result[i] = ColumnCompleteness{
+			Column:  col.Name,
+			Nulls:   total - nonNull,
+			NonNull: nonNull,
+		}
+		if total > 0 {
+			result[i].FillRate = float64(nonNull) / float64(total)
+		}
+	}
+
+	return map[string]interface{}{
+		"total_rows": total,
+		"columns":    result,
+	}, nil
+}
+
+const (
+	// Proporción de valores distintos a partir de la cual una columna es casi única
+	nearUniqueThreshold = 0.95
+	// Margen del conteo aproximado: solo se verifica con COUNT(DISTINCT) exacto
+	// a las columnas cuyo estimado supera este ratio
+	candidateKeyApproxThreshold = 0.9
+)
+
+// CandidateKey describe qué tan única es una columna
+type CandidateKey struct {
+	Column     string  `json:"column"`
+	Type       string  `json:"type"`
+	Distinct   int64   `json:"distinct"`
+	Nulls      int64   `json:"nulls"`
+	Duplicates int64   `json:"duplicates"`
+	Uniqueness float64 `json:"uniqueness"`
+}
+
+// GetCandidateKeys reporta las columnas individuales que podrían servir de clave:
+// únicas (sin nulos ni repetidos) y casi únicas. No prueba combinaciones de
+// columnas para no explotar combinatoriamente.
+func (m *Manager) GetCandidateKeys(ctx context.Context, uuid string) (map[string]interface{}, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	unique := []CandidateKey{}
+	nearUnique := []CandidateKey{}
+
+	var total int64
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&total); err != nil {
+		return nil, err
+	}
+	if total == 0 || len(columns) == 0 {
+		return map[string]interface{}{
+			"total_rows":  total,
+			"unique":      unique,
+			"near_unique": nearUnique,
+			"threshold":   nearUniqueThreshold,
+		}, nil
+	}
+
+	// 1. Estimado barato de distintos para todas las columnas en una sola pasada
+	selects := make([]string, len(columns))
+	for i, col := range columns {
+		selects[i] = fmt.Sprintf(`approx_count_distinct("%s")`, col.Name)
+	}
+	approx := make([]int64, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range approx {
+		dest[i] = &approx[i]
+	}
+	query := fmt.Sprintf("SELECT %s FROM data", strings.Join(selects, ", "))
+	if err := conn.QueryRowContext(ctx, query).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("error estimando valores distintos: %w", err)
+	}
+
+	// 2. Conteo exacto solo para las columnas prometedoras
+	var candidates []ColumnInfo
+	selects = selects[:0]
+	for i, col := range columns {
+		if float64(approx[i])/float64(total) >= candidateKeyApproxThreshold {
+			candidates = append(candidates, col)
+			selects = append(selects, fmt.Sprintf(`COUNT(DISTINCT "%s"), COUNT(*) - COUNT("%s")`, col.Name, col.Name))
+		}
+	}
+	if len(candidates) > 0 {
+		counts := make([]int64, 2*len(candidates))
+		dest = make([]interface{}, len(counts))
+		for i := range counts {
+			dest[i] = &counts[i]
+		}
+		query = fmt.Sprintf("SELECT %s FROM data", strings.Join(selects, ", "))
+		if err := conn.QueryRowContext(ctx, query).Scan(dest...); err != nil {
+			return nil, fmt.Errorf("error contando valores distintos: %w", err)
+		}
+
+		for i, col := range candidates {
+			key := CandidateKey{
+				Column:   col.Name,
+				Type:     col.Type,
+				Distinct: counts[2*i],
+				Nulls:    counts[2*i+1],
+			}
+			key.Duplicates = total - key.Nulls - key.Distinct
+			key.Uniqueness = float64(key.Distinct) / float64(total)
+
+			switch {
+			case key.Distinct == total:
+				unique = append(unique, key)
+			case key.Uniqueness >= nearUniqueThreshold:
+				nearUnique = append(nearUnique, key)
+			}
+		}
+	}
+
+	sort.Slice(nearUnique, func(i, j int) bool {
+		return nearUnique[i].Uniqueness > nearUnique[j].Uniqueness
+	})
+
+	return map[string]interface{}{
+		"total_rows":  total,
+		"unique":      unique,
+		"near_unique": nearUnique,
+		"threshold":   nearUniqueThreshold,
+	}, nil
+}
+
+// GetRowCountCheck compara las filas cargadas en data contra las esperadas:
+// el valor provisto (expected > 0) o los registros del CSV contados al cargar
+func (m *Manager) GetRowCountCheck(ctx context.Context, uuid string, expected int64) (map[string]interface{}, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded int64
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&loaded); err != nil {
+		return nil, fmt.Errorf("error contando filas: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"loaded_rows":   loaded,
+		"expected_rows": nil,
+		"mismatch":      false,
+	}
+
+	source := ""
+	meta, hasMeta := m.readMeta(uuid)
+	switch {
+	case expected > 0:
+		source = "provided"
+	case hasMeta && meta.ExpectedRows > 0:
+		// Copias anteriores a este conteo no lo tienen; 0 se trata como desconocido
+		expected = meta.ExpectedRows
+		source = "csv"
+	}
+	if hasMeta {
+		result["rejected_rows"] = meta.RejectedRows
+	}
+
+	if source != "" {
+		result["expected_rows"] = expected
+		result["expected_source"] = source
+		result["mismatch"] = loaded != expected
+		result["missing_rows"] = expected - loaded
+	}
+	return result, nil
+}
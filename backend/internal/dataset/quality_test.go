@@ -0,0 +1,213 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestTextLengthDistribution(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "claves",
+		`CREATE TABLE data (clave VARCHAR)`,
+		`INSERT INTO data VALUES (''), ('ab'), ('cd'), ('  '), ('xyz'), (NULL)`)
+
+	result, err := m.GetTextLengthDistribution(context.Background(), "claves", "clave")
+	if err != nil {
+		t.Fatalf("GetTextLengthDistribution: %v", err)
+	}
+
+	got := make(map[int64]int64)
+	for _, row := range result["distribution"].([]map[string]interface{}) {
+		got[row["length"].(int64)] = row["count"].(int64)
+	}
+	want := map[int64]int64{0: 1, 2: 3, 3: 1}
+	if len(got) != len(want) {
+		t.Fatalf("distribución = %v, se esperaba %v", got, want)
+	}
+	for length, n := range want {
+		if got[length] != n {
+			t.Errorf("longitud %d: %d filas, se esperaban %d", length, got[length], n)
+		}
+	}
+	// Los NULL no cuentan como longitud; vacíos son los que solo tienen espacios
+	if result["nulls"] != int64(1) || result["empty"] != int64(2) {
+		t.Errorf("nulls = %v, empty = %v; se esperaban 1 y 2", result["nulls"], result["empty"])
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "catalogo",
+		`CREATE TABLE data (estado VARCHAR, codigo INTEGER)`,
+		`INSERT INTO data VALUES ('JAL', 1), ('JAL', 2), ('CDMX', 1), ('Jalisco', 9), ('Jalisco', 9), ('xx', 1), (NULL, NULL)`)
+
+	result, err := m.CheckDomain(context.Background(), "catalogo", "estado", []interface{}{"JAL", "CDMX"})
+	if err != nil {
+		t.Fatalf("CheckDomain: %v", err)
+	}
+	// Los NULL se reportan aparte, no como fuera de dominio
+	if result["total_rows"] != int64(7) || result["out_of_domain"] != int64(3) || result["nulls"] != int64(1) {
+		t.Errorf("total = %v, fuera = %v, nulls = %v; se esperaban 7, 3 y 1",
+			result["total_rows"], result["out_of_domain"], result["nulls"])
+	}
+	sample := result["unexpected_values"].([]map[string]interface{})
+	if len(sample) != 2 || sample[0]["value"] != "Jalisco" || sample[0]["count"] != int64(2) {
+		t.Errorf("muestra = %v, se esperaba Jalisco (2) primero y luego xx", sample)
+	}
+
+	// Los números del JSON llegan como float64 y se comparan como texto
+	result, err = m.CheckDomain(context.Background(), "catalogo", "codigo", []interface{}{float64(1), float64(2)})
+	if err != nil {
+		t.Fatalf("CheckDomain numérico: %v", err)
+	}
+	if result["out_of_domain"] != int64(2) {
+		t.Errorf("fuera de dominio = %v, se esperaban 2 (los 9)", result["out_of_domain"])
+	}
+}
+
+func TestCheckDomainValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "catalogo", `CREATE TABLE data AS SELECT 'JAL' as estado`)
+
+	if _, err := m.CheckDomain(context.Background(), "catalogo", "estado", nil); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("sin valores: err = %v, se esperaba ErrInvalidParams", err)
+	}
+	if _, err := m.CheckDomain(context.Background(), "catalogo", "municipio", []interface{}{"JAL"}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("columna inexistente: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestCandidateKeys(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "padron",
+		`CREATE TABLE data AS
+			SELECT i as id,
+				CASE WHEN i <= 10 THEN 0 ELSE i END as folio,
+				CASE WHEN i % 200 = 0 THEN NULL ELSE 'CURP' || i END as curp,
+				CASE WHEN i % 2 = 0 THEN 'Norte' ELSE 'Sur' END as region
+			FROM range(1, 1001) t(i)`)
+
+	result, err := m.GetCandidateKeys(context.Background(), "padron")
+	if err != nil {
+		t.Fatalf("GetCandidateKeys: %v", err)
+	}
+
+	unique := result["unique"].([]CandidateKey)
+	if len(unique) != 1 || unique[0].Column != "id" {
+		t.Errorf("únicas = %+v, se esperaba solo id", unique)
+	}
+
+	// folio tiene 10 ceros repetidos y curp 5 nulos; region queda fuera
+	near := result["near_unique"].([]CandidateKey)
+	if len(near) != 2 || near[0].Column != "curp" || near[1].Column != "folio" {
+		t.Fatalf("casi únicas = %+v, se esperaban curp y folio", near)
+	}
+	if near[0].Nulls != 5 || near[0].Duplicates != 0 {
+		t.Errorf("curp: %d nulos, %d repetidos; se esperaban 5 y 0", near[0].Nulls, near[0].Duplicates)
+	}
+	if near[1].Distinct != 991 || near[1].Duplicates != 9 {
+		t.Errorf("folio: %d distintos, %d repetidos; se esperaban 991 y 9", near[1].Distinct, near[1].Duplicates)
+	}
+}
+
+func TestCandidateKeysEmptyDataset(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "vacio", `CREATE TABLE data (id INTEGER)`)
+
+	result, err := m.GetCandidateKeys(context.Background(), "vacio")
+	if err != nil {
+		t.Fatalf("GetCandidateKeys: %v", err)
+	}
+	if result["total_rows"] != int64(0) || len(result["unique"].([]CandidateKey)) != 0 {
+		t.Errorf("resultado = %v, se esperaba sin candidatas", result)
+	}
+}
+
+func TestGetNullCounts(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "completitud",
+		`CREATE TABLE data AS
+			SELECT i as id,
+				CASE WHEN i % 4 = 0 THEN NULL ELSE 'x' END as tres_cuartos,
+				NULL::VARCHAR as vacia
+			FROM range(1, 9) t(i)`)
+
+	result, err := m.GetNullCounts(context.Background(), "completitud")
+	if err != nil {
+		t.Fatalf("GetNullCounts: %v", err)
+	}
+	if result["total_rows"] != int64(8) {
+		t.Errorf("total_rows = %v, se esperaban 8", result["total_rows"])
+	}
+
+	want := map[string]ColumnCompleteness{
+		"id":           {Column: "id", Nulls: 0, NonNull: 8, FillRate: 1},
+		"tres_cuartos": {Column: "tres_cuartos", Nulls: 2, NonNull: 6, FillRate: 0.75},
+		"vacia":        {Column: "vacia", Nulls: 8, NonNull: 0, FillRate: 0},
+	}
+	columns := result["columns"].([]ColumnCompleteness)
+	if len(columns) != len(want) {
+		t.Fatalf("columnas = %+v, se esperaban %d", columns, len(want))
+	}
+	for _, col := range columns {
+		if col != want[col.Column] {
+			t.Errorf("%s = %+v, se esperaba %+v", col.Column, col, want[col.Column])
+		}
+	}
+}
+
+func TestGetNullCountsEmptyDataset(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "vacio", `CREATE TABLE data (id INTEGER)`)
+
+	result, err := m.GetNullCounts(context.Background(), "vacio")
+	if err != nil {
+		t.Fatalf("GetNullCounts: %v", err)
+	}
+	// Sin filas el fill_rate es 0 en lugar de NaN
+	columns := result["columns"].([]ColumnCompleteness)
+	if len(columns) != 1 || columns[0].FillRate != 0 {
+		t.Errorf("columnas = %+v, se esperaba fill_rate 0", columns)
+	}
+}
+
+func TestGetRowCountCheck(t *testing.T) {
+	// La última fila tiene UTF-8 inválido y se rechaza, como en una carga parcial
+	var csv strings.Builder
+	csv.WriteString("region,monto\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&csv, "Norte,%d\n", i)
+	}
+	csv.WriteString("Cen\xfftro,1\n")
+
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte(csv.String())})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "ventas", DownloadOptions{}, nil, nil); err != nil {
+		t.Fatalf("downloadAndConvertWithProgress: %v", err)
+	}
+
+	result, err := m.GetRowCountCheck(ctx, "ventas", 0)
+	if err != nil {
+		t.Fatalf("GetRowCountCheck: %v", err)
+	}
+	if result["loaded_rows"] != int64(10000) || result["expected_rows"] != int64(10001) ||
+		result["expected_source"] != "csv" || result["mismatch"] != true || result["missing_rows"] != int64(1) {
+		t.Errorf("resultado = %v, se esperaba una fila faltante según el CSV", result)
+	}
+
+	// Un conteo provisto tiene prioridad sobre el del CSV
+	result, err = m.GetRowCountCheck(ctx, "ventas", 10000)
+	if err != nil {
+		t.Fatalf("GetRowCountCheck: %v", err)
+	}
+	if result["expected_source"] != "provided" || result["mismatch"] != false {
+		t.Errorf("resultado = %v, se esperaba coincidir con el conteo provisto", result)
+	}
+}
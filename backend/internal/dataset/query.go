@@ -3,90 +3,750 @@ package dataset
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math/big"
 	"strings"
 )
 
 // FilterParams representa los parámetros de filtrado
 type FilterParams struct {
 	Filters map[string]interface{} `json:"filters"`
-	Limit   int                    `json:"limit"`
-	Offset  int                    `json:"offset"`
+	// Columns proyecta solo esas columnas, en ese orden; vacío retorna todas
+	Columns []string   `json:"columns,omitempty"`
+	OrderBy []SortSpec `json:"order_by,omitempty"`
+	Limit   int        `json:"limit"`
+	Offset  int        `json:"offset"`
+	// Distinct retorna solo combinaciones distintas de la proyección
+	Distinct bool `json:"distinct,omitempty"`
+	// CountOnly retorna solo el número de filas que cumplen los filtros
+	CountOnly bool `json:"count_only,omitempty"`
+	// ExactCount elige entre COUNT exacto y una estimación; sin indicar, el
+	// conteo es exacto salvo en datasets con más de exactCountMaxRows filas
+	ExactCount *bool `json:"exact_count,omitempty"`
 }
 
-// GetFilteredData obtiene datos filtrados
-func (m *Manager) GetFilteredData(ctx context.Context, uuid string, params FilterParams) ([]map[string]interface{}, error) {
-	// Obtener conexión
-	conn, err := m.GetConnection(ctx, uuid)
+// FilteredCount es el número de filas que cumplen los filtros
+type FilteredCount struct {
+	Count       int64 `json:"count"`
+	Approximate bool  `json:"approximate"`
+}
+
+const (
+	// Datasets con más filas usan conteo aproximado si no se pide exact_count
+	exactCountMaxRows = 1000000
+	// Filas que se buscan muestrear para estimar un conteo
+	countSampleRows = 100000
+)
+
+// SortSpec ordena por una columna; Dir es "asc" (default) o "desc". Nulls
+// es "first" o "last"; vacío usa el default de DuckDB (NULL al final)
+type SortSpec struct {
+	Column string `json:"column"`
+	Dir    string `json:"dir"`
+	Nulls  string `json:"nulls,omitempty"`
+}
+
+// GetFilteredData obtiene datos filtrados. truncated indica que el resultado
+// se cortó en el máximo de filas
+func (m *Manager) GetFilteredData(ctx context.Context, uuid string, params FilterParams) (data []map[string]interface{}, truncated bool, err error) {
+	rows, err := m.QueryFilteredRows(ctx, uuid, params)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	// convertir a slice de maps
+	return m.rowsToMaps(rows)
+}
+
+// GetFilteredPage obtiene una página de datos filtrados junto con el total
+// filtrado para paginar, preparando el query una sola vez. Una página
+// incompleta ya indica cuántas filas hay; solo se cuenta (exacto o aproximado
+// según ExactCount) si puede haber más o si el offset quedó fuera
+func (m *Manager) GetFilteredPage(ctx context.Context, uuid string, params FilterParams) (data []map[string]interface{}, truncated bool, count FilteredCount, err error) {
+	conn, types, err := m.prepareFilterQuery(ctx, uuid, params)
+	if err != nil {
+		return nil, false, FilteredCount{}, err
+	}
+
+	rows, err := m.queryFilteredRows(ctx, conn, types, params)
+	if err != nil {
+		return nil, false, FilteredCount{}, err
+	}
+	data, truncated, err = m.rowsToMaps(rows)
+	rows.Close()
+	if err != nil {
+		return nil, false, FilteredCount{}, err
+	}
+
+	count = FilteredCount{Count: int64(params.Offset + len(data))}
+	if len(data) >= params.Limit || truncated || (len(data) == 0 && params.Offset > 0) {
+		count, err = m.estimateFilteredRows(ctx, conn, types, params)
+		if err != nil {
+			return nil, false, FilteredCount{}, err
+		}
+	}
+	return data, truncated, count, nil
+}
+
+// QueryFilteredRows ejecuta el query de filtrado y retorna los rows sin
+// materializarlos, para que el llamador los consuma en streaming.
+// El llamador es responsable de cerrar los rows.
+func (m *Manager) QueryFilteredRows(ctx context.Context, uuid string, params FilterParams) (*sql.Rows, error) {
+	conn, types, err := m.prepareFilterQuery(ctx, uuid, params)
 	if err != nil {
 		return nil, err
 	}
+	return m.queryFilteredRows(ctx, conn, types, params)
+}
 
+// queryFilteredRows ejecuta el query de filtrado ya validado por prepareFilterQuery
+func (m *Manager) queryFilteredRows(ctx context.Context, conn *sql.DB, types columnTypes, params FilterParams) (*sql.Rows, error) {
 	// Construir query
-	query, args := m.buildFilterQuery(params)
+	query, args := m.buildFilterQuery(params, types)
 
 	// Ejecutar query
 	rows, err := conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error ejecutando query: %w", err)
 	}
-	defer rows.Close()
+	return rows, nil
+}
 
-	// convertir a slice de maps
-	return m.rowsToMaps(rows)
+// CountFilteredRows cuenta las filas (o combinaciones distintas, con Distinct)
+// que cumplen los filtros, sin aplicar orden, límite ni offset
+func (m *Manager) CountFilteredRows(ctx context.Context, uuid string, params FilterParams) (int64, error) {
+	conn, types, err := m.prepareFilterQuery(ctx, uuid, params)
+	if err != nil {
+		return 0, err
+	}
+	return m.countFilteredRows(ctx, conn, types, params)
 }
 
-func (m *Manager) buildFilterQuery(params FilterParams) (string, []interface{}) {
-	query := "SELECT * FROM data WHERE 1=1"
-	args := []interface{}{}
+// countFilteredRows es CountFilteredRows sobre un query ya preparado
+func (m *Manager) countFilteredRows(ctx context.Context, conn *sql.DB, types columnTypes, params FilterParams) (int64, error) {
+	params.OrderBy = nil
+	params.Limit = 0
+	params.Offset = 0
+	query, args := m.buildFilterQuery(params, types)
+
+	var count int64
+	if err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM (%s)", query), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error contando filas: %w", err)
+	}
+	return count, nil
+}
+
+// EstimateFilteredRows cuenta las filas que cumplen los filtros de forma exacta o
+// aproximada según ExactCount. La estimación cuenta las coincidencias en una
+// muestra del sistema y las escala al total de la tabla; con Distinct usa
+// approx_count_distinct.
+func (m *Manager) EstimateFilteredRows(ctx context.Context, uuid string, params FilterParams) (FilteredCount, error) {
+	conn, types, err := m.prepareFilterQuery(ctx, uuid, params)
+	if err != nil {
+		return FilteredCount{}, err
+	}
+	return m.estimateFilteredRows(ctx, conn, types, params)
+}
+
+// estimateFilteredRows es EstimateFilteredRows sobre un query ya preparado
+func (m *Manager) estimateFilteredRows(ctx context.Context, conn *sql.DB, types columnTypes, params FilterParams) (FilteredCount, error) {
+	var total int64
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&total); err != nil {
+		return FilteredCount{}, fmt.Errorf("error contando filas: %w", err)
+	}
+
+	exact := total <= exactCountMaxRows
+	if params.ExactCount != nil {
+		exact = *params.ExactCount
+	}
+
+	conditions, args := m.buildFilterConditions(params.Filters, types)
+	switch {
+	case len(conditions) == 0 && !params.Distinct:
+		// Sin filtros el total ya es exacto
+		return FilteredCount{Count: total}, nil
+	case exact || (!params.Distinct && total <= countSampleRows):
+		count, err := m.countFilteredRows(ctx, conn, types, params)
+		return FilteredCount{Count: count}, err
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	if params.Distinct {
+		projection := "data"
+		if len(params.Columns) > 0 {
+			quoted := make([]string, len(params.Columns))
+			for i, col := range params.Columns {
+				quoted[i] = fmt.Sprintf(`"%s"`, col)
+			}
+			projection = strings.Join(quoted, ", ")
+		}
+		var count int64
+		query := fmt.Sprintf("SELECT approx_count_distinct(hash(%s)) FROM data %s", projection, where)
+		if err := conn.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+			return FilteredCount{}, fmt.Errorf("error estimando filas: %w", err)
+		}
+		return FilteredCount{Count: count, Approximate: true}, nil
+	}
+
+	// Muestreo por bloques: no recorre toda la tabla
+	percent := float64(countSampleRows) * 100 / float64(total)
+	var sampled, matched int64
+	query := fmt.Sprintf(`
+		SELECT COUNT(*), COUNT(*) FILTER (%s)
+		FROM data TABLESAMPLE system(%.4f%%) REPEATABLE (42)
+	`, where, percent)
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&sampled, &matched); err != nil {
+		return FilteredCount{}, fmt.Errorf("error estimando filas: %w", err)
+	}
+	if sampled == 0 {
+		count, err := m.countFilteredRows(ctx, conn, types, params)
+		return FilteredCount{Count: count}, err
+	}
+
+	estimate := int64(float64(matched)*float64(total)/float64(sampled) + 0.5)
+	return FilteredCount{Count: estimate, Approximate: true}, nil
+}
+
+// prepareFilterQuery valida los parámetros de filtrado y retorna la conexión
+// del dataset junto con los tipos de las columnas filtradas
+func (m *Manager) prepareFilterQuery(ctx context.Context, uuid string, params FilterParams) (*sql.DB, columnTypes, error) {
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, nil, err
+	}
+
+	// Obtener conexión
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.validateColumns(ctx, conn, params.Columns); err != nil {
+		return nil, nil, err
+	}
+	if err := m.validateSort(ctx, conn, params.OrderBy); err != nil {
+		return nil, nil, err
+	}
+
+	// Con DISTINCT solo se puede ordenar por columnas proyectadas
+	if params.Distinct && len(params.Columns) > 0 {
+		projected := make(map[string]bool, len(params.Columns))
+		for _, col := range params.Columns {
+			projected[col] = true
+		}
+		for _, spec := range params.OrderBy {
+			if !projected[spec.Column] {
+				return nil, nil, fmt.Errorf("%w: con distinct, la columna de orden %s debe estar en columns", ErrInvalidParams, spec.Column)
+			}
+		}
+	}
+
+	m.recordFilterUsage(uuid, params.Filters, types)
+	return conn, types, nil
+}
+
+// QueryColumnsRows ejecuta el query de filtrado proyectando solo las columnas
+// indicadas, en ese orden. El llamador es responsable de cerrar los rows.
+func (m *Manager) QueryColumnsRows(ctx context.Context, uuid string, columns []string, params FilterParams) (*sql.Rows, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: se requiere al menos una columna", ErrInvalidParams)
+	}
+
+	params.Columns = columns
+	return m.QueryFilteredRows(ctx, uuid, params)
+}
+
+func (m *Manager) buildFilterQuery(params FilterParams, types columnTypes) (string, []interface{}) {
+	if len(params.Columns) == 0 {
+		return m.buildProjectedQuery("*", params, types)
+	}
+
+	// Columnas ya validadas contra el esquema
+	quoted := make([]string, len(params.Columns))
+	for i, col := range params.Columns {
+		quoted[i] = fmt.Sprintf(`"%s"`, col)
+	}
+	return m.buildProjectedQuery(strings.Join(quoted, ", "), params, types)
+}
+
+// buildProjectedQuery construye el query de filtrado con la proyección dada
+func (m *Manager) buildProjectedQuery(projection string, params FilterParams, types columnTypes) (string, []interface{}) {
+	if params.Distinct {
+		projection = "DISTINCT " + projection
+	}
+	query := fmt.Sprintf("SELECT %s FROM data WHERE 1=1", projection)
 
 	// Agregar filtros
-	for key, value := range params.Filters {
-		if value == nil || value == "" || value == "Todas" {
+	conditions, args := m.buildFilterConditions(params.Filters, types)
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+
+	// Orden (columnas y direcciones ya validadas con validateSort)
+	if len(params.OrderBy) > 0 {
+		sorts := make([]string, len(params.OrderBy))
+		for i, spec := range params.OrderBy {
+			sorts[i] = fmt.Sprintf(`"%s" %s%s`, spec.Column, sortDirection(spec.Dir), nullsOrder(spec.Nulls))
+		}
+		query += " ORDER BY " + strings.Join(sorts, ", ")
+	}
+
+	// Limit y Offset
+	if params.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", params.Limit)
+	}
+	if params.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", params.Offset)
+	}
+
+	return query, args
+}
+
+// Máximo de columnas en un ORDER BY
+const maxSortColumns = 10
+
+// validateSort verifica que las columnas de orden existan y las direcciones sean válidas
+func (m *Manager) validateSort(ctx context.Context, conn *sql.DB, specs []SortSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	if len(specs) > maxSortColumns {
+		return fmt.Errorf("%w: máximo %d columnas de orden", ErrInvalidParams, maxSortColumns)
+	}
+
+	columns := make([]string, len(specs))
+	for i, spec := range specs {
+		switch strings.ToLower(spec.Dir) {
+		case "", "asc", "desc":
+		default:
+			return fmt.Errorf("%w: dirección de orden inválida %q (asc|desc)", ErrInvalidParams, spec.Dir)
+		}
+		if err := validateNullsOrder(spec.Nulls); err != nil {
+			return err
+		}
+		columns[i] = spec.Column
+	}
+	return m.validateColumns(ctx, conn, columns)
+}
+
+// sortDirection normaliza la dirección de orden a ASC o DESC
+func sortDirection(dir string) string {
+	if strings.EqualFold(dir, "desc") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// validateNullsOrder verifica la posición de los NULL en un orden (first|last)
+func validateNullsOrder(nulls string) error {
+	switch strings.ToLower(nulls) {
+	case "", "first", "last":
+		return nil
+	}
+	return fmt.Errorf("%w: posición de nulos inválida %q (first|last)", ErrInvalidParams, nulls)
+}
+
+// nullsOrder retorna el sufijo NULLS FIRST/LAST de un ORDER BY, o vacío para
+// el default de DuckDB
+func nullsOrder(nulls string) string {
+	switch strings.ToLower(nulls) {
+	case "first":
+		return " NULLS FIRST"
+	case "last":
+		return " NULLS LAST"
+	}
+	return ""
+}
+
+// Profundidad máxima por default de un filtro: columna -> lista de valores
+const defaultMaxFilterDepth = 2
+
+// columnTypes asocia cada columna de la tabla data con su tipo en DuckDB
+type columnTypes map[string]string
+
+// isText indica si la columna es de texto, la única que se compara sin mayúsculas
+func (t columnTypes) isText(column string) bool {
+	return isTextType(t[column])
+}
+
+// filterColumn retorna la columna que filtra una key: la misma key o, en un
+// rango de fechas, la columna sin el sufijo _range
+func filterColumn(key string, value interface{}, types columnTypes) string {
+	if column, _, ok := rangeFilter(key, value, types); ok {
+		return column
+	}
+	return key
+}
+
+// validateFilters rechaza filtros con anidamiento no soportado, operadores mal
+// formados o más condiciones que el máximo configurado. No necesita el
+// esquema, así que corre antes de obtener la conexión y un filtro inválido no
+// descarga ni abre el dataset. Los valores que no filtran ("", nil, "Todas")
+// se ignoran
+func (m *Manager) validateFilters(filters map[string]interface{}) error {
+	conditions := 0
+	for key, value := range filters {
+		if isSkippedFilterValue(value) {
+			continue
+		}
+
+		if cond, structured := value.(map[string]interface{}); structured {
+			// Sin "op" solo puede ser un rango de fechas; si la key resulta
+			// no serlo, filterTypes lo rechaza con el esquema
+			var condArgs []interface{}
+			var err error
+			column, isRange := strings.CutSuffix(key, rangeFilterSuffix)
+			if _, hasOp := cond["op"]; !hasOp && isRange {
+				_, condArgs, err = rangeCondition(column, cond)
+			} else {
+				_, condArgs, err = operatorCondition(key, cond, false, false)
+			}
+			if err != nil {
+				return err
+			}
+			conditions += len(condArgs)
+		} else {
+			if depth := filterDepth(value); depth > m.maxFilterDepth {
+				return fmt.Errorf("%w: el filtro %q excede la profundidad máxima (%d)", ErrInvalidParams, key, m.maxFilterDepth)
+			}
+			if arr, ok := value.([]interface{}); ok {
+				conditions += len(arr)
+			} else {
+				conditions++
+			}
+		}
+		if conditions > m.maxFilterConditions {
+			return fmt.Errorf("%w: los filtros exceden el máximo de %d condiciones", ErrInvalidParams, m.maxFilterConditions)
+		}
+	}
+	return nil
+}
+
+// filterTypes rechaza filtros sobre columnas inexistentes y retorna los tipos
+// de las columnas con los que se arman las condiciones. La forma de los
+// filtros ya la revisó validateFilters
+func (m *Manager) filterTypes(ctx context.Context, conn *sql.DB, filters map[string]interface{}) (columnTypes, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	types := make(columnTypes, len(columns))
+	for _, col := range columns {
+		types[col.Name] = col.Type
+	}
+
+	for key, value := range filters {
+		if isSkippedFilterValue(value) {
+			continue
+		}
+		column, _, isRange := rangeFilter(key, value, types)
+		if !isRange {
+			column = key
+		}
+		if types[column] == "" {
+			return nil, fmt.Errorf("%w: columna %s no existe", ErrInvalidParams, column)
+		}
+		// Un objeto sin "op" que no es un rango no tiene operador válido
+		if cond, structured := value.(map[string]interface{}); structured && !isRange {
+			if _, _, err := operatorCondition(key, cond, false, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return types, nil
+}
+
+// filterDepth calcula la profundidad de un valor de filtro (un escalar es 1)
+func filterDepth(value interface{}) int {
+	depth := 0
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if d := filterDepth(item); d > depth {
+				depth = d
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if d := filterDepth(item); d > depth {
+				depth = d
+			}
+		}
+	default:
+		return 1
+	}
+	return depth + 1
+}
+
+// Operadores de filtros estructurados además de los de comparación:
+// {"op": "between", "from": a, "to": b}, {"op": "not_in", "values": [...]}
+// y búsqueda de texto {"op": "contains" | "starts_with", "value": "term"}.
+// "=", "!=" y not_in aceptan "case_insensitive": true|false, que
+// reemplaza la opción global del servidor para ese filtro.
+const (
+	filterOpBetween    = "between"
+	filterOpNotIn      = "not_in"
+	filterOpContains   = "contains"
+	filterOpStartsWith = "starts_with"
+)
+
+// isSkippedFilterValue indica si un valor de filtro significa "sin filtro"
+func isSkippedFilterValue(value interface{}) bool {
+	return value == nil || value == "" || value == "Todas"
+}
+
+// operatorCondition construye la condición parametrizada de un filtro
+// estructurado. Los operadores de comparación son los mismos de HAVING.
+// Una exclusión sin valores (o con "Todas") no genera condición. foldCase es
+// la opción global de comparación sin mayúsculas, que solo aplica si la
+// columna es de texto.
+func operatorCondition(column string, cond map[string]interface{}, foldCase, text bool) (string, []interface{}, error) {
+	op, _ := cond["op"].(string)
+	op = strings.ToLower(op)
+
+	if ci, ok := cond["case_insensitive"]; ok {
+		flag, isBool := ci.(bool)
+		if !isBool {
+			return "", nil, fmt.Errorf("%w: case_insensitive del filtro %q debe ser booleano", ErrInvalidParams, column)
+		}
+		foldCase = flag
+	}
+	foldCase = foldCase && text
+
+	switch op {
+	case filterOpBetween:
+		from, to := cond["from"], cond["to"]
+		if !isScalarFilterValue(from) || !isScalarFilterValue(to) {
+			return "", nil, fmt.Errorf("%w: el filtro %q con between requiere from y to", ErrInvalidParams, column)
+		}
+		return fmt.Sprintf(`"%s" BETWEEN ? AND ?`, column), []interface{}{from, to}, nil
+
+	case filterOpNotIn:
+		values, ok := cond["values"].([]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("%w: el filtro %q con %s requiere values", ErrInvalidParams, column, op)
+		}
+		args := []interface{}{}
+		for _, v := range values {
+			if isSkippedFilterValue(v) {
+				continue
+			}
+			if !isScalarFilterValue(v) {
+				return "", nil, fmt.Errorf("%w: valor inválido en %s del filtro %q", ErrInvalidParams, op, column)
+			}
+			args = append(args, v)
+		}
+		if len(args) == 0 {
+			return "", nil, nil
+		}
+		return keepNulls(column, inCondition(column, "NOT IN", args, foldCase)), args, nil
+
+	case filterOpContains, filterOpStartsWith:
+		term, ok := cond["value"].(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: el filtro %q con %s requiere un texto en value", ErrInvalidParams, column, op)
+		}
+		if term == "" {
+			return "", nil, nil
+		}
+		pattern := escapeLike(term) + "%"
+		if op == filterOpContains {
+			pattern = "%" + pattern
+		}
+		return fmt.Sprintf(`CAST("%s" AS VARCHAR) ILIKE ? ESCAPE '\'`, column), []interface{}{pattern}, nil
+	}
+
+	sqlOp, ok := havingOperators[op]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: operador inválido %q en el filtro %q", ErrInvalidParams, op, column)
+	}
+	value := cond["value"]
+	if op == "!=" && isSkippedFilterValue(value) {
+		return "", nil, nil
+	}
+	if !isScalarFilterValue(value) {
+		return "", nil, fmt.Errorf("%w: el filtro %q requiere value", ErrInvalidParams, column)
+	}
+	condition := fmt.Sprintf(`"%s" %s ?`, column, sqlOp)
+	if (op == "=" || op == "!=") && foldCase {
+		condition = fmt.Sprintf(`LOWER("%s") %s LOWER(?::VARCHAR)`, column, sqlOp)
+	}
+	if op == "!=" {
+		condition = keepNulls(column, condition)
+	}
+	return condition, []interface{}{value}, nil
+}
+
+// keepNulls agrega a una exclusión las filas con la columna NULL, que en SQL
+// no cumplen NOT IN ni <>: excluir unos valores no debe ocultar los vacíos
+func keepNulls(column, condition string) string {
+	return fmt.Sprintf(`(%s OR "%s" IS NULL)`, condition, column)
+}
+
+// inCondition construye "col IN (?, ...)" (o NOT IN); con foldCase compara
+// sin mayúsculas
+func inCondition(column, sqlOp string, values []interface{}, foldCase bool) string {
+	if !foldCase {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		return fmt.Sprintf(`"%s" %s (%s)`, column, sqlOp, placeholders)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("LOWER(?::VARCHAR), ", len(values)), ", ")
+	return fmt.Sprintf(`LOWER("%s") %s (%s)`, column, sqlOp, placeholders)
+}
+
+// Sufijo de los rangos de fechas que reporta GetAvailableFilters. Como filtro,
+// "<col>_range": {"from": a, "to": b} filtra la columna col
+const rangeFilterSuffix = "_range"
+
+// rangeFilter reconoce un filtro de rango de fechas y retorna la columna a
+// filtrar. Solo es un rango si la columna sin el sufijo existe y la key no es
+// a su vez una columna; un objeto con "op" es un filtro estructurado normal
+func rangeFilter(key string, value interface{}, types columnTypes) (string, map[string]interface{}, bool) {
+	cond, ok := value.(map[string]interface{})
+	if !ok {
+		return "", nil, false
+	}
+	if _, hasOp := cond["op"]; hasOp {
+		return "", nil, false
+	}
+	if _, isColumn := types[key]; isColumn {
+		return "", nil, false
+	}
+	column, ok := strings.CutSuffix(key, rangeFilterSuffix)
+	if !ok {
+		return "", nil, false
+	}
+	if _, exists := types[column]; !exists {
+		return "", nil, false
+	}
+	return column, cond, true
+}
+
+// rangeCondition construye la condición de un rango de fechas. Sin from o
+// sin to el rango queda abierto de ese lado; sin ninguno no hay condición.
+func rangeCondition(column string, cond map[string]interface{}) (string, []interface{}, error) {
+	from, to := cond["from"], cond["to"]
+	hasFrom, hasTo := !isSkippedFilterValue(from), !isSkippedFilterValue(to)
+	if (hasFrom && !isScalarFilterValue(from)) || (hasTo && !isScalarFilterValue(to)) {
+		return "", nil, fmt.Errorf("%w: from y to del rango %q deben ser valores simples", ErrInvalidParams, column)
+	}
+
+	switch {
+	case hasFrom && hasTo:
+		return fmt.Sprintf(`"%s" BETWEEN ? AND ?`, column), []interface{}{from, to}, nil
+	case hasFrom:
+		return fmt.Sprintf(`"%s" >= ?`, column), []interface{}{from}, nil
+	case hasTo:
+		return fmt.Sprintf(`"%s" <= ?`, column), []interface{}{to}, nil
+	}
+	return "", nil, nil
+}
+
+// isScalarFilterValue indica si un valor de filtro es un escalar (no nulo, lista ni objeto)
+func isScalarFilterValue(value interface{}) bool {
+	switch value.(type) {
+	case nil, []interface{}, map[string]interface{}:
+		return false
+	default:
+		return true
+	}
+}
+
+// buildFilterConditions construye las condiciones parametrizadas de los filtros,
+// para unirlas con AND en un WHERE. Los filtros ya pasaron validateFilters y
+// sus tipos vienen de filterTypes
+func (m *Manager) buildFilterConditions(filters map[string]interface{}, types columnTypes) ([]string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	for key, value := range filters {
+		if isSkippedFilterValue(value) {
 			continue
 		}
 
 		// Escapar nombre de la columna
 		safeKey := fmt.Sprintf(`"%s"`, key)
 
+		// Rango de fechas: {"from": a, "to": b} sobre la columna sin el sufijo _range
+		if column, cond, ok := rangeFilter(key, value, types); ok {
+			condition, condArgs, err := rangeCondition(column, cond)
+			if err != nil || condition == "" {
+				continue
+			}
+			conditions = append(conditions, condition)
+			args = append(args, condArgs...)
+			continue
+		}
+
+		// Condición estructurada: {"op": ">", "value": 10}, between, not_in o texto
+		if cond, ok := value.(map[string]interface{}); ok {
+			condition, condArgs, err := operatorCondition(key, cond, m.caseInsensitiveFilters, types.isText(key))
+			if err != nil || condition == "" {
+				// validateFilters ya rechazó las condiciones inválidas
+				continue
+			}
+			conditions = append(conditions, condition)
+			args = append(args, condArgs...)
+			continue
+		}
+
 		// Si es array (multiples valores), usar IN
 		if arr, ok := value.([]interface{}); ok {
 			if len(arr) > 0 {
-				placeholders := make([]string, len(arr))
-				for i, v := range arr {
-					args = append(args, v)
-					placeholders[i] = "?"
-				}
-				query += fmt.Sprintf(" AND %s IN (%s)", safeKey, strings.Join(placeholders, ","))
+				conditions = append(conditions, inCondition(key, "IN", arr, m.caseInsensitiveFilters && types.isText(key)))
+				args = append(args, arr...)
 			}
+		} else if m.caseInsensitiveFilters && types.isText(key) {
+			conditions = append(conditions, fmt.Sprintf("LOWER(%s) = LOWER(?::VARCHAR)", safeKey))
+			args = append(args, value)
 		} else {
 			//  Valor único
-			query += fmt.Sprintf(" AND %s = ?", safeKey)
+			conditions = append(conditions, fmt.Sprintf("%s = ?", safeKey))
 			args = append(args, value)
 		}
 	}
 
-	// Limit y Offset
-	if params.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", params.Limit)
-	}
-	if params.Offset > 0 {
-		query += fmt.Sprintf(" OFFSET %d", params.Offset)
-	}
-
-	return query, args
+	return conditions, args
 }
 
-// rowsToMaps convierte un sql.Rows a slice de maps
-func (m *Manager) rowsToMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
+// ErrResultTooLarge indica que una consulta excede el máximo de filas que se
+// cargan en memoria y el servidor está configurado para fallar en vez de cortar
+var ErrResultTooLarge = errors.New("el resultado excede el máximo de filas")
+
+// rowsToMaps convierte un sql.Rows a slice de maps. Pasado maxResultRows deja
+// de leer: retorna las filas leídas con truncated en true, o ErrResultTooLarge
+// si truncateResults está desactivado
+func (m *Manager) rowsToMaps(rows *sql.Rows) ([]map[string]interface{}, bool, error) {
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	var result []map[string]interface{}
 
 	for rows.Next() {
+		if m.maxResultRows > 0 && len(result) >= m.maxResultRows {
+			if !m.truncateResults {
+				return nil, false, fmt.Errorf("%w (%d); agrega filtros o un límite", ErrResultTooLarge, m.maxResultRows)
+			}
+			log.Printf("⚠️ Resultado cortado en %d filas", m.maxResultRows)
+			return result, true, nil
+		}
+
 		// Crear slice de interfaces para escanear
 		values := make([]interface{}, len(columns))
 		pointers := make([]interface{}, len(columns))
@@ -96,7 +756,7 @@ func (m *Manager) rowsToMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
 		}
 
 		if err := rows.Scan(pointers...); err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		// Crear map
@@ -114,40 +774,126 @@ func (m *Manager) rowsToMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
 		result = append(result, row)
 	}
 
-	return result, rows.Err()
+	return result, false, rows.Err()
 }
 
-// GetAvailableFilters obtiene valores únicos para los filtros
-func (m *Manager) GetAvailableFilters(ctx context.Context, uuid string) (map[string]interface{}, error) {
+// toFloat64 convierte un valor numérico escaneado de DuckDB a float64
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, true
+	case interface{ Float64() float64 }:
+		return v.Float64(), true
+	default:
+		return 0, false
+	}
+}
+
+const (
+	// Valores distintos que se retornan por columna si no se indica límite
+	defaultFilterValuesLimit = 1000
+	// Máximo de valores distintos por columna que se puede pedir
+	maxFilterValuesLimit = 10000
+)
+
+// FilterValuesOptions limita los valores que retorna GetAvailableFilters
+type FilterValuesOptions struct {
+	// Limit aplica a todas las columnas; 0 usa el default
+	Limit int
+	// ColumnLimits reemplaza Limit para columnas específicas, que se listan
+	// aunque no sean categóricas
+	ColumnLimits map[string]int
+}
+
+// limitFor retorna el límite de valores a usar para una columna
+func (o FilterValuesOptions) limitFor(column string) int {
+	limit := o.Limit
+	if columnLimit, ok := o.ColumnLimits[column]; ok {
+		limit = columnLimit
+	}
+	if limit <= 0 {
+		return defaultFilterValuesLimit
+	}
+	if limit > maxFilterValuesLimit {
+		return maxFilterValuesLimit
+	}
+	return limit
+}
+
+// GetAvailableFilters obtiene valores únicos para los filtros. truncated indica
+// las columnas cuya lista de valores se cortó por el límite. En datasets
+// anchos recorre muchas columnas, así que si el cliente se desconecta (o se
+// vence el timeout) se aborta entre columnas y se retorna el error del contexto.
+func (m *Manager) GetAvailableFilters(ctx context.Context, uuid string, opts FilterValuesOptions) (filters map[string]interface{}, truncated map[string]bool, err error) {
 	conn, err := m.GetConnection(ctx, uuid)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Obtener columnas
 	columns, err := m.getColumns(ctx, conn)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	filters := make(map[string]interface{})
+	filters = make(map[string]interface{})
+	truncated = make(map[string]bool)
 
 	// Para cada columna, determinar si es categórica
 	for _, col := range columns {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
 		// Contar valores distintos
 		var distinctCount int
 		query := fmt.Sprintf(`SELECT COUNT(DISTINCT "%s") FROM data`, col.Name)
 		if err := conn.QueryRowContext(ctx, query).Scan(&distinctCount); err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
 			continue
 		}
 
-		// Si tiene menos de 100 valores únicos, es categórica
-		if distinctCount < 100 && distinctCount > 0 {
-			values, err := m.getDistinctValues(ctx, conn, col.Name)
-			if err != nil {
-				continue
+		// Si tiene menos de 100 valores únicos, es categórica. Una columna con
+		// límite propio se lista aunque no lo sea, hasta ese límite
+		if _, requested := opts.ColumnLimits[col.Name]; !requested && !isCategorical(distinctCount) {
+			continue
+		}
+		limit := opts.limitFor(col.Name)
+		values, err := m.getDistinctValues(ctx, conn, col.Name, limit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
 			}
-			filters[col.Name] = values
+			continue
+		}
+		filters[col.Name] = values
+		if distinctCount > limit {
+			truncated[col.Name] = true
 		}
 	}
 	// Obtener rangos de fechas
@@ -157,6 +903,9 @@ func (m *Manager) GetAvailableFilters(ctx context.Context, uuid string) (map[str
 			var minDate, maxDate string
 			query := fmt.Sprintf(`SELECT MIN("%s"), MAX("%s") FROM data`, dateCol, dateCol)
 			if err := conn.QueryRowContext(ctx, query).Scan(&minDate, &maxDate); err != nil {
+				if ctx.Err() != nil {
+					return nil, nil, ctx.Err()
+				}
 				continue
 			}
 			filters[dateCol+"_range"] = map[string]string{
@@ -165,7 +914,7 @@ func (m *Manager) GetAvailableFilters(ctx context.Context, uuid string) (map[str
 			}
 		}
 	}
-	return filters, nil
+	return filters, truncated, nil
 }
 
 type ColumnInfo struct {
@@ -184,7 +933,7 @@ func (m *Manager) getColumns(ctx context.Context, conn *sql.DB) ([]ColumnInfo, e
 	for rows.Next() {
 		var cid int
 		var col ColumnInfo
-		var notnull, pk int
+		var notnull, pk bool
 		var dfltValue interface{}
 
 		if err := rows.Scan(&cid, &col.Name, &col.Type, &notnull, &dfltValue, &pk); err != nil {
@@ -196,8 +945,31 @@ func (m *Manager) getColumns(ctx context.Context, conn *sql.DB) ([]ColumnInfo, e
 	return columns, nil
 }
 
-func (m *Manager) getDistinctValues(ctx context.Context, conn *sql.DB, column string) ([]string, error) {
-	query := fmt.Sprintf(`SELECT DISTINCT "%s" FROM data WHERE "%s" IS NOT NULL ORDER BY  "%s" LIMIT 1000`, column, column, column)
+// validateColumns verifica que las columnas existan en la tabla data
+func (m *Manager) validateColumns(ctx context.Context, conn *sql.DB, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		valid[col.Name] = true
+	}
+	for _, name := range names {
+		if !valid[name] {
+			return fmt.Errorf("%w: columna %s no existe", ErrInvalidParams, name)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) getDistinctValues(ctx context.Context, conn *sql.DB, column string, limit int) ([]string, error) {
+	query := fmt.Sprintf(`SELECT DISTINCT "%s" FROM data WHERE "%s" IS NOT NULL ORDER BY  "%s" LIMIT %d`, column, column, column, limit)
 
 	rows, err := conn.QueryContext(ctx, query)
 	if err != nil {
@@ -0,0 +1,844 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestFilterOrderBy(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		orderBy []SortSpec
+		want    []string
+	}{
+		{"una columna", []SortSpec{{Column: "monto", Dir: "DESC"}}, []string{"60", "50", "40", "30", "20", "10"}},
+		{"varias columnas", []SortSpec{{Column: "region"}, {Column: "monto", Dir: "desc"}}, []string{"50", "20", "10", "40", "30", "60"}},
+	}
+	for _, tc := range tests {
+		rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{OrderBy: tc.orderBy})
+		if err != nil {
+			t.Fatalf("%s: GetFilteredData: %v", tc.name, err)
+		}
+		got := make([]string, len(rows))
+		for i, row := range rows {
+			got[i] = fmt.Sprint(row["monto"])
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: montos = %v, se esperaba %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFilterOrderByValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	for name, spec := range map[string]SortSpec{
+		"dirección inválida":  {Column: "monto", Dir: "sideways"},
+		"columna inexistente": {Column: "precio"},
+		"inyección":           {Column: `monto" ; DROP TABLE data; --`},
+	} {
+		_, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{OrderBy: []SortSpec{spec}})
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", name, err)
+		}
+	}
+
+	// La tabla sigue intacta
+	if _, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{}); err != nil {
+		t.Errorf("GetFilteredData tras la inyección: %v", err)
+	}
+}
+
+func TestFilterLimits(t *testing.T) {
+	m := newTestManager(t, Options{MaxFilterConditions: 5})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+		wantErr bool
+	}{
+		{"dentro del límite", map[string]interface{}{"region": []interface{}{"Norte", "Sur"}, "producto": "Pan"}, false},
+		{"justo en el límite", map[string]interface{}{"region": []interface{}{"Norte", "Sur", "Centro", "Este", "Oeste"}}, false},
+		{"lista demasiado larga", map[string]interface{}{"region": []interface{}{"a", "b", "c", "d", "e", "f"}}, true},
+		{"suma entre columnas", map[string]interface{}{
+			"region":   []interface{}{"Norte", "Sur", "Centro"},
+			"producto": []interface{}{"Pan", "Leche", "Queso"},
+		}, true},
+		{"anidamiento profundo", map[string]interface{}{"region": []interface{}{[]interface{}{[]interface{}{"Norte"}}}}, true},
+		{"lista dentro de lista", map[string]interface{}{"region": []interface{}{[]interface{}{"Norte"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{Filters: tt.filters})
+			if tt.wantErr && !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("err = %v, se esperaba ErrInvalidParams", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("err = %v, se esperaba que pasara", err)
+			}
+		})
+	}
+}
+
+func TestRangeFilterOpenBounds(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name  string
+		rango map[string]interface{}
+		want  int
+	}{
+		{"cerrado", map[string]interface{}{"from": "2024-02-01", "to": "2024-04-30"}, 3},
+		{"solo desde", map[string]interface{}{"from": "2024-03-01"}, 3},
+		{"solo hasta", map[string]interface{}{"to": "2024-02-10"}, 2},
+		{"sin límites", map[string]interface{}{}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{
+				Filters: map[string]interface{}{"fecha_range": tt.rango},
+			})
+			if err != nil {
+				t.Fatalf("GetFilteredData: %v", err)
+			}
+			if len(rows) != tt.want {
+				t.Errorf("filas = %d, se esperaban %d", len(rows), tt.want)
+			}
+		})
+	}
+
+	_, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{
+		Filters: map[string]interface{}{"fecha_range": map[string]interface{}{"from": []interface{}{"2024-01-01"}}},
+	})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("from no escalar: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestFiltersRejectUnknownColumns(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+	}{
+		{"columna inexistente", map[string]interface{}{"no_existe": "x"}},
+		{"rango de columna inexistente", map[string]interface{}{"no_existe_range": map[string]interface{}{"from": "2024-01-01"}}},
+		{"inyección en la key", map[string]interface{}{`region" = 'Norte' OR "region`: "x"}},
+		{"inyección en el rango", map[string]interface{}{`fecha" IS NOT NULL OR "fecha_range`: map[string]interface{}{"to": "2024-01-01"}}},
+		{"operador sobre columna inexistente", map[string]interface{}{"no_existe": map[string]interface{}{"op": ">", "value": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: tt.filters})
+			if !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("GetFilteredData: err = %v, se esperaba ErrInvalidParams", err)
+			}
+			_, _, err = m.GetAggregatedData(ctx, "ventas", AggregationParams{Filters: tt.filters, Agg: "count"})
+			if !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("GetAggregatedData: err = %v, se esperaba ErrInvalidParams", err)
+			}
+		})
+	}
+
+	// Los valores que no filtran se ignoran aunque la columna no exista
+	rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{
+		"no_existe": "Todas", "otra": "", "region": "Norte",
+	}})
+	if err != nil || len(rows) != 2 {
+		t.Errorf("filas = %d, err = %v; se esperaban 2 filas de Norte", len(rows), err)
+	}
+}
+
+func TestInvalidFiltersRejectedBeforeDownload(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	m := newCKANTestManager(t, ckan.URL(), Options{MaxFilterDepth: 1})
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+	}{
+		{"profundidad", map[string]interface{}{"region": []interface{}{"Norte"}}},
+		{"operador", map[string]interface{}{"region": map[string]interface{}{"op": "in", "values": []interface{}{"Norte"}}}},
+		{"rango", map[string]interface{}{"fecha_range": map[string]interface{}{"from": []interface{}{"2024-01-01"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.GetFilteredData(ctx, "sin-descargar", FilterParams{Filters: tt.filters})
+			if !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("GetFilteredData: err = %v, se esperaba ErrInvalidParams", err)
+			}
+			_, _, err = m.GetAggregatedData(ctx, "sin-descargar", AggregationParams{Filters: tt.filters, Agg: "count"})
+			if !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("GetAggregatedData: err = %v, se esperaba ErrInvalidParams", err)
+			}
+		})
+	}
+	if calls := ckan.Calls("resource_show"); calls != 0 {
+		t.Errorf("resource_show = %d llamadas, un filtro inválido no debe descargar el dataset", calls)
+	}
+}
+
+func TestFilterDepthConfigurable(t *testing.T) {
+	// Con profundidad 1 solo se aceptan valores simples
+	m := newTestManager(t, Options{MaxFilterDepth: 1})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	if _, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"region": "Norte"}}); err != nil {
+		t.Errorf("valor simple: err = %v, se esperaba que pasara", err)
+	}
+	_, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"region": []interface{}{"Norte", "Sur"}}})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("lista con profundidad 1: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestFilterDepth(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int
+	}{
+		{"Norte", 1},
+		{[]interface{}{"Norte", "Sur"}, 2},
+		{[]interface{}{"Norte", []interface{}{"Sur"}}, 3},
+		{map[string]interface{}{"op": "not_in", "value": []interface{}{1, 2}}, 3},
+	}
+	for _, tt := range tests {
+		if got := filterDepth(tt.value); got != tt.want {
+			t.Errorf("filterDepth(%v) = %d, se esperaba %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFilterColumnProjection(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{
+		Columns: []string{"monto", "region"},
+		Filters: map[string]interface{}{"producto": "Pan"},
+	})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d filas, se esperaban 3", len(rows))
+	}
+	for _, row := range rows {
+		if len(row) != 2 || row["monto"] == nil {
+			t.Errorf("fila = %v, se esperaban solo monto y region", row)
+		}
+	}
+
+	// Sin columnas se retornan todas
+	rows, _, err = m.GetFilteredData(ctx, "ventas", FilterParams{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if len(rows[0]) != 4 {
+		t.Errorf("fila = %v, se esperaban las 4 columnas", rows[0])
+	}
+
+	_, _, err = m.GetFilteredData(ctx, "ventas", FilterParams{Columns: []string{"monto", "precio"}})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("columna inexistente: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestFilterDistinct(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	// Pan aparece en Norte, Sur y una región NULL
+	params := FilterParams{
+		Columns:  []string{"producto"},
+		Distinct: true,
+		OrderBy:  []SortSpec{{Column: "producto"}},
+	}
+	rows, _, err := m.GetFilteredData(ctx, "ventas", params)
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, fmt.Sprint(row["producto"]))
+	}
+	if strings.Join(got, ",") != "Leche,Pan,Queso,<nil>" {
+		t.Errorf("productos = %v, se esperaban los 4 distintos", got)
+	}
+
+	count, err := m.CountFilteredRows(ctx, "ventas", params)
+	if err != nil || count != 4 {
+		t.Errorf("CountFilteredRows = %d, %v; se esperaban 4", count, err)
+	}
+
+	// Con filtros cuenta las combinaciones distintas que cumplen
+	params.Columns = []string{"region", "producto"}
+	params.OrderBy = nil
+	params.Filters = map[string]interface{}{"producto": "Pan"}
+	count, err = m.CountFilteredRows(ctx, "ventas", params)
+	if err != nil || count != 3 {
+		t.Errorf("CountFilteredRows con filtro = %d, %v; se esperaban 3", count, err)
+	}
+
+	// Con distinct solo se ordena por columnas proyectadas
+	_, _, err = m.GetFilteredData(ctx, "ventas", FilterParams{
+		Columns:  []string{"producto"},
+		Distinct: true,
+		OrderBy:  []SortSpec{{Column: "monto"}},
+	})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("orden fuera de la proyección: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestFilterCountOnly(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	// El conteo ignora límite y offset
+	count, err := m.CountFilteredRows(context.Background(), "ventas", FilterParams{
+		CountOnly: true,
+		Filters:   map[string]interface{}{"producto": "Pan"},
+		Limit:     1,
+		Offset:    1,
+	})
+	if err != nil || count != 3 {
+		t.Errorf("CountFilteredRows = %d, %v; se esperaban 3", count, err)
+	}
+}
+
+func TestOperatorFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		cond map[string]interface{}
+		want int
+	}{
+		{"between inclusivo", map[string]interface{}{"op": "between", "from": 20, "to": 40}, 3},
+		{"between en mayúsculas", map[string]interface{}{"op": "BETWEEN", "from": 10, "to": 10}, 1},
+		{"mayor que", map[string]interface{}{"op": ">", "value": 30}, 3},
+		{"mayor o igual", map[string]interface{}{"op": ">=", "value": 30}, 4},
+		{"menor que", map[string]interface{}{"op": "<", "value": 30}, 2},
+		{"menor o igual", map[string]interface{}{"op": "<=", "value": 30}, 3},
+		{"igual", map[string]interface{}{"op": "=", "value": 50}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := map[string]interface{}{"monto": tt.cond}
+			rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: filters})
+			if err != nil {
+				t.Fatalf("GetFilteredData: %v", err)
+			}
+			if len(rows) != tt.want {
+				t.Errorf("filas = %d, se esperaban %d", len(rows), tt.want)
+			}
+
+			// Las agregaciones usan las mismas condiciones
+			agg, _, err := m.GetAggregatedData(ctx, "ventas", AggregationParams{Filters: filters, Agg: "count"})
+			if err != nil {
+				t.Fatalf("GetAggregatedData: %v", err)
+			}
+			if len(agg) != 1 || fmt.Sprint(agg[0]["total"]) != fmt.Sprint(tt.want) {
+				t.Errorf("agregación = %v, se esperaba total %d", agg, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperatorFiltersCombineWithEquality(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	// Fechas entre febrero y abril de la región Sur
+	stats, err := m.GetStats(context.Background(), "ventas", "monto", map[string]interface{}{
+		"region": "Sur",
+		"fecha":  map[string]interface{}{"op": "between", "from": "2024-02-01", "to": "2024-04-30"},
+	}, false)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if fmt.Sprint(stats["count"]) != "2" || fmt.Sprint(stats["min"]) != "30" || fmt.Sprint(stats["max"]) != "40" {
+		t.Errorf("stats = %v, se esperaban 2 filas entre 30 y 40", stats)
+	}
+}
+
+func TestOperatorFiltersValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		cond map[string]interface{}
+	}{
+		{"between sin to", map[string]interface{}{"op": "between", "from": 10}},
+		{"between con lista", map[string]interface{}{"op": "between", "from": []interface{}{1}, "to": 2}},
+		{"operador desconocido", map[string]interface{}{"op": "~", "value": 1}},
+		{"sin operador", map[string]interface{}{"value": 1}},
+		{"comparación sin value", map[string]interface{}{"op": ">"}},
+		{"comparación con objeto", map[string]interface{}{"op": "<", "value": map[string]interface{}{"x": 1}}},
+	}
+	for _, tt := range tests {
+		_, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"monto": tt.cond}})
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
+
+func TestExclusionFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		cond map[string]interface{}
+		want []string
+	}{
+		// NOT IN y != conservan la región NULL, que no es ninguno de los valores excluidos
+		{"not_in", map[string]interface{}{"op": "not_in", "values": []interface{}{"Norte", "Sur"}}, []string{"Centro", "<nil>"}},
+		{"distinto", map[string]interface{}{"op": "!=", "value": "Norte"}, []string{"Centro", "Sur", "<nil>"}},
+		{"distinto sin mayúsculas", map[string]interface{}{"op": "!=", "value": "norte", "case_insensitive": true}, []string{"Centro", "Sur", "<nil>"}},
+		{"not_in ignora Todas y vacíos", map[string]interface{}{"op": "not_in", "values": []interface{}{"Todas", "", "Sur"}}, []string{"Centro", "Norte", "<nil>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := map[string]interface{}{"region": tt.cond}
+			rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: filters})
+			if err != nil {
+				t.Fatalf("GetFilteredData: %v", err)
+			}
+			seen := map[string]bool{}
+			for _, row := range rows {
+				seen[fmt.Sprint(row["region"])] = true
+			}
+			for _, candidate := range []string{"Norte", "Sur", "Centro", "<nil>"} {
+				want := false
+				for _, region := range tt.want {
+					want = want || region == candidate
+				}
+				if seen[candidate] != want {
+					t.Errorf("región %s presente = %v, se esperaba %v", candidate, seen[candidate], want)
+				}
+			}
+
+			// Tampoco aparecen como grupos de la agregación
+			agg, _, err := m.GetAggregatedData(ctx, "ventas", AggregationParams{Filters: filters, GroupBy: []string{"region"}, Agg: "count"})
+			if err != nil {
+				t.Fatalf("GetAggregatedData: %v", err)
+			}
+			groups := make([]string, len(agg))
+			for i, row := range agg {
+				groups[i] = fmt.Sprint(row["region"])
+			}
+			if got := strings.Join(groups, ","); got != strings.Join(tt.want, ",") {
+				t.Errorf("grupos = %s, se esperaban %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExclusionFiltersWithoutValues(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	// Excluir "nada" no filtra, igual que "Todas" en la igualdad
+	for _, cond := range []map[string]interface{}{
+		{"op": "not_in", "values": []interface{}{}},
+		{"op": "not_in", "values": []interface{}{"Todas"}},
+		{"op": "!=", "value": "Todas"},
+		{"op": "!=", "value": ""},
+	} {
+		rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"region": cond}})
+		if err != nil {
+			t.Fatalf("%v: GetFilteredData: %v", cond, err)
+		}
+		if len(rows) != 6 {
+			t.Errorf("%v: filas = %d, se esperaban las 6", cond, len(rows))
+		}
+	}
+
+	for _, cond := range []map[string]interface{}{
+		{"op": "not_in"},
+		{"op": "not_in", "values": "Norte"},
+		{"op": "not_in", "values": []interface{}{[]interface{}{"Norte"}}},
+	} {
+		_, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Filters: map[string]interface{}{"region": cond}})
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%v: err = %v, se esperaba ErrInvalidParams", cond, err)
+		}
+	}
+}
+
+// textoSQL tiene comodines de LIKE como texto literal
+var textoSQL = []string{
+	`CREATE TABLE data (nombre VARCHAR, monto INTEGER)`,
+	`INSERT INTO data VALUES
+		('Descuento 50% anual', 1),
+		('Descuento 50 pesos', 2),
+		('descuento_especial', 3),
+		('Descuento especial', 4),
+		('Cargo fijo', 5),
+		(NULL, 6)`,
+}
+
+func TestTextFilters(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "texto", textoSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		cond map[string]interface{}
+		want string
+	}{
+		{"contains sin mayúsculas", map[string]interface{}{"op": "contains", "value": "ESPECIAL"}, "3,4"},
+		{"starts_with", map[string]interface{}{"op": "starts_with", "value": "desc"}, "1,2,3,4"},
+		{"starts_with no busca en medio", map[string]interface{}{"op": "starts_with", "value": "fijo"}, ""},
+		{"porcentaje literal", map[string]interface{}{"op": "contains", "value": "50%"}, "1"},
+		{"guion bajo literal", map[string]interface{}{"op": "contains", "value": "o_e"}, "3"},
+		{"valor vacío no filtra", map[string]interface{}{"op": "contains", "value": ""}, "1,2,3,4,5,6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := map[string]interface{}{"nombre": tt.cond}
+			rows, _, err := m.GetFilteredData(ctx, "texto", FilterParams{Filters: filters, OrderBy: []SortSpec{{Column: "monto"}}})
+			if err != nil {
+				t.Fatalf("GetFilteredData: %v", err)
+			}
+			montos := make([]string, len(rows))
+			for i, row := range rows {
+				montos[i] = fmt.Sprint(row["monto"])
+			}
+			if got := strings.Join(montos, ","); got != tt.want {
+				t.Errorf("montos = %q, se esperaban %q", got, tt.want)
+			}
+
+			// Las agregaciones filtran igual
+			agg, _, err := m.GetAggregatedData(ctx, "texto", AggregationParams{Filters: filters, Agg: "count"})
+			if err != nil {
+				t.Fatalf("GetAggregatedData: %v", err)
+			}
+			if fmt.Sprint(agg[0]["total"]) != fmt.Sprint(len(rows)) {
+				t.Errorf("agregación = %v, se esperaba total %d", agg, len(rows))
+			}
+		})
+	}
+
+	_, _, err := m.GetFilteredData(ctx, "texto", FilterParams{Filters: map[string]interface{}{"nombre": map[string]interface{}{"op": "contains", "value": 50}}})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("contains sin texto: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestResultRowsCapTruncates(t *testing.T) {
+	m := newTestManager(t, Options{MaxResultRows: 3, TruncateResults: true})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	rows, truncated, err := m.GetFilteredData(ctx, "ventas", FilterParams{Limit: 100})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if len(rows) != 3 || !truncated {
+		t.Errorf("filas = %d, truncated = %v; se esperaban 3 filas cortadas", len(rows), truncated)
+	}
+
+	// Justo en el máximo no se marca como cortado
+	rows, truncated, err = m.GetFilteredData(ctx, "ventas", FilterParams{Limit: 3})
+	if err != nil {
+		t.Fatalf("GetFilteredData con limit: %v", err)
+	}
+	if len(rows) != 3 || truncated {
+		t.Errorf("filas = %d, truncated = %v; no se esperaba corte", len(rows), truncated)
+	}
+
+	rows, truncated, err = m.GetAggregatedData(ctx, "ventas", AggregationParams{GroupBy: []string{"producto", "region"}, Agg: "count"})
+	if err != nil || len(rows) != 3 || !truncated {
+		t.Errorf("GetAggregatedData: %d filas, truncated = %v, %v; se esperaban 3 cortadas", len(rows), truncated, err)
+	}
+
+	rows, truncated, err = m.SearchData(ctx, "ventas", "e", 100)
+	if err != nil || len(rows) != 3 || !truncated {
+		t.Errorf("SearchData: %d filas, truncated = %v, %v; se esperaban 3 cortadas", len(rows), truncated, err)
+	}
+}
+
+func TestResultRowsCapFails(t *testing.T) {
+	m := newTestManager(t, Options{MaxResultRows: 3})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	if _, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Limit: 100}); !errors.Is(err, ErrResultTooLarge) {
+		t.Errorf("GetFilteredData: err = %v, se esperaba ErrResultTooLarge", err)
+	}
+	if _, _, err := m.GetAggregatedData(ctx, "ventas", AggregationParams{GroupBy: []string{"producto", "region"}, Agg: "count"}); !errors.Is(err, ErrResultTooLarge) {
+		t.Errorf("GetAggregatedData: err = %v, se esperaba ErrResultTooLarge", err)
+	}
+	// Dentro del máximo responde normal
+	if rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{Limit: 2}); err != nil || len(rows) != 2 {
+		t.Errorf("GetFilteredData con limit: %d filas, %v", len(rows), err)
+	}
+}
+
+func TestAvailableFiltersTruncation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "codigos",
+		`CREATE TABLE data (codigo INTEGER, region VARCHAR)`,
+		`INSERT INTO data SELECT i, CASE WHEN i % 3 = 0 THEN 'Norte' WHEN i % 3 = 1 THEN 'Sur' ELSE 'Centro' END FROM range(150) t(i)`,
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		opts          FilterValuesOptions
+		column        string
+		wantValues    int
+		wantTruncated bool
+	}{
+		{"no categórica sin límite propio", FilterValuesOptions{}, "codigo", -1, false},
+		{"categórica completa", FilterValuesOptions{}, "region", 3, false},
+		{"categórica cortada por limit", FilterValuesOptions{Limit: 2}, "region", 2, true},
+		{"límite propio menor", FilterValuesOptions{ColumnLimits: map[string]int{"codigo": 120}}, "codigo", 120, true},
+		{"límite propio mayor", FilterValuesOptions{ColumnLimits: map[string]int{"codigo": 500}}, "codigo", 150, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, truncated, err := m.GetAvailableFilters(ctx, "codigos", tt.opts)
+			if err != nil {
+				t.Fatalf("GetAvailableFilters: %v", err)
+			}
+			values, listed := filters[tt.column].([]string)
+			if tt.wantValues < 0 {
+				if listed {
+					t.Errorf("%s no debería listarse", tt.column)
+				}
+			} else if len(values) != tt.wantValues {
+				t.Errorf("valores de %s = %d, se esperaban %d", tt.column, len(values), tt.wantValues)
+			}
+			if truncated[tt.column] != tt.wantTruncated {
+				t.Errorf("truncated[%s] = %v, se esperaba %v", tt.column, truncated[tt.column], tt.wantTruncated)
+			}
+		})
+	}
+}
+
+// cancelAfterChecks es un contexto que se cancela solo después de que lo
+// consultan n veces, para cortar un análisis a la mitad sin depender del reloj
+type cancelAfterChecks struct {
+	context.Context
+	cancel context.CancelFunc
+	n      int64
+	checks atomic.Int64
+}
+
+func newCancelAfterChecks(n int64) *cancelAfterChecks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &cancelAfterChecks{Context: ctx, cancel: cancel, n: n}
+}
+
+func (c *cancelAfterChecks) Done() <-chan struct{} {
+	if c.checks.Add(1) == c.n {
+		c.cancel()
+	}
+	return c.Context.Done()
+}
+
+func TestAvailableFiltersCancelledMidAnalysis(t *testing.T) {
+	m := newTestManager(t, Options{})
+	columns := make([]string, 30)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("i %% %d AS c%d", i+2, i)
+	}
+	writeDataset(t, m, "ancho", `CREATE TABLE data AS SELECT `+strings.Join(columns, ", ")+` FROM range(100) t(i)`)
+
+	// Análisis completo, para saber cuántas veces se consulta el contexto
+	full := newCancelAfterChecks(-1)
+	defer full.cancel()
+	filters, _, err := m.GetAvailableFilters(full, "ancho", FilterValuesOptions{})
+	if err != nil {
+		t.Fatalf("GetAvailableFilters: %v", err)
+	}
+	if len(filters) != 30 {
+		t.Fatalf("filtros = %d, se esperaban las 30 columnas", len(filters))
+	}
+	total := full.checks.Load()
+
+	// Cancelado a la mitad: retorna el error del contexto y deja de consultar
+	half := newCancelAfterChecks(total / 2)
+	filters, truncated, err := m.GetAvailableFilters(half, "ancho", FilterValuesOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, se esperaba context.Canceled", err)
+	}
+	if filters != nil || truncated != nil {
+		t.Errorf("filters = %v, no se esperaban resultados parciales", filters)
+	}
+	if checks := half.checks.Load(); checks >= total {
+		t.Errorf("consultas al contexto = %d de %d, el análisis no se abortó", checks, total)
+	}
+}
+
+func TestEstimateFilteredRowsExactCount(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "grande",
+		`CREATE TABLE data (id INTEGER, grupo INTEGER)`,
+		`INSERT INTO data SELECT i, i % 4 FROM range(500000) t(i)`,
+	)
+	ctx := context.Background()
+	filters := map[string]interface{}{"grupo": 1}
+
+	exact := true
+	count, err := m.EstimateFilteredRows(ctx, "grande", FilterParams{Filters: filters, ExactCount: &exact})
+	if err != nil {
+		t.Fatalf("EstimateFilteredRows exacto: %v", err)
+	}
+	if count.Count != 125000 || count.Approximate {
+		t.Errorf("conteo exacto = %+v, se esperaba 125000 exacto", count)
+	}
+
+	approx := false
+	count, err = m.EstimateFilteredRows(ctx, "grande", FilterParams{Filters: filters, ExactCount: &approx})
+	if err != nil {
+		t.Fatalf("EstimateFilteredRows aproximado: %v", err)
+	}
+	if !count.Approximate {
+		t.Errorf("conteo = %+v, se esperaba aproximado", count)
+	}
+	if count.Count < 100000 || count.Count > 150000 {
+		t.Errorf("estimación = %d, demasiado lejos de 125000", count.Count)
+	}
+
+	// Sin filtros el total de la tabla ya es exacto
+	count, err = m.EstimateFilteredRows(ctx, "grande", FilterParams{ExactCount: &approx})
+	if err != nil {
+		t.Fatalf("EstimateFilteredRows sin filtros: %v", err)
+	}
+	if count.Count != 500000 || count.Approximate {
+		t.Errorf("conteo sin filtros = %+v, se esperaba 500000 exacto", count)
+	}
+}
+
+func TestGetFilteredPageCountsOnce(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+	filters := map[string]interface{}{"producto": "Pan"}
+
+	// Página llena: se cuenta el total filtrado
+	data, truncated, count, err := m.GetFilteredPage(ctx, "ventas", FilterParams{Filters: filters, Limit: 2})
+	if err != nil {
+		t.Fatalf("GetFilteredPage: %v", err)
+	}
+	if len(data) != 2 || truncated || count.Count != 3 || count.Approximate {
+		t.Errorf("página = %d filas, truncated %v, total %+v; se esperaban 2 filas de 3", len(data), truncated, count)
+	}
+
+	// Página incompleta: el total sale de la página
+	data, _, count, err = m.GetFilteredPage(ctx, "ventas", FilterParams{Filters: filters, Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("GetFilteredPage con offset: %v", err)
+	}
+	if len(data) != 1 || count.Count != 3 {
+		t.Errorf("página = %d filas, total %+v; se esperaba 1 fila de 3", len(data), count)
+	}
+
+	// El uso del filtro se registra una vez por request, no una por query
+	value, _ := m.filterUsage.Load("ventas")
+	if got := value.(*columnUsage).counts["producto"]; got != 2 {
+		t.Errorf("uso de producto = %d, se esperaban 2", got)
+	}
+}
+
+func TestCaseInsensitiveFiltersByColumnType(t *testing.T) {
+	m := newTestManager(t, Options{CaseInsensitiveFilters: true})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+		want    int
+	}{
+		{"texto sin mayúsculas", map[string]interface{}{"region": "norte"}, 2},
+		{"lista de texto", map[string]interface{}{"producto": []interface{}{"PAN", "queso"}}, 4},
+		// La región NULL no es "SUR" y se conserva
+		{"operador sobre texto", map[string]interface{}{"region": map[string]interface{}{"op": "!=", "value": "SUR"}}, 4},
+		{"override exacto", map[string]interface{}{"region": map[string]interface{}{"op": "=", "value": "norte", "case_insensitive": false}}, 0},
+		{"número en columna de texto", map[string]interface{}{"producto": 10}, 0},
+		{"columna numérica", map[string]interface{}{"monto": 30}, 1},
+		{"lista numérica", map[string]interface{}{"monto": []interface{}{10, 20}}, 2},
+		{"columna de fecha", map[string]interface{}{"fecha": "2024-03-15"}, 1},
+		{"fecha con override", map[string]interface{}{"fecha": map[string]interface{}{"op": "=", "value": "2024-03-15", "case_insensitive": true}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, _, err := m.GetFilteredData(context.Background(), "ventas", FilterParams{Filters: tt.filters})
+			if err != nil {
+				t.Fatalf("GetFilteredData: %v", err)
+			}
+			if len(rows) != tt.want {
+				t.Errorf("filas = %d, se esperaban %d", len(rows), tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterOrderNulls(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+	ctx := context.Background()
+
+	rows, _, err := m.GetFilteredData(ctx, "ventas", FilterParams{
+		OrderBy: []SortSpec{{Column: "producto", Dir: "desc", Nulls: "first"}, {Column: "monto", Dir: "asc"}},
+	})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if rows[0]["producto"] != nil {
+		t.Errorf("primera fila = %v, se esperaba producto NULL", rows[0])
+	}
+	if rows[1]["producto"] != "Queso" {
+		t.Errorf("segunda fila = %v, se esperaba Queso", rows[1])
+	}
+
+	rows, _, err = m.GetFilteredData(ctx, "ventas", FilterParams{
+		OrderBy: []SortSpec{{Column: "producto", Dir: "asc", Nulls: "last"}},
+	})
+	if err != nil {
+		t.Fatalf("GetFilteredData: %v", err)
+	}
+	if rows[len(rows)-1]["producto"] != nil {
+		t.Errorf("última fila = %v, se esperaba producto NULL", rows[len(rows)-1])
+	}
+
+	_, _, err = m.GetFilteredData(ctx, "ventas", FilterParams{
+		OrderBy: []SortSpec{{Column: "producto", Nulls: "middle"}},
+	})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("nulls inválido: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
@@ -0,0 +1,104 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Puntos por defecto y máximo en una muestra de scatter
+	defaultScatterPoints = 1000
+	maxScatterPoints     = 10000
+)
+
+// ScatterParams define una muestra de pares (x, y) de dos columnas numéricas
+type ScatterParams struct {
+	XColumn   string                 `json:"x_column"`
+	YColumn   string                 `json:"y_column"`
+	MaxPoints int                    `json:"max_points"`
+	Filters   map[string]interface{} `json:"filters"`
+}
+
+// GetScatterSample retorna una muestra aleatoria (reservoir, reproducible) de pares
+// (x, y), descartando filas donde alguno no es numérico
+func (m *Manager) GetScatterSample(ctx context.Context, uuid string, params ScatterParams) (map[string]interface{}, error) {
+	if params.XColumn == "" || params.YColumn == "" {
+		return nil, fmt.Errorf("%w: columnas x y y requeridas", ErrInvalidParams)
+	}
+	if params.MaxPoints <= 0 {
+		params.MaxPoints = defaultScatterPoints
+	}
+	if params.MaxPoints > maxScatterPoints {
+		params.MaxPoints = maxScatterPoints
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{params.XColumn, params.YColumn}); err != nil {
+		return nil, err
+	}
+
+	x := fmt.Sprintf(`TRY_CAST("%s" AS DOUBLE)`, params.XColumn)
+	y := fmt.Sprintf(`TRY_CAST("%s" AS DOUBLE)`, params.YColumn)
+
+	conditions, args := m.buildFilterConditions(params.Filters, types)
+	conditions = append(conditions,
+		fmt.Sprintf("%s IS NOT NULL", x),
+		fmt.Sprintf("%s IS NOT NULL", y),
+	)
+	where := strings.Join(conditions, " AND ")
+
+	// Total de pares válidos, para saber qué fracción representa la muestra
+	var total int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM data WHERE %s", where)
+	if err := conn.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("error contando pares: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT x, y FROM (
+			SELECT %s as x, %s as y
+			FROM data
+			WHERE %s
+		) USING SAMPLE reservoir(%d ROWS) REPEATABLE (42)
+	`, x, y, where, params.MaxPoints)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo muestra: %w", err)
+	}
+	defer rows.Close()
+
+	points := make([][2]float64, 0, params.MaxPoints)
+	for rows.Next() {
+		var point [2]float64
+		if err := rows.Scan(&point[0], &point[1]); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"x_column": params.XColumn,
+		"y_column": params.YColumn,
+		"points":   points,
+		"sampled":  len(points),
+		"total":    total,
+	}, nil
+}
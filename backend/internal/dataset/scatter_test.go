@@ -0,0 +1,72 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// paresSQL crea 5000 filas con y = 2x, un grupo por paridad y algunos y no numéricos
+var paresSQL = []string{
+	`CREATE TABLE data AS
+		SELECT i as x,
+			CASE WHEN i % 100 = 0 THEN 'N/D' ELSE CAST(i * 2 AS VARCHAR) END as y,
+			CASE WHEN i % 2 = 0 THEN 'par' ELSE 'impar' END as grupo
+		FROM range(1, 5001) t(i)`,
+}
+
+func TestScatterSample(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "pares", paresSQL...)
+
+	sample, err := m.GetScatterSample(context.Background(), "pares", ScatterParams{
+		XColumn:   "x",
+		YColumn:   "y",
+		MaxPoints: 300,
+	})
+	if err != nil {
+		t.Fatalf("GetScatterSample: %v", err)
+	}
+
+	// Las 50 filas con y no numérico no cuentan como pares
+	if sample["total"] != int64(4950) || sample["sampled"] != 300 {
+		t.Errorf("total = %v, sampled = %v; se esperaban 4950 y 300", sample["total"], sample["sampled"])
+	}
+	for _, p := range sample["points"].([][2]float64) {
+		if p[1] != 2*p[0] {
+			t.Fatalf("par (%v, %v) no corresponde a una fila del dataset", p[0], p[1])
+		}
+	}
+}
+
+func TestScatterSampleFiltersAndLimits(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "pares", paresSQL...)
+	ctx := context.Background()
+
+	sample, err := m.GetScatterSample(ctx, "pares", ScatterParams{
+		XColumn:   "x",
+		YColumn:   "y",
+		MaxPoints: maxScatterPoints * 10,
+		Filters:   map[string]interface{}{"grupo": "impar"},
+	})
+	if err != nil {
+		t.Fatalf("GetScatterSample: %v", err)
+	}
+	// Menos pares que el máximo: la muestra los incluye todos
+	if sample["total"] != int64(2500) || sample["sampled"] != 2500 {
+		t.Errorf("total = %v, sampled = %v; se esperaban los 2500 impares", sample["total"], sample["sampled"])
+	}
+	for _, p := range sample["points"].([][2]float64) {
+		if int(p[0])%2 == 0 {
+			t.Fatalf("x = %v es par, el filtro pedía impares", p[0])
+		}
+	}
+
+	if _, err := m.GetScatterSample(ctx, "pares", ScatterParams{XColumn: "x"}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("sin y: err = %v, se esperaba ErrInvalidParams", err)
+	}
+	if _, err := m.GetScatterSample(ctx, "pares", ScatterParams{XColumn: "x", YColumn: "z"}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("columna inexistente: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
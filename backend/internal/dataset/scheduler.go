@@ -0,0 +1,232 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Intervalo mínimo entre re-descargas de un dataset
+	minScheduleInterval = 15 * time.Minute
+	// Cada cuánto revisa el scheduler si hay re-descargas pendientes
+	defaultSchedulerCheckInterval = time.Minute
+	// Key de Redis donde se persisten las programaciones
+	schedulesRedisKey = "schedules"
+)
+
+// Schedule programa la re-descarga periódica de un dataset
+type Schedule struct {
+	UUID      string    `json:"uuid"`
+	Interval  string    `json:"interval"`
+	NextRun   time.Time `json:"next_run"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+
+	every time.Duration
+}
+
+// Scheduler re-descarga datasets según su programación para mantener el cache fresco
+type Scheduler struct {
+	schedules  map[string]*Schedule
+	checkEvery time.Duration
+	mu         sync.Mutex
+	manager    *Manager
+
+	started  bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func NewScheduler(m *Manager, checkEvery time.Duration) *Scheduler {
+	if checkEvery <= 0 {
+		checkEvery = defaultSchedulerCheckInterval
+	}
+	s := &Scheduler{
+		schedules:  make(map[string]*Schedule),
+		checkEvery: checkEvery,
+		manager:    m,
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	s.load()
+	return s
+}
+
+// Start inicia la revisión periódica de programaciones
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	s.started = true
+	s.mu.Unlock()
+
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(s.checkEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.runDue(now)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop detiene la revisión periódica y espera a que termine la que esté en
+// curso. Se puede llamar más de una vez.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.mu.Lock()
+		started := s.started
+		s.mu.Unlock()
+		if started {
+			<-s.stopped
+		}
+	})
+}
+
+// Set crea o reemplaza la programación de un dataset. interval es una
+// duración de Go (p.ej. "24h", "6h30m")
+func (s *Scheduler) Set(uuid, interval string) (*Schedule, error) {
+	every, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("%w: intervalo inválido %q", ErrInvalidParams, interval)
+	}
+	if every < minScheduleInterval {
+		return nil, fmt.Errorf("%w: el intervalo mínimo es %v", ErrInvalidParams, minScheduleInterval)
+	}
+
+	s.mu.Lock()
+	schedule := &Schedule{
+		UUID:     uuid,
+		Interval: interval,
+		NextRun:  time.Now().Add(every),
+		every:    every,
+	}
+	if prev, ok := s.schedules[uuid]; ok {
+		schedule.LastRun = prev.LastRun
+		schedule.LastError = prev.LastError
+	}
+	s.schedules[uuid] = schedule
+	scheduleCopy := *schedule
+	s.mu.Unlock()
+
+	s.save()
+	log.Printf("⏰ Re-descarga de %s programada cada %s", uuid, interval)
+	return &scheduleCopy, nil
+}
+
+// Remove elimina la programación de un dataset. Retorna false si no existía.
+func (s *Scheduler) Remove(uuid string) bool {
+	s.mu.Lock()
+	_, exists := s.schedules[uuid]
+	delete(s.schedules, uuid)
+	s.mu.Unlock()
+
+	if exists {
+		s.save()
+	}
+	return exists
+}
+
+// Get retorna una copia de la programación de un dataset
+func (s *Scheduler) Get(uuid string) (*Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule, ok := s.schedules[uuid]; ok {
+		scheduleCopy := *schedule
+		return &scheduleCopy, true
+	}
+	return nil, false
+}
+
+// List retorna todas las programaciones ordenadas por UUID
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		list = append(list, *schedule)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UUID < list[j].UUID
+	})
+	return list
+}
+
+// runDue dispara la re-descarga de los datasets cuya programación venció
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	var due []string
+	for uuid, schedule := range s.schedules {
+		if !now.Before(schedule.NextRun) {
+			schedule.LastRun = now
+			schedule.NextRun = now.Add(schedule.every)
+			due = append(due, uuid)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	dm := s.manager.GetDownloadManager()
+	for _, uuid := range due {
+		errMsg := ""
+		if _, err := dm.Redownload(uuid); err != nil {
+			log.Printf("❌ Error en re-descarga programada de %s: %v", uuid, err)
+			errMsg = err.Error()
+		}
+
+		s.mu.Lock()
+		if schedule, ok := s.schedules[uuid]; ok {
+			schedule.LastError = errMsg
+		}
+		s.mu.Unlock()
+	}
+
+	s.save()
+}
+
+// save persiste las programaciones en Redis
+func (s *Scheduler) save() {
+	if err := s.manager.cacheManager.SetToRedis(schedulesRedisKey, s.List(), 0); err != nil {
+		log.Printf("Warning: error guardando programaciones: %v", err)
+	}
+}
+
+// load recupera las programaciones guardadas en Redis
+func (s *Scheduler) load() {
+	data, found := s.manager.cacheManager.GetFromRedis(schedulesRedisKey)
+	if !found {
+		return
+	}
+
+	var list []Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Printf("Warning: programaciones inválidas en Redis: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, schedule := range list {
+		every, err := time.ParseDuration(schedule.Interval)
+		if err != nil {
+			continue
+		}
+		schedule.every = every
+		s.schedules[schedule.UUID] = &schedule
+	}
+	log.Printf("⏰ %d re-descargas programadas cargadas", len(s.schedules))
+}
@@ -0,0 +1,92 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestSchedulerRejectsInvalidIntervals(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	for _, interval := range []string{"", "mañana", "5m"} {
+		if _, err := m.GetScheduler().Set("ventas", interval); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Set(%q): err = %v, se esperaba ErrInvalidParams", interval, err)
+		}
+	}
+	if list := m.GetScheduler().List(); len(list) != 0 {
+		t.Errorf("programaciones = %v, no debería haber ninguna", list)
+	}
+}
+
+func TestSchedulerPersistsInRedis(t *testing.T) {
+	m := newTestManager(t, Options{})
+	if _, err := m.GetScheduler().Set("ventas", "6h"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Un scheduler nuevo (p.ej. tras reiniciar) carga lo guardado
+	reloaded := NewScheduler(m, time.Hour)
+	schedule, ok := reloaded.Get("ventas")
+	if !ok {
+		t.Fatal("la programación no se cargó de Redis")
+	}
+	if schedule.Interval != "6h" {
+		t.Errorf("intervalo = %q, se esperaba 6h", schedule.Interval)
+	}
+
+	if !reloaded.Remove("ventas") {
+		t.Fatal("Remove retornó false")
+	}
+	if _, ok := NewScheduler(m, time.Hour).Get("ventas"); ok {
+		t.Error("la programación borrada se volvió a cargar")
+	}
+}
+
+func TestSchedulerRunsDueRedownloads(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n")})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+
+	scheduler := m.GetScheduler()
+	if _, err := scheduler.Set("ventas", "1h"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Antes del vencimiento no se descarga nada
+	scheduler.runDue(time.Now())
+	if job, exists := m.GetDownloadManager().GetJob("ventas"); exists {
+		t.Fatalf("se inició una descarga antes de tiempo: %+v", job)
+	}
+
+	now := time.Now().Add(2 * time.Hour)
+	scheduler.runDue(now)
+	job, _ := m.GetDownloadManager().Wait(context.Background(), "ventas", 30*time.Second)
+	if job == nil || job.Status != StatusReady {
+		t.Fatalf("job = %+v, se esperaba ready", job)
+	}
+	if got := ckan.Downloads("ventas"); got != 1 {
+		t.Errorf("descargas = %d, se esperaba 1", got)
+	}
+
+	schedule, _ := scheduler.Get("ventas")
+	if !schedule.LastRun.Equal(now) || !schedule.NextRun.Equal(now.Add(time.Hour)) {
+		t.Errorf("last_run = %v, next_run = %v; se esperaban %v y una hora después", schedule.LastRun, schedule.NextRun, now)
+	}
+}
+
+func TestManagerCloseStopsScheduler(t *testing.T) {
+	m := newTestManager(t, Options{SchedulerCheckInterval: time.Millisecond})
+	m.Close()
+
+	select {
+	case <-m.GetScheduler().stopped:
+	case <-time.After(time.Second):
+		t.Fatal("el scheduler sigue revisando programaciones después de Close")
+	}
+	// Detenerlo de nuevo no bloquea
+	m.GetScheduler().Stop()
+}
@@ -0,0 +1,126 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Una columna con menos valores únicos que esto se considera categórica
+const categoricalMaxDistinct = 100
+
+// Roles semánticos de una columna
+const (
+	RoleNumeric     = "numeric"
+	RoleCategorical = "categorical"
+	RoleDate        = "date"
+	RoleText        = "text"
+)
+
+// ColumnSchema describe una columna del dataset y su rol inferido
+type ColumnSchema struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	DistinctCount int64  `json:"distinct_count"`
+	NullCount     int64  `json:"null_count"`
+	Role          string `json:"role"`
+}
+
+// GetSchema retorna las columnas con su tipo DuckDB, conteos y rol inferido
+func (m *Manager) GetSchema(ctx context.Context, uuid string) ([]ColumnSchema, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return []ColumnSchema{}, nil
+	}
+
+	// Una sola pasada para distintos y nulos de todas las columnas
+	exprs := make([]string, 0, len(columns)*2)
+	for _, col := range columns {
+		exprs = append(exprs,
+			fmt.Sprintf(`COUNT(DISTINCT "%s")`, col.Name),
+			fmt.Sprintf(`COUNT(*) - COUNT("%s")`, col.Name),
+		)
+	}
+	query := fmt.Sprintf("SELECT %s FROM data", strings.Join(exprs, ", "))
+
+	counts := make([]int64, len(exprs))
+	pointers := make([]interface{}, len(exprs))
+	for i := range counts {
+		pointers[i] = &counts[i]
+	}
+	if err := conn.QueryRowContext(ctx, query).Scan(pointers...); err != nil {
+		return nil, fmt.Errorf("error obteniendo esquema: %w", err)
+	}
+
+	dateColumns := make(map[string]bool)
+	for _, name := range m.getDateColumns(columns) {
+		dateColumns[name] = true
+	}
+
+	schema := make([]ColumnSchema, len(columns))
+	for i, col := range columns {
+		schema[i] = ColumnSchema{
+			Name:          col.Name,
+			Type:          col.Type,
+			DistinctCount: counts[i*2],
+			NullCount:     counts[i*2+1],
+		}
+		schema[i].Role = inferRole(col, schema[i].DistinctCount, dateColumns[col.Name])
+	}
+
+	return schema, nil
+}
+
+// inferRole determina el rol de una columna a partir de su tipo, nombre y cardinalidad
+func inferRole(col ColumnInfo, distinctCount int64, nameLooksLikeDate bool) string {
+	switch {
+	case isDateType(col.Type) || nameLooksLikeDate:
+		return RoleDate
+	case isNumericType(col.Type):
+		return RoleNumeric
+	case isCategorical(int(distinctCount)):
+		return RoleCategorical
+	default:
+		return RoleText
+	}
+}
+
+// isCategorical aplica la heurística de valores únicos usada en los filtros
+func isCategorical(distinctCount int) bool {
+	return distinctCount > 0 && distinctCount < categoricalMaxDistinct
+}
+
+// isTextType indica si un tipo de DuckDB es texto
+func isTextType(colType string) bool {
+	colType = strings.ToUpper(colType)
+	return colType == "VARCHAR" || colType == "TEXT" || colType == "STRING" || strings.HasPrefix(colType, "VARCHAR(")
+}
+
+// isNumericType indica si un tipo de DuckDB es numérico
+func isNumericType(colType string) bool {
+	colType = strings.ToUpper(colType)
+	if strings.HasPrefix(colType, "DECIMAL") || strings.HasPrefix(colType, "NUMERIC") {
+		return true
+	}
+	switch colType {
+	case "TINYINT", "SMALLINT", "INTEGER", "BIGINT", "HUGEINT",
+		"UTINYINT", "USMALLINT", "UINTEGER", "UBIGINT", "UHUGEINT",
+		"FLOAT", "REAL", "DOUBLE":
+		return true
+	}
+	return false
+}
+
+// isDateType indica si un tipo de DuckDB es fecha u hora
+func isDateType(colType string) bool {
+	colType = strings.ToUpper(colType)
+	return colType == "DATE" || strings.HasPrefix(colType, "TIMESTAMP")
+}
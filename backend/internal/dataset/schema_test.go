@@ -0,0 +1,55 @@
+package dataset
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSchemaInfersRoles(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "mixto", `CREATE TABLE data AS
+		SELECT
+			i as id,
+			i * 1.5 as monto,
+			['Jalisco', 'Sonora', 'Yucatán'][i % 3 + 1] as estado,
+			'FOLIO-' || i as folio,
+			DATE '2024-01-01' + CAST(i AS INTEGER) as creado,
+			CAST(DATE '2024-01-01' + CAST(i AS INTEGER) AS VARCHAR) as fecha_registro,
+			CASE WHEN i % 2 = 0 THEN 'si' END as bandera
+		FROM range(200) t(i)`)
+
+	schema, err := m.GetSchema(context.Background(), "mixto")
+	if err != nil {
+		t.Fatalf("GetSchema: %v", err)
+	}
+
+	want := map[string]struct {
+		role     string
+		distinct int64
+		nulls    int64
+	}{
+		"id":     {RoleNumeric, 200, 0},
+		"monto":  {RoleNumeric, 200, 0},
+		"estado": {RoleCategorical, 3, 0},
+		// Más de 100 valores distintos: texto libre
+		"folio":  {RoleText, 200, 0},
+		"creado": {RoleDate, 200, 0},
+		// VARCHAR, pero el nombre indica fecha
+		"fecha_registro": {RoleDate, 200, 0},
+		"bandera":        {RoleCategorical, 1, 100},
+	}
+	if len(schema) != len(want) {
+		t.Fatalf("%d columnas, se esperaban %d: %+v", len(schema), len(want), schema)
+	}
+	for _, col := range schema {
+		w, ok := want[col.Name]
+		if !ok {
+			t.Errorf("columna inesperada %s", col.Name)
+			continue
+		}
+		if col.Role != w.role || col.DistinctCount != w.distinct || col.NullCount != w.nulls {
+			t.Errorf("%s (%s): rol %s, %d distintos, %d nulos; se esperaba %s, %d y %d",
+				col.Name, col.Type, col.Role, col.DistinctCount, col.NullCount, w.role, w.distinct, w.nulls)
+		}
+	}
+}
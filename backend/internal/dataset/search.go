@@ -0,0 +1,75 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Máximo de columnas de texto en las que se busca
+	maxSearchColumns = 50
+	// Límite por defecto y máximo de resultados de búsqueda
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+)
+
+// SearchData busca un término (sin distinguir mayúsculas) en todas las columnas de texto.
+// truncated indica que las coincidencias se cortaron en el máximo de filas
+func (m *Manager) SearchData(ctx context.Context, uuid, term string, limit int) (data []map[string]interface{}, truncated bool, err error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return nil, false, fmt.Errorf("%w: término de búsqueda requerido", ErrInvalidParams)
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Solo columnas de texto, con tope para datasets muy anchos
+	pattern := "%" + escapeLike(term) + "%"
+	var conditions []string
+	var args []interface{}
+	for _, col := range columns {
+		if !isTextType(col.Type) {
+			continue
+		}
+		if len(conditions) >= maxSearchColumns {
+			break
+		}
+		conditions = append(conditions, fmt.Sprintf(`"%s" ILIKE ? ESCAPE '\'`, col.Name))
+		args = append(args, pattern)
+	}
+
+	if len(conditions) == 0 {
+		return []map[string]interface{}{}, false, nil
+	}
+
+	query := fmt.Sprintf("SELECT * FROM data WHERE %s LIMIT %d", strings.Join(conditions, " OR "), limit)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error ejecutando búsqueda: %w", err)
+	}
+	defer rows.Close()
+
+	return m.rowsToMaps(rows)
+}
+
+// escapeLike escapa los comodines de LIKE para que el término se busque literal
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(term)
+}
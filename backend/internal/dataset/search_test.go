@@ -0,0 +1,67 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearchData(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ventas", ventasSQL...)
+
+	tests := []struct {
+		term string
+		rows int
+	}{
+		// Sin distinguir mayúsculas, en cualquier columna de texto
+		{"NORTE", 2},
+		{"pan", 3},
+		{"ues", 1},
+		// monto y fecha no son texto: "10" no coincide con 10 ni con 2024-02-10
+		{"10", 0},
+		// Los comodines de LIKE se buscan literales
+		{"%", 0},
+		{"_", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			rows, _, err := m.SearchData(context.Background(), "ventas", tt.term, 0)
+			if err != nil {
+				t.Fatalf("SearchData: %v", err)
+			}
+			if len(rows) != tt.rows {
+				t.Errorf("%d filas, se esperaban %d: %v", len(rows), tt.rows, rows)
+			}
+		})
+	}
+
+	if _, _, err := m.SearchData(context.Background(), "ventas", "  ", 0); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("término vacío: err = %v, se esperaba ErrInvalidParams", err)
+	}
+}
+
+func TestSearchDataCapsColumns(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	// El término solo aparece en una columna más allá del tope
+	columns := make([]string, maxSearchColumns+1)
+	for i := range columns {
+		value := "nada"
+		if i == maxSearchColumns {
+			value = "buscado"
+		}
+		columns[i] = fmt.Sprintf("'%s' as c%d", value, i)
+	}
+	writeDataset(t, m, "ancho", "CREATE TABLE data AS SELECT "+strings.Join(columns, ", "))
+
+	rows, _, err := m.SearchData(context.Background(), "ancho", "buscado", 0)
+	if err != nil {
+		t.Fatalf("SearchData: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("se buscó en más de %d columnas: %v", maxSearchColumns, rows)
+	}
+}
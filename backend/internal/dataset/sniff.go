@@ -0,0 +1,286 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+const (
+	// Bytes del inicio del CSV que se analizan para detectar formato
+	sniffSampleSize = 64 * 1024
+	// Líneas de la muestra usadas para detectar el delimitador
+	sniffMaxLines = 20
+
+	encodingUTF8   = "UTF-8"
+	encodingLatin1 = "ISO-8859-1"
+)
+
+// Delimitadores candidatos, en orden de preferencia ante empate
+var csvDelimiters = []byte{',', ';', '\t', '|'}
+
+// csvSniff es el formato detectado de un CSV
+type csvSniff struct {
+	Delimiter byte
+	Encoding  string
+	// Líneas de preámbulo (títulos, notas) antes del encabezado real
+	SkipRows int
+	// Registros no vacíos dentro del preámbulo, para descontarlos del conteo
+	PreambleRecords int64
+
+	lines [][]byte
+}
+
+// delimOption retorna la opción delim de read_csv_auto para el delimitador detectado
+func (s *csvSniff) delimOption() string {
+	if s.Delimiter == '\t' {
+		return `delim = '\t'`
+	}
+	return fmt.Sprintf("delim = '%c'", s.Delimiter)
+}
+
+// sniffCSV analiza los primeros KB del archivo para detectar delimitador y encoding
+func sniffCSV(path string) (*csvSniff, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sample := make([]byte, sniffSampleSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	sample = sample[:n]
+
+	// Si la muestra se cortó, descartar la última línea incompleta
+	if n == sniffSampleSize {
+		if i := bytes.LastIndexByte(sample, '\n'); i > 0 {
+			sample = sample[:i]
+		}
+	}
+	sample = bytes.TrimPrefix(sample, []byte("\xef\xbb\xbf"))
+
+	// Se conservan todas las líneas para contar un preámbulo configurado largo
+	lines := bytes.Split(sample, []byte("\n"))
+	head := lines
+	if len(head) > sniffMaxLines {
+		head = head[:sniffMaxLines]
+	}
+
+	sniff := &csvSniff{
+		Delimiter: detectDelimiter(head),
+		Encoding:  encodingUTF8,
+		lines:     lines,
+	}
+	if !utf8.Valid(sample) {
+		sniff.Encoding = encodingLatin1
+	}
+	sniff.setSkipRows(detectSkipRows(head, sniff.Delimiter))
+	return sniff, nil
+}
+
+// setSkipRows fija las líneas de preámbulo (detectadas o configuradas para
+// el dataset) y cuenta cuántas de ellas son registros no vacíos
+func (s *csvSniff) setSkipRows(skip int) {
+	s.SkipRows = skip
+	s.PreambleRecords = 0
+	for i := 0; i < skip && i < len(s.lines); i++ {
+		if len(bytes.TrimSpace(s.lines[i])) > 0 {
+			s.PreambleRecords++
+		}
+	}
+}
+
+// detectDelimiter elige el delimitador que se repite el mismo número de veces
+// en más líneas (ignorando lo que va entre comillas). Se usa la cuenta más
+// frecuente y no la del encabezado, que puede venir después de un preámbulo
+func detectDelimiter(lines [][]byte) byte {
+	best := byte(',')
+	bestScore := 0
+	for _, delim := range csvDelimiters {
+		count, matches := modalDelimiterCount(lines, delim)
+		if count == 0 {
+			continue
+		}
+
+		// Primero la consistencia entre líneas, luego el número de columnas
+		score := matches*1000 + count
+		if score > bestScore {
+			best, bestScore = delim, score
+		}
+	}
+	return best
+}
+
+// modalDelimiterCount retorna el número de delimitadores más común entre las
+// líneas no vacías que lo contienen, y en cuántas líneas aparece
+func modalDelimiterCount(lines [][]byte, delim byte) (count, matches int) {
+	frequency := make(map[int]int)
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if n := countDelimiter(line, delim); n > 0 {
+			frequency[n]++
+		}
+	}
+	for n, f := range frequency {
+		if f > matches || (f == matches && n > count) {
+			count, matches = n, f
+		}
+	}
+	return count, matches
+}
+
+// detectSkipRows cuenta las líneas de preámbulo antes del encabezado: líneas
+// vacías o con a lo más la mitad de las columnas con contenido, como un
+// título o la fuente de los datos ("Reporte 2023" o "Reporte 2023,,,,").
+// El encabezado es la primera línea con la mayoría de sus campos llenos.
+func detectSkipRows(lines [][]byte, delim byte) int {
+	count, _ := modalDelimiterCount(lines, delim)
+	if count == 0 {
+		return 0
+	}
+	columns := count + 1
+
+	for i, line := range lines {
+		if filledFields(line, delim)*2 > columns {
+			return i
+		}
+	}
+	// Sin una línea que parezca encabezado no se salta nada
+	return 0
+}
+
+// filledFields cuenta los campos no vacíos de una línea
+func filledFields(line []byte, delim byte) int {
+	filled := 0
+	inQuotes := false
+	content := false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			content = true
+		case c == delim && !inQuotes:
+			if content {
+				filled++
+			}
+			content = false
+		case c != ' ' && c != '\t' && c != '\r':
+			content = true
+		}
+	}
+	if content {
+		filled++
+	}
+	return filled
+}
+
+// skipOption retorna la opción skip de read_csv_auto, vacía sin preámbulo
+func (s *csvSniff) skipOption() string {
+	if s.SkipRows <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("skip = %d", s.SkipRows)
+}
+
+// countDelimiter cuenta las apariciones del delimitador fuera de comillas dobles
+func countDelimiter(line []byte, delim byte) int {
+	count := 0
+	inQuotes := false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == delim && !inQuotes:
+			count++
+		}
+	}
+	return count
+}
+
+// transcodeLatin1 convierte un archivo ISO-8859-1 a UTF-8
+func transcodeLatin1(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	reader := bufio.NewReaderSize(src, 64*1024)
+	writer := bufio.NewWriterSize(dst, 64*1024)
+
+	// Cada byte de ISO-8859-1 corresponde al mismo code point en Unicode
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if b < utf8.RuneSelf {
+			writer.WriteByte(b)
+		} else {
+			writer.WriteRune(rune(b))
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// countCSVRecords cuenta los registros no vacíos del archivo (incluido el
+// encabezado). Los saltos de línea dentro de comillas no separan registros.
+func countCSVRecords(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	var records int64
+	inQuotes := false
+	hasContent := false
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case b == '"':
+			inQuotes = !inQuotes
+			hasContent = true
+		case b == '\n' && !inQuotes:
+			if hasContent {
+				records++
+			}
+			hasContent = false
+		case b != '\r' && b != ' ' && b != '\t':
+			hasContent = true
+		}
+	}
+	if hasContent {
+		records++
+	}
+	return records, nil
+}
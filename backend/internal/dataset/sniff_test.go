@@ -0,0 +1,124 @@
+package dataset
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCSV escribe body en un archivo temporal y retorna su ruta
+func writeCSV(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "datos.csv")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSniffCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		delim    byte
+		encoding string
+	}{
+		{"comas", "region,monto\nNorte,10\nSur,20\n", ',', encodingUTF8},
+		{"punto y coma", "region;monto;nota\nNorte;10,5;\"a;b\"\nSur;20,1;c\n", ';', encodingUTF8},
+		{"tabulador", "region\tmonto\nNorte\t10\n", '\t', encodingUTF8},
+		{"latin1", "municipio;poblaci\xf3n\nLe\xf3n;1721215\n", ';', encodingLatin1},
+		{"utf8 con BOM", "\xef\xbb\xbfmunicipio,poblaci\xc3\xb3n\nLe\xc3\xb3n,1721215\n", ',', encodingUTF8},
+	}
+	for _, tt := range tests {
+		sniff, err := sniffCSV(writeCSV(t, tt.body))
+		if err != nil {
+			t.Fatalf("%s: sniffCSV: %v", tt.name, err)
+		}
+		if sniff.Delimiter != tt.delim || sniff.Encoding != tt.encoding {
+			t.Errorf("%s: delimitador %q, encoding %s; se esperaba %q y %s",
+				tt.name, sniff.Delimiter, sniff.Encoding, tt.delim, tt.encoding)
+		}
+	}
+}
+
+func TestTranscodeLatin1(t *testing.T) {
+	src := writeCSV(t, "Le\xf3n,Quer\xe9taro,\xd1uble\n")
+	dst := src + ".utf8"
+	if err := transcodeLatin1(src, dst); err != nil {
+		t.Fatalf("transcodeLatin1: %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "León,Querétaro,Ñuble\n" {
+		t.Errorf("transcodificado = %q, se esperaba UTF-8 con acentos", got)
+	}
+}
+
+func TestLoadCSVSemicolonLatin1(t *testing.T) {
+	m := newTestManager(t, Options{})
+
+	conn, stats, err := loadTestCSV(t, m, "municipio;poblaci\xf3n\nLe\xf3n;1721215\nQuer\xe9taro;1049777\n")
+	if err != nil {
+		t.Fatalf("loadCSV: %v", err)
+	}
+	if stats.LoadedRows != 2 {
+		t.Errorf("%d filas, se esperaban 2", stats.LoadedRows)
+	}
+
+	// Las columnas quedan separadas y los acentos sobreviven, también en el encabezado
+	var municipio string
+	var poblacion int64
+	if err := conn.QueryRow(`SELECT municipio, "población" FROM data ORDER BY "población" DESC LIMIT 1`).Scan(&municipio, &poblacion); err != nil {
+		t.Fatalf("consulta: %v", err)
+	}
+	if municipio != "León" || poblacion != 1721215 {
+		t.Errorf("fila = %q, %d; se esperaba León, 1721215", municipio, poblacion)
+	}
+}
+
+func TestCountCSVRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int64
+	}{
+		{"simple", "a,b\n1,2\n3,4\n", 3},
+		{"sin salto final", "a,b\n1,2\n3,4", 3},
+		{"CRLF y líneas vacías", "a,b\r\n1,2\r\n\r\n3,4\r\n\n", 3},
+		{"salto dentro de comillas", "a,b\n\"uno\ndos\",2\n3,4\n", 3},
+		{"vacío", "", 0},
+	}
+	for _, tc := range tests {
+		got, err := countCSVRecords(writeCSV(t, tc.body))
+		if err != nil {
+			t.Fatalf("%s: countCSVRecords: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: %d registros, se esperaban %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSniffCSVPreamble(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		skip int
+	}{
+		{"sin preámbulo", "region,monto,fecha\nNorte,10,2024-01-01\n", 0},
+		{"título y fuente", "Reporte de ventas 2023\nFuente: INEGI,,\nregion,monto,fecha\nNorte,10,2024-01-01\nSur,20,2024-01-02\n", 2},
+		{"línea vacía", "Reporte de ventas\n\nregion;monto;fecha\nNorte;10;2024-01-01\n", 2},
+		{"encabezado con un campo vacío", "region,monto,\nNorte,10,x\n", 0},
+	}
+	for _, tt := range tests {
+		sniff, err := sniffCSV(writeCSV(t, tt.body))
+		if err != nil {
+			t.Fatalf("%s: sniffCSV: %v", tt.name, err)
+		}
+		if sniff.SkipRows != tt.skip {
+			t.Errorf("%s: SkipRows = %d, se esperaban %d", tt.name, sniff.SkipRows, tt.skip)
+		}
+	}
+}
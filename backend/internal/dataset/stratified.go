@@ -0,0 +1,133 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Filas por estrato por defecto y máximo
+	defaultPerStratum = 10
+	maxPerStratum     = 1000
+	// Máximo de estratos (valores distintos de la columna)
+	maxStrata = 1000
+)
+
+// Modos de reparto de la muestra estratificada
+const (
+	// Cada estrato aporta hasta PerStratum filas
+	StratifyEqual = "equal"
+	// El estrato más grande aporta PerStratum y los demás en proporción a su
+	// tamaño, al menos una fila cada uno
+	StratifyProportional = "proportional"
+)
+
+// StratifiedSampleParams define una muestra con filas de cada valor de Column
+type StratifiedSampleParams struct {
+	Column     string                 `json:"column"`
+	PerStratum int                    `json:"per_stratum"`
+	Mode       string                 `json:"mode"`
+	Filters    map[string]interface{} `json:"filters"`
+}
+
+// GetStratifiedSample toma hasta PerStratum filas de cada estrato con
+// ROW_NUMBER por partición, en un orden pseudoaleatorio reproducible (hash del
+// rowid), así las categorías raras no quedan fuera como en una muestra global.
+// Los NULL de la columna forman su propio estrato.
+func (m *Manager) GetStratifiedSample(ctx context.Context, uuid string, params StratifiedSampleParams) (map[string]interface{}, error) {
+	if params.Column == "" {
+		return nil, fmt.Errorf("%w: columna de estrato requerida", ErrInvalidParams)
+	}
+	if params.PerStratum <= 0 {
+		params.PerStratum = defaultPerStratum
+	}
+	if params.PerStratum > maxPerStratum {
+		return nil, fmt.Errorf("%w: per_stratum máximo %d", ErrInvalidParams, maxPerStratum)
+	}
+	switch strings.ToLower(params.Mode) {
+	case "", StratifyEqual:
+		params.Mode = StratifyEqual
+	case StratifyProportional:
+		params.Mode = StratifyProportional
+	default:
+		return nil, fmt.Errorf("%w: modo inválido %q (equal|proportional)", ErrInvalidParams, params.Mode)
+	}
+
+	if err := m.validateFilters(params.Filters); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateColumns(ctx, conn, []string{params.Column}); err != nil {
+		return nil, err
+	}
+
+	m.recordFilterUsage(uuid, params.Filters, types)
+
+	conditions, args := m.buildFilterConditions(params.Filters, types)
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Verificar cuántos estratos hay antes de muestrear; sin filas cuenta 0
+	// (MAX daría NULL) y los NULL suman un estrato
+	var strata int64
+	countQuery := fmt.Sprintf(`SELECT COUNT(DISTINCT "%s") + (COUNT(*) > COUNT("%s"))::INT FROM data %s`,
+		params.Column, params.Column, where)
+	if err := conn.QueryRowContext(ctx, countQuery, args...).Scan(&strata); err != nil {
+		return nil, fmt.Errorf("error contando estratos: %w", err)
+	}
+	if strata > maxStrata {
+		return nil, fmt.Errorf("%w: %s tiene %d valores, máximo %d estratos", ErrInvalidParams, params.Column, strata, maxStrata)
+	}
+
+	// El cupo proporcional usa el estrato más grande (ventana), por eso QUALIFY
+	quota := fmt.Sprintf("WHERE stratum_row <= %d", params.PerStratum)
+	if params.Mode == StratifyProportional {
+		quota = fmt.Sprintf("QUALIFY stratum_row <= GREATEST(1, CEIL(%d * stratum_size / MAX(stratum_size) OVER ()))", params.PerStratum)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT * EXCLUDE (stratum_row, stratum_size) FROM (
+			SELECT *,
+				ROW_NUMBER() OVER (PARTITION BY "%[1]s" ORDER BY hash(rowid)) as stratum_row,
+				COUNT(*) OVER (PARTITION BY "%[1]s") as stratum_size
+			FROM data
+			%[2]s
+		) stratified
+		%[3]s
+		ORDER BY "%[1]s" NULLS LAST, stratum_row
+	`, params.Column, where, quota)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo muestra estratificada: %w", err)
+	}
+	defer rows.Close()
+
+	data, truncated, err := m.rowsToMaps(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"column":      params.Column,
+		"mode":        params.Mode,
+		"per_stratum": params.PerStratum,
+		"strata":      strata,
+		"data":        data,
+		"total":       len(data),
+		"truncated":   truncated,
+	}, nil
+}
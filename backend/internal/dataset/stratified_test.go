@@ -0,0 +1,88 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// estratosSQL crea 100 filas en A, 10 en B, 2 en C y 1 con categoría NULL
+var estratosSQL = []string{
+	`CREATE TABLE data AS
+		SELECT CASE WHEN i <= 100 THEN 'A' WHEN i <= 110 THEN 'B' WHEN i <= 112 THEN 'C' END as categoria,
+			i as id
+		FROM range(1, 114) t(i)`,
+}
+
+// countByStratum cuenta las filas de la muestra por valor de categoria
+func countByStratum(t *testing.T, sample map[string]interface{}) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for _, row := range sample["data"].([]map[string]interface{}) {
+		counts[fmt.Sprint(row["categoria"])]++
+	}
+	return counts
+}
+
+func TestStratifiedSampleEqual(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "estratos", estratosSQL...)
+
+	sample, err := m.GetStratifiedSample(context.Background(), "estratos", StratifiedSampleParams{
+		Column:     "categoria",
+		PerStratum: 5,
+	})
+	if err != nil {
+		t.Fatalf("GetStratifiedSample: %v", err)
+	}
+
+	if got := sample["strata"]; got != int64(4) {
+		t.Errorf("strata = %v, se esperaban 4 (incluye NULL)", got)
+	}
+	want := map[string]int{"A": 5, "B": 5, "C": 2, "<nil>": 1}
+	counts := countByStratum(t, sample)
+	for stratum, n := range want {
+		if counts[stratum] != n {
+			t.Errorf("estrato %s: %d filas, se esperaban %d", stratum, counts[stratum], n)
+		}
+	}
+}
+
+func TestStratifiedSampleProportional(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "estratos", estratosSQL...)
+
+	sample, err := m.GetStratifiedSample(context.Background(), "estratos", StratifiedSampleParams{
+		Column:     "categoria",
+		PerStratum: 20,
+		Mode:       StratifyProportional,
+	})
+	if err != nil {
+		t.Fatalf("GetStratifiedSample: %v", err)
+	}
+
+	// A aporta el cupo completo, B en proporción y los chicos al menos una fila
+	want := map[string]int{"A": 20, "B": 2, "C": 1, "<nil>": 1}
+	counts := countByStratum(t, sample)
+	for stratum, n := range want {
+		if counts[stratum] != n {
+			t.Errorf("estrato %s: %d filas, se esperaban %d", stratum, counts[stratum], n)
+		}
+	}
+}
+
+func TestStratifiedSampleNoRows(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "estratos", estratosSQL...)
+
+	sample, err := m.GetStratifiedSample(context.Background(), "estratos", StratifiedSampleParams{
+		Column:  "categoria",
+		Filters: map[string]interface{}{"categoria": "Z"},
+	})
+	if err != nil {
+		t.Fatalf("GetStratifiedSample sin filas: %v", err)
+	}
+	if sample["strata"] != int64(0) || sample["total"] != 0 {
+		t.Errorf("strata = %v, total = %v, se esperaba una muestra vacía", sample["strata"], sample["total"])
+	}
+}
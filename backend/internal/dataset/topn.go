@@ -0,0 +1,116 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TopNParams define un top-N de grupos según una métrica agregada (p.ej. los
+// 10 municipios con mayor suma de monto). Los empates en la métrica se
+// resuelven por TieBreaker en orden alfabético, o por las columnas agrupadas
+// en orden si no se indica. Con WithTies se incluyen todos los grupos
+// empatados en la última posición, aunque el resultado pase de N
+type TopNParams struct {
+	Filters    map[string]interface{} `json:"filters"`
+	GroupBy    []string               `json:"group_by"`
+	Agg        string                 `json:"agg"`
+	VarAgg     string                 `json:"var_agg"`
+	N          int                    `json:"n"`
+	OrderDir   string                 `json:"order_dir"`
+	TieBreaker string                 `json:"tie_breaker"`
+	WithTies   bool                   `json:"with_ties"`
+	DateFormat string                 `json:"date_format"`
+}
+
+// GetTopN retorna los N grupos con mayor (o menor, con order_dir asc) valor
+// agregado en un orden reproducible. Cada fila incluye rank, el puesto con
+// empates (dos grupos con el mismo total comparten rank). Con truncated en
+// true quedaron menos grupos por el máximo de filas
+func (m *Manager) GetTopN(ctx context.Context, uuid string, p TopNParams) (data []map[string]interface{}, truncated bool, err error) {
+	if len(p.GroupBy) == 0 {
+		return nil, false, fmt.Errorf("%w: group_by requerido", ErrInvalidParams)
+	}
+	if p.N <= 0 {
+		return nil, false, fmt.Errorf("%w: n debe ser positivo", ErrInvalidParams)
+	}
+
+	tieBreakers := p.GroupBy
+	if p.TieBreaker != "" {
+		found := false
+		for _, col := range p.GroupBy {
+			if col == p.TieBreaker {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false, fmt.Errorf("%w: tie_breaker %q debe estar en group_by", ErrInvalidParams, p.TieBreaker)
+		}
+		tieBreakers = []string{p.TieBreaker}
+	}
+
+	dir := "DESC"
+	if strings.ToLower(p.OrderDir) == "asc" {
+		dir = "ASC"
+	}
+
+	if err := m.validateFilters(p.Filters); err != nil {
+		return nil, false, err
+	}
+
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	types, err := m.filterTypes(ctx, conn, p.Filters)
+	if err != nil {
+		return nil, false, err
+	}
+
+	params := AggregationParams{
+		Filters:    p.Filters,
+		Agg:        p.Agg,
+		VarAgg:     p.VarAgg,
+		GroupBy:    p.GroupBy,
+		DateFormat: p.DateFormat,
+	}
+	if err := m.validateAggregationParams(ctx, conn, params); err != nil {
+		return nil, false, err
+	}
+
+	m.recordFilterUsage(uuid, params.Filters, types)
+
+	// El desempate va después de la métrica; NULLS LAST para que un grupo
+	// sin valor no gane posiciones
+	order := []string{fmt.Sprintf(`"total" %s NULLS LAST`, dir)}
+	for _, col := range tieBreakers {
+		order = append(order, fmt.Sprintf(`"%s" ASC NULLS LAST`, col))
+	}
+
+	// Con empates se corta por rank y no por número de filas
+	where, limit := "1=1", fmt.Sprintf("LIMIT %d", p.N)
+	if p.WithTies {
+		where, limit = fmt.Sprintf("rank <= %d", p.N), ""
+	}
+
+	aggQuery, args := m.buildAggregationQuery(params, types)
+	query := fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT *, RANK() OVER (ORDER BY "total" %s NULLS LAST) as rank
+			FROM (%s) grouped
+		) ranked
+		WHERE %s
+		ORDER BY %s
+		%s
+	`, dir, aggQuery, where, strings.Join(order, ", "), limit)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error obteniendo top-N: %w", err)
+	}
+	defer rows.Close()
+
+	return m.rowsToMaps(rows)
+}
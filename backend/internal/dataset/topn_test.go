@@ -0,0 +1,86 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// empatesSQL da sumas A 50, B 30, C 30, D 30 y E 10, con los empatados
+// insertados fuera de orden alfabético
+var empatesSQL = []string{
+	`CREATE TABLE data (estado VARCHAR, municipio VARCHAR, monto INTEGER)`,
+	`INSERT INTO data VALUES
+		('Sur', 'D', 30),
+		('Norte', 'A', 20), ('Norte', 'A', 30),
+		('Sur', 'C', 30),
+		('Norte', 'B', 30),
+		('Sur', 'E', 10)`,
+}
+
+// topNColumn une los valores de una columna del resultado, en orden
+func topNColumn(rows []map[string]interface{}, column string) string {
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = fmt.Sprint(row[column])
+	}
+	return strings.Join(values, ",")
+}
+
+func TestTopNTieBreaking(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "empates", empatesSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params TopNParams
+		want   string
+		ranks  string
+	}{
+		{"desempate alfabético", TopNParams{GroupBy: []string{"municipio"}, Agg: "sum", VarAgg: "monto", N: 2}, "A,B", "1,2"},
+		{"con empatados", TopNParams{GroupBy: []string{"municipio"}, Agg: "sum", VarAgg: "monto", N: 2, WithTies: true}, "A,B,C,D", "1,2,2,2"},
+		{"ascendente", TopNParams{GroupBy: []string{"municipio"}, Agg: "sum", VarAgg: "monto", N: 2, OrderDir: "asc"}, "E,B", "1,2"},
+		{"tie_breaker explícito", TopNParams{GroupBy: []string{"estado", "municipio"}, Agg: "sum", VarAgg: "monto", N: 3, TieBreaker: "municipio"}, "A,B,C", "1,2,2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Repetir para confirmar que el resultado es reproducible
+			for i := 0; i < 3; i++ {
+				rows, _, err := m.GetTopN(ctx, "empates", tt.params)
+				if err != nil {
+					t.Fatalf("GetTopN: %v", err)
+				}
+				if got := topNColumn(rows, "municipio"); got != tt.want {
+					t.Fatalf("municipios = %s, se esperaban %s", got, tt.want)
+				}
+				if got := topNColumn(rows, "rank"); got != tt.ranks {
+					t.Errorf("ranks = %s, se esperaban %s", got, tt.ranks)
+				}
+			}
+		})
+	}
+}
+
+func TestTopNValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "empates", empatesSQL...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params TopNParams
+	}{
+		{"sin group_by", TopNParams{Agg: "count", N: 3}},
+		{"n en cero", TopNParams{GroupBy: []string{"municipio"}, Agg: "count"}},
+		{"tie_breaker fuera de group_by", TopNParams{GroupBy: []string{"municipio"}, Agg: "count", N: 3, TieBreaker: "estado"}},
+		{"columna inexistente", TopNParams{GroupBy: []string{"colonia"}, Agg: "count", N: 3}},
+	}
+	for _, tt := range tests {
+		if _, _, err := m.GetTopN(ctx, "empates", tt.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
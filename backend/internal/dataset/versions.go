@@ -0,0 +1,357 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Versiones anteriores que se conservan por dataset (default)
+	defaultMaxVersions = 3
+	// ID de la copia vigente del dataset
+	currentVersionID = "current"
+	// Formato del ID de una versión archivada (fecha de descarga en UTC)
+	versionIDLayout = "20060102T150405Z"
+	// Claves de ejemplo que se retornan por tipo de cambio
+	versionDiffSampleSize = 20
+)
+
+var reVersionID = regexp.MustCompile(`^\d{8}T\d{6}Z$`)
+
+// DatasetVersion describe una copia de un dataset disponible para comparar
+type DatasetVersion struct {
+	ID           string    `json:"id"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	LastModified string    `json:"last_modified,omitempty"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Current      bool      `json:"current"`
+}
+
+// VersionDiffParams define la comparación entre dos versiones por una columna clave
+type VersionDiffParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Key  string `json:"key"`
+}
+
+// versionsDir es el directorio con las versiones archivadas de un dataset
+func (m *Manager) versionsDir(uuid string) string {
+	return filepath.Join(m.cacheManager.GetCacheDir(), "versions", uuid)
+}
+
+// archiveVersion conserva la copia vigente antes de reemplazarla. Usa un hard
+// link, así que no copia datos y las conexiones abiertas no se ven afectadas.
+func (m *Manager) archiveVersion(uuid, dbPath string, prev *datasetMeta) {
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		return
+	}
+
+	downloadedAt := fi.ModTime()
+	if prev != nil && !prev.DownloadedAt.IsZero() {
+		downloadedAt = prev.DownloadedAt
+	}
+	id := downloadedAt.UTC().Format(versionIDLayout)
+
+	dir := m.versionsDir(uuid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Warning: error creando directorio de versiones: %v", err)
+		return
+	}
+
+	versionPath := filepath.Join(dir, id+".duckdb")
+	os.Remove(versionPath)
+	if err := os.Link(dbPath, versionPath); err != nil {
+		log.Printf("Warning: no se pudo archivar la versión %s de %s: %v", id, uuid, err)
+		return
+	}
+	if prev != nil {
+		if data, err := json.Marshal(prev); err == nil {
+			os.WriteFile(filepath.Join(dir, id+".meta.json"), data, 0644)
+		}
+	}
+	log.Printf("🗂️  Versión %s de %s archivada", id, uuid)
+
+	m.pruneVersions(uuid)
+}
+
+// pruneVersions borra las versiones archivadas más antiguas que excedan el máximo
+func (m *Manager) pruneVersions(uuid string) {
+	versions := m.archivedVersions(uuid)
+	for i := m.maxVersions; i < len(versions); i++ {
+		base := filepath.Join(m.versionsDir(uuid), versions[i].ID)
+		os.Remove(base + ".duckdb")
+		os.Remove(base + ".meta.json")
+		log.Printf("🗑️  Versión %s de %s eliminada por retención", versions[i].ID, uuid)
+	}
+}
+
+// archivedVersions lista las versiones archivadas, de la más nueva a la más antigua
+func (m *Manager) archivedVersions(uuid string) []DatasetVersion {
+	matches, err := filepath.Glob(filepath.Join(m.versionsDir(uuid), "*.duckdb"))
+	if err != nil {
+		return nil
+	}
+
+	var versions []DatasetVersion
+	for _, path := range matches {
+		id := strings.TrimSuffix(filepath.Base(path), ".duckdb")
+		downloadedAt, err := time.Parse(versionIDLayout, id)
+		if err != nil {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		version := DatasetVersion{ID: id, DownloadedAt: downloadedAt, SizeBytes: fi.Size()}
+		if data, err := os.ReadFile(filepath.Join(m.versionsDir(uuid), id+".meta.json")); err == nil {
+			var meta datasetMeta
+			if json.Unmarshal(data, &meta) == nil {
+				version.LastModified = meta.LastModified
+			}
+		}
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].DownloadedAt.After(versions[j].DownloadedAt)
+	})
+	return versions
+}
+
+// ListVersions retorna la copia vigente (si está en cache) y las versiones archivadas
+func (m *Manager) ListVersions(uuid string) []DatasetVersion {
+	versions := []DatasetVersion{}
+
+	if dbPath, found := m.cacheManager.GetFromDisk(uuid); found {
+		current := DatasetVersion{ID: currentVersionID, Current: true}
+		if fi, err := os.Stat(dbPath); err == nil {
+			current.SizeBytes = fi.Size()
+			current.DownloadedAt = fi.ModTime()
+		}
+		if meta, ok := m.readMeta(uuid); ok {
+			current.DownloadedAt = meta.DownloadedAt
+			current.LastModified = meta.LastModified
+		}
+		versions = append(versions, current)
+	}
+
+	return append(versions, m.archivedVersions(uuid)...)
+}
+
+// versionPath resuelve el archivo DuckDB de una versión
+func (m *Manager) versionPath(uuid, id string) (string, error) {
+	if id == currentVersionID {
+		if dbPath, found := m.cacheManager.GetFromDisk(uuid); found {
+			return dbPath, nil
+		}
+		return "", fmt.Errorf("%w: dataset %s no está en cache", ErrInvalidParams, uuid)
+	}
+
+	if !reVersionID.MatchString(id) {
+		return "", fmt.Errorf("%w: versión inválida %q", ErrInvalidParams, id)
+	}
+	path := filepath.Join(m.versionsDir(uuid), id+".duckdb")
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%w: versión %s no existe", ErrInvalidParams, id)
+	}
+	return path, nil
+}
+
+// GetVersionDiff compara dos versiones de un dataset por una columna clave:
+// filas agregadas y eliminadas (anti-join) y filas cuya clave existe en ambas
+// pero con otros valores (EXCEPT sobre las columnas comunes)
+func (m *Manager) GetVersionDiff(ctx context.Context, uuid string, params VersionDiffParams) (map[string]interface{}, error) {
+	if params.Key == "" {
+		return nil, fmt.Errorf("%w: columna clave requerida", ErrInvalidParams)
+	}
+	if params.From == "" || params.To == "" || params.From == params.To {
+		return nil, fmt.Errorf("%w: se requieren dos versiones distintas", ErrInvalidParams)
+	}
+
+	fromPath, err := m.versionPath(uuid, params.From)
+	if err != nil {
+		return nil, err
+	}
+	toPath, err := m.versionPath(uuid, params.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffVersionFiles(ctx, fromPath, toPath, params)
+}
+
+// diffVersionFiles compara dos archivos DuckDB con la tabla data
+func diffVersionFiles(ctx context.Context, fromPath, toPath string, params VersionDiffParams) (map[string]interface{}, error) {
+	// Base en memoria con ambas versiones adjuntas en solo lectura
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return nil, fmt.Errorf("error creando DuckDB: %w", err)
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	for alias, path := range map[string]string{"v_from": fromPath, "v_to": toPath} {
+		attach := fmt.Sprintf("ATTACH '%s' AS %s (READ_ONLY)", strings.ReplaceAll(path, "'", "''"), alias)
+		if _, err := conn.ExecContext(ctx, attach); err != nil {
+			return nil, fmt.Errorf("error abriendo versión: %w", err)
+		}
+	}
+
+	fromColumns, err := versionColumns(ctx, conn, "v_from")
+	if err != nil {
+		return nil, err
+	}
+	toColumns, err := versionColumns(ctx, conn, "v_to")
+	if err != nil {
+		return nil, err
+	}
+
+	// Solo se comparan las columnas presentes en ambas versiones
+	inTo := make(map[string]bool, len(toColumns))
+	for _, col := range toColumns {
+		inTo[col] = true
+	}
+	var common []string
+	keyFound := false
+	for _, col := range fromColumns {
+		if inTo[col] {
+			common = append(common, fmt.Sprintf(`"%s"`, col))
+			keyFound = keyFound || col == params.Key
+		}
+	}
+	if !keyFound {
+		return nil, fmt.Errorf("%w: columna %s no existe en ambas versiones", ErrInvalidParams, params.Key)
+	}
+
+	key := fmt.Sprintf(`"%s"`, params.Key)
+	commonList := strings.Join(common, ", ")
+
+	queries := map[string]string{
+		"added": fmt.Sprintf(`
+			SELECT DISTINCT t.%s AS k FROM v_to.data t
+			ANTI JOIN v_from.data f ON t.%s = f.%s
+		`, key, key, key),
+		"removed": fmt.Sprintf(`
+			SELECT DISTINCT f.%s AS k FROM v_from.data f
+			ANTI JOIN v_to.data t ON f.%s = t.%s
+		`, key, key, key),
+		"changed": fmt.Sprintf(`
+			SELECT DISTINCT c.%s AS k FROM (
+				SELECT %s FROM v_to.data
+				EXCEPT
+				SELECT %s FROM v_from.data
+			) c
+			SEMI JOIN v_from.data f ON c.%s = f.%s
+		`, key, commonList, commonList, key, key),
+	}
+
+	result := map[string]interface{}{
+		"from":            params.From,
+		"to":              params.To,
+		"key":             params.Key,
+		"common_columns":  len(common),
+		"added_columns":   diffColumns(toColumns, fromColumns),
+		"removed_columns": diffColumns(fromColumns, toColumns),
+	}
+
+	for name, query := range queries {
+		var count int64
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM (%s)", query)
+		if err := conn.QueryRowContext(ctx, countQuery).Scan(&count); err != nil {
+			return nil, fmt.Errorf("error comparando versiones: %w", err)
+		}
+
+		sample, err := sampleKeys(ctx, conn, query)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = map[string]interface{}{
+			"count":       count,
+			"sample_keys": sample,
+		}
+	}
+
+	for alias, name := range map[string]string{"v_from": "from_rows", "v_to": "to_rows"} {
+		var rows int64
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s.data", alias)).Scan(&rows); err != nil {
+			return nil, err
+		}
+		result[name] = rows
+	}
+
+	return result, nil
+}
+
+// versionColumns retorna las columnas de la tabla data de una versión adjunta
+func versionColumns(ctx context.Context, conn *sql.Conn, alias string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_catalog = ? AND table_name = 'data'
+		ORDER BY ordinal_position
+	`, alias)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// sampleKeys retorna algunas claves de ejemplo como texto
+func sampleKeys(ctx context.Context, conn *sql.Conn, query string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT CAST(k AS VARCHAR) FROM (%s) ORDER BY k LIMIT %d", query, versionDiffSampleSize))
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo claves de ejemplo: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key sql.NullString
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key.String)
+	}
+	return keys, rows.Err()
+}
+
+// diffColumns retorna las columnas de a que no están en b
+func diffColumns(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, col := range b {
+		inB[col] = true
+	}
+	diff := []string{}
+	for _, col := range a {
+		if !inB[col] {
+			diff = append(diff, col)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,101 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestVersionDiff(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("escuelas", testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-01-01T00:00:00",
+		Body:         []byte("clave,nombre,alumnos\n1,Juárez,100\n2,Hidalgo,200\n3,Morelos,300\n4,Allende,400\n"),
+	})
+	m := newCKANTestManager(t, ckan.URL(), Options{})
+	ctx := context.Background()
+
+	if _, _, err := m.downloadAndConvertWithProgress(ctx, "escuelas", DownloadOptions{}, nil, nil); err != nil {
+		t.Fatalf("primera descarga: %v", err)
+	}
+
+	// En la versión nueva se elimina la 2, cambia la 3 y se agregan la 5 y la 6
+	ckan.SetResource("escuelas", testutil.CKANResource{
+		Format:       "CSV",
+		LastModified: "2024-02-01T00:00:00",
+		Body:         []byte("clave,nombre,alumnos\n1,Juárez,100\n3,Morelos,350\n4,Allende,400\n5,Zapata,50\n6,Villa,60\n"),
+	})
+	dbPath, _, err := m.downloadAndConvertWithProgress(ctx, "escuelas", DownloadOptions{}, nil, nil)
+	if err != nil {
+		t.Fatalf("segunda descarga: %v", err)
+	}
+	m.cacheManager.SetToDisk("escuelas", dbPath)
+
+	versions := m.ListVersions("escuelas")
+	if len(versions) != 2 || !versions[0].Current || versions[1].LastModified != "2024-01-01T00:00:00" {
+		t.Fatalf("versiones = %+v, se esperaban la vigente y la de enero", versions)
+	}
+
+	diff, err := m.GetVersionDiff(ctx, "escuelas", VersionDiffParams{From: versions[1].ID, To: currentVersionID, Key: "clave"})
+	if err != nil {
+		t.Fatalf("GetVersionDiff: %v", err)
+	}
+	want := map[string][]string{"added": {"5", "6"}, "removed": {"2"}, "changed": {"3"}}
+	for name, keys := range want {
+		got := diff[name].(map[string]interface{})
+		sample := got["sample_keys"].([]string)
+		if got["count"] != int64(len(keys)) || len(sample) != len(keys) || sample[0] != keys[0] {
+			t.Errorf("%s = %v, se esperaban las claves %v", name, got, keys)
+		}
+	}
+	if diff["from_rows"] != int64(4) || diff["to_rows"] != int64(5) {
+		t.Errorf("filas = %v -> %v, se esperaban 4 -> 5", diff["from_rows"], diff["to_rows"])
+	}
+}
+
+func TestVersionDiffValidation(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "escuelas", `CREATE TABLE data AS SELECT 1 as clave`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params VersionDiffParams
+	}{
+		{"sin clave", VersionDiffParams{From: "20240101T000000Z", To: currentVersionID}},
+		{"misma versión", VersionDiffParams{From: currentVersionID, To: currentVersionID, Key: "clave"}},
+		{"versión inválida", VersionDiffParams{From: "../../etc", To: currentVersionID, Key: "clave"}},
+		{"versión inexistente", VersionDiffParams{From: "20240101T000000Z", To: currentVersionID, Key: "clave"}},
+	}
+	for _, tt := range tests {
+		if _, err := m.GetVersionDiff(ctx, "escuelas", tt.params); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: err = %v, se esperaba ErrInvalidParams", tt.name, err)
+		}
+	}
+}
+
+func TestArchiveVersionRetention(t *testing.T) {
+	m := newTestManager(t, Options{MaxVersions: 2})
+	dbPath := filepath.Join(t.TempDir(), "escuelas.duckdb")
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		// Cada re-descarga reemplaza el archivo vigente
+		os.Remove(dbPath)
+		if err := os.WriteFile(dbPath, []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		m.archiveVersion("escuelas", dbPath, &datasetMeta{DownloadedAt: base.AddDate(0, i, 0)})
+	}
+
+	versions := m.archivedVersions("escuelas")
+	if len(versions) != 2 || versions[0].ID != "20240401T000000Z" || versions[1].ID != "20240301T000000Z" {
+		t.Errorf("versiones = %+v, se esperaban solo las 2 más nuevas", versions)
+	}
+}
@@ -0,0 +1,78 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Filas que se muestrean para estimar el tamaño serializado de una fila
+const widthProfileSampleRows = 1000
+
+// WidthProfile resume qué tan ancho es un dataset, para que el frontend elija
+// entre mostrarlo como tabla columnar o como objetos. AvgRowBytes es el
+// promedio de la fila serializada como objeto JSON, medido sobre una muestra.
+type WidthProfile struct {
+	Columns     int     `json:"columns"`
+	Numeric     int     `json:"numeric"`
+	Text        int     `json:"text"`
+	Date        int     `json:"date"`
+	Other       int     `json:"other"`
+	Rows        int64   `json:"rows"`
+	AvgRowBytes float64 `json:"avg_row_bytes"`
+	SampledRows int64   `json:"sampled_rows"`
+}
+
+// GetWidthProfile cuenta las columnas por tipo y estima el tamaño de fila.
+// Las fechas siguen el mismo criterio que el esquema: tipo fecha o nombre con
+// "fecha"/"date"
+func (m *Manager) GetWidthProfile(ctx context.Context, uuid string) (*WidthProfile, error) {
+	conn, err := m.GetConnection(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := m.getColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	dateColumns := make(map[string]bool)
+	for _, name := range m.getDateColumns(columns) {
+		dateColumns[name] = true
+	}
+
+	profile := &WidthProfile{Columns: len(columns)}
+	for _, col := range columns {
+		switch {
+		case isDateType(col.Type) || dateColumns[col.Name]:
+			profile.Date++
+		case isNumericType(col.Type):
+			profile.Numeric++
+		case isTextType(col.Type):
+			profile.Text++
+		default:
+			profile.Other++
+		}
+	}
+	if len(columns) == 0 {
+		return profile, nil
+	}
+
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM data").Scan(&profile.Rows); err != nil {
+		return nil, fmt.Errorf("error contando filas: %w", err)
+	}
+
+	// to_json de la fila completa, igual que la serializa la API
+	var avg sql.NullFloat64
+	query := fmt.Sprintf(`
+		SELECT AVG(strlen(CAST(to_json(sample) AS VARCHAR))), COUNT(*)
+		FROM (SELECT * FROM data USING SAMPLE reservoir(%d ROWS) REPEATABLE (42)) sample
+	`, widthProfileSampleRows)
+	if err := conn.QueryRowContext(ctx, query).Scan(&avg, &profile.SampledRows); err != nil {
+		return nil, fmt.Errorf("error midiendo filas: %w", err)
+	}
+	profile.AvgRowBytes = avg.Float64
+
+	return profile, nil
+}
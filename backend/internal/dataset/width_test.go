@@ -0,0 +1,60 @@
+package dataset
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWidthProfileColumnTypes(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "ancho",
+		`CREATE TABLE data (id INTEGER, monto DOUBLE, nombre VARCHAR, fecha DATE, fecha_alta VARCHAR, activo BOOLEAN)`,
+		`INSERT INTO data VALUES (1, 10.5, 'Ana', '2024-01-01', '2024-01-01', true)`,
+	)
+
+	profile, err := m.GetWidthProfile(context.Background(), "ancho")
+	if err != nil {
+		t.Fatalf("GetWidthProfile: %v", err)
+	}
+	// fecha_alta es texto pero cuenta como fecha por su nombre
+	want := WidthProfile{Columns: 6, Numeric: 2, Text: 1, Date: 2, Other: 1, Rows: 1, SampledRows: 1}
+	profile.AvgRowBytes = 0
+	if *profile != want {
+		t.Errorf("perfil = %+v, se esperaba %+v", *profile, want)
+	}
+}
+
+func TestWidthProfileRowSize(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "filas",
+		`CREATE TABLE data (id INTEGER, nombre VARCHAR)`,
+		`INSERT INTO data VALUES (1, 'ab'), (22, 'cdef')`,
+	)
+
+	profile, err := m.GetWidthProfile(context.Background(), "filas")
+	if err != nil {
+		t.Fatalf("GetWidthProfile: %v", err)
+	}
+	// {"id":1,"nombre":"ab"} son 22 bytes y {"id":22,"nombre":"cdef"} 25
+	if profile.AvgRowBytes != 23.5 || profile.SampledRows != 2 {
+		t.Errorf("perfil = %+v, se esperaba un promedio de 23.5 bytes sobre 2 filas", profile)
+	}
+}
+
+func TestWidthProfileSamplesLargeDatasets(t *testing.T) {
+	m := newTestManager(t, Options{})
+	writeDataset(t, m, "grande",
+		`CREATE TABLE data AS SELECT i AS id, 'x' AS nombre FROM range(5000) t(i)`,
+	)
+
+	profile, err := m.GetWidthProfile(context.Background(), "grande")
+	if err != nil {
+		t.Fatalf("GetWidthProfile: %v", err)
+	}
+	if profile.Rows != 5000 || profile.SampledRows != widthProfileSampleRows {
+		t.Errorf("perfil = %+v, se esperaban 5000 filas con %d muestreadas", profile, widthProfileSampleRows)
+	}
+	if profile.AvgRowBytes <= 0 {
+		t.Errorf("avg_row_bytes = %v, se esperaba positivo", profile.AvgRowBytes)
+	}
+}
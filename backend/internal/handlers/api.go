@@ -1,26 +1,112 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/ckan"
 	"visor-datos-abiertos-go/internal/dataset"
 )
 
 type APIHandler struct {
 	datasetManager *dataset.Manager
 	cacheManager   *cache.Manager
+	filtersTTL     TTLPolicy
+	ttls           CacheTTLs
+
+	// Previews remotos que se están obteniendo en segundo plano
+	previewsInFlight sync.Map
+}
+
+// CacheTTLs son los TTL en Redis de cada tipo de respuesta
+type CacheTTLs struct {
+	// Filtros disponibles; 0 usa DefaultFiltersTTLPolicy (según tamaño del dataset)
+	Filters time.Duration
+	// Metadata de CKAN y esquemas
+	Metadata time.Duration
+	// Filas filtradas y búsquedas
+	Data time.Duration
+	// Agregaciones, estadísticas y demás análisis
+	Agg time.Duration
+	// Búsqueda de datasets en CKAN
+	Search time.Duration
+	// Preview del esquema leído del CSV remoto mientras se descarga
+	Preview time.Duration
+}
+
+// DefaultCacheTTLs retorna los TTL por defecto
+func DefaultCacheTTLs() CacheTTLs {
+	return CacheTTLs{
+		Metadata: 24 * time.Hour,
+		Data:     30 * time.Minute,
+		Agg:      time.Hour,
+		Search:   15 * time.Minute,
+		Preview:  10 * time.Minute,
+	}
+}
+
+// TTLPolicy calcula el TTL de una respuesta cacheada según el tamaño del dataset en bytes
+type TTLPolicy func(datasetSize int64) time.Duration
+
+// DefaultFiltersTTLPolicy da más vida a los filtros de datasets grandes, que son
+// más caros de recalcular: 6 horas más 24 horas por GB, con tope de 7 días
+func DefaultFiltersTTLPolicy(datasetSize int64) time.Duration {
+	const (
+		base   = 6 * time.Hour
+		perGB  = 24 * time.Hour
+		maxTTL = 7 * 24 * time.Hour
+	)
+	ttl := base + time.Duration(float64(perGB)*float64(datasetSize)/(1<<30))
+	if ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
 }
 
 func NewAPIHandler(dm *dataset.Manager, cm *cache.Manager) *APIHandler {
 	return &APIHandler{
 		datasetManager: dm,
 		cacheManager:   cm,
+		filtersTTL:     DefaultFiltersTTLPolicy,
+		ttls:           DefaultCacheTTLs(),
+	}
+}
+
+// SetCacheTTLs reemplaza los TTL de Redis; los valores en 0 conservan el default
+func (h *APIHandler) SetCacheTTLs(ttls CacheTTLs) {
+	defaults := DefaultCacheTTLs()
+	if ttls.Metadata <= 0 {
+		ttls.Metadata = defaults.Metadata
+	}
+	if ttls.Data <= 0 {
+		ttls.Data = defaults.Data
+	}
+	if ttls.Agg <= 0 {
+		ttls.Agg = defaults.Agg
+	}
+	if ttls.Search <= 0 {
+		ttls.Search = defaults.Search
+	}
+	if ttls.Preview <= 0 {
+		ttls.Preview = defaults.Preview
 	}
+	if ttls.Filters > 0 {
+		fixed := ttls.Filters
+		h.filtersTTL = func(int64) time.Duration { return fixed }
+	}
+	h.ttls = ttls
+}
+
+// SetFiltersTTLPolicy reemplaza la política de TTL del cache de filtros
+func (h *APIHandler) SetFiltersTTLPolicy(policy TTLPolicy) {
+	h.filtersTTL = policy
 }
 
 // GetFilters retorna los filtros disponibles para un dataset
@@ -31,12 +117,38 @@ func (h *APIHandler) GetFilters(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Límite de valores por columna: ?limit=N para todas y ?limit.<columna>=N para una
+	var opts dataset.FilterValuesOptions
+	for key, values := range r.URL.Query() {
+		column, perColumn := strings.CutPrefix(key, "limit.")
+		if key != "limit" && (!perColumn || column == "") {
+			continue
+		}
+		var limit int
+		if _, err := fmt.Sscanf(values[0], "%d", &limit); err != nil || limit <= 0 {
+			http.Error(w, fmt.Sprintf("%s debe ser un entero positivo", key), http.StatusBadRequest)
+			return
+		}
+		if !perColumn {
+			opts.Limit = limit
+			continue
+		}
+		if opts.ColumnLimits == nil {
+			opts.ColumnLimits = make(map[string]int)
+		}
+		opts.ColumnLimits[column] = limit
+	}
+
 	// Verificar cache Redis primero
 	cacheKey := "filters:" + uuid
-	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Cache", "HIT")
-		w.Write(cached)
+	if opts.Limit > 0 || len(opts.ColumnLimits) > 0 {
+		cacheKey = h.cacheManager.GenerateKey("filters", map[string]interface{}{
+			"uuid":          uuid,
+			"limit":         opts.Limit,
+			"column_limits": opts.ColumnLimits,
+		})
+	}
+	if h.writeCached(w, r, cacheKey) {
 		return
 	}
 
@@ -51,43 +163,115 @@ func (h *APIHandler) GetFilters(w http.ResponseWriter, r *http.Request) {
 
 		log.Printf("📤 Dataset %s no está en cache, iniciando descarga asíncrona", uuid)
 
-		// Retornar status inmediatamente
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusAccepted) // 202 Accepted
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":          job.Status,
-			"progress":        job.Progress,
-			"message":         job.Message,
-			"check_status_at": fmt.Sprintf("/api/status/%s", uuid),
-		})
-		return
+		// Si el cliente prefiere esperar (Prefer: wait=N), bloquear hasta que esté listo
+		if wait := preferWait(r); wait > 0 {
+			w.Header().Set("Preference-Applied", fmt.Sprintf("wait=%d", int(wait.Seconds())))
+			if waited, finished := dm.Wait(r.Context(), uuid, wait); waited != nil {
+				job = waited
+				if finished && job.Status == dataset.StatusFailed {
+					http.Error(w, fmt.Sprintf("Error: %s", job.ErrorMsg), http.StatusBadGateway)
+					return
+				}
+			}
+		}
+
+		if job.Status != dataset.StatusReady {
+			// Retornar status inmediatamente, leído de una copia del job porque
+			// la descarga lo sigue modificando. El esquema leído del inicio del
+			// CSV se incluye solo si ya está en cache; si no, se obtiene en
+			// segundo plano para las siguientes consultas
+			if current, ok := dm.GetJob(uuid); ok {
+				job = current
+			}
+			response := map[string]interface{}{
+				"status":          job.Status,
+				"progress":        job.Progress,
+				"message":         job.Message,
+				"check_status_at": fmt.Sprintf("/api/status/%s", uuid),
+			}
+			if preview, found := h.cacheManager.GetFromRedis(previewCacheKey(uuid)); found {
+				response["preview"] = json.RawMessage(preview)
+			} else {
+				go h.warmSchemaPreview(uuid)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted) // 202 Accepted
+			json.NewEncoder(w).Encode(response)
+			return
+		}
 	}
 
 	// Dataset está en cache, obtener filtros
 	log.Printf("🔍 Obteniendo filtros para dataset: %s (desde cache)", uuid)
 
-	filters, err := h.datasetManager.GetAvailableFilters(r.Context(), uuid)
+	filters, truncated, err := h.datasetManager.GetAvailableFilters(r.Context(), uuid, opts)
+	if errors.Is(err, context.Canceled) {
+		// El cliente se desconectó, no hay a quién responder
+		log.Printf("🔌 Análisis de filtros de %s cancelado, el cliente se desconectó", uuid)
+		return
+	}
 	if err != nil {
 		log.Printf("❌ Error obteniendo filtros: %v", err)
-		http.Error(w, fmt.Sprintf("Error: %v", err), http.StatusInternalServerError)
+		writeDatasetError(w, err)
 		return
 	}
 
 	data, _ := json.Marshal(map[string]interface{}{
-		"filters": filters,
-		"cached":  true,
+		"filters":   filters,
+		"truncated": truncated,
+		"cached":    true,
 	})
 
-	// Cachear en Redis
-	h.cacheManager.SetToRedis(cacheKey, data, 24*time.Hour)
+	// Cachear en Redis, el TTL depende del tamaño del dataset
+	size, _ := h.cacheManager.GetDatasetSize(uuid)
+	h.cacheManager.SetToRedis(cacheKey, data, h.filtersTTL(size))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
 	w.Write(data)
 }
 
+// Tiempo máximo que un cliente puede pedir esperar con Prefer: wait=N
+const maxPreferWait = 60 * time.Second
+
+const (
+	// limit por default cuando el cliente no lo indica (o no es positivo)
+	defaultDataLimit = 1000
+	defaultTopLimit  = 10
+)
+
+// preferWait interpreta el header Prefer (RFC 7240). Retorna 0 si el cliente
+// prefiere respuesta asíncrona o no indicó wait.
+func preferWait(r *http.Request) time.Duration {
+	var wait time.Duration
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			pref = strings.TrimSpace(strings.ToLower(pref))
+			if pref == "respond-async" {
+				return 0
+			}
+			if value, ok := strings.CutPrefix(pref, "wait="); ok {
+				var seconds int
+				if _, err := fmt.Sscanf(value, "%d", &seconds); err == nil && seconds > 0 {
+					wait = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+	if wait > maxPreferWait {
+		wait = maxPreferWait
+	}
+	return wait
+}
+
 // NUEVO: Endpoint de status
 func (h *APIHandler) GetDownloadStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		h.CancelDownload(w, r)
+		return
+	}
+
 	uuid := strings.TrimPrefix(r.URL.Path, "/api/status/")
 	if uuid == "" {
 		http.Error(w, "UUID requerido", http.StatusBadRequest)
@@ -141,12 +325,41 @@ func (h *APIHandler) GetDownloadStatus(w http.ResponseWriter, r *http.Request) {
 	if job.Status == dataset.StatusReady {
 		response["end_time"] = job.EndTime
 		response["duration_seconds"] = job.EndTime.Sub(job.StartTime).Seconds()
+		response["rejected_rows"] = job.RejectedRows
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// CancelDownload cancela la descarga en curso de un dataset
+func (h *APIHandler) CancelDownload(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/status/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	dm := h.datasetManager.GetDownloadManager()
+	if !dm.Cancel(uuid) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "not_found",
+			"message": "No hay una descarga en curso para este dataset",
+		})
+		return
+	}
+
+	job, _ := dm.GetJob(uuid)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  job.Status,
+		"message": job.Message,
+	})
+}
+
 // GetFilteredData retorna datos filtrados
 func (h *APIHandler) GetFilteredData(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -156,7 +369,7 @@ func (h *APIHandler) GetFilteredData(w http.ResponseWriter, r *http.Request) {
 
 	// Extraer el UUID
 	uuid := strings.TrimPrefix(r.URL.Path, "/api/data/")
-	if uuid != "" {
+	if uuid == "" {
 		http.Error(w, "UUID requerido", http.StatusBadRequest)
 		return
 	}
@@ -167,6 +380,7 @@ func (h *APIHandler) GetFilteredData(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "datos inválidos", http.StatusBadRequest)
 		return
 	}
+	params.Limit = h.datasetManager.ClampLimit(params.Limit, defaultDataLimit)
 
 	// Cache Key
 	cacheKey := h.cacheManager.GenerateKey("data", map[string]interface{}{
@@ -175,25 +389,42 @@ func (h *APIHandler) GetFilteredData(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Verificar cache (30 min)
-	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
-		w.Header().Set("Content_Type", "application/json")
-		w.Header().Set("X-Cache", "HIT")
-		w.Write(cached)
+	if h.writeCached(w, r, cacheKey) {
 		return
 	}
 
-	// Obtener datos
-	data, err := h.datasetManager.GetFilteredData(r.Context(), uuid, params)
-	if err != nil {
-		log.Printf("Error obteniendo datos: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	// Serializar
-	response := map[string]interface{}{
-		"data":   data,
-		"total":  len(data),
-		"cached": false,
+	// Obtener datos, o solo el conteo
+	var response map[string]interface{}
+	if params.CountOnly {
+		count, err := h.datasetManager.EstimateFilteredRows(r.Context(), uuid, params)
+		if err != nil {
+			log.Printf("Error contando datos: %v", err)
+			writeDatasetError(w, err)
+			return
+		}
+		response = map[string]interface{}{
+			"count":       count.Count,
+			"approximate": count.Approximate,
+		}
+	} else {
+		// El total filtrado para la paginación solo se cuenta si hace falta
+		data, truncated, count, err := h.datasetManager.GetFilteredPage(r.Context(), uuid, params)
+		if err != nil {
+			log.Printf("Error obteniendo datos: %v", err)
+			writeDatasetError(w, err)
+			return
+		}
+
+		// Serializar
+		response = map[string]interface{}{
+			"data":                       data,
+			"total":                      len(data),
+			"truncated":                  truncated,
+			"total_filtered":             count.Count,
+			"total_filtered_approximate": count.Approximate,
+			"applied_limit":              params.Limit,
+			"cached":                     false,
+		}
 	}
 
 	jsonData, err := json.Marshal(response)
@@ -202,7 +433,7 @@ func (h *APIHandler) GetFilteredData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.cacheManager.SetToRedis(cacheKey, jsonData, 30*time.Minute)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Data)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
@@ -212,6 +443,12 @@ func (h *APIHandler) GetFilteredData(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *APIHandler) GetAggregatedData(w http.ResponseWriter, r *http.Request) {
+	// /api/aggregated/<uuid>/html responde la misma agregación como tabla HTML
+	if uuid, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/aggregated/"), "/html"); ok && uuid != "" {
+		h.getAggregatedHTML(w, r, uuid)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		return
@@ -219,7 +456,7 @@ func (h *APIHandler) GetAggregatedData(w http.ResponseWriter, r *http.Request) {
 
 	// Extraer el UUID
 	uuid := strings.TrimPrefix(r.URL.Path, "/api/aggregated/")
-	if uuid != "" {
+	if uuid == "" {
 		http.Error(w, "UUID requerido", http.StatusBadRequest)
 		return
 	}
@@ -230,6 +467,7 @@ func (h *APIHandler) GetAggregatedData(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "datos inválidos", http.StatusBadRequest)
 		return
 	}
+	params.Limit = h.datasetManager.ClampLimit(params.Limit, defaultDataLimit)
 
 	// Cache Key
 	cacheKey := h.cacheManager.GenerateKey("agg", map[string]interface{}{
@@ -238,25 +476,24 @@ func (h *APIHandler) GetAggregatedData(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Verificar cache (1 hora)
-	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
-		w.Header().Set("Content_Type", "application/json")
-		w.Header().Set("X-Cache", "HIT")
-		w.Write(cached)
+	if h.writeCached(w, r, cacheKey) {
 		return
 	}
 
 	// Obtener datos agregados
-	data, err := h.datasetManager.GetAggregatedData(r.Context(), uuid, params)
+	data, truncated, err := h.datasetManager.GetAggregatedData(r.Context(), uuid, params)
 	if err != nil {
 		log.Printf("Error obteniendo datos agregados: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDatasetError(w, err)
 		return
 	}
 
 	response := map[string]interface{}{
-		"data":   data,
-		"total":  len(data),
-		"cached": false,
+		"data":          data,
+		"total":         len(data),
+		"truncated":     truncated,
+		"applied_limit": params.Limit,
+		"cached":        false,
 	}
 
 	jsonData, err := json.Marshal(response)
@@ -266,7 +503,7 @@ func (h *APIHandler) GetAggregatedData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cachear (1 hora)
-	h.cacheManager.SetToRedis(cacheKey, jsonData, time.Hour)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
 
 	// Retornar
 	w.Header().Set("Content-Type", "application/json")
@@ -279,7 +516,7 @@ func (h *APIHandler) GetAggregatedData(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) GetMetadata(w http.ResponseWriter, r *http.Request) {
 	// Extraer el UUID
 	uuid := strings.TrimPrefix(r.URL.Path, "/api/metadata/")
-	if uuid != "" {
+	if uuid == "" {
 		http.Error(w, "UUID requerido", http.StatusBadRequest)
 		return
 	}
@@ -287,10 +524,7 @@ func (h *APIHandler) GetMetadata(w http.ResponseWriter, r *http.Request) {
 	cacheKey := "metadata:" + uuid
 
 	// verificar cache (24 horas)
-	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
-		w.Header().Set("Content-Type", "applicaction/json")
-		w.Header().Set("X-Cache", "HIT")
-		w.Write(cached)
+	if h.writeCached(w, r, cacheKey) {
 		return
 	}
 
@@ -309,7 +543,7 @@ func (h *APIHandler) GetMetadata(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cachear data
-	h.cacheManager.SetToRedis(cacheKey, data, 24*time.Hour)
+	h.cacheManager.SetToRedis(cacheKey, data, h.ttls.Metadata)
 
 	// Responder
 	w.Header().Set("Content-Type", "application/json")
@@ -317,6 +551,126 @@ func (h *APIHandler) GetMetadata(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+const (
+	// Máximo de UUIDs por petición batch
+	maxBatchMetadata = 100
+	// Llamadas simultáneas a CKAN en una petición batch
+	batchMetadataConcurrency = 5
+)
+
+// GetMetadataBatch retorna la metadata de varios recursos en una sola respuesta
+func (h *APIHandler) GetMetadataBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		UUIDs []string `json:"uuids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+	if len(body.UUIDs) == 0 {
+		http.Error(w, "UUIDs requeridos", http.StatusBadRequest)
+		return
+	}
+	if len(body.UUIDs) > maxBatchMetadata {
+		http.Error(w, fmt.Sprintf("máximo %d UUIDs por petición", maxBatchMetadata), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		resources = make(map[string]*ckan.Resource)
+		errs      = make(map[string]string)
+		sem       = make(chan struct{}, batchMetadataConcurrency)
+	)
+
+	seen := make(map[string]bool, len(body.UUIDs))
+	for _, uuid := range body.UUIDs {
+		if uuid == "" || seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+
+		wg.Add(1)
+		go func(uuid string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			resource, err := h.getResource(r.Context(), uuid)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Error obteniendo el metadata de %s: %v", uuid, err)
+				errs[uuid] = err.Error()
+				return
+			}
+			resources[uuid] = resource
+		}(uuid)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resources": resources,
+		"errors":    errs,
+	})
+}
+
+// getResource obtiene el recurso de CKAN, usando la metadata cacheada en Redis si existe
+func (h *APIHandler) getResource(ctx context.Context, uuid string) (*ckan.Resource, error) {
+	cacheKey := "metadata:" + uuid
+	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
+		var resource ckan.Resource
+		if err := json.Unmarshal(cached, &resource); err == nil {
+			return &resource, nil
+		}
+	}
+
+	resource, err := h.datasetManager.GetCKANCLient().GetResource(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	h.cacheManager.SetToRedis(cacheKey, resource, h.ttls.Metadata)
+	return resource, nil
+}
+
+// writeCached responde con la respuesta cacheada en Redis, si existe. Si está
+// comprimida y el cliente acepta gzip se envía tal cual con Content-Encoding,
+// sin descomprimir ni volver a comprimir en el middleware
+func (h *APIHandler) writeCached(w http.ResponseWriter, r *http.Request, cacheKey string) bool {
+	cached, gzipped, found := h.cacheManager.GetFromRedisEncoded(cacheKey)
+	if !found {
+		return false
+	}
+
+	if gzipped {
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Add("Vary", "Accept-Encoding")
+		} else {
+			data, err := cache.Decompress(cached)
+			if err != nil {
+				log.Printf("Warning: respuesta cacheada inválida en %s: %v", cacheKey, err)
+				return false
+			}
+			cached = data
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "HIT")
+	w.Write(cached)
+	return true
+}
+
 func (h *APIHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	//  Extraer el UUID
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/stats/"), "/")
@@ -328,6 +682,9 @@ func (h *APIHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	uuid := parts[0]
 	column := parts[1]
 
+	// Mediana y cuartiles aproximados
+	approx := r.URL.Query().Get("approx") == "true"
+
 	// Parse filtros
 	var filters map[string]interface{}
 	if r.Method == http.MethodPost {
@@ -339,27 +696,25 @@ func (h *APIHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		"uuid":    uuid,
 		"column":  column,
 		"filters": filters,
+		"approx":  approx,
 	})
 
 	// Verificar cache
-	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Cache", "HIT")
-		w.Write(cached)
+	if h.writeCached(w, r, cacheKey) {
 		return
 	}
 
 	// Obtener stats
-	stats, err := h.datasetManager.GetStats(r.Context(), uuid, column, filters)
+	stats, err := h.datasetManager.GetStats(r.Context(), uuid, column, filters, approx)
 	if err != nil {
 		log.Printf("erro obteniendo stats: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDatasetError(w, err)
 		return
 	}
 
 	// Serializar y cachear
 	jsonData, _ := json.Marshal(stats)
-	h.cacheManager.SetToRedis(cacheKey, jsonData, time.Hour)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
@@ -379,10 +734,16 @@ func (h *APIHandler) GetTopValues(w http.ResponseWriter, r *http.Request) {
 	column := parts[1]
 
 	// Limit desde query param
-	limit := 10
+	limit := 0
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		fmt.Sscanf(limitStr, "%d", &limit)
 	}
+	limit = h.datasetManager.ClampLimit(limit, defaultTopLimit)
+	// La respuesta es una lista, así que el limit aplicado va en un header
+	w.Header().Set("X-Applied-Limit", fmt.Sprint(limit))
+
+	// Contar los NULL como categoría
+	includeNulls := r.URL.Query().Get("include_nulls") == "true"
 
 	// Filtros
 	var filters map[string]interface{}
@@ -392,31 +753,1569 @@ func (h *APIHandler) GetTopValues(w http.ResponseWriter, r *http.Request) {
 
 	// CacheKey
 	cacheKey := h.cacheManager.GenerateKey("top", map[string]interface{}{
-		"uuid":    uuid,
-		"column":  column,
-		"limit":   limit,
-		"filters": filters,
+		"uuid":          uuid,
+		"column":        column,
+		"limit":         limit,
+		"filters":       filters,
+		"include_nulls": includeNulls,
 	})
 
 	// Verificar cache
-	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Cache", "HIT")
-		w.Write(cached)
+	if h.writeCached(w, r, cacheKey) {
 		return
 	}
 
 	// Obtener top values
-	data, err := h.datasetManager.GetTopValues(r.Context(), uuid, column, limit, filters)
+	data, err := h.datasetManager.GetTopValues(r.Context(), uuid, column, limit, filters, includeNulls)
 	if err != nil {
 		log.Printf("Error obteniendo top values: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDatasetError(w, err)
 		return
 	}
 
 	// Serializar y cachear
 	jsonData, _ := json.Marshal(data)
-	h.cacheManager.SetToRedis(cacheKey, jsonData, time.Hour)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetColumnSummary retorna estadísticas o valores más frecuentes de una
+// columna según su rol (numérica o no), con sus conteos de distintos y nulos
+func (h *APIHandler) GetColumnSummary(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/column/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "UUID y columna requeridos", http.StatusBadRequest)
+		return
+	}
+
+	uuid := parts[0]
+	column := parts[1]
+
+	// Limit de los valores más frecuentes
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	limit = h.datasetManager.ClampLimit(limit, defaultTopLimit)
+
+	cacheKey := h.cacheManager.GenerateKey("column", map[string]interface{}{
+		"uuid":   uuid,
+		"column": column,
+		"limit":  limit,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	summary, err := h.datasetManager.GetColumnSummary(r.Context(), uuid, column, limit)
+	if err != nil {
+		log.Printf("Error obteniendo resumen de columna: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(summary)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetTopN retorna el top-N de grupos por una métrica agregada con un
+// desempate reproducible; with_ties incluye los empatados en el último puesto
+func (h *APIHandler) GetTopN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/top-n/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.TopNParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+	params.N = h.datasetManager.ClampLimit(params.N, defaultTopLimit)
+	w.Header().Set("X-Applied-Limit", fmt.Sprint(params.N))
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("top-n", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, truncated, err := h.datasetManager.GetTopN(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo top-N: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"data":      data,
+		"total":     len(data),
+		"truncated": truncated,
+	})
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// Máximo de UUIDs por petición de precarga
+const maxPreloadUUIDs = 100
+
+// Preload encola la descarga de varios datasets para que estén en cache
+// antes de que los usuarios los pidan. Retorna el estado del job de cada UUID.
+func (h *APIHandler) Preload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		UUIDs []string `json:"uuids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+	if len(body.UUIDs) == 0 {
+		http.Error(w, "UUIDs requeridos", http.StatusBadRequest)
+		return
+	}
+	if len(body.UUIDs) > maxPreloadUUIDs {
+		http.Error(w, fmt.Sprintf("máximo %d UUIDs por petición", maxPreloadUUIDs), http.StatusBadRequest)
+		return
+	}
+
+	jobs := h.datasetManager.GetDownloadManager().Preload(body.UUIDs)
+	log.Printf("🔥 Precarga solicitada de %d datasets", len(jobs))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": jobs,
+	})
+}
+
+// Reindex recrea los índices de un dataset sobre las columnas realmente filtradas
+func (h *APIHandler) Reindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/reindex/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Columnas opcionales, si no vienen se usa el uso real de filtros
+	var body struct {
+		Columns []string `json:"columns"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "datos inválidos", http.StatusBadRequest)
+			return
+		}
+	}
+
+	indexes, err := h.datasetManager.Reindex(r.Context(), uuid, body.Columns)
+	if err != nil {
+		log.Printf("Error reindexando: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uuid":    uuid,
+		"indexes": indexes,
+	})
+}
+
+// writeDatasetError responde con el status HTTP que corresponde al error
+func writeDatasetError(w http.ResponseWriter, err error) {
+	// El error de DuckDB es largo y técnico, se responde uno que oriente al usuario
+	if dataset.IsOutOfMemory(err) {
+		http.Error(w, "La consulta excede la memoria disponible, agrega filtros o reduce las columnas solicitadas", http.StatusInsufficientStorage)
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, dataset.ErrInvalidParams):
+		status = http.StatusBadRequest
+	case errors.Is(err, dataset.ErrResultTooLarge):
+		status = http.StatusUnprocessableEntity
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// GetNarrative retorna un resumen ejecutivo en texto de un dataset
+func (h *APIHandler) GetNarrative(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/narrative/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	group := query.Get("group")
+	agg := query.Get("agg")
+
+	// Parse filtros: el resumen describe la vista filtrada
+	var filters map[string]interface{}
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&filters); err != nil {
+			http.Error(w, "datos inválidos", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("narrative", map[string]interface{}{
+		"uuid":    uuid,
+		"metric":  metric,
+		"group":   group,
+		"agg":     agg,
+		"filters": filters,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	narrative, err := h.datasetManager.GetNarrative(r.Context(), uuid, metric, agg, group, filters)
+	if err != nil {
+		log.Printf("Error generando resumen: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(narrative)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetPartitionSuggestion sugiere un esquema de partición temporal para un dataset
+func (h *APIHandler) GetPartitionSuggestion(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/partition-suggestion/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	column := r.URL.Query().Get("column")
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("partition", map[string]interface{}{
+		"uuid":   uuid,
+		"column": column,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	suggestion, err := h.datasetManager.GetPartitionSuggestion(r.Context(), uuid, column)
+	if err != nil {
+		log.Printf("Error sugiriendo partición: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(suggestion)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Metadata)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// SearchData busca un término en todas las columnas de texto de un dataset
+func (h *APIHandler) SearchData(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/search/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	term := r.URL.Query().Get("q")
+	if term == "" {
+		http.Error(w, "parámetro q requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Limit desde query param
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("search", map[string]interface{}{
+		"uuid":  uuid,
+		"q":     term,
+		"limit": limit,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, truncated, err := h.datasetManager.SearchData(r.Context(), uuid, term, limit)
+	if err != nil {
+		log.Printf("Error buscando: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":      data,
+		"total":     len(data),
+		"q":         term,
+		"truncated": truncated,
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(response)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Data)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetGeoAggregate retorna conteos por celda geográfica para mapas de densidad
+func (h *APIHandler) GetGeoAggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/geo-aggregate/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.GeoAggregateParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("geo", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetGeoAggregate(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error en agregación geográfica: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetTextLengthDistribution retorna el histograma de longitudes de texto de una columna
+func (h *APIHandler) GetTextLengthDistribution(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/text-length-dist/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "UUID y columna requeridos", http.StatusBadRequest)
+		return
+	}
+
+	uuid := parts[0]
+	column := parts[1]
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("textlen", map[string]interface{}{
+		"uuid":   uuid,
+		"column": column,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetTextLengthDistribution(r.Context(), uuid, column)
+	if err != nil {
+		log.Printf("Error obteniendo longitudes: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetPreview retorna columnas, tipos inferidos y filas de ejemplo leyendo solo
+// el inicio del CSV remoto, sin esperar la descarga completa
+func (h *APIHandler) GetPreview(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/preview/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	preview, err := h.schemaPreview(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error obteniendo preview: %v", err)
+		http.Error(w, fmt.Sprintf("Error obteniendo preview: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(preview)
+}
+
+// previewCacheKey es la key de Redis del preview remoto de un dataset
+func previewCacheKey(uuid string) string {
+	return "preview:" + uuid
+}
+
+// schemaPreview obtiene el preview remoto de un dataset, cacheado en Redis
+func (h *APIHandler) schemaPreview(ctx context.Context, uuid string) ([]byte, error) {
+	cacheKey := previewCacheKey(uuid)
+	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
+		return cached, nil
+	}
+
+	preview, err := h.datasetManager.GetRemotePreview(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(preview)
+	h.cacheManager.SetToRedis(cacheKey, data, h.ttls.Preview)
+	return data, nil
+}
+
+// warmSchemaPreview obtiene y cachea el preview remoto de un dataset sin
+// depender de un request. Si ya se está obteniendo no hace nada.
+func (h *APIHandler) warmSchemaPreview(uuid string) {
+	if _, running := h.previewsInFlight.LoadOrStore(uuid, struct{}{}); running {
+		return
+	}
+	defer h.previewsInFlight.Delete(uuid)
+
+	if _, err := h.schemaPreview(context.Background(), uuid); err != nil {
+		log.Printf("Warning: sin preview de %s: %v", uuid, err)
+	}
+}
+
+// GetHistogram retorna el histograma de bins de igual ancho de una columna numérica
+func (h *APIHandler) GetHistogram(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/histogram/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "UUID y columna requeridos", http.StatusBadRequest)
+		return
+	}
+
+	uuid := parts[0]
+	column := parts[1]
+
+	// Bins desde query param
+	bins := 0
+	if binsStr := r.URL.Query().Get("bins"); binsStr != "" {
+		fmt.Sscanf(binsStr, "%d", &bins)
+	}
+
+	// Filtros
+	var filters map[string]interface{}
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&filters)
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("histogram", map[string]interface{}{
+		"uuid":    uuid,
+		"column":  column,
+		"bins":    bins,
+		"filters": filters,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetHistogram(r.Context(), uuid, column, bins, filters)
+	if err != nil {
+		log.Printf("Error obteniendo histograma: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetRangeBuckets retorna el conteo por rangos con cortes arbitrarios
+func (h *APIHandler) GetRangeBuckets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/range-buckets/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "UUID y columna requeridos", http.StatusBadRequest)
+		return
+	}
+
+	uuid := parts[0]
+	column := parts[1]
+
+	// Parse request body
+	var params dataset.RangeBucketParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("range-buckets", map[string]interface{}{
+		"uuid":   uuid,
+		"column": column,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetRangeBuckets(r.Context(), uuid, column, params)
+	if err != nil {
+		log.Printf("Error obteniendo rangos: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetNullCounts retorna nulos, no nulos y fill_rate por columna
+func (h *APIHandler) GetNullCounts(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/nulls/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("nulls", map[string]interface{}{
+		"uuid": uuid,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetNullCounts(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error contando nulos: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetRowCountCheck compara las filas cargadas contra las esperadas (?expected=N
+// o los registros del CSV original) para detectar cargas parciales
+func (h *APIHandler) GetRowCountCheck(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/row-count/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	var expected int64
+	if value := r.URL.Query().Get("expected"); value != "" {
+		var n int64
+		if _, err := fmt.Sscanf(value, "%d", &n); err != nil || n <= 0 {
+			http.Error(w, "expected debe ser un entero positivo", http.StatusBadRequest)
+			return
+		}
+		expected = n
+	}
+
+	data, err := h.datasetManager.GetRowCountCheck(r.Context(), uuid, expected)
+	if err != nil {
+		log.Printf("Error verificando conteo de filas: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// GetCandidateKeys retorna las columnas únicas o casi únicas que podrían servir de clave
+func (h *APIHandler) GetCandidateKeys(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/candidate-keys/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("ckeys", map[string]interface{}{
+		"uuid": uuid,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetCandidateKeys(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error buscando columnas clave: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetSchema retorna las columnas del dataset con tipo, conteos y rol inferido
+func (h *APIHandler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/schema/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := "schema:" + uuid
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	schema, err := h.datasetManager.GetSchema(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error obteniendo esquema: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"uuid":    uuid,
+		"columns": schema,
+	})
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Metadata)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetWidthProfile retorna cuántas columnas tiene un dataset por tipo y el
+// tamaño promedio de fila, para elegir cómo visualizarlo
+func (h *APIHandler) GetWidthProfile(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/width-profile/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := "width-profile:" + uuid
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	profile, err := h.datasetManager.GetWidthProfile(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error obteniendo perfil de ancho: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(profile)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Metadata)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// CheckDomain cuenta los valores de una columna fuera de un conjunto válido
+func (h *APIHandler) CheckDomain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/domain-check/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "UUID y columna requeridos", http.StatusBadRequest)
+		return
+	}
+
+	uuid := parts[0]
+	column := parts[1]
+
+	var body struct {
+		Values []interface{} `json:"values"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("domain", map[string]interface{}{
+		"uuid":   uuid,
+		"column": column,
+		"values": body.Values,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.CheckDomain(r.Context(), uuid, column, body.Values)
+	if err != nil {
+		log.Printf("Error verificando dominio: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetPackage retorna un paquete de CKAN con la lista de sus recursos
+func (h *APIHandler) GetPackage(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/package/")
+	if id == "" {
+		http.Error(w, "ID de paquete requerido", http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := "package:" + id
+
+	// Verificar cache (1 hora)
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	pkg, err := h.datasetManager.GetCKANCLient().GetPackage(r.Context(), id)
+	if err != nil {
+		log.Printf("Error obteniendo paquete: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	data, err := json.Marshal(pkg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.cacheManager.SetToRedis(cacheKey, data, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(data)
+}
+
+const (
+	// Resultados por página en la búsqueda de datasets
+	datasetSearchPageSize = 20
+	maxDatasetSearchRows  = 100
+)
+
+// SearchDatasets busca paquetes en CKAN con paginación
+func (h *APIHandler) SearchDatasets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	page := 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		fmt.Sscanf(pageStr, "%d", &page)
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	rows := datasetSearchPageSize
+	if rowsStr := r.URL.Query().Get("rows"); rowsStr != "" {
+		fmt.Sscanf(rowsStr, "%d", &rows)
+	}
+	if rows < 1 || rows > maxDatasetSearchRows {
+		rows = datasetSearchPageSize
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("dsearch", map[string]interface{}{
+		"q":    query,
+		"page": page,
+		"rows": rows,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	result, err := h.datasetManager.GetCKANCLient().SearchPackages(r.Context(), query, (page-1)*rows, rows)
+	if err != nil {
+		log.Printf("Error buscando datasets: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	totalPages := (result.Count + rows - 1) / rows
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"results":     result.Results,
+		"count":       result.Count,
+		"page":        page,
+		"rows":        rows,
+		"total_pages": totalPages,
+	})
+
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Search)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetTimeSeries retorna una serie temporal agregada por día (o la granularidad
+// indicada), opcionalmente reducida a max_points. Con ?window=N agrega el
+// promedio móvil de N puntos (moving_avg)
+func (h *APIHandler) GetTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/timeseries/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		dataset.TimeSeriesParams
+		// agg_func es sinónimo de agg
+		AggFunc string `json:"agg_func"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+	params := body.TimeSeriesParams
+	if params.Agg == "" {
+		params.Agg = body.AggFunc
+	}
+	if params.DateColumn == "" {
+		http.Error(w, "date_column requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Ventana del promedio móvil desde query param
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		if _, err := fmt.Sscanf(windowStr, "%d", &params.Window); err != nil || params.Window <= 0 {
+			http.Error(w, "window debe ser un entero positivo", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("timeseries", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetTimeSeries(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo serie temporal: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetAnomalies retorna la serie temporal con su promedio móvil y los puntos
+// que se alejan más de threshold desviaciones estándar
+func (h *APIHandler) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/anomalies/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		dataset.AnomalyParams
+		// agg_func es sinónimo de agg
+		AggFunc string `json:"agg_func"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+	params := body.AnomalyParams
+	if params.Agg == "" {
+		params.Agg = body.AggFunc
+	}
+	if params.DateColumn == "" {
+		http.Error(w, "date_column requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("anomalies", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, truncated, err := h.datasetManager.GetAnomalies(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error detectando anomalías: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	anomalies := 0
+	for _, point := range data {
+		if flagged, _ := point["anomaly"].(bool); flagged {
+			anomalies++
+		}
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"data":      data,
+		"total":     len(data),
+		"anomalies": anomalies,
+		"truncated": truncated,
+	})
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// InvalidateCache borra un dataset de todos los niveles de cache (conexión,
+// memoria, disco y Redis). Con ?redownload=true lo vuelve a descargar.
+func (h *APIHandler) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/cache/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// all_varchar solo aplica a la re-descarga
+	redownload := r.URL.Query().Get("redownload") == "true"
+	if r.URL.Query().Has("all_varchar") && !redownload {
+		http.Error(w, "all_varchar requiere redownload=true", http.StatusBadRequest)
+		return
+	}
+
+	dm := h.datasetManager.GetDownloadManager()
+	deleted, err := dm.Invalidate(uuid)
+	if err != nil {
+		if errors.Is(err, dataset.ErrDownloadInProgress) {
+			http.Error(w, "El dataset se está descargando, intenta más tarde", http.StatusConflict)
+			return
+		}
+		log.Printf("Error invalidando cache de %s: %v", uuid, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"uuid":               uuid,
+		"status":             "invalidated",
+		"redis_keys_deleted": deleted,
+	}
+
+	// Re-descargar de inmediato; all_varchar=true recarga en modo seguro, todo como texto
+	if redownload {
+		job, err := dm.StartDownloadWithOptions(uuid, dataset.DownloadOptions{
+			AllVarchar: r.URL.Query().Get("all_varchar") == "true",
+		})
+		if err != nil {
+			// Otra petición ya re-descarga el dataset con otras opciones
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		response["status"] = job.Status
+		response["message"] = job.Message
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetNumberFormat reporta qué separador decimal y de miles parece usar una columna de texto
+func (h *APIHandler) GetNumberFormat(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/number-format/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "UUID y columna requeridos", http.StatusBadRequest)
+		return
+	}
+
+	uuid := parts[0]
+	column := parts[1]
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("numformat", map[string]interface{}{
+		"uuid":   uuid,
+		"column": column,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetNumberFormat(r.Context(), uuid, column)
+	if err != nil {
+		log.Printf("Error detectando formato numérico: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// Cada cuánto se envía un comentario para mantener viva la conexión SSE
+const sseHeartbeat = 15 * time.Second
+
+// StreamDownloadStatus envía el progreso de la descarga como Server-Sent Events
+// hasta que el job queda listo o falla
+func (h *APIHandler) StreamDownloadStatus(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/status-stream/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming no soportado", http.StatusInternalServerError)
+		return
+	}
+
+	dm := h.datasetManager.GetDownloadManager()
+
+	// Suscribirse antes de leer el estado para no perder cambios
+	updates, unsubscribe := dm.Subscribe(uuid)
+	defer unsubscribe()
+
+	job, exists := dm.GetJob(uuid)
+	if !exists {
+		_, inMemory := h.cacheManager.GetFromMemory(uuid)
+		_, onDisk := h.cacheManager.GetFromDisk(uuid)
+		if !inMemory && !onDisk {
+			http.Error(w, "No hay descarga para este dataset", http.StatusNotFound)
+			return
+		}
+		job = &dataset.DownloadJob{
+			UUID:     uuid,
+			Status:   dataset.StatusReady,
+			Progress: 100,
+			Message:  "Dataset listo para consultar",
+		}
+	}
+
+	// La descarga puede durar más que el WriteTimeout del servidor
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	last := *job
+	if err := writeSSEJob(w, job); err != nil {
+		return
+	}
+	flusher.Flush()
+	if isFinished(job) {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case update, open := <-updates:
+			if !open {
+				// El job terminó; si el evento final se perdió, enviarlo desde el estado actual
+				if !isFinished(&last) {
+					if final, ok := dm.GetJob(uuid); ok {
+						writeSSEJob(w, final)
+						flusher.Flush()
+					}
+				}
+				return
+			}
+
+			// Omitir actualizaciones sin cambio visible (el progreso llega por cada bloque leído)
+			if update.Status == last.Status && update.Message == last.Message && int(update.Progress) == int(last.Progress) {
+				continue
+			}
+			last = update
+
+			if err := writeSSEJob(w, &update); err != nil {
+				return
+			}
+			flusher.Flush()
+			if isFinished(&update) {
+				return
+			}
+		}
+	}
+}
+
+// writeSSEJob escribe el job como evento SSE; el nombre del evento es
+// "progress" mientras avanza y el estado final (ready/failed) al terminar
+func writeSSEJob(w http.ResponseWriter, job *dataset.DownloadJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	event := "progress"
+	if isFinished(job) {
+		event = string(job.Status)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+func isFinished(job *dataset.DownloadJob) bool {
+	return job.Status == dataset.StatusReady || job.Status == dataset.StatusFailed
+}
+
+// GetScatterSample retorna una muestra de pares (x, y) para graficar dispersión
+func (h *APIHandler) GetScatterSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/scatter/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.ScatterParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("scatter", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetScatterSample(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo muestra de dispersión: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetStratifiedSample retorna hasta N filas por cada valor de una columna
+// (POST /api/stratified-sample/<uuid>)
+func (h *APIHandler) GetStratifiedSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/stratified-sample/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	var params dataset.StratifiedSampleParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := h.cacheManager.GenerateKey("stratified-sample", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetStratifiedSample(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo muestra estratificada: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetNestedAggregation agrega en dos niveles (hijo y luego padre) en una sola petición
+func (h *APIHandler) GetNestedAggregation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/nested-aggregate/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.NestedAggregationParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("nested", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, truncated, err := h.datasetManager.GetNestedAggregation(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo agregación anidada: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"data":      data,
+		"total":     len(data),
+		"truncated": truncated,
+	})
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetCoverage retorna la matriz categoría × periodo con el conteo de filas,
+// para detectar huecos de reporte
+func (h *APIHandler) GetCoverage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/coverage/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.CoverageParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("coverage", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	result, err := h.datasetManager.GetCoverage(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo cobertura: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(result)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// PreviewClean previsualiza reglas de limpieza (trim, upper, replace...) sin
+// modificar el dataset: filas afectadas y un diff de ejemplo
+func (h *APIHandler) PreviewClean(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/preview-clean/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.CleanPreviewParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("preview-clean", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	preview, err := h.datasetManager.PreviewClean(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error previsualizando limpieza: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(preview)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// GetCrossTab retorna una tabla cruzada con una o varias métricas por celda, en
+// formato largo (default), como matriz ancha (?pivot=true) o anidada por fila
+// ("shape": "nested" en el body)
+func (h *APIHandler) GetCrossTab(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/crosstab/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.CrossTabParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// ?pivot=true pide la matriz ancha y ?pivot=false el formato largo
+	switch r.URL.Query().Get("pivot") {
+	case "true":
+		params.Shape = dataset.CrossTabWide
+	case "false":
+		params.Shape = dataset.CrossTabLong
+	}
+
+	// Cache Key
+	cacheKey := h.cacheManager.GenerateKey("crosstab", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetCrossTab(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo tabla cruzada: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
 	w.Write(jsonData)
@@ -0,0 +1,1297 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/dataset"
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+// Puerto cerrado para las pruebas que no descargan de CKAN
+const noCKAN = "http://127.0.0.1:1"
+
+// newTestHandler crea un APIHandler con Redis en memoria, el cache en un
+// directorio temporal y el CKAN indicado
+func newTestHandler(t *testing.T, ckanURL string, opts dataset.Options) *APIHandler {
+	t.Helper()
+	h, _ := newTestHandlerWithRedis(t, ckanURL, opts)
+	return h
+}
+
+// newTestHandlerWithRedis es newTestHandler y además retorna el Redis en
+// memoria, para revisar lo que quedó guardado
+func newTestHandlerWithRedis(t *testing.T, ckanURL string, opts dataset.Options) (*APIHandler, *testutil.Redis) {
+	t.Helper()
+	redis := testutil.NewRedis(t)
+	cm, err := cache.NewManager(redis.URL(), 1<<30, 10, 1<<30, t.TempDir())
+	if err != nil {
+		t.Fatalf("error creando cache: %v", err)
+	}
+	if opts.CKANMaxAttempts == 0 {
+		opts.CKANMaxAttempts = testutil.NoRetryAttempts
+	}
+	dm := dataset.NewManager(ckanURL, cm, opts)
+	t.Cleanup(func() {
+		// Detener las descargas en segundo plano antes de borrar el cache
+		dm.GetDownloadManager().Shutdown(context.Background())
+		dm.Close()
+		cm.Close()
+	})
+	return NewAPIHandler(dm, cm), redis
+}
+
+// writeDataset crea el dataset uuid en el cache en disco del handler
+func writeDataset(t *testing.T, h *APIHandler, uuid string, statements ...string) {
+	t.Helper()
+	testutil.WriteDataset(t, h.cacheManager.GetCacheDir(), uuid, statements...)
+}
+
+// serve ejecuta el handler con una petición; body vacío no envía cuerpo
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, target, reader))
+	return rec
+}
+
+// decodeJSON decodifica la respuesta; falla la prueba si el status no es 200
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, se esperaba 200: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("respuesta inválida: %v\n%s", err, rec.Body.String())
+	}
+}
+
+func TestInvalidateCacheTriggersFreshDownload(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n")})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	total := func() float64 {
+		t.Helper()
+		var resp map[string]interface{}
+		decodeJSON(t, serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{}`), &resp)
+		return resp["total"].(float64)
+	}
+
+	if got := total(); got != 1 {
+		t.Fatalf("total = %v, se esperaba 1", got)
+	}
+	if got := ckan.Downloads("ventas"); got != 1 {
+		t.Fatalf("descargas = %d, se esperaba 1", got)
+	}
+
+	// CKAN publica una versión nueva; sin invalidar se sigue sirviendo la cacheada
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+	if got := total(); got != 1 {
+		t.Fatalf("total antes de invalidar = %v, se esperaba 1", got)
+	}
+
+	var resp map[string]interface{}
+	decodeJSON(t, serve(h.InvalidateCache, http.MethodDelete, "/api/cache/ventas", ""), &resp)
+	if resp["status"] != "invalidated" {
+		t.Errorf("status = %v, se esperaba invalidated", resp["status"])
+	}
+	if deleted := resp["redis_keys_deleted"].(float64); deleted < 1 {
+		t.Errorf("redis_keys_deleted = %v, se esperaba al menos 1", deleted)
+	}
+
+	// La siguiente consulta descarga de nuevo y ve la versión nueva
+	if got := total(); got != 2 {
+		t.Errorf("total tras invalidar = %v, se esperaba 2", got)
+	}
+	if got := ckan.Downloads("ventas"); got != 2 {
+		t.Errorf("descargas = %d, se esperaban 2", got)
+	}
+}
+
+func TestInvalidateCacheRedownloadAllVarchar(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n")})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+	ctx := context.Background()
+	dm := h.datasetManager.GetDownloadManager()
+
+	// Primero la carga tipada
+	dm.StartDownload("ventas")
+	if job, done := dm.Wait(ctx, "ventas", 10*time.Second); !done || job.Status != dataset.StatusReady || job.AllVarchar {
+		t.Fatalf("job = %+v, se esperaba la carga tipada", job)
+	}
+
+	rec := serve(h.InvalidateCache, http.MethodDelete, "/api/cache/ventas?redownload=true&all_varchar=true", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	job, done := dm.Wait(ctx, "ventas", 10*time.Second)
+	if !done || job.Status != dataset.StatusReady || !job.AllVarchar {
+		t.Fatalf("job = %+v, se esperaba recargado en modo seguro", job)
+	}
+	schema, err := h.datasetManager.GetSchema(ctx, "ventas")
+	if err != nil {
+		t.Fatalf("GetSchema: %v", err)
+	}
+	for _, col := range schema {
+		if col.Type != "VARCHAR" {
+			t.Errorf("columna %s = %s, se esperaba VARCHAR", col.Name, col.Type)
+		}
+	}
+}
+
+func TestInvalidateCacheAllVarcharRequiresRedownload(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.InvalidateCache, http.MethodDelete, "/api/cache/ventas?all_varchar=true", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, se esperaba 400 sin redownload", rec.Code)
+	}
+	// Una petición rechazada no invalida nada
+	if _, onDisk := h.cacheManager.GetFromDisk("ventas"); !onDisk {
+		t.Error("el dataset no debería haberse borrado del cache")
+	}
+}
+
+func TestInvalidateCacheRejectsGet(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	if rec := serve(h.InvalidateCache, http.MethodGet, "/api/cache/ventas", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, se esperaba 405", rec.Code)
+	}
+}
+
+func TestFilteredDataTotalFiltered(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantRows  int
+		wantTotal float64
+	}{
+		{"primera página llena", `{"limit": 2}`, 2, 6},
+		{"página intermedia llena", `{"limit": 2, "offset": 2}`, 2, 6},
+		{"última página incompleta", `{"limit": 4, "offset": 4}`, 2, 6},
+		{"una sola página", `{"limit": 10}`, 6, 6},
+		{"offset fuera del total", `{"limit": 4, "offset": 20}`, 0, 6},
+		{"con filtros", `{"limit": 1, "filters": {"producto": "Pan"}}`, 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Data          []map[string]interface{} `json:"data"`
+				TotalFiltered float64                  `json:"total_filtered"`
+				Approximate   bool                     `json:"total_filtered_approximate"`
+			}
+			decodeJSON(t, serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", tt.body), &resp)
+			if len(resp.Data) != tt.wantRows {
+				t.Errorf("filas = %d, se esperaban %d", len(resp.Data), tt.wantRows)
+			}
+			if resp.TotalFiltered != tt.wantTotal || resp.Approximate {
+				t.Errorf("total_filtered = %v (aproximado %v), se esperaba %v exacto", resp.TotalFiltered, resp.Approximate, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestFilteredDataCountOnly(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var resp map[string]interface{}
+	decodeJSON(t, serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{"count_only": true, "filters": {"region": "Sur"}}`), &resp)
+	if resp["count"] != 2.0 || resp["approximate"] != false {
+		t.Errorf("respuesta = %v, se esperaba count 2 exacto", resp)
+	}
+	if _, ok := resp["data"]; ok {
+		t.Error("count_only no debería retornar data")
+	}
+}
+
+// ventasSQL crea un dataset chico con texto, números y fechas
+var ventasSQL = []string{
+	`CREATE TABLE data (region VARCHAR, producto VARCHAR, monto INTEGER, fecha DATE)`,
+	`INSERT INTO data VALUES
+		('Norte', 'Pan', 10, '2024-01-05'),
+		('Norte', 'Leche', 20, '2024-02-10'),
+		('Sur', 'Pan', 30, '2024-03-15'),
+		('Sur', 'Queso', 40, '2024-04-20'),
+		('Centro', NULL, 50, '2024-05-25'),
+		(NULL, 'Pan', 60, NULL)`,
+}
+
+func TestCancelDownloadWithoutJob(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	rec := serve(h.GetDownloadStatus, http.MethodDelete, "/api/status/ventas", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, se esperaba 404 sin descarga en curso", rec.Code)
+	}
+}
+
+func TestFiltersTTLGrowsWithDatasetSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		ttl  time.Duration
+	}{
+		{0, 6 * time.Hour},
+		{1 << 29, 18 * time.Hour},
+		{1 << 30, 30 * time.Hour},
+		// Con tope de 7 días
+		{1 << 40, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := DefaultFiltersTTLPolicy(tt.size); got != tt.ttl {
+			t.Errorf("DefaultFiltersTTLPolicy(%d) = %v, se esperaba %v", tt.size, got, tt.ttl)
+		}
+	}
+}
+
+func TestFiltersTTLOverrides(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	// Un TTL fijo configurado reemplaza la política por tamaño
+	h.SetCacheTTLs(CacheTTLs{Filters: time.Hour})
+	if got := h.filtersTTL(1 << 30); got != time.Hour {
+		t.Errorf("TTL fijo = %v, se esperaba 1h", got)
+	}
+
+	h.SetFiltersTTLPolicy(func(size int64) time.Duration { return time.Duration(size) * time.Second })
+	if got := h.filtersTTL(42); got != 42*time.Second {
+		t.Errorf("TTL con política propia = %v, se esperaba 42s", got)
+	}
+}
+
+func TestPreferWait(t *testing.T) {
+	tests := []struct {
+		prefer string
+		wait   time.Duration
+	}{
+		{"", 0},
+		{"wait=5", 5 * time.Second},
+		{"respond-async, wait=5", 0},
+		{"wait=0", 0},
+		{"wait=abc", 0},
+		{"wait=3600", maxPreferWait},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/filters/ventas", nil)
+		if tt.prefer != "" {
+			req.Header.Set("Prefer", tt.prefer)
+		}
+		if got := preferWait(req); got != tt.wait {
+			t.Errorf("Prefer %q: wait = %v, se esperaba %v", tt.prefer, got, tt.wait)
+		}
+	}
+}
+
+func TestGetFiltersPreferWait(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	// Con wait=N el handler espera la descarga y responde los filtros
+	req := httptest.NewRequest(http.MethodGet, "/api/filters/ventas", nil)
+	req.Header.Set("Prefer", "wait=10")
+	rec := httptest.NewRecorder()
+	h.GetFilters(rec, req)
+
+	var resp map[string]interface{}
+	decodeJSON(t, rec, &resp)
+	if _, ok := resp["filters"]; !ok {
+		t.Errorf("respuesta sin filtros: %v", resp)
+	}
+	if got := rec.Header().Get("Preference-Applied"); got != "wait=10" {
+		t.Errorf("Preference-Applied = %q, se esperaba wait=10", got)
+	}
+}
+
+func TestGetFiltersRespondAsync(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	hold := make(chan struct{})
+	t.Cleanup(func() { close(hold) })
+	// Más de 64 KB: el preview lee el inicio del CSV sin esperar el resto
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 8000)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	// Sin preferencia (o con respond-async) responde 202 de inmediato
+	for _, prefer := range []string{"", "respond-async"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/filters/ventas", nil)
+		if prefer != "" {
+			req.Header.Set("Prefer", prefer)
+		}
+		rec := httptest.NewRecorder()
+		h.GetFilters(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Prefer %q: status = %d, se esperaba 202", prefer, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "/api/status/ventas") {
+			t.Errorf("Prefer %q: falta check_status_at: %s", prefer, rec.Body.String())
+		}
+	}
+}
+
+func TestGetMetadataBatch(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	for _, uuid := range []string{"a", "b", "c"} {
+		ckan.SetResource(uuid, testutil.CKANResource{Name: "Recurso " + uuid, Format: "CSV"})
+	}
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	// a queda en el cache de metadata
+	var first struct {
+		Resources map[string]map[string]interface{} `json:"resources"`
+	}
+	decodeJSON(t, serve(h.GetMetadataBatch, http.MethodPost, "/api/metadata/batch", `{"uuids": ["a"]}`), &first)
+	if first.Resources["a"]["name"] != "Recurso a" {
+		t.Fatalf("recursos = %v", first.Resources)
+	}
+
+	var resp struct {
+		Resources map[string]map[string]interface{} `json:"resources"`
+		Errors    map[string]string                 `json:"errors"`
+	}
+	decodeJSON(t, serve(h.GetMetadataBatch, http.MethodPost, "/api/metadata/batch", `{"uuids": ["a", "b", "c", "b", "no_existe"]}`), &resp)
+
+	for _, uuid := range []string{"a", "b", "c"} {
+		if resp.Resources[uuid]["name"] != "Recurso "+uuid {
+			t.Errorf("recurso %s = %v", uuid, resp.Resources[uuid])
+		}
+	}
+	if _, ok := resp.Errors["no_existe"]; !ok || len(resp.Errors) != 1 {
+		t.Errorf("errores = %v, se esperaba solo no_existe", resp.Errors)
+	}
+	// a salió del cache y b, repetido, se pidió una vez
+	if got := ckan.Calls("resource_show"); got != 4 {
+		t.Errorf("llamadas a resource_show = %d, se esperaban 4", got)
+	}
+}
+
+func TestGetMetadataBatchValidation(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	tooMany := make([]string, maxBatchMetadata+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%q", fmt.Sprint(i))
+	}
+	for _, body := range []string{`{"uuids": []}`, `no es json`, `{"uuids": [` + strings.Join(tooMany, ",") + `]}`} {
+		if rec := serve(h.GetMetadataBatch, http.MethodPost, "/api/metadata/batch", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, se esperaba 400 para %.40s", rec.Code, body)
+		}
+	}
+	if rec := serve(h.GetMetadataBatch, http.MethodGet, "/api/metadata/batch", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, se esperaba 405", rec.Code)
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var result struct {
+		OutOfDomain      int64 `json:"out_of_domain"`
+		UnexpectedValues []struct {
+			Value string `json:"value"`
+			Count int64  `json:"count"`
+		} `json:"unexpected_values"`
+	}
+	rec := serve(h.CheckDomain, http.MethodPost, "/api/domain-check/ventas/producto", `{"values":["Pan","Leche"]}`)
+	decodeJSON(t, rec, &result)
+	if result.OutOfDomain != 1 || len(result.UnexpectedValues) != 1 || result.UnexpectedValues[0].Value != "Queso" {
+		t.Errorf("resultado = %+v, se esperaba solo Queso fuera de dominio", result)
+	}
+
+	for _, tc := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/api/domain-check/ventas/producto", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/domain-check/ventas", `{"values":["Pan"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/domain-check/ventas/producto", `{"values":[]}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/domain-check/ventas/producto", `no es json`, http.StatusBadRequest},
+	} {
+		if rec := serve(h.CheckDomain, tc.method, tc.target, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s %s: status = %d, se esperaba %d", tc.method, tc.target, tc.body, rec.Code, tc.want)
+		}
+	}
+}
+
+// packageShowCKAN responde package_show con el paquete "presupuesto"; para
+// cualquier otro id responde success=false con status 200, como algunas instancias
+func packageShowCKAN(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/3/action/package_show" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("id") != "presupuesto" {
+			fmt.Fprint(w, `{"success": false, "error": {"message": "Not found"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "result": {
+			"id": "pkg-1", "name": "presupuesto", "title": "Presupuesto 2024",
+			"resources": [
+				{"id": "res-csv", "name": "Egresos", "format": "CSV", "size": 2048},
+				{"id": "res-pdf", "name": "Metodología", "format": "PDF", "size": null}
+			]}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetPackage(t *testing.T) {
+	srv := packageShowCKAN(t)
+	h := newTestHandler(t, srv.URL+"/api/3/action", dataset.Options{})
+
+	var pkg struct {
+		Title     string `json:"title"`
+		Resources []struct {
+			ID     string `json:"id"`
+			Format string `json:"format"`
+			Size   int64  `json:"size"`
+		} `json:"resources"`
+	}
+	rec := serve(h.GetPackage, http.MethodGet, "/api/package/presupuesto", "")
+	decodeJSON(t, rec, &pkg)
+	if pkg.Title != "Presupuesto 2024" || len(pkg.Resources) != 2 {
+		t.Fatalf("paquete = %+v, se esperaba Presupuesto 2024 con 2 recursos", pkg)
+	}
+	if r := pkg.Resources[0]; r.ID != "res-csv" || r.Format != "CSV" || r.Size != 2048 {
+		t.Errorf("recurso = %+v, se esperaba res-csv en CSV de 2048 bytes", r)
+	}
+
+	// La segunda consulta sale del cache
+	if rec := serve(h.GetPackage, http.MethodGet, "/api/package/presupuesto", ""); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q, se esperaba HIT", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestGetPackageErrors(t *testing.T) {
+	srv := packageShowCKAN(t)
+	h := newTestHandler(t, srv.URL+"/api/3/action", dataset.Options{})
+
+	if rec := serve(h.GetPackage, http.MethodGet, "/api/package/no-existe", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("success=false: status = %d, se esperaba 502", rec.Code)
+	}
+	if rec := serve(h.GetPackage, http.MethodGet, "/api/package/", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("sin id: status = %d, se esperaba 400", rec.Code)
+	}
+}
+
+// packageSearchCKAN responde package_search con 45 paquetes para q=agua y
+// ninguno para cualquier otra búsqueda, respetando start y rows
+func packageSearchCKAN(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/3/action/package_search" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		total := 0
+		if q.Get("q") == "agua" {
+			total = 45
+		}
+		var start, rows int
+		fmt.Sscanf(q.Get("start"), "%d", &start)
+		fmt.Sscanf(q.Get("rows"), "%d", &rows)
+
+		results := []map[string]interface{}{}
+		for i := start; i < start+rows && i < total; i++ {
+			results = append(results, map[string]interface{}{"id": fmt.Sprintf("pkg-%d", i), "name": fmt.Sprintf("agua-%d", i)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  map[string]interface{}{"count": total, "results": results},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type datasetSearchPage struct {
+	Count      int `json:"count"`
+	Page       int `json:"page"`
+	TotalPages int `json:"total_pages"`
+	Results    []struct {
+		ID string `json:"id"`
+	} `json:"results"`
+}
+
+func TestSearchDatasetsPagination(t *testing.T) {
+	srv := packageSearchCKAN(t)
+	h := newTestHandler(t, srv.URL+"/api/3/action", dataset.Options{})
+
+	var first, last datasetSearchPage
+	decodeJSON(t, serve(h.SearchDatasets, http.MethodGet, "/api/datasets/search?q=agua", ""), &first)
+	if first.Count != 45 || first.TotalPages != 3 || len(first.Results) != 20 || first.Results[0].ID != "pkg-0" {
+		t.Errorf("página 1: count = %d, páginas = %d, %d resultados; se esperaban 45, 3 y 20 desde pkg-0",
+			first.Count, first.TotalPages, len(first.Results))
+	}
+
+	decodeJSON(t, serve(h.SearchDatasets, http.MethodGet, "/api/datasets/search?q=agua&page=3", ""), &last)
+	if last.Page != 3 || len(last.Results) != 5 || last.Results[0].ID != "pkg-40" {
+		t.Errorf("página 3 = %+v, se esperaban 5 resultados desde pkg-40", last)
+	}
+
+	// rows fuera de rango vuelve al tamaño de página por defecto
+	var page datasetSearchPage
+	decodeJSON(t, serve(h.SearchDatasets, http.MethodGet, "/api/datasets/search?q=agua&page=2&rows=500", ""), &page)
+	if len(page.Results) != 20 || page.Results[0].ID != "pkg-20" {
+		t.Errorf("rows=500: %d resultados, se esperaban 20 desde pkg-20", len(page.Results))
+	}
+}
+
+func TestSearchDatasetsEmpty(t *testing.T) {
+	srv := packageSearchCKAN(t)
+	h := newTestHandler(t, srv.URL+"/api/3/action", dataset.Options{})
+
+	var page datasetSearchPage
+	decodeJSON(t, serve(h.SearchDatasets, http.MethodGet, "/api/datasets/search?q=nada", ""), &page)
+	if page.Count != 0 || page.TotalPages != 0 || len(page.Results) != 0 {
+		t.Errorf("búsqueda vacía = %+v, se esperaban cero resultados", page)
+	}
+}
+
+func TestFilteredDataRejectsDeepFilters(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{MaxFilterConditions: 3})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	for _, body := range []string{
+		`{"filters": {"region": [[["Norte"]]]}}`,
+		`{"filters": {"region": ["Norte", "Sur", "Centro", "Este"]}}`,
+	} {
+		if rec := serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, se esperaba 400", body, rec.Code)
+		}
+	}
+}
+
+// readSSEEvents lee los nombres de evento del stream hasta que el servidor lo
+// cierra; onEvent se llama después de cada evento recibido
+func readSSEEvents(t *testing.T, body io.Reader, onEvent func(n int)) []string {
+	t.Helper()
+	var events []string
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			events = append(events, name)
+			onEvent(len(events))
+		}
+	}
+	return events
+}
+
+func TestStreamDownloadStatus(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	hold := make(chan struct{})
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 100)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+	h.datasetManager.GetDownloadManager().StartDownload("ventas")
+
+	srv := httptest.NewServer(http.HandlerFunc(h.StreamDownloadStatus))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/api/status-stream/ventas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, se esperaba text/event-stream", ct)
+	}
+
+	// Con el primer evento recibido se deja terminar la descarga
+	events := readSSEEvents(t, resp.Body, func(n int) {
+		if n == 1 {
+			close(hold)
+		}
+	})
+	if len(events) < 2 {
+		t.Fatalf("eventos = %v, se esperaban progreso y el final", events)
+	}
+	for i, event := range events {
+		want := "progress"
+		if i == len(events)-1 {
+			want = "ready"
+		}
+		if event != want {
+			t.Errorf("evento %d = %q, se esperaba %q (secuencia %v)", i, event, want, events)
+		}
+	}
+}
+
+func TestStreamDownloadStatusFinished(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	// Un dataset en cache responde un único evento ready y cierra
+	rec := serve(h.StreamDownloadStatus, http.MethodGet, "/api/status-stream/ventas", "")
+	events := readSSEEvents(t, rec.Body, func(int) {})
+	if len(events) != 1 || events[0] != "ready" {
+		t.Errorf("eventos = %v, se esperaba solo ready", events)
+	}
+
+	if rec := serve(h.StreamDownloadStatus, http.MethodGet, "/api/status-stream/otro", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("sin descarga: status = %d, se esperaba 404", rec.Code)
+	}
+}
+
+func TestWriteDatasetError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"memoria de DuckDB", fmt.Errorf("error ejecutando query: %w", fmt.Errorf("Out of Memory Error: could not allocate block of size 256.0 KiB (1.9 MiB/2.0 MiB used)")), http.StatusInsufficientStorage},
+		{"parámetros inválidos", fmt.Errorf("%w: columna inexistente", dataset.ErrInvalidParams), http.StatusBadRequest},
+		{"otro error", fmt.Errorf("disco lleno"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		writeDatasetError(rec, tc.err)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, se esperaba %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestAggregationOutOfMemory(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{MemoryLimitPerDataset: "2MB", ThreadsPerDataset: 1})
+	writeDataset(t, h, "grande",
+		`CREATE TABLE data AS SELECT 'clave-' || i as clave, i as monto FROM range(300000) t(i)`)
+
+	// Agrupar por una columna única no cabe en 2MB
+	rec := serve(h.GetAggregatedData, http.MethodPost, "/api/aggregated/grande",
+		`{"GroupBy":["clave"],"Agg":"sum","VarAgg":"monto","Limit":10}`)
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("status %d, se esperaba 507: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "agrega filtros") || strings.Contains(body, "Out of Memory") {
+		t.Errorf("respuesta = %q, se esperaba el mensaje que sugiere filtros", body)
+	}
+}
+
+func TestFilteredDataRejectsInvalidSort(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	for _, body := range []string{
+		`{"order_by": [{"column": "monto", "dir": "up"}]}`,
+		`{"order_by": [{"column": "monto\" DESC; DROP TABLE data; --"}]}`,
+	} {
+		if rec := serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, se esperaba 400", body, rec.Code)
+		}
+	}
+}
+
+func TestFilteredDataDistinct(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var resp struct {
+		Data          []map[string]interface{} `json:"data"`
+		TotalFiltered float64                  `json:"total_filtered"`
+	}
+	decodeJSON(t, serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{"distinct": true, "columns": ["region"], "limit": 2}`), &resp)
+	if len(resp.Data) != 2 || resp.TotalFiltered != 4 {
+		t.Errorf("%d filas, total_filtered %v; se esperaban 2 filas de 4 regiones distintas", len(resp.Data), resp.TotalFiltered)
+	}
+}
+
+func TestGetHistogram(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var resp struct {
+		Bins []dataset.HistogramBin `json:"bins"`
+	}
+	decodeJSON(t, serve(h.GetHistogram, http.MethodGet, "/api/histogram/ventas/monto?bins=5", ""), &resp)
+	if len(resp.Bins) != 5 || resp.Bins[0].BinStart != 10 || resp.Bins[4].BinEnd != 60 {
+		t.Errorf("bins = %+v, se esperaban 5 bins entre 10 y 60", resp.Bins)
+	}
+
+	if rec := serve(h.GetHistogram, http.MethodGet, "/api/histogram/ventas/region", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("columna de texto: status = %d, se esperaba 400", rec.Code)
+	}
+}
+
+func TestGetNarrativeFilters(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	// Solo las ventas de Norte: Pan 10 y Leche 20
+	var resp dataset.Narrative
+	decodeJSON(t, serve(h.GetNarrative, http.MethodPost, "/api/narrative/ventas?metric=monto&group=producto", `{"region": "Norte"}`), &resp)
+	if total := resp.Highlights["total"]; total != 30.0 {
+		t.Errorf("total = %v, se esperaba 30 (solo Norte)", total)
+	}
+	if groups := resp.Highlights["groups"]; groups != 2.0 {
+		t.Errorf("grupos = %v, se esperaban 2", groups)
+	}
+
+	rec := serve(h.GetNarrative, http.MethodPost, "/api/narrative/ventas?metric=monto&group=producto", `{"no_existe": "x"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("columna inexistente: status = %d, se esperaba 400", rec.Code)
+	}
+}
+
+func TestGetTimeSeriesWindow(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+	body := `{"date_column": "fecha", "value_column": "monto", "agg": "sum"}`
+
+	var series []map[string]interface{}
+	decodeJSON(t, serve(h.GetTimeSeries, http.MethodPost, "/api/timeseries/ventas?window=2", body), &series)
+	// Días con 10, 20, 30, 40 y 50 (más la fila sin fecha): el segundo promedia 10 y 20
+	if len(series) != 6 || series[1]["moving_avg"] != 15.0 {
+		t.Errorf("serie = %v, se esperaba moving_avg 15 en el segundo día", series)
+	}
+
+	for _, window := range []string{"0", "-1", "dos"} {
+		if rec := serve(h.GetTimeSeries, http.MethodPost, "/api/timeseries/ventas?window="+window, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("window=%s: status = %d, se esperaba 400", window, rec.Code)
+		}
+	}
+	if rec := serve(h.GetTimeSeries, http.MethodGet, "/api/timeseries/ventas", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, se esperaba 405", rec.Code)
+	}
+}
+
+func TestGetTimeSeriesGranularity(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "diario",
+		`CREATE TABLE data (fecha DATE, monto INTEGER)`,
+		`INSERT INTO data VALUES
+			('2024-01-01', 5), ('2024-01-01', 5), ('2024-01-15', 20),
+			('2024-02-03', 30), ('2024-02-20', 40)`)
+
+	tests := []struct {
+		granularity string
+		want        []float64
+	}{
+		{"day", []float64{10, 20, 30, 40}},
+		{"month", []float64{30, 70}},
+	}
+	for _, tc := range tests {
+		body := fmt.Sprintf(`{"date_column": "fecha", "value_column": "monto", "agg_func": "sum", "granularity": %q}`, tc.granularity)
+		var series []map[string]interface{}
+		decodeJSON(t, serve(h.GetTimeSeries, http.MethodPost, "/api/timeseries/diario", body), &series)
+		if len(series) != len(tc.want) {
+			t.Fatalf("%s: serie = %v, se esperaban %d puntos", tc.granularity, series, len(tc.want))
+		}
+		for i, point := range series {
+			if point["total"] != tc.want[i] {
+				t.Errorf("%s: punto %d = %v, se esperaba total %v", tc.granularity, i, point, tc.want[i])
+			}
+		}
+	}
+
+	// La misma petición se responde desde Redis
+	body := `{"date_column": "fecha", "value_column": "monto", "agg_func": "sum", "granularity": "month"}`
+	if rec := serve(h.GetTimeSeries, http.MethodPost, "/api/timeseries/diario", body); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q, se esperaba HIT", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestGetTimeSeriesValidation(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	for _, body := range []string{
+		`{"value_column": "monto", "agg": "sum"}`,
+		`{"date_column": "region", "value_column": "monto", "agg": "sum"}`,
+		`{"date_column": "fecha", "value_column": "monto", "agg": "sum", "granularity": "decade"}`,
+	} {
+		if rec := serve(h.GetTimeSeries, http.MethodPost, "/api/timeseries/ventas", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, se esperaba 400", body, rec.Code)
+		}
+	}
+	if rec := serve(h.GetTimeSeries, http.MethodGet, "/api/timeseries/ventas", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, se esperaba 405", rec.Code)
+	}
+}
+
+func TestGetCrossTabPivot(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+	body := `{"row": "region", "column": "producto"}`
+
+	var long struct {
+		Shape string                   `json:"shape"`
+		Rows  []map[string]interface{} `json:"rows"`
+	}
+	decodeJSON(t, serve(h.GetCrossTab, http.MethodPost, "/api/crosstab/ventas", body), &long)
+	if long.Shape != dataset.CrossTabLong || len(long.Rows) != 6 {
+		t.Errorf("largo = %+v, se esperaban 6 combinaciones en la forma default", long)
+	}
+
+	var wide struct {
+		Shape   string                   `json:"shape"`
+		Columns []string                 `json:"columns"`
+		Rows    []map[string]interface{} `json:"rows"`
+	}
+	decodeJSON(t, serve(h.GetCrossTab, http.MethodPost, "/api/crosstab/ventas?pivot=true", body), &wide)
+	if wide.Shape != dataset.CrossTabWide || len(wide.Rows) != 4 || len(wide.Columns) != 4 {
+		t.Errorf("ancho = %+v, se esperaban 4 regiones por 4 productos", wide)
+	}
+	for _, row := range wide.Rows {
+		if row["row_value"] == "Norte" && (row["Pan"] != 1.0 || row["Queso"] != nil) {
+			t.Errorf("fila Norte = %v, se esperaban Pan 1 y Queso null", row)
+		}
+	}
+
+	var nested struct {
+		Shape string `json:"shape"`
+		Rows  []struct {
+			RowValue interface{}                       `json:"row_value"`
+			Cells    map[string]map[string]interface{} `json:"cells"`
+		} `json:"rows"`
+	}
+	nestedBody := `{"row": "region", "column": "producto", "shape": "nested"}`
+	decodeJSON(t, serve(h.GetCrossTab, http.MethodPost, "/api/crosstab/ventas", nestedBody), &nested)
+	if nested.Shape != dataset.CrossTabNested || len(nested.Rows) != 4 {
+		t.Errorf("anidada = %+v, se esperaban 4 regiones", nested)
+	}
+	for _, row := range nested.Rows {
+		if row.RowValue == "Norte" && row.Cells["Pan"]["count"] != 1.0 {
+			t.Errorf("celdas Norte = %v, se esperaba count 1 en Pan", row.Cells)
+		}
+	}
+
+	if rec := serve(h.GetCrossTab, http.MethodPost, "/api/crosstab/ventas", `{"row": "region", "column": "producto", "shape": "diagonal"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("shape inválido: status = %d, se esperaba 400", rec.Code)
+	}
+}
+
+func TestGetCrossTabTooManyColumns(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ancho", `CREATE TABLE data AS SELECT i as id, i % 2 as par FROM range(600) t(i)`)
+
+	rec := serve(h.GetCrossTab, http.MethodPost, "/api/crosstab/ancho?pivot=true", `{"row": "par", "column": "id"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, se esperaba 400 por exceso de columnas", rec.Code)
+	}
+}
+
+func TestAppliedLimit(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{MaxResultLimit: 3})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		body    string
+		want    float64
+		rows    int
+	}{
+		{"data arriba del máximo", h.GetFilteredData, "/api/data/ventas", `{"limit": 100000000}`, 3, 3},
+		{"data debajo del máximo", h.GetFilteredData, "/api/data/ventas", `{"limit": 2}`, 2, 2},
+		{"agregación arriba del máximo", h.GetAggregatedData, "/api/aggregated/ventas", `{"GroupBy": ["producto"], "Agg": "count", "Limit": 50}`, 3, 3},
+	}
+	for _, tc := range tests {
+		var resp struct {
+			Data         []map[string]interface{} `json:"data"`
+			AppliedLimit float64                  `json:"applied_limit"`
+		}
+		decodeJSON(t, serve(tc.handler, http.MethodPost, tc.target, tc.body), &resp)
+		if resp.AppliedLimit != tc.want || len(resp.Data) != tc.rows {
+			t.Errorf("%s: applied_limit %v con %d filas, se esperaban %v y %d", tc.name, resp.AppliedLimit, len(resp.Data), tc.want, tc.rows)
+		}
+	}
+
+	rec := serve(h.GetTopValues, http.MethodGet, "/api/top/ventas/producto?limit=999", "")
+	var top []map[string]interface{}
+	decodeJSON(t, rec, &top)
+	if rec.Header().Get("X-Applied-Limit") != "3" || len(top) != 3 {
+		t.Errorf("top: X-Applied-Limit %q con %d valores, se esperaban 3", rec.Header().Get("X-Applied-Limit"), len(top))
+	}
+}
+
+func TestGetFiltersClientDisconnected(t *testing.T) {
+	h, redis := newTestHandlerWithRedis(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas",
+		`CREATE TABLE data (region VARCHAR, monto INTEGER)`,
+		`INSERT INTO data VALUES ('Norte', 10), ('Sur', 20)`,
+	)
+
+	// El cliente ya se fue: no se responde ni se cachea un resultado parcial
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	h.GetFilters(rec, httptest.NewRequest(http.MethodGet, "/api/filters/ventas", nil).WithContext(ctx))
+	if rec.Body.Len() != 0 {
+		t.Errorf("body = %q, no se esperaba respuesta", rec.Body.String())
+	}
+	if keys := redis.Keys(); len(keys) != 0 {
+		t.Errorf("keys = %v, no se esperaba nada en cache", keys)
+	}
+}
+
+func TestGetFiltersIncludesPreview(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	hold := make(chan struct{})
+	t.Cleanup(func() { close(hold) })
+	body := "region,monto\n" + strings.Repeat("Norte,10\n", 8000)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte(body), Hold: hold})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	// La primera respuesta no espera a CKAN por el preview; las siguientes lo
+	// incluyen una vez obtenido en segundo plano
+	var resp struct {
+		Preview *dataset.SchemaPreview `json:"preview"`
+	}
+	rec := serve(h.GetFilters, http.MethodGet, "/api/filters/ventas", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Preview != nil {
+		t.Fatalf("primera respuesta = %s, no se esperaba preview", rec.Body.String())
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for resp.Preview == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout esperando el preview")
+		}
+		rec := serve(h.GetFilters, http.MethodGet, "/api/filters/ventas", "")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, se esperaba 202", rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("respuesta inválida: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	columns := resp.Preview.Columns
+	if len(columns) != 2 || columns[0] != (dataset.PreviewColumn{Name: "region", Type: "VARCHAR"}) || columns[1] != (dataset.PreviewColumn{Name: "monto", Type: "BIGINT"}) {
+		t.Errorf("preview = %+v, se esperaban region VARCHAR y monto BIGINT", resp.Preview)
+	}
+	if !resp.Preview.Partial {
+		t.Error("se esperaba un preview parcial del CSV")
+	}
+}
+
+func TestGetPreviewCached(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n")})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(h.GetPreview, http.MethodGet, "/api/preview/ventas", ""); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, se esperaba 200", rec.Code)
+		}
+	}
+	if calls := ckan.Calls("resource_show"); calls != 1 {
+		t.Errorf("%d llamadas a resource_show, la segunda debería salir de Redis", calls)
+	}
+
+	if rec := serve(h.GetPreview, http.MethodGet, "/api/preview/no-existe", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("recurso inexistente: status = %d, se esperaba 502", rec.Code)
+	}
+}
+
+func TestGetStatsApprox(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	// Exacto y aproximado se cachean por separado
+	for _, approx := range []bool{true, false} {
+		var stats map[string]interface{}
+		target := fmt.Sprintf("/api/stats/ventas/monto?approx=%t", approx)
+		decodeJSON(t, serve(h.GetStats, http.MethodGet, target, ""), &stats)
+		if stats["approximate"] != approx {
+			t.Errorf("approx=%t: approximate = %v", approx, stats["approximate"])
+		}
+	}
+}
+
+func TestWriteCachedCompressed(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	body := []byte(`[` + strings.Repeat(`{"region": "Norte"},`, 200) + `{}]`)
+	h.cacheManager.SetToRedis("respuesta", body, time.Minute)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !h.writeCached(w, r, "respuesta") {
+			t.Error("writeCached no encontró la respuesta")
+		}
+	}
+
+	// Con gzip aceptado se envían los bytes de Redis sin descomprimir
+	req := httptest.NewRequest(http.MethodGet, "/api/filters/x", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	raw, _, _ := h.cacheManager.GetFromRedisEncoded("respuesta")
+	if rec.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(rec.Body.Bytes(), raw) {
+		t.Errorf("Content-Encoding = %q, se esperaba el valor comprimido tal cual", rec.Header().Get("Content-Encoding"))
+	}
+
+	// Sin gzip se descomprime
+	rec = serve(handler, http.MethodGet, "/api/filters/x", "")
+	if rec.Header().Get("Content-Encoding") != "" || !bytes.Equal(rec.Body.Bytes(), body) {
+		t.Errorf("Content-Encoding = %q, se esperaba el JSON sin comprimir", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q, se esperaba HIT", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheTTLsPerEndpoint(t *testing.T) {
+	h, redis := newTestHandlerWithRedis(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+	h.SetCacheTTLs(CacheTTLs{Filters: 5 * time.Hour, Metadata: 2 * time.Hour, Data: 3 * time.Minute, Agg: 4 * time.Minute})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		prefix  string
+		ttl     time.Duration
+	}{
+		{"filtros", h.GetFilters, http.MethodGet, "/api/filters/ventas", "", "filters:", 5 * time.Hour},
+		{"datos", h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{"filters": {}}`, "data:", 3 * time.Minute},
+		{"agregación", h.GetAggregatedData, http.MethodPost, "/api/aggregated/ventas", `{"group_by": ["region"], "agg": "count"}`, "agg:", 4 * time.Minute},
+		{"stats", h.GetStats, http.MethodGet, "/api/stats/ventas/monto", "", "stats:", 4 * time.Minute},
+		{"esquema", h.GetSchema, http.MethodGet, "/api/schema/ventas", "", "schema:", 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.handler, tt.method, tt.target, tt.body); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			found := false
+			for _, key := range redis.Keys() {
+				if !strings.HasPrefix(key, tt.prefix) {
+					continue
+				}
+				found = true
+				// TTL reporta lo que queda, unos instantes menos que lo configurado
+				if got := redis.TTL(key); got > tt.ttl || got < tt.ttl-5*time.Second {
+					t.Errorf("TTL de %s = %v, se esperaba %v", key, got, tt.ttl)
+				}
+			}
+			if !found {
+				t.Errorf("no se cacheó ninguna key %s*: %v", tt.prefix, redis.Keys())
+			}
+		})
+	}
+}
+
+func TestSetCacheTTLsKeepsDefaults(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	h.SetCacheTTLs(CacheTTLs{Data: time.Minute})
+
+	want := DefaultCacheTTLs()
+	want.Data = time.Minute
+	if h.ttls != want {
+		t.Errorf("ttls = %+v, se esperaba %+v", h.ttls, want)
+	}
+	// Sin TTL fijo de filtros se conserva la política por tamaño
+	if got := h.filtersTTL(1 << 30); got != DefaultFiltersTTLPolicy(1<<30) {
+		t.Errorf("TTL de filtros = %v, se esperaba la política por tamaño", got)
+	}
+}
+
+func TestPreviewCacheTTL(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\n")})
+	h, redis := newTestHandlerWithRedis(t, ckan.URL(), dataset.Options{})
+	h.SetCacheTTLs(CacheTTLs{Preview: 7 * time.Minute})
+
+	if rec := serve(h.GetPreview, http.MethodGet, "/api/preview/ventas", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := redis.TTL("preview:ventas"); got > 7*time.Minute || got < 7*time.Minute-5*time.Second {
+		t.Errorf("TTL de preview:ventas = %v, se esperaban 7m", got)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	for _, uuid := range []string{"a", "b"} {
+		ckan.SetResource(uuid, testutil.CKANResource{Format: "CSV", Body: []byte("region,monto\nNorte,10\nSur,20\n")})
+	}
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.Preload, http.MethodPost, "/api/preload", `{"uuids": ["a", "b", "a", "ventas"]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, se esperaba 202: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Jobs map[string]dataset.DownloadJob `json:"jobs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("respuesta inválida: %v", err)
+	}
+	if len(resp.Jobs) != 3 || resp.Jobs["ventas"].Status != dataset.StatusReady {
+		t.Errorf("jobs = %+v, se esperaban 3 con ventas ya lista", resp.Jobs)
+	}
+
+	dm := h.datasetManager.GetDownloadManager()
+	for _, uuid := range []string{"a", "b"} {
+		if job, done := dm.Wait(context.Background(), uuid, 10*time.Second); !done || job.Status != dataset.StatusReady {
+			t.Fatalf("job %s = %+v, se esperaba listo", uuid, job)
+		}
+	}
+
+	// Los filtros ya no esperan descarga y la segunda petición sale de Redis
+	for i, want := range []string{"MISS", "HIT"} {
+		rec := serve(h.GetFilters, http.MethodGet, "/api/filters/a", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != want {
+			t.Errorf("petición %d: status %d, X-Cache %q; se esperaba 200 y %s", i+1, rec.Code, rec.Header().Get("X-Cache"), want)
+		}
+	}
+	if ckan.Downloads("a") != 1 || ckan.Downloads("b") != 1 || ckan.Downloads("ventas") != 0 {
+		t.Errorf("descargas a=%d b=%d ventas=%d, se esperaba una por dataset no cacheado",
+			ckan.Downloads("a"), ckan.Downloads("b"), ckan.Downloads("ventas"))
+	}
+}
+
+func TestPreloadValidation(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"GET", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"JSON inválido", http.MethodPost, `{`, http.StatusBadRequest},
+		{"sin UUIDs", http.MethodPost, `{"uuids": []}`, http.StatusBadRequest},
+		{"demasiados UUIDs", http.MethodPost, `{"uuids": [` + strings.TrimSuffix(strings.Repeat(`"x",`, maxPreloadUUIDs+1), ",") + `]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(h.Preload, tt.method, "/api/preload", tt.body); rec.Code != tt.status {
+			t.Errorf("%s: status = %d, se esperaba %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestResultRowsCapResponse(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{MaxResultRows: 3, TruncateResults: true})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var resp struct {
+		Data      []map[string]interface{} `json:"data"`
+		Total     int                      `json:"total"`
+		Truncated bool                     `json:"truncated"`
+	}
+	decodeJSON(t, serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{"limit": 100}`), &resp)
+	if len(resp.Data) != 3 || resp.Total != 3 || !resp.Truncated {
+		t.Errorf("respuesta = %+v, se esperaban 3 filas marcadas como truncated", resp)
+	}
+
+	resp.Truncated = false
+	decodeJSON(t, serve(h.GetAggregatedData, http.MethodPost, "/api/aggregated/ventas", `{"GroupBy": ["region"], "Agg": "count"}`), &resp)
+	if !resp.Truncated {
+		t.Errorf("agregación = %+v, se esperaba truncated", resp)
+	}
+
+	decodeJSON(t, serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{"limit": 2}`), &resp)
+	if len(resp.Data) != 2 || resp.Truncated {
+		t.Errorf("respuesta = %+v, no se esperaba corte", resp)
+	}
+
+	decodeJSON(t, serve(h.SearchData, http.MethodGet, "/api/search/ventas?q=e", ""), &resp)
+	if len(resp.Data) != 3 || !resp.Truncated {
+		t.Errorf("búsqueda = %+v, se esperaban 3 coincidencias marcadas como truncated", resp)
+	}
+
+	var preview dataset.CleanPreview
+	decodeJSON(t, serve(h.PreviewClean, http.MethodPost, "/api/preview-clean/ventas", `{"rules": [{"column": "region", "op": "upper"}]}`), &preview)
+	if len(preview.Sample) != 3 || !preview.Truncated {
+		t.Errorf("preview de limpieza = %+v, se esperaba un diff de 3 filas marcado como truncated", preview)
+	}
+}
+
+func TestResultRowsCapError(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{MaxResultRows: 3})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.GetFilteredData, http.MethodPost, "/api/data/ventas", `{"limit": 100}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, se esperaba 422: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "agrega filtros") {
+		t.Errorf("respuesta = %q, se esperaba el mensaje que sugiere filtros", rec.Body.String())
+	}
+}
+
+func TestGetWidthProfile(t *testing.T) {
+	h, redis := newTestHandlerWithRedis(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var profile dataset.WidthProfile
+	rec := serve(h.GetWidthProfile, http.MethodGet, "/api/width-profile/ventas", "")
+	decodeJSON(t, rec, &profile)
+	if profile.Columns != 4 || profile.Rows != 6 || profile.AvgRowBytes <= 0 {
+		t.Errorf("perfil = %+v, se esperaban 4 columnas y 6 filas", profile)
+	}
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("X-Cache = %q, se esperaba MISS", rec.Header().Get("X-Cache"))
+	}
+	if _, found := redis.Get("width-profile:ventas"); !found {
+		t.Error("el perfil no se guardó en Redis")
+	}
+	if rec := serve(h.GetWidthProfile, http.MethodGet, "/api/width-profile/ventas", ""); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q, se esperaba HIT", rec.Header().Get("X-Cache"))
+	}
+
+	if rec := serve(h.GetWidthProfile, http.MethodGet, "/api/width-profile/", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("sin uuid: status = %d, se esperaba 400", rec.Code)
+	}
+}
+
+func TestGetColumnSummary(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	var numeric map[string]interface{}
+	decodeJSON(t, serve(h.GetColumnSummary, http.MethodGet, "/api/column/ventas/monto", ""), &numeric)
+	if numeric["role"] != dataset.RoleNumeric || numeric["stats"] == nil || numeric["top_values"] != nil {
+		t.Errorf("monto = %v, se esperaban estadísticas", numeric)
+	}
+	if numeric["distinct_count"] != float64(6) || numeric["null_count"] != float64(0) {
+		t.Errorf("monto = %v, se esperaban 6 distintos y 0 nulos", numeric)
+	}
+
+	var categorical map[string]interface{}
+	decodeJSON(t, serve(h.GetColumnSummary, http.MethodGet, "/api/column/ventas/region?limit=2", ""), &categorical)
+	top, _ := categorical["top_values"].([]interface{})
+	if categorical["role"] != dataset.RoleCategorical || categorical["stats"] != nil || len(top) != 2 {
+		t.Errorf("region = %v, se esperaban 2 valores frecuentes", categorical)
+	}
+	if categorical["null_count"] != float64(1) {
+		t.Errorf("region = %v, se esperaba 1 nulo", categorical)
+	}
+
+	for _, target := range []string{"/api/column/ventas", "/api/column/ventas/", "/api/column/ventas/precio"} {
+		if rec := serve(h.GetColumnSummary, http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, se esperaba 400", target, rec.Code)
+		}
+	}
+}
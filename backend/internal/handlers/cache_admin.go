@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Máximo de keys de Redis que se listan por petición
+const maxListedRedisKeys = 1000
+
+// CacheCapacity consulta (GET) o ajusta en caliente (PUT) cuántos datasets
+// se mantienen en memoria. Al reducirla se desalojan los menos usados.
+//
+//	GET /api/admin/cache-capacity
+//	PUT /api/admin/cache-capacity {"capacity": 5}
+func (h *APIHandler) CacheCapacity(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.cacheManager.MemoryStats())
+
+	case http.MethodPut:
+		var body struct {
+			Capacity int `json:"capacity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Capacity <= 0 {
+			http.Error(w, "capacity debe ser un entero positivo", http.StatusBadRequest)
+			return
+		}
+
+		evicted := h.cacheManager.SetMemoryCapacity(body.Capacity)
+		if evicted == nil {
+			evicted = []string{}
+		}
+		log.Printf("⚙️ Capacidad del cache en memoria: %d datasets", body.Capacity)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"memory":  h.cacheManager.MemoryStats(),
+			"evicted": evicted,
+		})
+
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	}
+}
+
+// CacheStats reporta qué hay en cada nivel de cache, para dimensionar
+// MemoryCacheGB y DiskCacheGB: datasets y bytes en memoria y en disco, y
+// keys de Redis por prefijo. Si Redis no responde se reporta el error.
+//
+//	GET /api/cache/stats
+func (h *APIHandler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	disk, err := h.cacheManager.DiskStats()
+	if err != nil {
+		log.Printf("Error recorriendo el cache en disco: %v", err)
+		http.Error(w, "Error leyendo el cache en disco", http.StatusInternalServerError)
+		return
+	}
+
+	redisStats := map[string]interface{}{}
+	if keys, err := h.cacheManager.RedisKeyCounts(r.Context()); err != nil {
+		log.Printf("Warning: no se pudieron contar las keys de Redis: %v", err)
+		redisStats["error"] = err.Error()
+	} else {
+		total := 0
+		for _, n := range keys {
+			total += n
+		}
+		redisStats["keys"] = keys
+		redisStats["total"] = total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"memory": h.cacheManager.MemoryStats(),
+		"disk":   disk,
+		"redis":  redisStats,
+	})
+}
+
+// RedisKeys lista (GET) o borra (DELETE) las respuestas cacheadas en Redis
+// cuyas keys empiezan con prefix, para depurar resultados obsoletos.
+//
+//	GET    /api/cache/redis?prefix=data:
+//	DELETE /api/cache/redis?prefix=data:
+func (h *APIHandler) RedisKeys(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, truncated, err := h.cacheManager.ListKeys(r.Context(), prefix, maxListedRedisKeys)
+		if err != nil {
+			log.Printf("Error listando keys de Redis: %v", err)
+			http.Error(w, "Error consultando Redis", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"prefix":    prefix,
+			"keys":      keys,
+			"truncated": truncated,
+		})
+
+	case http.MethodDelete:
+		// Sin prefijo se borraría todo Redis, incluidas las programaciones
+		if prefix == "" {
+			http.Error(w, "prefix requerido", http.StatusBadRequest)
+			return
+		}
+		deleted, err := h.cacheManager.PurgeByPrefix(prefix)
+		if err != nil {
+			log.Printf("Error purgando keys %q de Redis: %v", prefix, err)
+			http.Error(w, "Error purgando Redis", http.StatusBadGateway)
+			return
+		}
+		log.Printf("🧹 %d keys de Redis con prefijo %q purgadas", deleted, prefix)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"prefix":  prefix,
+			"deleted": deleted,
+		})
+
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/dataset"
+)
+
+func TestCacheCapacity(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	for _, uuid := range []string{"a", "b", "c"} {
+		h.cacheManager.SetToMemory(uuid, uuid+".duckdb")
+	}
+
+	var stats struct {
+		Capacity int `json:"capacity"`
+		Datasets int `json:"datasets"`
+	}
+	decodeJSON(t, serve(h.CacheCapacity, http.MethodGet, "/api/admin/cache-capacity", ""), &stats)
+	if stats.Capacity != 10 || stats.Datasets != 3 {
+		t.Errorf("stats = %+v, se esperaba capacidad 10 con 3 datasets", stats)
+	}
+
+	var resp struct {
+		Memory struct {
+			Capacity int `json:"capacity"`
+			Datasets int `json:"datasets"`
+		} `json:"memory"`
+		Evicted []string `json:"evicted"`
+	}
+	decodeJSON(t, serve(h.CacheCapacity, http.MethodPut, "/api/admin/cache-capacity", `{"capacity": 1}`), &resp)
+	if resp.Memory.Capacity != 1 || resp.Memory.Datasets != 1 {
+		t.Errorf("memory = %+v, se esperaba capacidad 1 con 1 dataset", resp.Memory)
+	}
+	if len(resp.Evicted) != 2 || resp.Evicted[0] != "a" || resp.Evicted[1] != "b" {
+		t.Errorf("evicted = %v, se esperaban a y b", resp.Evicted)
+	}
+	if _, ok := h.cacheManager.GetFromMemory("c"); !ok {
+		t.Error("c, el más reciente, debería seguir en memoria")
+	}
+}
+
+func TestCacheCapacityValidation(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	for _, body := range []string{`{"capacity": 0}`, `{"capacity": -3}`, `no es json`} {
+		if rec := serve(h.CacheCapacity, http.MethodPut, "/api/admin/cache-capacity", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, se esperaba 400", body, rec.Code)
+		}
+	}
+	if rec := serve(h.CacheCapacity, http.MethodDelete, "/api/admin/cache-capacity", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: status = %d, se esperaba 405", rec.Code)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+	writeDataset(t, h, "otro", ventasSQL...)
+	h.cacheManager.SetToMemory("ventas", filepath.Join(h.cacheManager.GetCacheDir(), "ventas.duckdb"))
+	h.cacheManager.SetToRedis("filters:ventas", "x", time.Minute)
+	h.cacheManager.SetToRedis("agg:ventas:1", "x", time.Minute)
+
+	var stats struct {
+		Memory cache.MemoryStats `json:"memory"`
+		Disk   cache.DiskStats   `json:"disk"`
+		Redis  struct {
+			Keys  map[string]int `json:"keys"`
+			Total int            `json:"total"`
+		} `json:"redis"`
+	}
+	decodeJSON(t, serve(h.CacheStats, http.MethodGet, "/api/cache/stats", ""), &stats)
+
+	if stats.Memory.Datasets != 1 || stats.Memory.Capacity != 10 {
+		t.Errorf("memory = %+v, se esperaba 1 dataset con capacidad 10", stats.Memory)
+	}
+	if stats.Disk.Datasets != 2 || stats.Disk.SizeBytes <= 0 {
+		t.Errorf("disk = %+v, se esperaban 2 datasets con su tamaño", stats.Disk)
+	}
+	if stats.Redis.Keys["filters"] != 1 || stats.Redis.Keys["agg"] != 1 || stats.Redis.Total != 2 {
+		t.Errorf("redis = %+v, se esperaban filters 1 y agg 1", stats.Redis)
+	}
+
+	if rec := serve(h.CacheStats, http.MethodPost, "/api/cache/stats", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, se esperaba 405", rec.Code)
+	}
+}
+
+func TestRedisKeys(t *testing.T) {
+	h, redis := newTestHandlerWithRedis(t, noCKAN, dataset.Options{})
+	for _, key := range []string{"data:ventas:1", "data:ventas:2", "agg:ventas:1", "schedule:ventas"} {
+		redis.Set(key, "x")
+	}
+
+	var list struct {
+		Prefix    string   `json:"prefix"`
+		Keys      []string `json:"keys"`
+		Truncated bool     `json:"truncated"`
+	}
+	decodeJSON(t, serve(h.RedisKeys, http.MethodGet, "/api/cache/redis?prefix=data:", ""), &list)
+	if list.Prefix != "data:" || len(list.Keys) != 2 || list.Keys[0] != "data:ventas:1" || list.Truncated {
+		t.Errorf("respuesta = %+v, se esperaban las 2 keys de data:", list)
+	}
+
+	var purge struct {
+		Prefix  string `json:"prefix"`
+		Deleted int    `json:"deleted"`
+	}
+	decodeJSON(t, serve(h.RedisKeys, http.MethodDelete, "/api/cache/redis?prefix=data:", ""), &purge)
+	if purge.Deleted != 2 {
+		t.Errorf("deleted = %d, se esperaban 2", purge.Deleted)
+	}
+	remaining := redis.Keys()
+	sort.Strings(remaining)
+	if strings.Join(remaining, ",") != "agg:ventas:1,schedule:ventas" {
+		t.Errorf("keys restantes = %v, solo se debían borrar las de data:", remaining)
+	}
+
+	// Sin prefijo no se borra nada
+	if rec := serve(h.RedisKeys, http.MethodDelete, "/api/cache/redis", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("DELETE sin prefix: status = %d, se esperaba 400", rec.Code)
+	}
+	if len(redis.Keys()) != 2 {
+		t.Errorf("keys = %v, DELETE sin prefix borró keys", redis.Keys())
+	}
+	if rec := serve(h.RedisKeys, http.MethodPost, "/api/cache/redis?prefix=data:", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, se esperaba 405", rec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// CSVSkip consulta, configura o elimina las líneas de preámbulo (títulos,
+// notas) que se saltan antes del encabezado del CSV de un dataset. Sin valor
+// configurado el preámbulo se detecta automáticamente al cargar el CSV.
+//
+//	GET    /api/csv-skip/<uuid>  consulta
+//	PUT    /api/csv-skip/<uuid>  {"skip": 2} configura y recarga el dataset
+//	DELETE /api/csv-skip/<uuid>  vuelve a la detección automática
+func (h *APIHandler) CSVSkip(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/csv-skip/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		skip, ok := h.datasetManager.CSVSkip(uuid)
+		if !ok {
+			http.Error(w, "No hay preámbulo configurado para este dataset", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"uuid": uuid,
+			"skip": skip,
+		})
+
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Skip *int `json:"skip"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Skip == nil {
+			http.Error(w, "datos inválidos", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.datasetManager.SetCSVSkip(uuid, *body.Skip); err != nil {
+			log.Printf("Error configurando preámbulo: %v", err)
+			writeDatasetError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"uuid": uuid,
+			"skip": *body.Skip,
+		})
+
+	case http.MethodDelete:
+		if !h.datasetManager.RemoveCSVSkip(uuid) {
+			http.Error(w, "No hay preámbulo configurado para este dataset", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/dataset"
+)
+
+func TestCSVSkip(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	if rec := serve(h.CSVSkip, http.MethodGet, "/api/csv-skip/ventas", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("sin configurar: status = %d, se esperaba 404", rec.Code)
+	}
+
+	var resp struct {
+		Skip int `json:"skip"`
+	}
+	decodeJSON(t, serve(h.CSVSkip, http.MethodPut, "/api/csv-skip/ventas", `{"skip": 2}`), &resp)
+	decodeJSON(t, serve(h.CSVSkip, http.MethodGet, "/api/csv-skip/ventas", ""), &resp)
+	if resp.Skip != 2 {
+		t.Errorf("skip = %d, se esperaba 2", resp.Skip)
+	}
+
+	if rec := serve(h.CSVSkip, http.MethodDelete, "/api/csv-skip/ventas", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status = %d, se esperaba 204", rec.Code)
+	}
+	if rec := serve(h.CSVSkip, http.MethodDelete, "/api/csv-skip/ventas", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("segundo DELETE: status = %d, se esperaba 404", rec.Code)
+	}
+}
+
+func TestCSVSkipValidation(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"sin UUID", http.MethodGet, "/api/csv-skip/", "", http.StatusBadRequest},
+		{"sin skip", http.MethodPut, "/api/csv-skip/ventas", `{}`, http.StatusBadRequest},
+		{"skip negativo", http.MethodPut, "/api/csv-skip/ventas", `{"skip": -1}`, http.StatusBadRequest},
+		{"método", http.MethodPatch, "/api/csv-skip/ventas", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if rec := serve(h.CSVSkip, tt.method, tt.target, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: status = %d, se esperaba %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
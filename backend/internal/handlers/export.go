@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"visor-datos-abiertos-go/internal/dataset"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Cada cuántas filas se hace flush del writer durante el streaming
+const exportFlushEvery = 1000
+
+// ExportData exporta los datos filtrados como CSV (o TSV) en streaming
+func (h *APIHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extraer el UUID
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/export/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Formato de salida
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+	}
+
+	var delimiter rune
+	var contentType string
+	switch format {
+	case "csv":
+		delimiter = ','
+		contentType = "text/csv; charset=utf-8"
+	case "tsv":
+		delimiter = '\t'
+		contentType = "text/tab-separated-values; charset=utf-8"
+	default:
+		http.Error(w, "formato inválido (csv|tsv)", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.FilterParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.datasetManager.QueryFilteredRows(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error exportando datos: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", contentDisposition(h.exportFilename(r.Context(), uuid, format)))
+
+	count, err := writeCSVRows(w, rows, columns, delimiter)
+	if err != nil {
+		log.Printf("Error exportando %s: %v", uuid, err)
+		return
+	}
+	log.Printf("📄 Exportadas %d filas de %s (%s)", count, uuid, format)
+}
+
+// ExportCustom exporta como CSV solo las columnas pedidas, con encabezados personalizados
+func (h *APIHandler) ExportCustom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extraer el UUID
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/export-custom/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body, columns conserva el orden de salida
+	var body struct {
+		Columns []struct {
+			Column string `json:"column"`
+			Header string `json:"header"`
+		} `json:"columns"`
+		Filters map[string]interface{} `json:"filters"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	columns := make([]string, len(body.Columns))
+	headers := make([]string, len(body.Columns))
+	for i, c := range body.Columns {
+		columns[i] = c.Column
+		headers[i] = c.Header
+		if headers[i] == "" {
+			headers[i] = c.Column
+		}
+	}
+
+	rows, err := h.datasetManager.QueryColumnsRows(r.Context(), uuid, columns, dataset.FilterParams{Filters: body.Filters})
+	if err != nil {
+		log.Printf("Error exportando datos: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", contentDisposition(h.exportFilename(r.Context(), uuid, "csv")))
+
+	count, err := writeCSVRows(w, rows, headers, ',')
+	if err != nil {
+		log.Printf("Error exportando %s: %v", uuid, err)
+		return
+	}
+	log.Printf("📄 Exportadas %d filas de %s (custom)", count, uuid)
+}
+
+// writeCSVRows escribe el encabezado y las filas en streaming, haciendo flush periódicamente
+func writeCSVRows(w http.ResponseWriter, rows *sql.Rows, header []string, delimiter rune) (int, error) {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+
+	// Encabezados
+	if err := writer.Write(header); err != nil {
+		return 0, err
+	}
+
+	values := make([]interface{}, len(header))
+	pointers := make([]interface{}, len(header))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(header))
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		for i, val := range values {
+			record[i] = formatExportValue(val)
+		}
+		if err := writer.Write(record); err != nil {
+			return count, err
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			writer.Flush()
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, writer.Error()
+}
+
+// formatExportValue convierte un valor escaneado de DuckDB a texto
+func formatExportValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ExportAggregated exporta el resultado de una agregación como XLSX
+func (h *APIHandler) ExportAggregated(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extraer el UUID
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/export-agg/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.AggregationParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.datasetManager.QueryAggregatedRows(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error exportando agregación: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Datos"
+	f.SetSheetName("Sheet1", sheet)
+
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Encabezados
+	for i, col := range columns {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheet, cell, col)
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	rowNum := 2
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i, val := range values {
+			cell, _ := excelize.CoordinatesToCellName(i+1, rowNum)
+			cellValue := xlsxValue(val)
+			f.SetCellValue(sheet, cell, cellValue)
+			if _, ok := cellValue.(time.Time); ok {
+				f.SetCellStyle(sheet, cell, cell, dateStyle)
+			}
+		}
+		rowNum++
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterando filas: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", contentDisposition(h.exportFilename(r.Context(), uuid, "xlsx")))
+
+	if err := f.Write(w); err != nil {
+		log.Printf("Error escribiendo XLSX: %v", err)
+		return
+	}
+	log.Printf("📊 Exportadas %d filas agregadas de %s (xlsx)", rowNum-2, uuid)
+}
+
+// xlsxValue convierte un valor de DuckDB a un tipo que excelize escribe como celda tipada
+func xlsxValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return string(v)
+	case *big.Int:
+		// SUM sobre enteros retorna HUGEINT
+		if v.IsInt64() {
+			return v.Int64()
+		}
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case interface{ Float64() float64 }:
+		// DECIMAL
+		return v.Float64()
+	default:
+		return v
+	}
+}
+
+// exportFilename genera el nombre del archivo a partir del nombre del recurso
+// en CKAN (metadata cacheada) y la fecha de exportación, p.ej.
+// Poblacion_2020_2024-05-01.csv. Sin nombre se usa el UUID
+func (h *APIHandler) exportFilename(ctx context.Context, uuid, ext string) string {
+	name := uuid
+	if resource, err := h.getResource(ctx, uuid); err == nil {
+		// Muchos recursos se llaman como el archivo original ("datos.csv")
+		base := resource.Name
+		switch strings.ToLower(path.Ext(base)) {
+		case ".csv", ".tsv", ".xls", ".xlsx", ".zip":
+			base = strings.TrimSuffix(base, path.Ext(base))
+		}
+		if safe := sanitizeFilename(base); safe != "" {
+			name = safe
+		}
+	}
+	return fmt.Sprintf("%s_%s.%s", name, time.Now().Format("2006-01-02"), ext)
+}
+
+// contentDisposition arma el header de descarga para un nombre ya saneado
+func contentDisposition(filename string) string {
+	return fmt.Sprintf(`attachment; filename="%s"`, filename)
+}
+
+// Quitar acentos antes de sanear, para no perder las letras
+var accentFolder = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U", "Ñ", "N",
+)
+
+// Longitud máxima del nombre saneado, sin fecha ni extensión
+const maxFilenameLength = 100
+
+// sanitizeFilename deja solo caracteres seguros para un nombre de archivo
+func sanitizeFilename(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, accentFolder.Replace(strings.TrimSpace(name)))
+
+	// Colapsar separadores repetidos ("a  (b)" -> "a_b")
+	for strings.Contains(safe, "__") {
+		safe = strings.ReplaceAll(safe, "__", "_")
+	}
+	if len(safe) > maxFilenameLength {
+		safe = safe[:maxFilenameLength]
+	}
+	return strings.Trim(safe, "_.")
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"visor-datos-abiertos-go/internal/dataset"
+	"visor-datos-abiertos-go/internal/testutil"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// readCSV parsea la respuesta de una exportación con el delimitador indicado
+func readCSV(t *testing.T, body string, delimiter rune) [][]string {
+	t.Helper()
+	reader := csv.NewReader(strings.NewReader(body))
+	reader.Comma = delimiter
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("CSV inválido: %v\n%s", err, body)
+	}
+	return records
+}
+
+func TestExportDataFormats(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	tests := []struct {
+		format      string
+		delimiter   rune
+		contentType string
+	}{
+		{"", ',', "text/csv; charset=utf-8"},
+		{"csv", ',', "text/csv; charset=utf-8"},
+		{"tsv", '\t', "text/tab-separated-values; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run("format="+tt.format, func(t *testing.T) {
+			rec := serve(h.ExportData, http.MethodPost, "/api/export/ventas?format="+tt.format, `{"filters": {"region": "Norte"}}`)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, se esperaba %q", got, tt.contentType)
+			}
+
+			records := readCSV(t, rec.Body.String(), tt.delimiter)
+			if want := []string{"region", "producto", "monto", "fecha"}; strings.Join(records[0], "|") != strings.Join(want, "|") {
+				t.Errorf("encabezado = %v, se esperaba %v", records[0], want)
+			}
+			// Encabezado más las dos filas de Norte
+			if len(records) != 3 {
+				t.Fatalf("%d registros, se esperaban 3: %v", len(records), records)
+			}
+			for _, record := range records[1:] {
+				if record[0] != "Norte" {
+					t.Errorf("fila fuera del filtro: %v", record)
+				}
+			}
+		})
+	}
+}
+
+func TestExportDataErrors(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"formato inválido", http.MethodPost, "/api/export/ventas?format=xml", `{}`, http.StatusBadRequest},
+		{"GET", http.MethodGet, "/api/export/ventas", "", http.StatusMethodNotAllowed},
+		{"sin UUID", http.MethodPost, "/api/export/", `{}`, http.StatusBadRequest},
+		{"columna inexistente", http.MethodPost, "/api/export/ventas", `{"filters": {"nada": "x"}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(h.ExportData, tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("status = %d, se esperaba %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportAggregatedXLSX(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.ExportAggregated, http.MethodPost, "/api/export-agg/ventas",
+		`{"GroupBy": ["region"], "Agg": "sum", "VarAgg": "monto"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	f, err := excelize.OpenReader(rec.Body)
+	if err != nil {
+		t.Fatalf("XLSX inválido: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Datos")
+	if err != nil {
+		t.Fatalf("GetRows: %v", err)
+	}
+	want := [][]string{{"region", "total"}, {"Centro", "50"}, {"Norte", "30"}, {"Sur", "70"}, {"", "60"}}
+	if len(rows) != len(want) {
+		t.Fatalf("filas = %v, se esperaban %v", rows, want)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("fila %d = %v, se esperaba %v", i, rows[i], want[i])
+		}
+	}
+
+	// Los totales se escriben como números, no como texto
+	if cellType, _ := f.GetCellType("Datos", "B2"); cellType == excelize.CellTypeSharedString || cellType == excelize.CellTypeInlineString {
+		t.Errorf("B2 es texto, se esperaba un número")
+	}
+}
+
+func TestExportAggregatedExcludeNulls(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.ExportAggregated, http.MethodPost, "/api/export-agg/ventas",
+		`{"GroupBy": ["region"], "Agg": "sum", "VarAgg": "monto", "ExcludeNulls": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	f, err := excelize.OpenReader(rec.Body)
+	if err != nil {
+		t.Fatalf("XLSX inválido: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Datos")
+	if err != nil {
+		t.Fatalf("GetRows: %v", err)
+	}
+	// Sin el grupo de región NULL
+	want := [][]string{{"region", "total"}, {"Centro", "50"}, {"Norte", "30"}, {"Sur", "70"}}
+	if len(rows) != len(want) {
+		t.Fatalf("filas = %v, se esperaban %v", rows, want)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("fila %d = %v, se esperaba %v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestExportCustomHeaders(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.ExportCustom, http.MethodPost, "/api/export-custom/ventas", `{
+		"columns": [{"column": "monto", "header": "Monto (MXN)"}, {"column": "region", "header": "Región"}, {"column": "producto"}],
+		"filters": {"region": "Sur"}
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	records := readCSV(t, rec.Body.String(), ',')
+	want := [][]string{{"Monto (MXN)", "Región", "producto"}, {"30", "Sur", "Pan"}, {"40", "Sur", "Queso"}}
+	if len(records) != len(want) {
+		t.Fatalf("registros = %v, se esperaban %v", records, want)
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("registro %d = %v, se esperaba %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestExportCustomRejectsUnknownColumns(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	for _, body := range []string{
+		`{"columns": [{"column": "no_existe", "header": "X"}]}`,
+		`{"columns": []}`,
+	} {
+		if rec := serve(h.ExportCustom, http.MethodPost, "/api/export-custom/ventas", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, se esperaba 400", body, rec.Code)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Población 2020", "Poblacion_2020"},
+		{"  Año (preliminar) / ñandú ", "Ano_preliminar_nandu"},
+		{"../../etc/passwd", "etc_passwd"},
+		{`datos "con" comillas`, "datos_con_comillas"},
+		{"???", ""},
+		{strings.Repeat("a", 150), strings.Repeat("a", maxFilenameLength)},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q, se esperaba %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("censo", testutil.CKANResource{Name: "Censo Población.csv", Format: "CSV"})
+	ckan.SetResource("sin-nombre", testutil.CKANResource{Name: "***", Format: "CSV"})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+	ctx := context.Background()
+	today := time.Now().Format("2006-01-02")
+
+	// La extensión del nombre original se reemplaza por la del export
+	if got, want := h.exportFilename(ctx, "censo", "xlsx"), "Censo_Poblacion_"+today+".xlsx"; got != want {
+		t.Errorf("nombre = %q, se esperaba %q", got, want)
+	}
+	// Sin nombre utilizable, o sin metadata, se usa el UUID
+	if got, want := h.exportFilename(ctx, "sin-nombre", "csv"), "sin-nombre_"+today+".csv"; got != want {
+		t.Errorf("nombre = %q, se esperaba %q", got, want)
+	}
+	if got, want := h.exportFilename(ctx, "no-existe", "csv"), "no-existe_"+today+".csv"; got != want {
+		t.Errorf("nombre = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestExportDataContentDisposition(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Name: "Ventas Año 2024", Format: "CSV"})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+	writeDataset(t, h, "ventas", ventasSQL...)
+
+	rec := serve(h.ExportData, http.MethodPost, "/api/export/ventas?format=tsv", `{}`)
+	want := `attachment; filename="Ventas_Ano_2024_` + time.Now().Format("2006-01-02") + `.tsv"`
+	if got := rec.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("Content-Disposition = %q, se esperaba %q", got, want)
+	}
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
 	"time"
+	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/dataset"
 )
 
 type HealthHandler struct{}
@@ -24,3 +28,126 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(response)
 }
+
+// ReadinessHandler reporta si la instancia puede atender peticiones: Redis
+// responde y se puede escribir en el directorio de cache. Las conexiones DuckDB abiertas
+// se reportan como informativas. Responde 503 si falla una dependencia crítica
+type ReadinessHandler struct {
+	datasetManager *dataset.Manager
+	cacheManager   *cache.Manager
+}
+
+func NewReadinessHandler(dm *dataset.Manager, cm *cache.Manager) *ReadinessHandler {
+	return &ReadinessHandler{
+		datasetManager: dm,
+		cacheManager:   cm,
+	}
+}
+
+func (h *ReadinessHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	results, failing := runChecks(r.Context(), healthChecks{
+		"redis": h.cacheManager.Ping,
+		"cache_dir": func(context.Context) error {
+			return h.cacheManager.CheckDisk()
+		},
+	})
+	results["duckdb"] = map[string]interface{}{
+		"status":           "ok",
+		"open_connections": h.datasetManager.OpenConnections(),
+	}
+	writeHealth(w, results, failing)
+}
+
+// Tiempo máximo de cada verificación del health check profundo
+const deepCheckTimeout = 5 * time.Second
+
+// DeepHealthHandler verifica Redis, el disco de cache y, opcionalmente,
+// que DuckDB responda sobre un dataset de prueba precargado
+type DeepHealthHandler struct {
+	datasetManager *dataset.Manager
+	cacheManager   *cache.Manager
+	testUUID       string
+}
+
+func NewDeepHealthHandler(dm *dataset.Manager, cm *cache.Manager, testUUID string) *DeepHealthHandler {
+	return &DeepHealthHandler{
+		datasetManager: dm,
+		cacheManager:   cm,
+		testUUID:       testUUID,
+	}
+}
+
+func (h *DeepHealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	checks := healthChecks{
+		"redis": h.cacheManager.Ping,
+		"disk": func(context.Context) error {
+			return h.cacheManager.CheckDisk()
+		},
+	}
+	if h.testUUID != "" {
+		checks["duckdb"] = func(ctx context.Context) error {
+			return h.datasetManager.PingDataset(ctx, h.testUUID)
+		}
+	}
+
+	results, failing := runChecks(r.Context(), checks)
+	if h.testUUID == "" {
+		results["duckdb"] = map[string]interface{}{"status": "skipped"}
+	}
+	writeHealth(w, results, failing)
+}
+
+// healthChecks son las verificaciones de un health check, por nombre
+type healthChecks map[string]func(context.Context) error
+
+// runChecks ejecuta cada verificación con runCheck y retorna los resultados
+// por nombre y los nombres de las que fallaron, ordenados
+func runChecks(ctx context.Context, checks healthChecks) (map[string]interface{}, []string) {
+	results := make(map[string]interface{}, len(checks))
+	failing := []string{}
+	for name, check := range checks {
+		result := runCheck(ctx, check)
+		if result["status"] == "error" {
+			failing = append(failing, name)
+		}
+		results[name] = result
+	}
+	sort.Strings(failing)
+	return results, failing
+}
+
+// writeHealth responde el resultado de un health check, con 503 si falló
+// alguna verificación
+func writeHealth(w http.ResponseWriter, results map[string]interface{}, failing []string) {
+	status := "ok"
+	w.Header().Set("Content-Type", "application/json")
+	if len(failing) > 0 {
+		status = "error"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"checks":    results,
+		"failing":   failing,
+	})
+}
+
+// runCheck ejecuta una verificación con timeout y reporta su estado y latencia
+func runCheck(ctx context.Context, check func(context.Context) error) map[string]interface{} {
+	ctx, cancel := context.WithTimeout(ctx, deepCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := map[string]interface{}{
+		"status":     "ok",
+		"latency_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result["status"] = "error"
+		result["error"] = err.Error()
+	}
+	return result
+}
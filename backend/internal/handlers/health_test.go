@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/dataset"
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+// healthResponse es la forma común de las respuestas de health
+type healthResponse struct {
+	Status string                            `json:"status"`
+	Checks map[string]map[string]interface{} `json:"checks"`
+}
+
+func TestDeepHealth(t *testing.T) {
+	api := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, api, "ventas", ventasSQL...)
+
+	h := NewDeepHealthHandler(api.datasetManager, api.cacheManager, "ventas")
+	var resp healthResponse
+	decodeJSON(t, serve(h.Health, http.MethodGet, "/api/health/deep", ""), &resp)
+	if resp.Status != "ok" {
+		t.Errorf("status = %q, se esperaba ok: %v", resp.Status, resp.Checks)
+	}
+	for _, name := range []string{"redis", "disk", "duckdb"} {
+		if resp.Checks[name]["status"] != "ok" {
+			t.Errorf("check %s = %v, se esperaba ok", name, resp.Checks[name])
+		}
+	}
+}
+
+func TestDeepHealthSkipsDuckDBWithoutUUID(t *testing.T) {
+	api := newTestHandler(t, noCKAN, dataset.Options{})
+
+	h := NewDeepHealthHandler(api.datasetManager, api.cacheManager, "")
+	var resp healthResponse
+	decodeJSON(t, serve(h.Health, http.MethodGet, "/api/health/deep", ""), &resp)
+	if resp.Checks["duckdb"]["status"] != "skipped" {
+		t.Errorf("check duckdb = %v, se esperaba skipped", resp.Checks["duckdb"])
+	}
+}
+
+func TestDeepHealthFailsWithoutCachedDataset(t *testing.T) {
+	api := newTestHandler(t, noCKAN, dataset.Options{})
+
+	// El dataset de prueba no está en cache y el check no debe descargarlo
+	h := NewDeepHealthHandler(api.datasetManager, api.cacheManager, "ventas")
+	rec := serve(h.Health, http.MethodGet, "/api/health/deep", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, se esperaba 503: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// newReadinessHandler crea el handler de readiness con su propio Redis y
+// directorio de cache, para que la prueba pueda tirarlos
+func newReadinessHandler(t *testing.T) (*ReadinessHandler, *testutil.Redis, string) {
+	t.Helper()
+	redis := testutil.NewRedis(t)
+	dir := t.TempDir()
+	cm, err := cache.NewManager(redis.URL(), 1<<30, 10, 1<<30, dir)
+	if err != nil {
+		t.Fatalf("error creando cache: %v", err)
+	}
+	dm := dataset.NewManager(noCKAN, cm, dataset.Options{CKANMaxAttempts: testutil.NoRetryAttempts})
+	t.Cleanup(func() {
+		dm.GetDownloadManager().Shutdown(context.Background())
+		dm.Close()
+		cm.Close()
+	})
+	return NewReadinessHandler(dm, cm), redis, dir
+}
+
+// readyResponse es la respuesta de /api/ready
+type readyResponse struct {
+	healthResponse
+	Failing []string `json:"failing"`
+}
+
+func TestReady(t *testing.T) {
+	h, _, dir := newReadinessHandler(t)
+	testutil.WriteDataset(t, dir, "ventas", ventasSQL...)
+	if _, err := h.datasetManager.GetConnection(context.Background(), "ventas"); err != nil {
+		t.Fatalf("GetConnection: %v", err)
+	}
+
+	var resp readyResponse
+	decodeJSON(t, serve(h.Ready, http.MethodGet, "/api/ready", ""), &resp)
+	if resp.Status != "ok" || len(resp.Failing) != 0 {
+		t.Errorf("respuesta = %+v, se esperaba ok sin fallas", resp)
+	}
+	if resp.Checks["duckdb"]["open_connections"] != float64(1) {
+		t.Errorf("duckdb = %v, se esperaba 1 conexión abierta", resp.Checks["duckdb"])
+	}
+}
+
+func TestReadyRedisDown(t *testing.T) {
+	h, redis, _ := newReadinessHandler(t)
+	redis.Close()
+
+	rec := serve(h.Ready, http.MethodGet, "/api/ready", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, se esperaba 503", rec.Code)
+	}
+	var resp readyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("respuesta inválida: %v", err)
+	}
+	if strings.Join(resp.Failing, ",") != "redis" {
+		t.Errorf("failing = %v, se esperaba redis", resp.Failing)
+	}
+	if resp.Checks["redis"]["status"] != "error" || resp.Checks["redis"]["error"] == nil {
+		t.Errorf("check redis = %v, se esperaba error con detalle", resp.Checks["redis"])
+	}
+	if resp.Checks["cache_dir"]["status"] != "ok" {
+		t.Errorf("check cache_dir = %v, se esperaba ok", resp.Checks["cache_dir"])
+	}
+}
+
+func TestReadyCacheDirMissing(t *testing.T) {
+	h, _, dir := newReadinessHandler(t)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("error borrando el cache: %v", err)
+	}
+
+	rec := serve(h.Ready, http.MethodGet, "/api/ready", "")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"failing":["cache_dir"]`) {
+		t.Errorf("status = %d, se esperaba 503 con cache_dir fallando: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLiveIgnoresDependencies(t *testing.T) {
+	// /api/live solo indica que el proceso responde
+	var resp healthResponse
+	decodeJSON(t, serve(NewHealthHandler().Health, http.MethodGet, "/api/live", ""), &resp)
+	if resp.Status != "ok" {
+		t.Errorf("status = %q, se esperaba ok", resp.Status)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"visor-datos-abiertos-go/internal/dataset"
+)
+
+// htmlTableTemplate es la tabla de una agregación lista para incrustar en un
+// reporte. html/template escapa títulos, encabezados y celdas.
+var htmlTableTemplate = template.Must(template.New("table").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; font-size: 14px; }
+caption { font-weight: bold; padding: 8px 0; text-align: left; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+th { background: #f2f2f2; text-align: left; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+tbody tr:nth-child(even) { background: #fafafa; }
+</style>
+</head>
+<body>
+<table>
+<caption>{{.Title}}</caption>
+<thead><tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td{{if .Numeric}} class="num"{{end}}>{{.Text}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// htmlCell es una celda ya formateada; las numéricas se alinean a la derecha
+type htmlCell struct {
+	Text    string
+	Numeric bool
+}
+
+// getAggregatedHTML responde la agregación como tabla HTML. Los parámetros
+// van en el query string (GET) o en el body como en /api/aggregated/ (POST).
+func (h *APIHandler) getAggregatedHTML(w http.ResponseWriter, r *http.Request, uuid string) {
+	var params dataset.AggregationParams
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if params, err = aggregationParamsFromQuery(r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "datos inválidos", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	params.Limit = h.datasetManager.ClampLimit(params.Limit, defaultDataLimit)
+
+	rows, err := h.datasetManager.QueryAggregatedRows(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error obteniendo agregación en HTML: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var table [][]htmlCell
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		row := make([]htmlCell, len(values))
+		for i, val := range values {
+			row[i] = htmlCellValue(val)
+		}
+		table = append(table, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterando filas: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	title := uuid
+	if resource, err := h.getResource(r.Context(), uuid); err == nil && resource.Name != "" {
+		title = resource.Name
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := htmlTableTemplate.Execute(w, map[string]interface{}{
+		"Title":   title,
+		"Columns": columns,
+		"Rows":    table,
+	}); err != nil {
+		log.Printf("Error generando tabla HTML: %v", err)
+	}
+}
+
+// aggregationParamsFromQuery lee una agregación del query string:
+// group_by (separado por comas), agg, var_agg, order_by, order_dir,
+// order_nulls, limit, date_format y filters (JSON)
+func aggregationParamsFromQuery(query url.Values) (dataset.AggregationParams, error) {
+	params := dataset.AggregationParams{
+		Agg:        query.Get("agg"),
+		VarAgg:     query.Get("var_agg"),
+		OrderBy:    query.Get("order_by"),
+		OrderDir:   query.Get("order_dir"),
+		OrderNulls: query.Get("order_nulls"),
+		DateFormat: query.Get("date_format"),
+	}
+	for _, col := range strings.Split(query.Get("group_by"), ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			params.GroupBy = append(params.GroupBy, col)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if _, err := fmt.Sscanf(limit, "%d", &params.Limit); err != nil {
+			return params, fmt.Errorf("limit debe ser un entero")
+		}
+	}
+	if filters := query.Get("filters"); filters != "" {
+		if err := json.Unmarshal([]byte(filters), &params.Filters); err != nil {
+			return params, fmt.Errorf("filters debe ser un objeto JSON")
+		}
+	}
+	return params, nil
+}
+
+// htmlCellValue formatea un valor para la tabla: números con separador de
+// miles (y dos decimales si no son enteros), fechas como en la exportación
+func htmlCellValue(val interface{}) htmlCell {
+	switch v := xlsxValue(val).(type) {
+	case int64:
+		return htmlCell{Text: groupThousands(strconv.FormatInt(v, 10)), Numeric: true}
+	case int32:
+		return htmlCell{Text: groupThousands(strconv.FormatInt(int64(v), 10)), Numeric: true}
+	case float64:
+		return htmlCell{Text: formatHTMLFloat(v), Numeric: true}
+	case float32:
+		return htmlCell{Text: formatHTMLFloat(float64(v)), Numeric: true}
+	default:
+		return htmlCell{Text: formatExportValue(v)}
+	}
+}
+
+// formatHTMLFloat formatea un número sin decimales si es entero
+func formatHTMLFloat(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return groupThousands(strconv.FormatFloat(v, 'f', 0, 64))
+	}
+	return groupThousands(strconv.FormatFloat(v, 'f', 2, 64))
+}
+
+// groupThousands agrega comas de miles a un número ya formateado (1234567.5 -> 1,234,567.5)
+func groupThousands(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if hasFrac {
+		b.WriteByte('.')
+		b.WriteString(frac)
+	}
+	return sign + b.String()
+}
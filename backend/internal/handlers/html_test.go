@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/dataset"
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestGroupThousands(t *testing.T) {
+	tests := map[string]string{
+		"0":          "0",
+		"999":        "999",
+		"1000":       "1,000",
+		"1234567.5":  "1,234,567.5",
+		"-1234567":   "-1,234,567",
+		"-100":       "-100",
+		"100000.25":  "100,000.25",
+		"12345678.9": "12,345,678.9",
+	}
+	for in, want := range tests {
+		if got := groupThousands(in); got != want {
+			t.Errorf("groupThousands(%q) = %q, se esperaba %q", in, got, want)
+		}
+	}
+}
+
+func TestHTMLCellValue(t *testing.T) {
+	tests := []struct {
+		val     interface{}
+		text    string
+		numeric bool
+	}{
+		{int64(1234567), "1,234,567", true},
+		{int32(-2500), "-2,500", true},
+		{float64(1500), "1,500", true},
+		{float64(1234.567), "1,234.57", true},
+		{"Norte", "Norte", false},
+		{nil, "", false},
+	}
+	for _, tt := range tests {
+		got := htmlCellValue(tt.val)
+		if got.Text != tt.text || got.Numeric != tt.numeric {
+			t.Errorf("htmlCellValue(%v) = %+v, se esperaba %q (numérico %v)", tt.val, got, tt.text, tt.numeric)
+		}
+	}
+}
+
+func TestAggregatedHTML(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Name: `Ventas <b>2024</b>`, Format: "CSV"})
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+	writeDataset(t, h, "ventas",
+		`CREATE TABLE data (region VARCHAR, monto INTEGER)`,
+		`INSERT INTO data VALUES ('Norte', 1500000), ('Norte', 2500), ('<script>alert(1)</script>', 7)`,
+	)
+
+	query := url.Values{"group_by": {"region"}, "agg": {"sum"}, "var_agg": {"monto"}, "order_by": {"region"}}
+	rec := serve(h.GetAggregatedData, http.MethodGet, "/api/aggregated/ventas/html?"+query.Encode(), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, se esperaba text/html", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<th>region</th>",
+		"<td>Norte</td>",
+		`<td class="num">1,502,500</td>`,
+		`<td class="num">7</td>`,
+		// Celdas y título escapados
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"<title>Ventas &lt;b&gt;2024&lt;/b&gt;</title>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("el HTML no contiene %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "<script>") || strings.Contains(body, "<b>") {
+		t.Errorf("el HTML contiene etiquetas sin escapar:\n%s", body)
+	}
+}
+
+func TestAggregatedHTMLPost(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas",
+		`CREATE TABLE data (region VARCHAR, monto INTEGER)`,
+		`INSERT INTO data VALUES ('Norte', 10), ('Sur', 20)`,
+	)
+
+	rec := serve(h.GetAggregatedData, http.MethodPost, "/api/aggregated/ventas/html",
+		`{"GroupBy": ["region"], "Agg": "count", "Filters": {"region": "Sur"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	// Sin nombre en CKAN el título es el uuid
+	if !strings.Contains(body, "<title>ventas</title>") || !strings.Contains(body, "<td>Sur</td>") || strings.Contains(body, "Norte") {
+		t.Errorf("HTML inesperado:\n%s", body)
+	}
+}
+
+func TestAggregatedHTMLValidation(t *testing.T) {
+	h := newTestHandler(t, noCKAN, dataset.Options{})
+	writeDataset(t, h, "ventas",
+		`CREATE TABLE data (region VARCHAR, monto INTEGER)`,
+		`INSERT INTO data VALUES ('Norte', 10)`,
+	)
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodGet, "/api/aggregated/ventas/html?group_by=region&agg=count&limit=diez", http.StatusBadRequest},
+		{http.MethodGet, "/api/aggregated/ventas/html?group_by=region&agg=count&filters=no-json", http.StatusBadRequest},
+		{http.MethodGet, "/api/aggregated/ventas/html?group_by=provincia&agg=count", http.StatusBadRequest},
+		{http.MethodPut, "/api/aggregated/ventas/html", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if rec := serve(h.GetAggregatedData, tt.method, tt.target, ""); rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d, se esperaba %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
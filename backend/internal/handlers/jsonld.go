@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"visor-datos-abiertos-go/internal/ckan"
+	"visor-datos-abiertos-go/internal/dataset"
+)
+
+// GetDatasetJSONLD responde la metadata de un dataset como schema.org/Dataset
+// en JSON-LD (GET /api/dataset/<uuid>/jsonld), combinando el recurso de CKAN
+// con el esquema real de la tabla
+func (h *APIHandler) GetDatasetJSONLD(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/dataset/"), "/jsonld")
+	if !ok || uuid == "" || strings.Contains(uuid, "/") {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := "jsonld:" + uuid
+
+	// writeCached respondería application/json
+	if cached, found := h.cacheManager.GetFromRedis(cacheKey); found {
+		w.Header().Set("Content-Type", "application/ld+json")
+		w.Header().Set("X-Cache", "HIT")
+		w.Write(cached)
+		return
+	}
+
+	resource, err := h.getResource(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error obteniendo recurso de CKAN: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	schema, err := h.datasetManager.GetSchema(r.Context(), uuid)
+	if err != nil {
+		log.Printf("Error obteniendo esquema: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(datasetJSONLD(uuid, resource, schema))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Metadata)
+
+	w.Header().Set("Content-Type", "application/ld+json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
+
+// datasetJSONLD arma el documento schema.org/Dataset. Cada columna es un
+// PropertyValue de variableMeasured con su tipo DuckDB y rol inferido
+func datasetJSONLD(uuid string, resource *ckan.Resource, schema []dataset.ColumnSchema) map[string]interface{} {
+	name := resource.Name
+	if name == "" {
+		name = uuid
+	}
+
+	variables := make([]map[string]interface{}, len(schema))
+	for i, col := range schema {
+		variables[i] = map[string]interface{}{
+			"@type":       "PropertyValue",
+			"name":        col.Name,
+			"description": fmt.Sprintf("%s (%s)", col.Type, col.Role),
+		}
+	}
+
+	distribution := map[string]interface{}{
+		"@type":          "DataDownload",
+		"contentUrl":     resource.URL,
+		"encodingFormat": encodingFormat(resource.Format),
+	}
+	if resource.Size > 0 {
+		distribution["contentSize"] = fmt.Sprintf("%d B", resource.Size)
+	}
+
+	doc := map[string]interface{}{
+		"@context":            "https://schema.org",
+		"@type":               "Dataset",
+		"identifier":          uuid,
+		"name":                name,
+		"url":                 resource.URL,
+		"isAccessibleForFree": true,
+		"distribution":        []map[string]interface{}{distribution},
+		"variableMeasured":    variables,
+	}
+	if resource.Description != "" {
+		doc["description"] = resource.Description
+	}
+	if resource.Created != "" {
+		doc["dateCreated"] = resource.Created
+	}
+	if resource.LastModified != "" {
+		doc["dateModified"] = resource.LastModified
+	}
+	return doc
+}
+
+// encodingFormat convierte el formato de CKAN (p.ej. "CSV") en tipo MIME
+func encodingFormat(format string) string {
+	switch strings.ToUpper(format) {
+	case "CSV":
+		return "text/csv"
+	case "JSON":
+		return "application/json"
+	case "XLSX":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return format
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/ckan"
+	"visor-datos-abiertos-go/internal/dataset"
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+func TestDatasetJSONLD(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	ckan.SetResource("ventas", testutil.CKANResource{Name: "Ventas 2024", Format: "CSV", LastModified: "2024-05-01T10:00:00"})
+	h, redis := newTestHandlerWithRedis(t, ckan.URL(), dataset.Options{})
+	writeDataset(t, h, "ventas",
+		`CREATE TABLE data (region VARCHAR, monto INTEGER)`,
+		`INSERT INTO data VALUES ('Norte', 10), ('Sur', 20)`,
+	)
+
+	rec := serve(h.GetDatasetJSONLD, http.MethodGet, "/api/dataset/ventas/jsonld", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/ld+json" {
+		t.Errorf("Content-Type = %q, se esperaba application/ld+json", ct)
+	}
+
+	var doc struct {
+		Context      string `json:"@context"`
+		Type         string `json:"@type"`
+		Identifier   string `json:"identifier"`
+		Name         string `json:"name"`
+		URL          string `json:"url"`
+		DateModified string `json:"dateModified"`
+		Distribution []struct {
+			Type           string `json:"@type"`
+			ContentURL     string `json:"contentUrl"`
+			EncodingFormat string `json:"encodingFormat"`
+		} `json:"distribution"`
+		VariableMeasured []struct {
+			Type        string `json:"@type"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		} `json:"variableMeasured"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("JSON-LD inválido: %v", err)
+	}
+	if doc.Context != "https://schema.org" || doc.Type != "Dataset" || doc.Identifier != "ventas" || doc.Name != "Ventas 2024" {
+		t.Errorf("documento = %+v, se esperaba un schema.org/Dataset de ventas", doc)
+	}
+	if !strings.HasSuffix(doc.URL, "/files/ventas") || doc.DateModified != "2024-05-01T10:00:00" {
+		t.Errorf("url = %q, dateModified = %q", doc.URL, doc.DateModified)
+	}
+	if len(doc.Distribution) != 1 || doc.Distribution[0].Type != "DataDownload" || doc.Distribution[0].EncodingFormat != "text/csv" || doc.Distribution[0].ContentURL != doc.URL {
+		t.Errorf("distribution = %+v, se esperaba una descarga CSV", doc.Distribution)
+	}
+	if len(doc.VariableMeasured) != 2 {
+		t.Fatalf("variableMeasured = %+v, se esperaban las 2 columnas", doc.VariableMeasured)
+	}
+	region := doc.VariableMeasured[0]
+	if region.Type != "PropertyValue" || region.Name != "region" || !strings.HasPrefix(region.Description, "VARCHAR") {
+		t.Errorf("variable = %+v, se esperaba region VARCHAR", region)
+	}
+	if monto := doc.VariableMeasured[1]; monto.Name != "monto" || !strings.HasPrefix(monto.Description, "INTEGER") {
+		t.Errorf("variable = %+v, se esperaba monto INTEGER", monto)
+	}
+
+	// La segunda consulta sale del cache
+	if _, found := redis.Get("jsonld:ventas"); !found {
+		t.Error("el documento no se guardó en Redis")
+	}
+	rec = serve(h.GetDatasetJSONLD, http.MethodGet, "/api/dataset/ventas/jsonld", "")
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("Content-Type") != "application/ld+json" {
+		t.Errorf("X-Cache = %q, Content-Type = %q; se esperaba HIT con JSON-LD", rec.Header().Get("X-Cache"), rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestDatasetJSONLDOptionalFields(t *testing.T) {
+	resource := &ckan.Resource{URL: "https://datos.example/ventas.xlsx", Format: "xlsx", Description: "Ventas por región", Created: "2024-01-01", Size: 2048}
+	doc := datasetJSONLD("ventas", resource, nil)
+
+	// Sin nombre en CKAN se usa el uuid
+	if doc["name"] != "ventas" || doc["description"] != "Ventas por región" || doc["dateCreated"] != "2024-01-01" {
+		t.Errorf("documento = %v", doc)
+	}
+	if _, ok := doc["dateModified"]; ok {
+		t.Error("dateModified vacío no debería incluirse")
+	}
+	distribution := doc["distribution"].([]map[string]interface{})[0]
+	if distribution["contentSize"] != "2048 B" || !strings.Contains(distribution["encodingFormat"].(string), "spreadsheetml") {
+		t.Errorf("distribution = %v", distribution)
+	}
+}
+
+func TestDatasetJSONLDErrors(t *testing.T) {
+	ckan := testutil.NewCKAN(t)
+	h := newTestHandler(t, ckan.URL(), dataset.Options{})
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodGet, "/api/dataset//jsonld", http.StatusBadRequest},
+		{http.MethodGet, "/api/dataset/ventas", http.StatusBadRequest},
+		{http.MethodGet, "/api/dataset/a/b/jsonld", http.StatusBadRequest},
+		{http.MethodPost, "/api/dataset/ventas/jsonld", http.StatusMethodNotAllowed},
+		// Recurso que no existe en CKAN
+		{http.MethodGet, "/api/dataset/no-existe/jsonld", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if rec := serve(h.GetDatasetJSONLD, tt.method, tt.target, ""); rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d, se esperaba %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Schedules lista, consulta, crea o elimina re-descargas programadas.
+//
+//	GET    /api/schedules/        lista todas
+//	GET    /api/schedules/<uuid>  consulta una
+//	PUT    /api/schedules/<uuid>  {"interval": "24h"} crea o reemplaza
+//	DELETE /api/schedules/<uuid>  elimina
+func (h *APIHandler) Schedules(w http.ResponseWriter, r *http.Request) {
+	scheduler := h.datasetManager.GetScheduler()
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/schedules/")
+
+	if uuid == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scheduler.List())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schedule, ok := scheduler.Get(uuid)
+		if !ok {
+			http.Error(w, "No hay re-descarga programada para este dataset", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Interval string `json:"interval"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "datos inválidos", http.StatusBadRequest)
+			return
+		}
+
+		schedule, err := scheduler.Set(uuid, body.Interval)
+		if err != nil {
+			log.Printf("Error programando re-descarga: %v", err)
+			writeDatasetError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+
+	case http.MethodDelete:
+		if !scheduler.Remove(uuid) {
+			http.Error(w, "No hay re-descarga programada para este dataset", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	}
+}
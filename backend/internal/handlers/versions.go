@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"visor-datos-abiertos-go/internal/dataset"
+)
+
+// ListVersions lista la copia vigente y las versiones archivadas de un dataset
+func (h *APIHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/versions/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uuid":     uuid,
+		"versions": h.datasetManager.ListVersions(uuid),
+	})
+}
+
+// GetVersionDiff compara dos versiones de un dataset por una columna clave
+func (h *APIHandler) GetVersionDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/api/version-diff/")
+	if uuid == "" {
+		http.Error(w, "UUID requerido", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var params dataset.VersionDiffParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "datos inválidos", http.StatusBadRequest)
+		return
+	}
+
+	// Cache Key (se invalida con el dataset al re-descargarlo)
+	cacheKey := h.cacheManager.GenerateKey("vdiff", map[string]interface{}{
+		"uuid":   uuid,
+		"params": params,
+	})
+
+	// Verificar cache
+	if h.writeCached(w, r, cacheKey) {
+		return
+	}
+
+	data, err := h.datasetManager.GetVersionDiff(r.Context(), uuid, params)
+	if err != nil {
+		log.Printf("Error comparando versiones: %v", err)
+		writeDatasetError(w, err)
+		return
+	}
+
+	// Serializar y cachear
+	jsonData, _ := json.Marshal(data)
+	h.cacheManager.SetToRedis(cacheKey, jsonData, h.ttls.Agg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(jsonData)
+}
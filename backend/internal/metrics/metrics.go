@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Métricas Prometheus expuestas en /metrics
+
+var (
+	// HTTPRequests cuenta peticiones por ruta registrada (no la URL completa,
+	// para no crear una serie por UUID), método y status
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "visor_http_requests_total",
+		Help: "Peticiones HTTP atendidas por ruta, método y status.",
+	}, []string{"path", "method", "status"})
+
+	// HTTPRequestDuration mide la duración de las peticiones por ruta
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "visor_http_request_duration_seconds",
+		Help:    "Duración de las peticiones HTTP por ruta.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"path"})
+
+	// CacheRequests cuenta consultas al cache por nivel (l1, redis, memory, disk) y resultado
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "visor_cache_requests_total",
+		Help: "Consultas al cache por nivel y resultado (hit/miss).",
+	}, []string{"layer", "result"})
+
+	// ActiveDownloads es el número de descargas de CKAN en curso
+	ActiveDownloads = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "visor_active_downloads",
+		Help: "Descargas de datasets en curso.",
+	})
+
+	// DownloadDuration mide descarga + conversión a DuckDB por resultado
+	DownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "visor_download_duration_seconds",
+		Help:    "Duración de la descarga y conversión de datasets por resultado.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800},
+	}, []string{"result"})
+)
+
+// CacheResult registra un hit o miss en un nivel del cache
+func CacheResult(layer string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(layer, result).Inc()
+}
@@ -1,10 +1,84 @@
 package server
 
+import "time"
+
 type Config struct {
 	Port          string
 	CKANBaseURL   string
 	RedisURL      string
+	AdminAPIKey   string // header X-API-Key de los endpoints de administración; vacío los deshabilita
 	CacheDir      string
 	MemoryCacheGB int64
 	DiskCacheGB   int64
+	// Datasets que se mantienen abiertos en memoria (ajustable en caliente)
+	MemoryCacheDatasets int
+	// Datasets fijados en memoria: no se desalojan al reducir la capacidad
+	PinnedDatasets []string
+
+	// Descargas simultáneas desde CKAN
+	MaxConcurrentDownloads int
+	// Intentos por petición a la API de CKAN
+	CKANMaxAttempts int
+	// API key de CKAN (no se loguea)
+	CKANAPIKey string
+
+	// Dataset precargado para el health check profundo (opcional)
+	HealthCheckUUID string
+
+	// Máximo de condiciones en los filtros de una consulta
+	MaxFilterConditions int
+	// Profundidad máxima de un filtro (2: columna -> lista de valores)
+	MaxFilterDepth int
+	// Máximo de filas que un cliente puede pedir con limit
+	MaxResultLimit int
+	// Máximo de filas que una consulta carga en memoria; al pasarlo se
+	// responde truncated o, con TruncateResults en false, un error
+	MaxResultRows   int
+	TruncateResults bool
+
+	// Versiones anteriores que se conservan por dataset
+	MaxDatasetVersions int
+
+	// Orígenes permitidos para CORS ("*" permite cualquiera, solo para desarrollo)
+	AllowedOrigins []string
+
+	// Directorio del frontend en disco (modo dev); vacío usa el frontend embebido
+	FrontendDir string
+
+	// Límite de peticiones por IP (token bucket); 0 lo desactiva
+	RateLimitRPS   float64
+	RateLimitBurst int
+	// Usar el último valor de X-Forwarded-For como IP del cliente (solo detrás
+	// de un proxy que lo agregue)
+	TrustProxy bool
+
+	// Tiempo máximo por petición (excepto streaming); 0 lo desactiva.
+	// Incluye la descarga síncrona de un dataset que aún no está en cache.
+	RequestTimeout time.Duration
+
+	// memory_limit de DuckDB de cada dataset abierto (p.ej. "2GB"). Cada dataset
+	// es una base DuckDB aparte, así que el total puede llegar a
+	// MemoryCacheDatasets × este límite
+	DuckDBMemoryLimitPerDataset string
+	// threads de DuckDB de cada dataset abierto; 0 usa todos los núcleos. Igual
+	// que la memoria, se suman entre los MemoryCacheDatasets abiertos
+	DuckDBThreadsPerDataset int
+
+	// Tamaño máximo del CSV a descargar de CKAN; 0 no limita
+	MaxDownloadBytes int64
+
+	// Filtros de igualdad de texto sin distinguir mayúsculas ("cdmx" = "CDMX")
+	CaseInsensitiveFilters bool
+
+	// TTL en Redis por tipo de respuesta. CacheTTLFilters en 0 usa el TTL
+	// según el tamaño del dataset
+	CacheTTLFilters  time.Duration
+	CacheTTLMetadata time.Duration
+	CacheTTLData     time.Duration
+	CacheTTLAgg      time.Duration
+	CacheTTLSearch   time.Duration
+	CacheTTLPreview  time.Duration
+
+	// Datasets que se descargan al arrancar para tenerlos en cache
+	PreloadUUIDs []string
 }
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"compress/gzip"
+	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"strings"
 )
@@ -18,7 +21,7 @@ func CacheControl(maxAge int) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			if maxAge > 0 {
-				w.Header().Set("Cache-Control", "public max-age="+string(rune(maxAge)))
+				w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
 			} else {
 				w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 			}
@@ -27,9 +30,16 @@ func CacheControl(maxAge int) func(http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// APIKeyAuth exige la API key en el header X-API-Key (o en ?api_key=). Sin una
+// key configurada las rutas quedan cerradas: responden 403 a cualquiera
 func APIKeyAuth(validKey string) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
+			if validKey == "" {
+				http.Error(w, "API key de administración no configurada", http.StatusForbidden)
+				return
+			}
+
 			apiKey := r.Header.Get("X-API-Key")
 
 			if apiKey == "" {
@@ -37,7 +47,8 @@ func APIKeyAuth(validKey string) func(http.HandlerFunc) http.HandlerFunc {
 				apiKey = r.URL.Query().Get("api_key")
 			}
 
-			if validKey != "" && apiKey != validKey {
+			// Comparación en tiempo constante, para no filtrar la key por tiempos
+			if subtle.ConstantTimeCompare([]byte(apiKey), []byte(validKey)) != 1 {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
@@ -46,16 +57,88 @@ func APIKeyAuth(validKey string) func(http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// WriteAPIKeyAuth es APIKeyAuth solo para los métodos que modifican estado:
+// las consultas GET y HEAD no requieren la API key
+func WriteAPIKeyAuth(validKey string) func(http.HandlerFunc) http.HandlerFunc {
+	auth := APIKeyAuth(validKey)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		protected := auth(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next(w, r)
+				return
+			}
+			protected(w, r)
+		}
+	}
+}
+
+// Compression comprime con gzip las respuestas si el cliente lo acepta. Si el
+// handler ya fijó Content-Encoding (p.ej. una respuesta que viene comprimida
+// de Redis) el cuerpo se pasa tal cual, sin recomprimir
 func Compression(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Verificar si el cliente acepta gzip
-
 		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 			next(w, r)
 			return
 		}
 
-		// TODO: Implementar gzip writer !!
-		next(w, r)
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next(gw, r)
+	}
+}
+
+// gzipResponseWriter decide si comprimir al escribir los headers, cuando el
+// handler ya fijó los suyos
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.Header()
+	// Sin cuerpo o ya codificada: pasar tal cual
+	if code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	return g.gz.Write(b)
+}
+
+// Flush envía lo comprimido hasta ahora
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close termina el stream gzip, si se comprimió
+func (g *gzipResponseWriter) Close() error {
+	if g.gz == nil {
+		return nil
 	}
+	return g.gz.Close()
 }
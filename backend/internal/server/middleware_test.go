@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"visor-datos-abiertos-go/internal/cache"
+)
+
+// okHandler responde 200 y marca que se llamó
+func okHandler(called *bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	s := newTestServer(t, &Config{AllowedOrigins: []string{"https://visor.example.gob"}})
+
+	var called bool
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Origin", "https://visor.example.gob")
+	rec := httptest.NewRecorder()
+	s.corsMiddleware(okHandler(&called))(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://visor.example.gob" {
+		t.Errorf("Access-Control-Allow-Origin = %q, se esperaba el origen de la petición", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, se esperaba Origin", got)
+	}
+	if !called {
+		t.Error("el handler no se llamó")
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	s := newTestServer(t, &Config{AllowedOrigins: []string{"https://visor.example.gob"}})
+
+	var called bool
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Origin", "https://otro.example.com")
+	rec := httptest.NewRecorder()
+	s.corsMiddleware(okHandler(&called))(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, no se esperaba header para un origen no permitido", got)
+	}
+	// La petición se atiende; es el navegador quien bloquea la respuesta
+	if !called {
+		t.Error("el handler no se llamó")
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	s := newTestServer(t, &Config{AllowedOrigins: []string{"*"}})
+
+	var called bool
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	rec := httptest.NewRecorder()
+	s.corsMiddleware(okHandler(&called))(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:5173" {
+		t.Errorf("Access-Control-Allow-Origin = %q, se esperaba el origen de la petición", got)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s := newTestServer(t, &Config{AllowedOrigins: []string{"https://visor.example.gob"}})
+
+	var called bool
+	req := httptest.NewRequest(http.MethodOptions, "/api/data/ventas", nil)
+	req.Header.Set("Origin", "https://visor.example.gob")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	s.corsMiddleware(okHandler(&called))(rec, req)
+
+	if rec.Code != http.StatusOK || called {
+		t.Errorf("status = %d, handler llamado = %v; el preflight se responde sin llegar al handler", rec.Code, called)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, PUT, DELETE, OPTIONS" {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got == "" {
+		t.Error("falta Access-Control-Allow-Headers en el preflight")
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		maxAge int
+		want   string
+	}{
+		{0, "no-cache, no-store, must-revalidate"},
+		{-1, "no-cache, no-store, must-revalidate"},
+		{60, "public, max-age=60"},
+		{3600, "public, max-age=3600"},
+		{86400, "public, max-age=86400"},
+	}
+	for _, tt := range tests {
+		var called bool
+		rec := httptest.NewRecorder()
+		CacheControl(tt.maxAge)(okHandler(&called))(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := rec.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("CacheControl(%d) = %q, se esperaba %q", tt.maxAge, got, tt.want)
+		}
+		if !called {
+			t.Errorf("CacheControl(%d) no llamó al handler", tt.maxAge)
+		}
+	}
+}
+
+func TestCompressionGzipsPlainResponses(t *testing.T) {
+	body := strings.Repeat("datos ", 100)
+	handler := Compression(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/filters/x", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, se esperaba gzip", rec.Header().Get("Content-Encoding"))
+	}
+	data, err := cache.Decompress(rec.Body.Bytes())
+	if err != nil || string(data) != body {
+		t.Errorf("cuerpo descomprimido = %q, %v; se esperaba el original", data, err)
+	}
+
+	// Sin Accept-Encoding no se comprime
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/filters/x", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+		t.Errorf("Content-Encoding = %q, se esperaba la respuesta sin comprimir", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressionPassesThroughEncodedResponses(t *testing.T) {
+	// Una respuesta que viene comprimida de Redis
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"total": 1}`))
+	gz.Close()
+	precompressed := buf.Bytes()
+
+	handler := Compression(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(precompressed)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/filters/x", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if !bytes.Equal(rec.Body.Bytes(), precompressed) {
+		t.Error("el cuerpo ya comprimido se recomprimió")
+	}
+	if got := rec.Header().Values("Vary"); len(got) != 0 {
+		t.Errorf("Vary = %v, el middleware no debe tocar los headers de una respuesta ya codificada", got)
+	}
+}
+
+func TestCompressionSkipsNotModified(t *testing.T) {
+	handler := Compression(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/filters/x", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusNotModified || rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+		t.Errorf("status %d, Content-Encoding %q, %d bytes; se esperaba 304 sin cuerpo", rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.Len())
+	}
+}
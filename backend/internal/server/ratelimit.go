@@ -0,0 +1,139 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tiempo sin peticiones tras el cual se olvida el bucket de una IP
+const rateLimitIdleTTL = 10 * time.Minute
+
+// rateLimiter limita peticiones por IP con un token bucket
+type rateLimiter struct {
+	rate    float64 // tokens por segundo
+	burst   float64
+	buckets map[string]*tokenBucket
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	rl := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+
+	// Limpiar buckets inactivos
+	go func() {
+		ticker := time.NewTicker(rateLimitIdleTTL)
+		defer ticker.Stop()
+		for range ticker.C {
+			rl.cleanup()
+		}
+	}()
+
+	return rl
+}
+
+// allow consume un token de la IP. Si no hay, retorna cuánto esperar.
+func (rl *rateLimiter) allow(ip string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	bucket, ok := rl.buckets[ip]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[ip] = bucket
+	}
+
+	// Recargar tokens según el tiempo transcurrido
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+elapsed*rl.rate)
+	bucket.lastSeen = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := (1 - bucket.tokens) / rl.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (rl *rateLimiter) cleanup() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cutoff := rl.now().Add(-rateLimitIdleTTL)
+	for ip, bucket := range rl.buckets {
+		if bucket.lastSeen.Before(cutoff) {
+			delete(rl.buckets, ip)
+		}
+	}
+}
+
+// isHealthCheck indica si la ruta es de health check (liveness o readiness)
+func isHealthCheck(path string) bool {
+	return strings.HasPrefix(path, "/api/health") || path == "/api/ready" || path == "/api/live"
+}
+
+// Rate Limit Middleware
+func (s *Server) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Sin límite configurado, o health checks (los usan balanceadores y monitoreo)
+		if s.rateLimiter == nil || isHealthCheck(r.URL.Path) {
+			next(w, r)
+			return
+		}
+
+		ok, wait := s.rateLimiter.allow(s.clientIP(r))
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "Demasiadas peticiones, intente más tarde", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// clientIP obtiene la IP del cliente. X-Forwarded-For solo se usa si el servidor
+// está detrás de un proxy de confianza, si no cualquiera podría falsearlo.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.config.TrustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			// El último valor lo agrega el proxy con la IP que le abrió la
+			// conexión; los anteriores vienen del cliente y pueden ser falsos
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			ip := strings.TrimSpace(hops[len(hops)-1])
+			if ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
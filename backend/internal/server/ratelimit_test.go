@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newLimitedServer crea un servidor con límite de 1 petición/s, ráfaga de 3 y
+// un reloj controlado por la prueba
+func newLimitedServer(t *testing.T, trustProxy bool) (*Server, *time.Time) {
+	t.Helper()
+	s := newTestServer(t, &Config{RateLimitRPS: 1, RateLimitBurst: 3, TrustProxy: trustProxy})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.rateLimiter.now = func() time.Time { return now }
+	return s, &now
+}
+
+// limitedRequest pasa una petición por el middleware y retorna la respuesta
+func limitedRequest(s *Server, path, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	var called bool
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	s.rateLimitMiddleware(okHandler(&called))(rec, req)
+	return rec
+}
+
+func TestRateLimitBurstAndRecovery(t *testing.T) {
+	s, now := newLimitedServer(t, false)
+
+	for i := 0; i < 3; i++ {
+		if rec := limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", ""); rec.Code != http.StatusOK {
+			t.Fatalf("petición %d: status %d, se esperaba 200 dentro de la ráfaga", i+1, rec.Code)
+		}
+	}
+
+	rec := limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, se esperaba 429 al superar la ráfaga", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, se esperaba 1", got)
+	}
+
+	// Otra IP tiene su propio bucket
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.2:5000", ""); rec.Code != http.StatusOK {
+		t.Errorf("otra IP: status %d, se esperaba 200", rec.Code)
+	}
+
+	// Tras un segundo se recarga un token
+	*now = now.Add(time.Second)
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", ""); rec.Code != http.StatusOK {
+		t.Errorf("tras la ventana: status %d, se esperaba 200", rec.Code)
+	}
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d, se esperaba 429 con el bucket vacío otra vez", rec.Code)
+	}
+}
+
+func TestRateLimitSkipsHealthChecks(t *testing.T) {
+	s, _ := newLimitedServer(t, false)
+
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/api/health", "/api/health/deep", "/api/ready", "/api/live"} {
+			if rec := limitedRequest(s, path, "10.0.0.1:5000", ""); rec.Code != http.StatusOK {
+				t.Fatalf("%s: status %d, los health checks no se limitan", path, rec.Code)
+			}
+		}
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	// Detrás de un proxy todas las peticiones llegan desde la IP del proxy
+	s, _ := newLimitedServer(t, true)
+	for i := 0; i < 3; i++ {
+		limitedRequest(s, "/api/filters/x", "10.0.0.100:5000", "203.0.113.1")
+	}
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.100:5000", "203.0.113.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d, se esperaba 429 para el cliente original", rec.Code)
+	}
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.100:5000", "203.0.113.2"); rec.Code != http.StatusOK {
+		t.Errorf("status %d, otro cliente tras el proxy no debe compartir el límite", rec.Code)
+	}
+
+	// Sin TrustProxy el header se ignora para que no se pueda falsear
+	s, _ = newLimitedServer(t, false)
+	for i := 0; i < 3; i++ {
+		limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", "203.0.113.1")
+	}
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", "203.0.113.99"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d, se esperaba 429 aunque cambie X-Forwarded-For", rec.Code)
+	}
+}
+
+func TestRateLimitIgnoresClientForwardedFor(t *testing.T) {
+	// El cliente manda su propio X-Forwarded-For y el proxy le agrega la IP
+	// real al final; cambiar el valor falso no evita el límite
+	s, _ := newLimitedServer(t, true)
+	for i := 0; i < 3; i++ {
+		forwarded := fmt.Sprintf("198.51.100.%d, 203.0.113.1", i)
+		if rec := limitedRequest(s, "/api/filters/x", "10.0.0.100:5000", forwarded); rec.Code != http.StatusOK {
+			t.Fatalf("petición %d: status %d, se esperaba 200 dentro de la ráfaga", i+1, rec.Code)
+		}
+	}
+	if rec := limitedRequest(s, "/api/filters/x", "10.0.0.100:5000", "198.51.100.99, 203.0.113.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d, se esperaba 429 aunque el cliente cambie su X-Forwarded-For", rec.Code)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	s := newTestServer(t, &Config{})
+	for i := 0; i < 20; i++ {
+		if rec := limitedRequest(s, "/api/filters/x", "10.0.0.1:5000", ""); rec.Code != http.StatusOK {
+			t.Fatalf("status %d, sin RateLimitRPS no se limita", rec.Code)
+		}
+	}
+}
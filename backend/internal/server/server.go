@@ -4,10 +4,15 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 	"visor-datos-abiertos-go/internal/cache"
 	"visor-datos-abiertos-go/internal/dataset"
 	"visor-datos-abiertos-go/internal/handlers"
+	"visor-datos-abiertos-go/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Server struct {
@@ -15,6 +20,7 @@ type Server struct {
 	datasetManager *dataset.Manager
 	cacheManager   *cache.Manager
 	mux            *http.ServeMux
+	rateLimiter    *rateLimiter
 }
 
 func New(config *Config, dm *dataset.Manager, cm *cache.Manager) *Server {
@@ -25,6 +31,11 @@ func New(config *Config, dm *dataset.Manager, cm *cache.Manager) *Server {
 		mux:            http.NewServeMux(),
 	}
 
+	// Límite de peticiones por IP
+	if config.RateLimitRPS > 0 {
+		s.rateLimiter = newRateLimiter(config.RateLimitRPS, config.RateLimitBurst)
+	}
+
 	// registrar rutas(endpoints)
 	s.registerRoutes()
 
@@ -32,23 +43,97 @@ func New(config *Config, dm *dataset.Manager, cm *cache.Manager) *Server {
 }
 
 func (s *Server) registerRoutes() {
-	// Health check
-	s.mux.HandleFunc("/api/health", s.withMiddleware(handlers.NewHealthHandler().Health))
+	// Health check: /api/live indica que el proceso responde y /api/ready (y
+	// /api/health) que sus dependencias están disponibles
+	readiness := handlers.NewReadinessHandler(s.datasetManager, s.cacheManager)
+	s.mux.HandleFunc("/api/health", s.withMiddleware(readiness.Ready))
+	s.mux.HandleFunc("/api/ready", s.withMiddleware(readiness.Ready))
+	s.mux.HandleFunc("/api/live", s.withMiddleware(handlers.NewHealthHandler().Health))
+	s.mux.HandleFunc("/api/health/deep", s.withMiddleware(handlers.NewDeepHealthHandler(s.datasetManager, s.cacheManager, s.config.HealthCheckUUID).Health))
+
+	// Métricas Prometheus
+	s.mux.Handle("/metrics", promhttp.Handler())
 
 	// API handlers
 	apiHandler := handlers.NewAPIHandler(s.datasetManager, s.cacheManager)
+	apiHandler.SetCacheTTLs(handlers.CacheTTLs{
+		Filters:  s.config.CacheTTLFilters,
+		Metadata: s.config.CacheTTLMetadata,
+		Data:     s.config.CacheTTLData,
+		Agg:      s.config.CacheTTLAgg,
+		Search:   s.config.CacheTTLSearch,
+		Preview:  s.config.CacheTTLPreview,
+	})
 
 	s.mux.HandleFunc("/api/filters/", s.withMiddleware(apiHandler.GetFilters))
 	s.mux.HandleFunc("/api/data/", s.withMiddleware(apiHandler.GetFilteredData))
 	s.mux.HandleFunc("/api/aggregated/", s.withMiddleware(apiHandler.GetAggregatedData))
 	s.mux.HandleFunc("/api/metadata/", s.withMiddleware(apiHandler.GetMetadata))
+	s.mux.HandleFunc("/api/metadata/batch", s.withMiddleware(apiHandler.GetMetadataBatch))
 	s.mux.HandleFunc("/api/stats/", s.withMiddleware(apiHandler.GetStats))
 	s.mux.HandleFunc("/api/top/", s.withMiddleware(apiHandler.GetTopValues))
+	s.mux.HandleFunc("/api/top-n/", s.withMiddleware(apiHandler.GetTopN))
+	s.mux.HandleFunc("/api/column/", s.withMiddleware(apiHandler.GetColumnSummary))
 	s.mux.HandleFunc("/api/status/", s.withMiddleware(apiHandler.GetDownloadStatus))
+	s.mux.HandleFunc("/api/export/", s.withStreamingMiddleware(apiHandler.ExportData))
+	s.mux.HandleFunc("/api/export-agg/", s.withStreamingMiddleware(apiHandler.ExportAggregated))
+	s.mux.HandleFunc("/api/export-custom/", s.withStreamingMiddleware(apiHandler.ExportCustom))
+	s.mux.HandleFunc("/api/narrative/", s.withMiddleware(apiHandler.GetNarrative))
+	s.mux.HandleFunc("/api/partition-suggestion/", s.withMiddleware(apiHandler.GetPartitionSuggestion))
+	s.mux.HandleFunc("/api/search/", s.withMiddleware(apiHandler.SearchData))
+	s.mux.HandleFunc("/api/geo-aggregate/", s.withMiddleware(apiHandler.GetGeoAggregate))
+	s.mux.HandleFunc("/api/text-length-dist/", s.withMiddleware(apiHandler.GetTextLengthDistribution))
+	s.mux.HandleFunc("/api/schema/", s.withMiddleware(apiHandler.GetSchema))
+	s.mux.HandleFunc("/api/width-profile/", s.withMiddleware(apiHandler.GetWidthProfile))
+	s.mux.HandleFunc("/api/domain-check/", s.withMiddleware(apiHandler.CheckDomain))
+	s.mux.HandleFunc("/api/package/", s.withMiddleware(apiHandler.GetPackage))
+	s.mux.HandleFunc("/api/datasets/search", s.withMiddleware(apiHandler.SearchDatasets))
+	s.mux.HandleFunc("/api/anomalies/", s.withMiddleware(apiHandler.GetAnomalies))
+	s.mux.HandleFunc("/api/number-format/", s.withMiddleware(apiHandler.GetNumberFormat))
+	s.mux.HandleFunc("/api/status-stream/", s.withStreamingMiddleware(apiHandler.StreamDownloadStatus))
+	s.mux.HandleFunc("/api/scatter/", s.withMiddleware(apiHandler.GetScatterSample))
+	s.mux.HandleFunc("/api/stratified-sample/", s.withMiddleware(apiHandler.GetStratifiedSample))
+	s.mux.HandleFunc("/api/versions/", s.withMiddleware(apiHandler.ListVersions))
+	s.mux.HandleFunc("/api/version-diff/", s.withMiddleware(apiHandler.GetVersionDiff))
+	s.mux.HandleFunc("/api/candidate-keys/", s.withMiddleware(apiHandler.GetCandidateKeys))
+	s.mux.HandleFunc("/api/nulls/", s.withMiddleware(apiHandler.GetNullCounts))
+	s.mux.HandleFunc("/api/crosstab/", s.withMiddleware(apiHandler.GetCrossTab))
+	s.mux.HandleFunc("/api/row-count/", s.withMiddleware(apiHandler.GetRowCountCheck))
+	s.mux.HandleFunc("/api/histogram/", s.withMiddleware(apiHandler.GetHistogram))
+	s.mux.HandleFunc("/api/timeseries/", s.withMiddleware(apiHandler.GetTimeSeries))
+	s.mux.HandleFunc("/api/range-buckets/", s.withMiddleware(apiHandler.GetRangeBuckets))
+	s.mux.HandleFunc("/api/preview/", s.withMiddleware(apiHandler.GetPreview))
+	s.mux.HandleFunc("/api/nested-aggregate/", s.withMiddleware(apiHandler.GetNestedAggregation))
+	s.mux.HandleFunc("/api/preview-clean/", s.withMiddleware(apiHandler.PreviewClean))
+	s.mux.HandleFunc("/api/coverage/", s.withMiddleware(apiHandler.GetCoverage))
+	s.mux.HandleFunc("/api/dataset/", s.withMiddleware(apiHandler.GetDatasetJSONLD))
+
+	// Administración, protegidos con la API key de admin
+	adminOnly := APIKeyAuth(s.config.AdminAPIKey)
+	s.mux.HandleFunc("/api/preload", s.withMiddleware(adminOnly(apiHandler.Preload)))
+	s.mux.HandleFunc("/api/cache/redis", s.withMiddleware(adminOnly(apiHandler.RedisKeys)))
+	s.mux.HandleFunc("/api/cache/stats", s.withMiddleware(adminOnly(apiHandler.CacheStats)))
+	s.mux.HandleFunc("/api/reindex/", s.withMiddleware(adminOnly(apiHandler.Reindex)))
+	s.mux.HandleFunc("/api/cache/", s.withMiddleware(adminOnly(apiHandler.InvalidateCache)))
+	s.mux.HandleFunc("/api/admin/cache-capacity", s.withMiddleware(adminOnly(apiHandler.CacheCapacity)))
+	s.mux.HandleFunc("/api/admin/config", s.withMiddleware(adminOnly(s.handleAdminConfig)))
+
+	// Las programaciones y el preámbulo de CSV se pueden consultar sin API
+	// key; cambiarlos no
+	writeAdminOnly := WriteAPIKeyAuth(s.config.AdminAPIKey)
+	s.mux.HandleFunc("/api/schedules/", s.withMiddleware(writeAdminOnly(apiHandler.Schedules)))
+	s.mux.HandleFunc("/api/csv-skip/", s.withMiddleware(writeAdminOnly(apiHandler.CSVSkip)))
 }
 
 func (s *Server) MountFrontend(frontendFS fs.FS) {
-	s.mux.Handle("/", s.spaHandler(frontendFS))
+	s.mux.Handle("/", s.spaHandler(http.FS(frontendFS)))
+}
+
+// MountFrontendDir sirve el frontend desde un directorio del disco (modo dev),
+// para ver cambios sin recompilar el binario
+func (s *Server) MountFrontendDir(dir string) {
+	log.Printf("🛠️  Modo dev: sirviendo frontend desde %s", dir)
+	s.mux.Handle("/", s.spaHandler(http.Dir(dir)))
 }
 
 func (s *Server) Router() http.Handler {
@@ -56,9 +141,17 @@ func (s *Server) Router() http.Handler {
 }
 
 func (s *Server) withMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.withStreamingMiddleware(s.timeoutMiddleware(Compression(next)))
+}
+
+// withStreamingMiddleware es withMiddleware sin el timeout por petición, para
+// respuestas que se envían por partes (SSE, exportaciones)
+func (s *Server) withStreamingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return s.recoverMiddleware(
 		s.loggingMiddleware(
-			s.corsMiddleware(next),
+			s.corsMiddleware(
+				s.rateLimitMiddleware(next),
+			),
 		),
 	)
 }
@@ -75,18 +168,28 @@ func (s *Server) loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		duration := time.Since(start)
 		log.Printf("%s %s %d %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+
+		// Métricas por ruta registrada, no por URL, para no crear una serie por UUID
+		_, pattern := s.mux.Handler(r)
+		metrics.HTTPRequests.WithLabelValues(pattern, r.Method, strconv.Itoa(wrapped.statusCode)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(pattern).Observe(duration.Seconds())
 	}
 }
 
 // Cors Middleware
 func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// NOTE: Revisar lista de origenes permitidos
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONs")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		// La respuesta depende del Origin, los proxies no deben compartirla entre orígenes
+		w.Header().Add("Vary", "Origin")
 
-		if r.Method == "OPTIONS" {
+		// Solo se devuelve el Origin si está en la lista de permitidos
+		if origin := r.Header.Get("Origin"); origin != "" && s.originAllowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+		}
+
+		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -94,6 +197,16 @@ func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// originAllowed indica si el origen está en AllowedOrigins ("*" permite cualquiera)
+func (s *Server) originAllowed(origin string) bool {
+	for _, allowed := range s.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) recoverMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -106,20 +219,21 @@ func (s *Server) recoverMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func (s *Server) spaHandler(fsys fs.FS) http.Handler {
+func (s *Server) spaHandler(fsys http.FileSystem) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		// Si es la raíz servir el index.html
 		if path == "/" {
-			path = "index.html"
+			path = "/index.html"
 		}
 
-		// Intentar abrir el archivo
-		file, err := fsys.Open(path)
+		// Intentar abrir el archivo; si no existe o es un directorio,
+		// servir el index.html (SPA routing)
+		file, stat, err := openFile(fsys, path)
 		if err != nil {
-			// Si no existe, servir el index.html (SPA routing)
-			file, err = fsys.Open("index.html")
+			path = "/index.html"
+			file, stat, err = openFile(fsys, path)
 			if err != nil {
 				http.NotFound(w, r)
 				return
@@ -127,16 +241,24 @@ func (s *Server) spaHandler(fsys fs.FS) http.Handler {
 		}
 		defer file.Close()
 
-		// Obtener la info del archivo
-		stat, err := file.Stat()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		http.ServeContent(w, r, path, stat.ModTime(), file.(http.File))
+		http.ServeContent(w, r, path, stat.ModTime(), file)
 	})
 }
 
+// openFile abre un archivo regular del frontend
+func openFile(fsys http.FileSystem, path string) (http.File, fs.FileInfo, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		file.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	return file, stat, nil
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -146,3 +268,15 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap expone el writer original a http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush permite hacer streaming a través del wrapper
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"visor-datos-abiertos-go/internal/cache"
+	"visor-datos-abiertos-go/internal/dataset"
+	"visor-datos-abiertos-go/internal/testutil"
+)
+
+// newTestServer crea un Server con Redis en memoria, cache en un directorio
+// temporal y un CKAN inexistente
+func newTestServer(t *testing.T, config *Config) *Server {
+	t.Helper()
+	redis := testutil.NewRedis(t)
+	cm, err := cache.NewManager(redis.URL(), 1<<30, 10, 1<<30, t.TempDir())
+	if err != nil {
+		t.Fatalf("error creando cache: %v", err)
+	}
+	dm := dataset.NewManager("http://127.0.0.1:1", cm, dataset.Options{CKANMaxAttempts: testutil.NoRetryAttempts})
+	t.Cleanup(func() {
+		dm.GetDownloadManager().Shutdown(context.Background())
+		dm.Close()
+		cm.Close()
+	})
+	return New(config, dm, cm)
+}
+
+func TestAdminRoutesRequireKey(t *testing.T) {
+	s := newTestServer(t, &Config{AdminAPIKey: "secreto"})
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/reindex/abc"},
+		{http.MethodDelete, "/api/cache/abc"},
+		{http.MethodPut, "/api/admin/cache-capacity"},
+		{http.MethodGet, "/api/admin/config"},
+		{http.MethodPut, "/api/schedules/abc"},
+		{http.MethodDelete, "/api/schedules/abc"},
+		{http.MethodPut, "/api/csv-skip/abc"},
+		{http.MethodPost, "/api/csv-skip/abc"},
+		{http.MethodDelete, "/api/csv-skip/abc"},
+		{http.MethodGet, "/api/cache/redis"},
+		{http.MethodDelete, "/api/cache/redis?prefix=data:"},
+		{http.MethodGet, "/api/cache/stats"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("sin API key: status = %d, se esperaba 401", rec.Code)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-API-Key", "otra")
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("con API key incorrecta: status = %d, se esperaba 401", rec.Code)
+			}
+
+			req = httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-API-Key", "secreto")
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code == http.StatusUnauthorized {
+				t.Errorf("con API key: status = 401")
+			}
+		})
+	}
+}
+
+func TestAdminRoutesClosedWithoutConfiguredKey(t *testing.T) {
+	s := newTestServer(t, &Config{})
+
+	for _, path := range []string{"/api/reindex/abc", "/api/cache/abc", "/api/admin/cache-capacity"} {
+		for _, key := range []string{"", "cualquiera"} {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			if key != "" {
+				req.Header.Set("X-API-Key", key)
+			}
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("%s con key %q: status = %d, se esperaba 403", path, key, rec.Code)
+			}
+		}
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/api/schedules/abc", nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE /api/schedules/abc: status = %d, se esperaba 403", rec.Code)
+	}
+}
+
+func TestSchedulesReadableWithoutKey(t *testing.T) {
+	s := newTestServer(t, &Config{AdminAPIKey: "secreto"})
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/schedules/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET sin API key: status = %d, se esperaba 200", rec.Code)
+	}
+
+	// Sin preámbulo configurado responde 404, pero no pide API key
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/csv-skip/abc", nil))
+	if rec.Code == http.StatusUnauthorized {
+		t.Errorf("GET /api/csv-skip sin API key: status = 401")
+	}
+}
+
+func TestRedactedConfigPerDatasetLimits(t *testing.T) {
+	config := (&Config{DuckDBMemoryLimitPerDataset: "2GB", DuckDBThreadsPerDataset: 4}).redacted()
+
+	if config["duckdb_memory_limit_per_dataset"] != "2GB" || config["duckdb_threads_per_dataset"] != 4 {
+		t.Errorf("config = %v, faltan los límites por dataset", config)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := newTestServer(t, &Config{})
+
+	// Una petición HTTP, una consulta al cache y una descarga fallida
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	s.cacheManager.GetFromRedis("filters:no-existe")
+	dm := s.datasetManager.GetDownloadManager()
+	dm.StartDownload("no-existe")
+	if _, finished := dm.Wait(context.Background(), "no-existe", 10*time.Second); !finished {
+		t.Fatal("la descarga no terminó")
+	}
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, se esperaba 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`visor_http_requests_total{method="GET",path="/api/health",status="200"}`,
+		`visor_http_request_duration_seconds_bucket{path="/api/health"`,
+		`visor_cache_requests_total{layer="redis",result="miss"}`,
+		`visor_cache_requests_total{layer="l1",result="miss"}`,
+		"visor_active_downloads 0",
+		`visor_download_duration_seconds_count{result="failed"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics no contiene %s", want)
+		}
+	}
+}
+
+// get sirve una petición GET por el mux del servidor
+func get(s *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestMountFrontendDirServesFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>visor</h1>"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0644)
+	os.Mkdir(filepath.Join(dir, "assets"), 0755)
+
+	s := newTestServer(t, &Config{FrontendDir: dir})
+	s.MountFrontendDir(dir)
+
+	if rec := get(s, "/app.js"); rec.Body.String() != "console.log(1)" {
+		t.Errorf("/app.js = %q, se esperaba el archivo del disco", rec.Body.String())
+	}
+
+	// Los cambios en disco se ven sin reiniciar
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(2)"), 0644)
+	if rec := get(s, "/app.js"); rec.Body.String() != "console.log(2)" {
+		t.Errorf("/app.js = %q, se esperaba la versión modificada", rec.Body.String())
+	}
+
+	// Rutas del SPA y directorios responden el index.html
+	for _, path := range []string{"/", "/datasets/abc", "/assets"} {
+		if rec := get(s, path); rec.Code != http.StatusOK || rec.Body.String() != "<h1>visor</h1>" {
+			t.Errorf("%s: status %d, cuerpo %q; se esperaba el index.html", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestMountFrontendEmbedded(t *testing.T) {
+	s := newTestServer(t, &Config{})
+	s.MountFrontend(fstest.MapFS{
+		"index.html": {Data: []byte("<h1>embebido</h1>")},
+		"app.js":     {Data: []byte("console.log(0)")},
+	})
+
+	if rec := get(s, "/app.js"); rec.Body.String() != "console.log(0)" {
+		t.Errorf("/app.js = %q, se esperaba el archivo embebido", rec.Body.String())
+	}
+	if rec := get(s, "/datasets/abc"); rec.Body.String() != "<h1>embebido</h1>" {
+		t.Errorf("ruta del SPA = %q, se esperaba el index.html", rec.Body.String())
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Timeout Middleware: la petición se cancela al vencer RequestTimeout, lo que
+// interrumpe las consultas DuckDB hechas con QueryContext
+func (s *Server) timeoutMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if s.config.RequestTimeout <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), s.config.RequestTimeout)
+		defer cancel()
+
+		tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+		next(tw, r.WithContext(ctx))
+
+		// El handler terminó por el timeout sin responder
+		if !tw.wroteHeader && timedOut(ctx) {
+			http.Error(w, "Tiempo de espera agotado", http.StatusGatewayTimeout)
+		}
+	}
+}
+
+// timeoutWriter reporta como 504 los errores 5xx que ocurren porque la
+// petición excedió su tiempo (p.ej. una consulta interrumpida)
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	if code >= http.StatusInternalServerError && timedOut(tw.ctx) {
+		code = http.StatusGatewayTimeout
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap expone el writer original a http.ResponseController
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// Flush permite hacer streaming a través del wrapper
+func (tw *timeoutWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowHandler espera a que se cancele la petición, como una consulta lenta
+// hecha con QueryContext
+func slowHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	s := newTestServer(t, &Config{RequestTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	s.timeoutMiddleware(slowHandler)(rec, httptest.NewRequest(http.MethodGet, "/api/aggregate/x", nil))
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, se esperaba 504", rec.Code)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("respondió en %v, se esperaba al vencer el timeout de 50ms", elapsed)
+	}
+}
+
+func TestTimeoutMiddlewareConvertsCancelledQueryError(t *testing.T) {
+	s := newTestServer(t, &Config{RequestTimeout: 20 * time.Millisecond})
+
+	// El handler reporta 500 porque la consulta se interrumpió
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		http.Error(w, "error ejecutando query", http.StatusInternalServerError)
+	}
+	rec := httptest.NewRecorder()
+	s.timeoutMiddleware(handler)(rec, httptest.NewRequest(http.MethodGet, "/api/aggregate/x", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, se esperaba 504 en lugar del 500 del handler", rec.Code)
+	}
+}
+
+func TestTimeoutMiddlewareFastRequest(t *testing.T) {
+	s := newTestServer(t, &Config{RequestTimeout: time.Second})
+
+	var called bool
+	rec := httptest.NewRecorder()
+	s.timeoutMiddleware(okHandler(&called))(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+
+	if rec.Code != http.StatusOK || !called {
+		t.Errorf("status %d, se esperaba 200 sin tocar el timeout", rec.Code)
+	}
+}
+
+func TestStreamingMiddlewareHasNoTimeout(t *testing.T) {
+	s := newTestServer(t, &Config{RequestTimeout: 20 * time.Millisecond})
+
+	// Las rutas SSE y de exportación no deben tener deadline
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("la petición de streaming tiene deadline")
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}
+	rec := httptest.NewRecorder()
+	s.withStreamingMiddleware(handler)(rec, httptest.NewRequest(http.MethodGet, "/api/status-stream/x", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, se esperaba 200", rec.Code)
+	}
+}
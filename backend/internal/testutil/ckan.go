@@ -0,0 +1,162 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NoRetryAttempts es el máximo de intentos contra CKAN en las pruebas: sin
+// reintentos, para no esperar el backoff contra un CKAN que no responde
+const NoRetryAttempts = 1
+
+// CKAN es un CKAN mínimo para pruebas. Responde resource_show con los
+// recursos registrados y sirve sus archivos en /files/<id>, contando las
+// llamadas y descargas para que las pruebas verifiquen cuándo se descargó.
+type CKAN struct {
+	server    *httptest.Server
+	mu        sync.Mutex
+	resources map[string]CKANResource
+	calls     map[string]int
+	downloads map[string]int
+}
+
+// CKANResource es un recurso registrado en el CKAN de prueba
+type CKANResource struct {
+	Name         string
+	Format       string
+	LastModified string
+	// ContentType del archivo; vacío responde text/csv
+	ContentType string
+	Body        []byte
+	// Headers agrega headers a la respuesta del archivo. Con ETag, una
+	// petición con el mismo If-None-Match recibe 304
+	Headers map[string]string
+	// Hold, si no es nil, deja la descarga abierta después de enviar Body
+	// hasta que se cierre o el cliente corte, para simular descargas lentas
+	Hold chan struct{}
+}
+
+// NewCKAN inicia un CKAN de prueba que se cierra al terminar la prueba
+func NewCKAN(t testing.TB) *CKAN {
+	t.Helper()
+	c := &CKAN{
+		resources: make(map[string]CKANResource),
+		calls:     make(map[string]int),
+		downloads: make(map[string]int),
+	}
+	c.server = httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+// URL retorna la base de la API de acciones, la que recibe ckan.NewClient
+func (c *CKAN) URL() string {
+	return c.server.URL + "/api/3/action"
+}
+
+// SetResource registra (o reemplaza) un recurso
+func (c *CKAN) SetResource(id string, res CKANResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resources[id] = res
+}
+
+// Calls retorna cuántas veces se llamó una acción (p.ej. "resource_show")
+func (c *CKAN) Calls(action string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[action]
+}
+
+// Downloads retorna cuántas veces se descargó el archivo de un recurso
+func (c *CKAN) Downloads(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.downloads[id]
+}
+
+func (c *CKAN) serve(w http.ResponseWriter, r *http.Request) {
+	if id, ok := strings.CutPrefix(r.URL.Path, "/files/"); ok {
+		c.serveFile(w, r, id)
+		return
+	}
+
+	action, ok := strings.CutPrefix(r.URL.Path, "/api/3/action/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.mu.Lock()
+	c.calls[action]++
+	id := r.URL.Query().Get("id")
+	res, found := c.resources[id]
+	c.mu.Unlock()
+
+	if action != "resource_show" || !found {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"result": map[string]interface{}{
+			"id":            id,
+			"name":          res.Name,
+			"url":           c.server.URL + "/files/" + id,
+			"format":        res.Format,
+			"last_modified": res.LastModified,
+			"size":          len(res.Body),
+		},
+	})
+}
+
+func (c *CKAN) serveFile(w http.ResponseWriter, r *http.Request, id string) {
+	c.mu.Lock()
+	res, found := c.resources[id]
+	if found {
+		c.downloads[id]++
+	}
+	c.mu.Unlock()
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	contentType := res.ContentType
+	if contentType == "" {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	for key, value := range res.Headers {
+		w.Header().Set(key, value)
+	}
+	// Con el mismo ETag la descarga condicional responde 304 sin cuerpo
+	if etag := res.Headers["ETag"]; etag != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// Las peticiones con Range reciben solo ese tramo (206)
+	if r.Header.Get("Range") != "" && res.Hold == nil {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(res.Body))
+		return
+	}
+	w.Write(res.Body)
+
+	if res.Hold != nil {
+		w.(http.Flusher).Flush()
+		select {
+		case <-res.Hold:
+		case <-r.Context().Done():
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package testutil
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/duckdb/duckdb-go/v2"
+)
+
+// WriteDataset crea dir/<uuid>.duckdb ejecutando las sentencias dadas (que deben
+// crear la tabla data) y retorna su ruta
+func WriteDataset(t testing.TB, dir, uuid string, statements ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, uuid+".duckdb")
+	conn, err := sql.Open("duckdb", path)
+	if err != nil {
+		t.Fatalf("error creando DuckDB de prueba: %v", err)
+	}
+	defer conn.Close()
+
+	for _, stmt := range statements {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("error preparando dataset %s: %v\n%s", uuid, err, stmt)
+		}
+	}
+	if _, err := conn.Exec("CHECKPOINT"); err != nil {
+		t.Fatalf("error en checkpoint de %s: %v", uuid, err)
+	}
+	return path
+}
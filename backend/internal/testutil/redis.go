@@ -0,0 +1,69 @@
+// Package testutil reúne utilidades compartidas por las pruebas: un Redis en
+// memoria (miniredis), un CKAN de prueba y la creación de datasets DuckDB.
+package testutil
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// Redis es un Redis en memoria para pruebas sobre miniredis, que además
+// cuenta los comandos recibidos
+type Redis struct {
+	*miniredis.Miniredis
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// NewRedis inicia un Redis en memoria que se cierra al terminar la prueba
+func NewRedis(t testing.TB) *Redis {
+	t.Helper()
+	mr := miniredis.NewMiniRedis()
+	if err := mr.Start(); err != nil {
+		t.Fatalf("error iniciando Redis de prueba: %v", err)
+	}
+	r := &Redis{Miniredis: mr, calls: make(map[string]int)}
+	mr.Server().SetPreHook(func(_ *server.Peer, cmd string, _ ...string) bool {
+		r.mu.Lock()
+		r.calls[cmd]++
+		r.mu.Unlock()
+		return false
+	})
+	t.Cleanup(mr.Close)
+	return r
+}
+
+// URL retorna la URL de conexión (redis://host:port/0)
+func (r *Redis) URL() string {
+	return "redis://" + r.Addr() + "/0"
+}
+
+// Get retorna el valor guardado en key
+func (r *Redis) Get(key string) (string, bool) {
+	value, err := r.Miniredis.Get(key)
+	return value, err == nil
+}
+
+// Set guarda un valor sin expiración
+func (r *Redis) Set(key, value string) {
+	r.Miniredis.Set(key, value)
+}
+
+// TTL retorna el tiempo de vida de key; 0 si no expira o no existe. miniredis
+// no descuenta el tiempo transcurrido: las keys expiran solo con FastForward
+func (r *Redis) TTL(key string) time.Duration {
+	return r.Miniredis.TTL(key)
+}
+
+// Calls retorna cuántas veces se recibió un comando (p.ej. "GET")
+func (r *Redis) Calls(command string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[strings.ToUpper(command)]
+}